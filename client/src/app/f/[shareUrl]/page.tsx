@@ -1,7 +1,7 @@
 /* eslint-disable @typescript-eslint/no-explicit-any */
 'use client';
 
-import { useState, useEffect } from 'react';
+import { useState, useEffect, useRef } from 'react';
 import { useParams } from 'next/navigation';
 import axios from 'axios';
 
@@ -30,6 +30,8 @@ export default function PublicFormPage() {
   const [isSubmitting, setIsSubmitting] = useState(false);
   const [isSubmitted, setIsSubmitted] = useState(false);
   const [error, setError] = useState<string | null>(null);
+  const sessionId = useRef<string | null>(null);
+  const lastFieldId = useRef<string | null>(null);
   const apiBaseUrl = process.env.NEXT_PUBLIC_API_URL;
 
   useEffect(() => {
@@ -43,6 +45,7 @@ export default function PublicFormPage() {
       setIsLoading(true);
       const response = await axios.get(`${apiBaseUrl}/public/forms/${params.shareUrl}`);
       setForm(response.data);
+      recordView();
     } catch (error) {
       console.error('Error fetching form:', error);
       setError('Form not found or no longer available');
@@ -52,11 +55,31 @@ export default function PublicFormPage() {
   };
   
 
+  // Funnel tracking is best effort and never blocks the respondent
+  const recordView = async () => {
+    try {
+      const response = await axios.post(`${apiBaseUrl}/public/forms/${params.shareUrl}/views`);
+      sessionId.current = response.data.session_id;
+    } catch (error) {
+      console.error('Error recording view:', error);
+    }
+  };
+
+  const recordProgress = (fieldId: string) => {
+    if (!sessionId.current || lastFieldId.current === fieldId) return;
+    lastFieldId.current = fieldId;
+    axios.post(`${apiBaseUrl}/public/forms/${params.shareUrl}/starts`, {
+      session_id: sessionId.current,
+      field_id: fieldId
+    }).catch((error) => console.error('Error recording progress:', error));
+  };
+
   const handleInputChange = (fieldId: string, value: any) => {
     setResponses(prev => ({
       ...prev,
       [fieldId]: value
     }));
+    recordProgress(fieldId);
   };
 
   const handleSubmit = async (e: React.FormEvent) => {
@@ -78,13 +101,31 @@ export default function PublicFormPage() {
       setIsSubmitting(true);
       setError(null);
   
+      // Answers as the form's schema expects them: numbers as numbers, and
+      // fields left empty out
+      const answers: Record<string, any> = {};
+      form.fields.forEach(field => {
+        const value = responses[field.id];
+        if (value === undefined || value === '' || (Array.isArray(value) && value.length === 0)) return;
+        answers[field.id] = field.type === 'number' ? Number(value) : value;
+      });
+
       await axios.post(`${apiBaseUrl}/public/forms/${params.shareUrl}/responses`, {
-        responses: responses
+        responses: answers,
+        session_id: sessionId.current || undefined
       });
   
       setIsSubmitted(true);
     } catch (error) {
-      setError('Failed to submit form. Please try again.');
+      const problems: { path: string; message: string }[] | undefined =
+        axios.isAxiosError(error) ? error.response?.data?.problems : undefined;
+      if (problems?.length) {
+        // Paths look like /responses/<field id>/...
+        const labelOf = (path: string) => form.fields.find(field => field.id === path.split('/')[2])?.label ?? path;
+        setError(problems.map(problem => `${labelOf(problem.path)} ${problem.message}`).join('; '));
+      } else {
+        setError('Failed to submit form. Please try again.');
+      }
     } finally {
       setIsSubmitting(false);
     }
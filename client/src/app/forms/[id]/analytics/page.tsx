@@ -6,6 +6,7 @@ import { useParams, useRouter } from 'next/navigation';
 import AuthenticatedLayout from '../../../../components/AuthenticatedLayout';
 import { useSocket } from '../../../../hooks/useSocket';
 import api from '@/services/api';
+import { RealtimeTopic } from '@/types/realtime-protocol';
 
 interface FieldAnalytics {
   field_id: string;
@@ -15,14 +16,139 @@ interface FieldAnalytics {
   data: any;
 }
 
+interface FormFunnel {
+  views: number;
+  starts: number;
+  submissions: number;
+  conversion_rate: number;
+  median_completion_seconds: number | null;
+  abandoned: number;
+  abandoned_at: { field_id: string; field_label: string; count: number }[];
+}
+
+interface ClientBreakdown {
+  devices: Record<string, number>;
+  browsers: Record<string, number>;
+  operating_systems: Record<string, number>;
+  countries: Record<string, number>;
+}
+
+interface ClientInfo {
+  browser: string;
+  os: string;
+  device: string;
+  country?: string;
+}
+
 interface FormAnalytics {
   form_id: string;
   form_title: string;
   total_responses: number;
   field_analytics: FieldAnalytics[];
+  funnel?: FormFunnel;
+  clients?: ClientBreakdown;
   created_at: string;
 }
 
+interface FieldDelta {
+  field_id: string;
+  answered: boolean;
+  counted: boolean;
+  value?: number;
+  length?: number;
+  options?: string[];
+  text?: {
+    language: string;
+    terms?: string[];
+    sentiment: number;
+    sentiment_label?: 'positive' | 'neutral' | 'negative'; // Missing when the language is not scored
+  };
+}
+
+interface AnalyticsDelta {
+  form_id: string;
+  response_id: string;
+  submitted_at: string;
+  client?: ClientInfo;
+  fields: FieldDelta[];
+}
+
+function increment(counts: Record<string, number>, key?: string): Record<string, number> {
+  return key ? { ...counts, [key]: (counts[key] || 0) + 1 } : counts;
+}
+
+// Applies the delta of a single new response to the analytics already on screen
+function applyAnalyticsDelta(analytics: FormAnalytics, delta: AnalyticsDelta): FormAnalytics {
+  const deltas = new Map(delta.fields.map((field) => [field.field_id, field]));
+
+  return {
+    ...analytics,
+    total_responses: analytics.total_responses + 1,
+    clients: analytics.clients && delta.client ? {
+      devices: increment(analytics.clients.devices, delta.client.device),
+      browsers: increment(analytics.clients.browsers, delta.client.browser),
+      operating_systems: increment(analytics.clients.operating_systems, delta.client.os),
+      countries: increment(analytics.clients.countries, delta.client.country),
+    } : analytics.clients,
+    field_analytics: analytics.field_analytics.map((field) => {
+      const fieldDelta = deltas.get(field.field_id);
+      if (!fieldDelta) {
+        return field;
+      }
+
+      const data = { ...field.data };
+      const count = data.response_count || 0;
+      const nextCount = fieldDelta.counted ? count + 1 : count;
+
+      if (fieldDelta.options && fieldDelta.options.length > 0) {
+        const distribution = { ...(data.distribution || {}) };
+        fieldDelta.options.forEach((option) => {
+          distribution[option] = (distribution[option] || 0) + 1;
+        });
+        data.distribution = distribution;
+      }
+
+      if (fieldDelta.counted) {
+        if (fieldDelta.length !== undefined && data.average_length !== undefined) {
+          data.average_length = (data.average_length * count + fieldDelta.length) / nextCount;
+        }
+        if (fieldDelta.value !== undefined && field.field_type === 'number') {
+          data.average = (data.average * count + fieldDelta.value) / nextCount;
+          data.min = count === 0 ? fieldDelta.value : Math.min(data.min, fieldDelta.value);
+          data.max = count === 0 ? fieldDelta.value : Math.max(data.max, fieldDelta.value);
+        }
+        if (fieldDelta.value !== undefined && field.field_type === 'rating') {
+          data.average_rating = (data.average_rating * count + fieldDelta.value) / nextCount;
+        }
+        if (fieldDelta.text) {
+          const label = fieldDelta.text.sentiment_label;
+          if (label && data.sentiment) {
+            const analyzed = data.sentiment.analyzed_count || 0;
+            data.sentiment = {
+              ...data.sentiment,
+              average: (data.sentiment.average * analyzed + fieldDelta.text.sentiment) / (analyzed + 1),
+              analyzed_count: analyzed + 1,
+              [label]: (data.sentiment[label] || 0) + 1,
+            };
+          }
+          // Term counts only update for terms already in the top list; the next fetch reorders them
+          const terms = new Set(fieldDelta.text.terms || []);
+          data.top_terms = (data.top_terms || []).map((term: { term: string; count: number }) =>
+            terms.has(term.term) ? { ...term, count: term.count + 1 } : term
+          );
+        }
+      }
+      data.response_count = nextCount;
+
+      return {
+        ...field,
+        response_count: fieldDelta.answered ? field.response_count + 1 : field.response_count,
+        data,
+      };
+    }),
+  };
+}
+
 export default function AnalyticsPage() {
   const params = useParams();
   const router = useRouter();
@@ -30,7 +156,6 @@ export default function AnalyticsPage() {
   const [isLoading, setIsLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
   const [lastUpdated, setLastUpdated] = useState<Date>(new Date());
-  const [hasJoinedRoom, setHasJoinedRoom] = useState(false);
   
   // WebSocket connection
   const socket = useSocket('/');
@@ -40,37 +165,37 @@ export default function AnalyticsPage() {
   }, [params.id]);
 
   useEffect(() => {
-    if (socket && params.id && !hasJoinedRoom) {
-      const tryJoinRoom = () => {
-        socket.emit('join-analytics', { form_id: params.id });
-        console.log('📊 Attempting to join analytics room for form:', params.id);
-      };
+    if (!params.id) {
+      return;
+    }
+    const topics: RealtimeTopic[] = [{ name: 'form-analytics', form_id: params.id as string }];
 
-      tryJoinRoom();
-      
-      const retryTimeout = setTimeout(() => {
-        if (!hasJoinedRoom) {
-          console.log('🔄 Retrying join analytics room...');
-          tryJoinRoom();
-          setHasJoinedRoom(true);
-        }
-      }, 1000);
+    socket.on('analytics-delta', (data) => {
+      console.log('📊 Real-time analytics delta:', data);
+      setAnalytics((current) => current ? applyAnalyticsDelta(current, data.delta) : current);
+      setLastUpdated(new Date());
+    });
+
+    // Imports are announced once, with no delta to apply
+    socket.on('responses-imported', () => {
+      fetchAnalytics();
+    });
 
-      socket.on('analytics-update', (data) => {
-        console.log('📊 Real-time analytics update:', data);
-        setAnalytics(data.analytics);
-        setLastUpdated(new Date());
-        setHasJoinedRoom(true); 
+    // Requests wait for the connection to open, so no retry is needed
+    socket.request('subscribe', { topics })
+      .then(() => {
+        console.log('📊 Subscribed to live analytics for form:', params.id);
+      })
+      .catch((error) => {
+        console.error('❌ Live analytics unavailable:', error.code, error.message);
       });
 
-      return () => {
-        clearTimeout(retryTimeout);
-        socket.emit('leave-analytics', { form_id: params.id });
-        socket.off('analytics-update');
-        setHasJoinedRoom(false);
-      };
-    }
-  }, [socket, params.id, hasJoinedRoom]);
+    return () => {
+      socket.emit('unsubscribe', { topics });
+      socket.off('analytics-delta');
+      socket.off('responses-imported');
+    };
+  }, [socket.request, socket.emit, socket.on, socket.off, params.id]);
 
   const fetchAnalytics = async () => {
     try {
@@ -183,9 +308,9 @@ export default function AnalyticsPage() {
               </div>
               <div className="ml-5 w-0 flex-1">
                 <dl>
-                  <dt className="text-sm font-medium text-gray-500 truncate">Completion Rate</dt>
+                  <dt className="text-sm font-medium text-gray-500 truncate">Conversion Rate</dt>
                   <dd className="text-lg font-medium text-black">
-                    {analytics.total_responses > 0 ? '100%' : '0%'}
+                    {analytics.funnel ? `${analytics.funnel.conversion_rate.toFixed(1)}%` : '—'}
                   </dd>
                 </dl>
               </div>
@@ -193,6 +318,70 @@ export default function AnalyticsPage() {
           </div>
         </div>
 
+        {analytics.funnel && analytics.funnel.views > 0 && (
+          <div className="bg-white rounded-lg shadow p-6">
+            <h2 className="text-lg font-medium text-black mb-4">Funnel</h2>
+            <div className="grid grid-cols-2 md:grid-cols-4 gap-4 text-center">
+              <div>
+                <div className="text-lg font-bold text-indigo-600">{analytics.funnel.views}</div>
+                <div className="text-xs text-gray-900">Views</div>
+              </div>
+              <div>
+                <div className="text-lg font-bold text-blue-600">{analytics.funnel.starts}</div>
+                <div className="text-xs text-gray-900">Started</div>
+              </div>
+              <div>
+                <div className="text-lg font-bold text-green-600">{analytics.funnel.submissions}</div>
+                <div className="text-xs text-gray-900">Submitted</div>
+              </div>
+              <div>
+                <div className="text-lg font-bold text-yellow-600">
+                  {analytics.funnel.median_completion_seconds !== null
+                    ? `${Math.round(analytics.funnel.median_completion_seconds)}s`
+                    : '—'}
+                </div>
+                <div className="text-xs text-gray-900">Median Completion Time</div>
+              </div>
+            </div>
+            {analytics.funnel.abandoned_at.length > 0 && (
+              <div className="mt-4 text-sm text-gray-700">
+                <span className="font-medium">Most abandoned after: </span>
+                {analytics.funnel.abandoned_at[0].field_label || 'Before answering any field'} ({analytics.funnel.abandoned_at[0].count})
+              </div>
+            )}
+          </div>
+        )}
+
+        {analytics.clients && analytics.total_responses > 0 && (
+          <div className="bg-white rounded-lg shadow p-6">
+            <h2 className="text-lg font-medium text-black mb-4">Respondents</h2>
+            <div className="grid grid-cols-1 md:grid-cols-3 gap-6">
+              {([
+                ['Devices', analytics.clients.devices],
+                ['Browsers', analytics.clients.browsers],
+                ['Countries', analytics.clients.countries],
+              ] as [string, Record<string, number>][]).map(([title, counts]) => (
+                <div key={title}>
+                  <h3 className="text-sm font-medium text-gray-500 mb-2">{title}</h3>
+                  {Object.keys(counts).length === 0 ? (
+                    <div className="text-sm text-gray-400">No data</div>
+                  ) : (
+                    Object.entries(counts)
+                      .sort(([, a], [, b]) => b - a)
+                      .slice(0, 5)
+                      .map(([name, count]) => (
+                        <div key={name} className="flex justify-between text-sm text-gray-900">
+                          <span>{name}</span>
+                          <span>{count}</span>
+                        </div>
+                      ))
+                  )}
+                </div>
+              ))}
+            </div>
+          </div>
+        )}
+
         <div className="space-y-6">
           <h2 className="text-lg font-medium text-black">Field Analytics</h2>
           
@@ -285,6 +474,34 @@ export default function AnalyticsPage() {
                         <div className="text-xs text-gray-900">Avg. Characters</div>
                       </div>
                     )}
+
+                    {field.data.sentiment && field.data.sentiment.analyzed_count > 0 && (
+                      <div className="mt-4 space-y-3">
+                        <div className="grid grid-cols-3 gap-4 text-center">
+                          <div>
+                            <div className="text-lg font-bold text-green-600">{field.data.sentiment.positive}</div>
+                            <div className="text-xs text-gray-900">Positive</div>
+                          </div>
+                          <div>
+                            <div className="text-lg font-bold text-gray-600">{field.data.sentiment.neutral}</div>
+                            <div className="text-xs text-gray-900">Neutral</div>
+                          </div>
+                          <div>
+                            <div className="text-lg font-bold text-red-600">{field.data.sentiment.negative}</div>
+                            <div className="text-xs text-gray-900">Negative</div>
+                          </div>
+                        </div>
+                        {field.data.top_terms?.length > 0 && (
+                          <div className="flex flex-wrap gap-2">
+                            {field.data.top_terms.slice(0, 15).map((term: { term: string; count: number }) => (
+                              <span key={term.term} className="px-2 py-1 text-xs bg-indigo-50 text-indigo-700 rounded">
+                                {term.term} ({term.count})
+                              </span>
+                            ))}
+                          </div>
+                        )}
+                      </div>
+                    )}
                   </div>
                 </div>
               ))}
@@ -4,7 +4,8 @@ import { useState, useEffect } from 'react';
 import { useRouter, useParams } from 'next/navigation';
 import AuthenticatedLayout from '../../../components/AuthenticatedLayout';
 import FormBuilder, { FormData } from '../../../components/FormBuilder/FormBuilder';
-import { CreateFormRequest, formsAPI } from '../../../services/api';
+import axios from 'axios';
+import { CreateFormRequest, formsAPI, publishErrorMessage } from '../../../services/api';
 
 export default function FormViewPage() {
   const params = useParams();
@@ -13,6 +14,8 @@ export default function FormViewPage() {
   const [isLoading, setIsLoading] = useState(true);
   const [isSaving, setIsSaving] = useState(false);
   const [error, setError] = useState<string | null>(null);
+  const [conflict, setConflict] = useState<string | null>(null);
+  const [publishError, setPublishError] = useState<string | null>(null);
   const [isEditing, setIsEditing] = useState(false);
 
   useEffect(() => {
@@ -37,16 +40,30 @@ export default function FormViewPage() {
     try {
       setIsSaving(true);
       setError(null);
+      setConflict(null);
+      setPublishError(null);
       
-      const payload = {
+      const { revision, ...payload } = {
         ...formData,
         status: isDraft ? 'draft' : 'published'
       };
 
-      await formsAPI.updateForm(params.id as string, payload as CreateFormRequest);
+      await formsAPI.updateForm(params.id as string, payload as CreateFormRequest, revision ?? form?.revision ?? 0);
       setIsEditing(false);
       fetchForm(); // Refresh form data
     } catch (error) {
+      if (axios.isAxiosError(error) && error.response?.status === 409) {
+        // Someone saved first; start over from their version rather than overwrite it
+        setForm(error.response.data.form);
+        setConflict('Someone else changed this form while you were editing. Their version is loaded below, please apply your changes again.');
+        return;
+      }
+      const message = publishErrorMessage(error);
+      if (message) {
+        // Keep the builder open so the problems can be fixed
+        setPublishError(message);
+        return;
+      }
       setError('Failed to save form. Please try again.');
     } finally {
       setIsSaving(false);
@@ -130,11 +147,25 @@ export default function FormViewPage() {
           </div>
         )}
 
+        {conflict && (
+          <div className="mb-4 bg-amber-50 border border-amber-200 rounded-md p-4">
+            <p className="text-sm text-amber-800">{conflict}</p>
+          </div>
+        )}
+
+        {publishError && (
+          <div className="mb-4 bg-red-50 border border-red-200 rounded-md p-4">
+            <p className="text-sm text-red-800">{publishError}</p>
+          </div>
+        )}
+
         {isEditing ? (
           <FormBuilder 
+            key={form.revision}
             onSave={handleSaveForm}
             isLoading={isSaving}
             initialData={form}
+            formId={params.id as string}
           />
         ) : (
           // Read-only view
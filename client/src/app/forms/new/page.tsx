@@ -4,7 +4,7 @@ import { useState } from 'react';
 import { useRouter } from 'next/navigation';
 import AuthenticatedLayout from '../../../components/AuthenticatedLayout';
 import FormBuilder, {FormData} from '@/components/FormBuilder/FormBuilder';
-import { CreateFormRequest, formsAPI } from '../../../services/api';
+import { CreateFormRequest, formsAPI, publishErrorMessage } from '../../../services/api';
 
 export default function NewFormPage() {
   const router = useRouter();
@@ -24,7 +24,7 @@ export default function NewFormPage() {
       await formsAPI.createForm(payload as CreateFormRequest);
       router.push('/forms');
     } catch (error: unknown) {
-      setError('Failed to save form. Please try again.');
+      setError(publishErrorMessage(error) ?? 'Failed to save form. Please try again.');
       console.error('Error saving form:', error);
     } finally {
       setIsLoading(false);
@@ -11,6 +11,8 @@ interface Form {
   description?: string;
   status: 'draft' | 'published' | 'archived';
   share_url?: string; 
+  folder?: string;
+  tags?: string[];
   created_at: string;
   updated_at: string;
 }
@@ -20,18 +22,24 @@ export default function FormsPage() {
   const [isLoading, setIsLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
   const [showDraftsOnly, setShowDraftsOnly] = useState(false); 
+  const [search, setSearch] = useState('');
+  const [query, setQuery] = useState('');
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
+  const [isLoadingMore, setIsLoadingMore] = useState(false);
   const router = useRouter();
 
-  useEffect(() => {
-    fetchForms();
-  }, []);
+  const listOptions = () => ({
+    status: showDraftsOnly ? 'draft' as const : undefined,
+    q: query || undefined,
+  });
 
   const fetchForms = async () => {
     try {
       setIsLoading(true);
       setError(null);
-      const response = await formsAPI.getAllForms(showDraftsOnly ? 'draft' : undefined);
+      const response = await formsAPI.getAllForms(listOptions());
       setForms(response.forms || []);
+      setNextCursor(response.next_cursor ?? null);
     } catch (error: unknown) {
       console.error('Error fetching forms:', error);
       setError('Failed to load forms. Please try again.');
@@ -40,9 +48,29 @@ export default function FormsPage() {
     }
   };
 
+  const fetchMoreForms = async () => {
+    if (!nextCursor) return;
+    try {
+      setIsLoadingMore(true);
+      const response = await formsAPI.getAllForms({ ...listOptions(), cursor: nextCursor });
+      setForms((current) => [...current, ...(response.forms || [])]);
+      setNextCursor(response.next_cursor ?? null);
+    } catch (error: unknown) {
+      console.error('Error fetching more forms:', error);
+      setError('Failed to load forms. Please try again.');
+    } finally {
+      setIsLoadingMore(false);
+    }
+  };
+
   useEffect(() => {
     fetchForms();
-  }, [showDraftsOnly]);
+  }, [showDraftsOnly, query]);
+
+  const handleSearch = (e: React.FormEvent) => {
+    e.preventDefault();
+    setQuery(search.trim());
+  };
 
   const handleNewForm = () => {
     router.push('/forms/new');
@@ -69,6 +97,15 @@ export default function FormsPage() {
           </div>
           
           <div className="flex space-x-3">
+            <form onSubmit={handleSearch}>
+              <input
+                type="search"
+                value={search}
+                onChange={(e) => setSearch(e.target.value)}
+                placeholder="Search forms"
+                className="px-3 py-2 border border-gray-300 rounded-md shadow-sm text-sm focus:outline-none focus:ring-indigo-500 focus:border-indigo-500"
+              />
+            </form>
             <button
               onClick={handleViewDrafts}
               className={`inline-flex items-center px-4 py-2 border shadow-sm text-sm font-medium rounded-md focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 ${
@@ -126,7 +163,7 @@ export default function FormsPage() {
                   <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M9 12h6m-6 4h6m2 5H7a2 2 0 01-2-2V5a2 2 0 012-2h5.586a1 1 0 01.707.293l5.414 5.414a1 1 0 01.293.707V19a2 2 0 01-2 2z" />
                 </svg>
                 <h3 className="mt-2 text-sm font-medium text-gray-900">
-                  {showDraftsOnly ? 'No draft forms' : 'No saved forms'}
+                  {query ? 'No forms match your search' : showDraftsOnly ? 'No draft forms' : 'No saved forms'}
                 </h3>
                 <p className="mt-1 text-sm text-gray-500">
                   {showDraftsOnly 
@@ -177,6 +214,12 @@ export default function FormsPage() {
                           <span>
                             Updated {new Date(form.updated_at).toLocaleDateString()}
                           </span>
+                          {form.folder && <span>📁 {form.folder}</span>}
+                          {form.tags?.map((tag) => (
+                            <span key={tag} className="inline-flex items-center px-2 py-0.5 rounded text-xs bg-gray-100 text-gray-700">
+                              #{tag}
+                            </span>
+                          ))}
                           {form.status === 'published' && form.share_url && (
                             <button
                               onClick={(e) => {
@@ -217,6 +260,17 @@ export default function FormsPage() {
                     </div>
                   </div>
                 ))}
+                {nextCursor && (
+                  <div className="p-4 text-center">
+                    <button
+                      onClick={fetchMoreForms}
+                      disabled={isLoadingMore}
+                      className="px-4 py-2 text-sm font-medium text-indigo-700 bg-indigo-50 rounded-md hover:bg-indigo-100 disabled:opacity-50"
+                    >
+                      {isLoadingMore ? 'Loading...' : 'Load more'}
+                    </button>
+                  </div>
+                )}
               </div>
             )}
           </div>
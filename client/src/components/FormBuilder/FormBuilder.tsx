@@ -1,6 +1,9 @@
 'use client';
 
-import { useState, useCallback } from 'react';
+import { useState, useCallback, useEffect } from 'react';
+import { applyFieldOperation, useFormCollaboration } from '../../hooks/useFormCollaboration';
+import type { FormField as StoredField } from '../../services/api';
+import type { FieldOperation } from '@/types/realtime-protocol';
 
 export interface FormField {
   id: string;
@@ -8,6 +11,7 @@ export interface FormField {
   label: string;
   placeholder?: string;
   required: boolean;
+  sensitive?: boolean;
   options?: string[];
   validation?: {
     minLength?: number;
@@ -25,15 +29,17 @@ export interface FormData {
   share_url?: string;
   fields: FormField[];
   status: string;
+  revision?: number; // Revision of the stored form the data is based on
 }
 
 interface FormBuilderProps {
   onSave: (formData: FormData, isDraft?: boolean) => void;
   isLoading: boolean;
   initialData?: FormData;
+  formId?: string; // Set for saved forms, whose fields are edited collaboratively
 }
 
-export default function FormBuilder({ onSave, isLoading, initialData }: FormBuilderProps) {
+export default function FormBuilder({ onSave, isLoading, initialData, formId }: FormBuilderProps) {
   const [formData, setFormData] = useState<FormData>(
     initialData || {
       title: '',
@@ -46,6 +52,22 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
   const [selectedField, setSelectedField] = useState<string | null>(null);
   const [previewMode, setPreviewMode] = useState(false);
 
+  // Field changes from other editors arrive as operations. Ours are already
+  // applied, but they move the revision the next save is based on.
+  const applyOperation = useCallback((op: FieldOperation, own: boolean) => {
+    setFormData(prev => ({
+      ...prev,
+      revision: Math.max(prev.revision ?? 0, op.revision ?? 0),
+      fields: own ? prev.fields : applyFieldOperation(prev.fields as StoredField[], op) as unknown as FormField[],
+    }));
+  }, []);
+  const collaboration = useFormCollaboration(formId, applyOperation);
+  const { focusField } = collaboration;
+
+  useEffect(() => {
+    focusField(selectedField);
+  }, [focusField, selectedField]);
+
   const updateFormSettings = useCallback((updates: Partial<FormData>) => {
     setFormData(prev => ({ ...prev, ...updates }));
   }, []);
@@ -70,7 +92,8 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
       fields: [...prev.fields, newField],
     }));
     setSelectedField(newField.id);
-  }, [formData.fields.length]);
+    collaboration.sendOperation({ op: 'add', field_id: newField.id, field: newField as unknown as StoredField });
+  }, [formData.fields.length, collaboration.sendOperation]);
 
   const updateField = useCallback((fieldId: string, updates: Partial<FormField>) => {
     setFormData(prev => ({
@@ -79,7 +102,8 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
         field.id === fieldId ? { ...field, ...updates } : field
       ),
     }));
-  }, []);
+    collaboration.updateField(fieldId, updates as FieldOperation['changes']);
+  }, [collaboration.updateField]);
 
   const deleteField = useCallback((fieldId: string) => {
     setFormData(prev => ({
@@ -88,9 +112,16 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
         .map((field, index) => ({ ...field, order: index })),
     }));
     setSelectedField(null);
-  }, []);
+    collaboration.sendOperation({ op: 'delete', field_id: fieldId });
+  }, [collaboration.sendOperation]);
 
   const moveField = useCallback((fieldId: string, direction: 'up' | 'down') => {
+    const currentIndex = formData.fields.findIndex(f => f.id === fieldId);
+    const newIndex = direction === 'up' ? currentIndex - 1 : currentIndex + 1;
+    if (currentIndex !== -1 && newIndex >= 0 && newIndex < formData.fields.length) {
+      collaboration.sendOperation({ op: 'move', field_id: fieldId, index: newIndex });
+    }
+
     setFormData(prev => {
       const currentIndex = prev.fields.findIndex(f => f.id === fieldId);
       if (currentIndex === -1) return prev;
@@ -106,7 +137,7 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
         fields: newFields.map((field, index) => ({ ...field, order: index })),
       };
     });
-  }, []);
+  }, [formData.fields, collaboration.sendOperation]);
 
   const handleSave = (isDraft: boolean = true) => {
     if (!formData.title.trim()) {
@@ -211,6 +242,11 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
             </div>
             
             <div className="flex items-center space-x-2">
+              {collaboration.editors.length > 0 && (
+                <span className="text-xs text-gray-500" title={collaboration.editors.map(e => e.email).join(', ')}>
+                  {collaboration.editors.length} other {collaboration.editors.length === 1 ? 'editor' : 'editors'}
+                </span>
+              )}
               <button
                 onClick={() => handleSave(true)}
                 disabled={!canSave || isLoading}
@@ -354,6 +390,16 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
                               <span className="text-xs text-gray-500 bg-gray-100 px-2 py-1 rounded">
                                 {field.type}
                               </span>
+                              {collaboration.editors
+                                .filter(editor => editor.field_id === field.id)
+                                .map(editor => (
+                                  <span
+                                    key={editor.client_id}
+                                    className="text-xs text-amber-800 bg-amber-100 px-2 py-1 rounded"
+                                  >
+                                    ✏️ {editor.email}
+                                  </span>
+                                ))}
                             </div>
                             
                             {/* Field Preview */}
@@ -460,6 +506,18 @@ export default function FormBuilder({ onSave, isLoading, initialData }: FormBuil
                       Required field
                     </label>
                   </div>
+
+                  <div className="flex items-center">
+                    <input
+                      type="checkbox"
+                      checked={field.sensitive || false}
+                      onChange={(e) => updateField(field.id, { sensitive: e.target.checked })}
+                      className="mr-2"
+                    />
+                    <label className="text-sm font-medium text-gray-900">
+                      Sensitive (hidden in the live response feed)
+                    </label>
+                  </div>
                   
                   {(field.type === 'select' || field.type === 'radio' || field.type === 'checkbox') && (
                     <div>
@@ -0,0 +1,136 @@
+import { useEffect, useRef, useState, useCallback } from 'react';
+import { useSocket } from './useSocket';
+import {
+  ConnectedMessage,
+  EditorPresence,
+  EventMessage,
+  FieldOperation,
+  RealtimeTopic,
+} from '@/types/realtime-protocol';
+import type { FormField } from '@/services/api';
+
+// Changes typed into the same field in quick succession are sent as one operation
+const UPDATE_DEBOUNCE_MS = 300;
+
+interface PendingUpdate {
+  changes: FieldOperation['changes'];
+  timer: ReturnType<typeof setTimeout>;
+}
+
+// applyFieldOperation applies an operation broadcast by the server. Broadcasts
+// carry the field as stored and its index, so every editor ends up with the
+// same fields whatever order operations arrive in.
+export function applyFieldOperation(fields: FormField[], op: FieldOperation): FormField[] {
+  const rest = fields.filter((field) => field.id !== op.field_id);
+  let next = rest;
+  if (op.op !== 'delete' && op.field) {
+    const index = op.index ?? rest.length;
+    next = [...rest.slice(0, index), op.field, ...rest.slice(index)];
+  }
+  return next.map((field, index) => ({ ...field, order: index }));
+}
+
+// useFormCollaboration joins the editing session of a saved form. Local edits
+// are sent as field operations, and every applied operation is passed to
+// onOperation, with own set for those sent from here. Nothing is sent when
+// formId is undefined.
+export function useFormCollaboration(formId: string | undefined, onOperation: (op: FieldOperation, own: boolean) => void) {
+  const socket = useSocket('/', !!formId);
+  const [editors, setEditors] = useState<EditorPresence[]>([]);
+  const [clientId, setClientId] = useState<string | null>(null);
+  const clientIdRef = useRef<string | null>(null);
+  const pendingUpdates = useRef<Map<string, PendingUpdate>>(new Map());
+  const onOperationRef = useRef(onOperation);
+  onOperationRef.current = onOperation;
+
+  useEffect(() => {
+    if (!formId) return;
+    const topics: RealtimeTopic[] = [{ name: 'form-edits', form_id: formId }];
+
+    socket.on('connected', (message: ConnectedMessage) => {
+      clientIdRef.current = message.client_id;
+      setClientId(message.client_id);
+    });
+    socket.on('presence', (message: EventMessage) => {
+      setEditors(message.editors ?? []);
+    });
+    socket.on('field-op', (message: EventMessage) => {
+      const op = message.operation;
+      if (!op) return;
+      if (op.client_id === clientIdRef.current) {
+        onOperationRef.current(op, true);
+        return;
+      }
+      // Keep changes we have not sent yet on top of the stored field
+      const pending = pendingUpdates.current.get(op.field_id);
+      if (pending && op.field) {
+        onOperationRef.current({ ...op, field: { ...op.field, ...pending.changes } as FormField }, false);
+      } else {
+        onOperationRef.current(op, false);
+      }
+    });
+
+    socket.request('subscribe', { topics }).catch((error) => {
+      console.error('❌ Failed to join the editing session:', error);
+    });
+
+    return () => {
+      socket.emit('unsubscribe', { topics });
+      socket.off('connected');
+      socket.off('presence');
+      socket.off('field-op');
+    };
+  }, [socket.request, socket.emit, socket.on, socket.off, formId]);
+
+  const send = useCallback((op: FieldOperation) => {
+    if (!formId) return;
+    socket.request('field-op', { form_id: formId, operation: op }).catch((error) => {
+      console.error('❌ Field operation was rejected:', error);
+    });
+  }, [socket.request, formId]);
+
+  // flushUpdates sends pending updates right away, so they stay ordered before other operations
+  const flushUpdates = useCallback(() => {
+    pendingUpdates.current.forEach((pending, fieldId) => {
+      clearTimeout(pending.timer);
+      send({ op: 'update', field_id: fieldId, changes: pending.changes });
+    });
+    pendingUpdates.current.clear();
+  }, [send]);
+
+  const sendOperation = useCallback((op: FieldOperation) => {
+    if (op.op === 'delete') {
+      const pending = pendingUpdates.current.get(op.field_id);
+      if (pending) {
+        clearTimeout(pending.timer);
+        pendingUpdates.current.delete(op.field_id);
+      }
+    }
+    flushUpdates();
+    send(op);
+  }, [flushUpdates, send]);
+
+  const updateField = useCallback((fieldId: string, changes: FieldOperation['changes']) => {
+    const pending = pendingUpdates.current.get(fieldId);
+    if (pending) clearTimeout(pending.timer);
+    const merged = { ...pending?.changes, ...changes };
+    const timer = setTimeout(() => {
+      pendingUpdates.current.delete(fieldId);
+      send({ op: 'update', field_id: fieldId, changes: merged });
+    }, UPDATE_DEBOUNCE_MS);
+    pendingUpdates.current.set(fieldId, { changes: merged, timer });
+  }, [send]);
+
+  const focusField = useCallback((fieldId: string | null) => {
+    if (!formId) return;
+    socket.emit('presence', { form_id: formId, field_id: fieldId ?? undefined });
+  }, [socket.emit, formId]);
+
+  return {
+    // Other editors; the same user in another tab is listed too
+    editors: editors.filter((editor) => editor.client_id !== clientId),
+    sendOperation,
+    updateField,
+    focusField,
+  };
+}
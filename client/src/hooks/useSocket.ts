@@ -1,17 +1,41 @@
 /* eslint-disable @typescript-eslint/no-unused-vars */
 /* eslint-disable @typescript-eslint/no-explicit-any */
 import { useEffect, useRef, useCallback } from 'react';
+import {
+  REALTIME_PROTOCOL_VERSION,
+  AckMessage,
+  ClientMessage,
+  ClientMessageType,
+  ErrorMessage,
+  ServerMessage,
+} from '@/types/realtime-protocol';
 
-interface WebSocketMessage {
-  type: string;
-  [key: string]: any;
+interface PendingRequest {
+  resolve: (ack: AckMessage) => void;
+  reject: (error: ErrorMessage) => void;
 }
 
-export function useSocket(_path: string) {
+// The connection is only opened while enabled
+export function useSocket(_path: string, enabled: boolean = true) {
   const ws = useRef<WebSocket | null>(null);
   const listeners = useRef<Map<string, (data: any) => void>>(new Map());
+  const pending = useRef<Map<string, PendingRequest>>(new Map());
+  // Requests made before the connection opens are sent once it does
+  const queue = useRef<ClientMessage[]>([]);
+  const nextRequestId = useRef(1);
+
+  const send = useCallback((message: ClientMessage) => {
+    if (ws.current && ws.current.readyState === WebSocket.OPEN) {
+      ws.current.send(JSON.stringify(message));
+    } else {
+      queue.current.push(message);
+    }
+  }, []);
 
   useEffect(() => {
+    if (!enabled) {
+      return;
+    }
     const wsUrl = process.env.NEXT_PUBLIC_WS_URL;
     if (!wsUrl) {
       console.error('❌ WebSocket URL is not defined in NEXT_PUBLIC_WS_URL');
@@ -21,13 +45,34 @@ export function useSocket(_path: string) {
 
     ws.current.onopen = () => {
       console.log('🔌 Connected to WebSocket server');
+      // Rooms require authentication; the message is handled before any subscription sent after it
+      const token = localStorage.getItem('auth_token');
+      if (token) {
+        ws.current?.send(JSON.stringify({ v: REALTIME_PROTOCOL_VERSION, type: 'auth', token }));
+      }
+      queue.current.forEach((message) => ws.current?.send(JSON.stringify(message)));
+      queue.current = [];
     };
 
     ws.current.onmessage = (event) => {
       try {
-        const message: WebSocketMessage = JSON.parse(event.data);
+        const message: ServerMessage = JSON.parse(event.data);
         console.log('📨 WebSocket message received:', message);
-        
+
+        // Replies settle the request they answer
+        if ((message.type === 'ack' || message.type === 'error') && message.id) {
+          const request = pending.current.get(message.id);
+          if (request) {
+            pending.current.delete(message.id);
+            if (message.type === 'ack') {
+              request.resolve(message);
+            } else {
+              request.reject(message);
+            }
+            return;
+          }
+        }
+
         // Call appropriate listener
         const listener = listeners.current.get(message.type);
         if (listener) {
@@ -51,14 +96,20 @@ export function useSocket(_path: string) {
         ws.current.close();
       }
     };
-  }, []);
+  }, [enabled]);
 
-  const emit = useCallback((type: string, data?: any) => {
-    if (ws.current && ws.current.readyState === WebSocket.OPEN) {
-      const message = { type, ...data };
-      ws.current.send(JSON.stringify(message));
-    }
-  }, []);
+  // request sends a message and resolves with its ack, or rejects with the error reply
+  const request = useCallback((type: ClientMessageType, data?: Omit<ClientMessage, 'type' | 'v' | 'id'>) => {
+    const id = String(nextRequestId.current++);
+    return new Promise<AckMessage>((resolve, reject) => {
+      pending.current.set(id, { resolve, reject });
+      send({ v: REALTIME_PROTOCOL_VERSION, id, type, ...data });
+    });
+  }, [send]);
+
+  const emit = useCallback((type: ClientMessageType, data?: Omit<ClientMessage, 'type' | 'v' | 'id'>) => {
+    send({ v: REALTIME_PROTOCOL_VERSION, type, ...data });
+  }, [send]);
 
   const on = useCallback((event: string, callback: (data: any) => void) => {
     listeners.current.set(event, callback);
@@ -68,5 +119,5 @@ export function useSocket(_path: string) {
     listeners.current.delete(event);
   }, []);
 
-  return { emit, on, off };
-}
\ No newline at end of file
+  return { request, emit, on, off };
+}
@@ -62,6 +62,7 @@ export interface FormField {
   label: string;
   placeholder?: string;
   required: boolean;
+  sensitive?: boolean;
   options?: string[];
   validation?: Record<string, string>;
   order: number;
@@ -73,6 +74,82 @@ export interface CreateFormRequest {
   fields: FormField[];
   status?: 'draft' | 'published';
   share_url?: string;
+  folder?: string; // Slash-separated path, e.g. 'Marketing/Q3'
+  tags?: string[];
+  workspace_id?: string; // On creation; the personal workspace when left out
+}
+
+export interface ListFormsOptions {
+  status?: 'draft' | 'published';
+  workspace_id?: string;
+  folder?: string; // Includes subfolders; '' for forms in no folder
+  tag?: string;
+  q?: string; // Searches titles, descriptions and field labels
+  sort?: 'updated_at' | 'created_at' | 'title' | 'relevance';
+  order?: 'asc' | 'desc';
+  limit?: number;
+  cursor?: string; // next_cursor of the previous page
+}
+
+export interface FormLabelCount {
+  name: string;
+  count: number;
+}
+
+export type WorkspaceRole = 'owner' | 'editor' | 'analyst' | 'viewer';
+
+export interface WorkspaceMember {
+  user_id: string;
+  email: string;
+  name: string;
+  role: WorkspaceRole;
+  added_at: string;
+}
+
+export interface FormCollaborator {
+  id: string;
+  email: string;
+  user_id?: string; // Set once the invitation is accepted
+  role: Exclude<WorkspaceRole, 'owner'>;
+  invited_by: string;
+  invited_at: string;
+  accepted_at?: string;
+}
+
+export interface Invitation {
+  form_id: string;
+  form_title: string;
+  role: FormCollaborator['role'];
+  invited_by: string;
+  invited_at: string;
+}
+
+export interface FormTemplate {
+  id: string; // The key of built-in templates, e.g. 'nps'
+  visibility: 'private' | 'workspace' | 'builtin';
+  user_id?: string;
+  workspace_id?: string;
+  title: string;
+  description?: string;
+  fields: FormField[];
+  tags?: string[];
+  created_at?: string;
+}
+
+export interface FormCopyRequest {
+  title?: string;
+  folder?: string;
+  workspace_id?: string;
+}
+
+export interface Workspace {
+  id: string;
+  name: string;
+  personal: boolean;
+  role: WorkspaceRole; // Of the current user
+  members: WorkspaceMember[];
+  created_at: string;
+  updated_at: string;
 }
 
 export interface SubmitFormResponse {
@@ -80,10 +157,48 @@ export interface SubmitFormResponse {
 }
 
 
+export interface LintIssue {
+  severity: 'error' | 'warning';
+  rule: string; // e.g. 'duplicate-field-id'
+  path?: string; // e.g. 'fields[2].options'
+  message: string;
+}
+
+// Errors block publishing; warnings are likely mistakes
+export interface FormLint {
+  errors: LintIssue[];
+  warnings: LintIssue[];
+}
+
+// The message of a save refused because the form has lint errors, or null for other failures
+export function publishErrorMessage(error: unknown): string | null {
+  if (!axios.isAxiosError(error) || error.response?.status !== 422 || !error.response.data?.lint) {
+    return null;
+  }
+  const lint: FormLint = error.response.data.lint;
+  const problems = lint.errors.map((issue) => (issue.path ? `${issue.path}: ${issue.message}` : issue.message));
+  return `Fix these problems before publishing: ${problems.join('; ')}`;
+}
+
 export const formsAPI = {
-  getAllForms: async (status?: string) => {
-    const params = status ? `?status=${status}` : '';
-    const response = await api.get(`/forms${params}`);
+  // Resolves to a page of forms, with a next_cursor when there are more
+  getAllForms: async (options: ListFormsOptions = {}) => {
+    const params = new URLSearchParams();
+    Object.entries(options).forEach(([key, value]) => {
+      if (value !== undefined) params.set(key, String(value));
+    });
+    const query = params.toString();
+    const response = await api.get(`/forms${query ? `?${query}` : ''}`);
+    return response.data;
+  },
+
+  getFolders: async (): Promise<{ folders: FormLabelCount[] }> => {
+    const response = await api.get('/forms/folders');
+    return response.data;
+  },
+
+  getTags: async (): Promise<{ tags: FormLabelCount[] }> => {
+    const response = await api.get('/forms/tags');
     return response.data;
   },
 
@@ -97,15 +212,220 @@ export const formsAPI = {
     return response.data;
   },
 
+  // Checks fields without saving them
+  lintForm: async (formData: CreateFormRequest): Promise<FormLint> => {
+    const response = await api.post('/forms/lint', formData);
+    return response.data;
+  },
+
   submitFormResponse: async (formId: string, responseData: SubmitFormResponse) => {
     const response = await api.post(`/forms/${formId}/responses`, responseData);
     return response.data;
   },
 
-  updateForm: async (id: string, formData: CreateFormRequest) => {
-    const response = await api.put(`/forms/${id}`, formData);
+  // revision is that of the form the changes were made to; a 409 response carries the current form
+  updateForm: async (id: string, formData: CreateFormRequest, revision: number) => {
+    const response = await api.put(`/forms/${id}`, formData, {
+      headers: { 'If-Match': `"${revision}"` },
+    });
     return response.data;
   },
 };
 
-export default api;
\ No newline at end of file
+export const workspacesAPI = {
+  getWorkspaces: async () => {
+    const response = await api.get('/workspaces');
+    return response.data;
+  },
+
+  createWorkspace: async (name: string) => {
+    const response = await api.post('/workspaces', { name });
+    return response.data;
+  },
+
+  addMember: async (workspaceId: string, email: string, role: WorkspaceRole) => {
+    const response = await api.post(`/workspaces/${workspaceId}/members`, { email, role });
+    return response.data;
+  },
+
+  updateMember: async (workspaceId: string, userId: string, role: WorkspaceRole) => {
+    const response = await api.put(`/workspaces/${workspaceId}/members/${userId}`, { role });
+    return response.data;
+  },
+
+  removeMember: async (workspaceId: string, userId: string) => {
+    await api.delete(`/workspaces/${workspaceId}/members/${userId}`);
+  },
+};
+
+export const sharingAPI = {
+  inviteCollaborator: async (formId: string, email: string, role: FormCollaborator['role']) => {
+    const response = await api.post(`/forms/${formId}/collaborators`, { email, role });
+    return response.data;
+  },
+
+  updateCollaborator: async (formId: string, collaboratorId: string, role: FormCollaborator['role']) => {
+    const response = await api.put(`/forms/${formId}/collaborators/${collaboratorId}`, { role });
+    return response.data;
+  },
+
+  removeCollaborator: async (formId: string, collaboratorId: string) => {
+    await api.delete(`/forms/${formId}/collaborators/${collaboratorId}`);
+  },
+
+  transferOwnership: async (formId: string, email: string, keepAccess = false) => {
+    const response = await api.post(`/forms/${formId}/transfer`, { email, keep_access: keepAccess });
+    return response.data;
+  },
+
+  getInvitations: async () => {
+    const response = await api.get('/invitations');
+    return response.data;
+  },
+
+  acceptInvitation: async (formId: string) => {
+    const response = await api.post(`/invitations/${formId}/accept`);
+    return response.data;
+  },
+
+  declineInvitation: async (formId: string) => {
+    await api.delete(`/invitations/${formId}`);
+  },
+};
+
+export interface DefinitionProblem {
+  path?: string; // e.g. 'fields[2].options'
+  message: string;
+}
+
+export const definitionsAPI = {
+  // Resolves to the definition as text, to be saved as a file
+  exportForm: async (formId: string, format: 'json' | 'yaml' = 'json'): Promise<string> => {
+    const response = await api.get(`/forms/${formId}/definition`, {
+      params: { format },
+      responseType: 'text',
+    });
+    return response.data;
+  },
+
+  // Invalid definitions are rejected with a 400 listing their problems
+  importForm: async (definition: string, format: 'json' | 'yaml', workspaceId?: string) => {
+    const response = await api.post('/forms/import', definition, {
+      params: workspaceId ? { workspace_id: workspaceId } : undefined,
+      headers: { 'Content-Type': format === 'yaml' ? 'application/yaml' : 'application/json' },
+    });
+    return response.data;
+  },
+
+  replaceDefinition: async (formId: string, definition: string, format: 'json' | 'yaml') => {
+    const response = await api.put(`/forms/${formId}/definition`, definition, {
+      headers: { 'Content-Type': format === 'yaml' ? 'application/yaml' : 'application/json' },
+    });
+    return response.data;
+  },
+};
+
+export const templatesAPI = {
+  getTemplates: async (): Promise<{ templates: FormTemplate[]; count: number }> => {
+    const response = await api.get('/templates');
+    return response.data;
+  },
+
+  getTemplate: async (id: string): Promise<FormTemplate> => {
+    const response = await api.get(`/templates/${id}`);
+    return response.data;
+  },
+
+  deleteTemplate: async (id: string) => {
+    await api.delete(`/templates/${id}`);
+  },
+
+  saveFormAsTemplate: async (
+    formId: string,
+    template: { title?: string; description?: string; visibility?: 'private' | 'workspace' } = {}
+  ): Promise<FormTemplate> => {
+    const response = await api.post(`/forms/${formId}/templates`, template);
+    return response.data;
+  },
+
+  // Resolves to the new draft form
+  createFormFromTemplate: async (id: string, copy: FormCopyRequest = {}) => {
+    const response = await api.post(`/templates/${id}/forms`, copy);
+    return response.data;
+  },
+
+  duplicateForm: async (formId: string, copy: FormCopyRequest = {}) => {
+    const response = await api.post(`/forms/${formId}/duplicate`, copy);
+    return response.data;
+  },
+};
+
+export default api;
+export interface ResponseImportOptions {
+  mapping?: Record<string, string>; // Column header to field ID; '' ignores the column
+  submitted_at_column?: string;
+  time_layout?: string; // Go time layout, e.g. '02/01/2006 15:04'
+  timezone?: string;
+  list_separator?: string;
+}
+
+export interface ResponseImportReport {
+  dry_run: boolean;
+  columns: Record<string, string>;
+  ignored_columns?: string[];
+  missing_fields?: string[];
+  submitted_at_column?: string;
+  total_rows: number;
+  valid_rows: number;
+  imported_rows: number;
+  rejected_rows: number;
+  rejected?: { line: number; errors: string[] }[]; // The first 100
+}
+
+export interface ResponseImportJob {
+  id: string;
+  form_id: string;
+  user_id: string;
+  status: 'running' | 'completed' | 'failed';
+  report: ResponseImportReport;
+  error?: string;
+  created_at: string;
+  updated_at: string;
+  finished_at?: string;
+}
+
+export const responseImportsAPI = {
+  // Only reports what would be imported, so rejected rows can be fixed first
+  preview: async (formId: string, file: File, options: ResponseImportOptions = {}): Promise<ResponseImportReport> => {
+    const response = await api.post(`/forms/${formId}/responses/import`, importData(file, options), {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  // Large files keep importing in the background; poll getImport until the job is done
+  commit: async (formId: string, file: File, options: ResponseImportOptions = {}): Promise<ResponseImportJob> => {
+    const response = await api.post(`/forms/${formId}/responses/import`, importData(file, options), {
+      params: { commit: true },
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  getImports: async (formId: string): Promise<ResponseImportJob[]> => {
+    const response = await api.get(`/forms/${formId}/responses/imports`);
+    return response.data;
+  },
+
+  getImport: async (formId: string, importId: string): Promise<ResponseImportJob> => {
+    const response = await api.get(`/forms/${formId}/responses/imports/${importId}`);
+    return response.data;
+  },
+};
+
+function importData(file: File, options: ResponseImportOptions): FormData {
+  const data = new FormData();
+  data.append('file', file);
+  data.append('options', JSON.stringify(options));
+  return data;
+}
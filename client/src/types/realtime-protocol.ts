@@ -0,0 +1,132 @@
+/* eslint-disable @typescript-eslint/no-explicit-any */
+// Types of the WebSocket protocol described by realtime-protocol.schema.json,
+// which the server generates with `go run ./cmd/realtime-schema`. They can be
+// regenerated with json-schema-to-typescript when the protocol changes.
+
+import type { FormField } from '@/services/api';
+
+export const REALTIME_PROTOCOL_VERSION = 1;
+
+export type RealtimeTopicName = 'form-analytics' | 'form-responses' | 'form-edits';
+
+export interface RealtimeTopic {
+  name: RealtimeTopicName;
+  form_id: string;
+}
+
+export type ClientMessageType =
+  | 'auth'
+  | 'subscribe'
+  | 'unsubscribe'
+  | 'join-analytics'
+  | 'leave-analytics'
+  | 'subscribe-responses'
+  | 'unsubscribe-responses'
+  | 'field-op'
+  | 'presence';
+
+export interface ClientMessage {
+  v?: number;
+  id?: string;
+  type: ClientMessageType;
+  token?: string;
+  topics?: RealtimeTopic[];
+  form_id?: string;
+  operation?: FieldOperation;
+  field_id?: string;
+}
+
+// A change to a single field. Broadcasts carry the field as stored after the
+// operation and its index, along with who applied it.
+export interface FieldOperation {
+  id?: string;
+  op: 'add' | 'update' | 'move' | 'delete';
+  field_id: string;
+  field?: FormField;
+  index?: number;
+  changes?: Partial<Omit<FormField, 'id' | 'order'>>;
+  user_id?: string;
+  client_id?: string;
+  applied_at?: string;
+  revision?: number;
+}
+
+export interface EditorPresence {
+  client_id: string;
+  user_id: string;
+  email: string;
+  field_id?: string;
+  since: string;
+}
+
+export interface ConnectedMessage {
+  v: number;
+  type: 'connected';
+  client_id: string;
+}
+
+export interface AckMessage {
+  v: number;
+  type: 'ack';
+  id?: string;
+  request: ClientMessageType;
+  user_id?: string;
+  topics?: RealtimeTopic[];
+}
+
+export type RealtimeErrorCode =
+  | 'bad_request'
+  | 'unsupported_version'
+  | 'unknown_topic'
+  | 'unauthorized'
+  | 'token_expired'
+  | 'invalid_form_id'
+  | 'forbidden'
+  | 'conflict'
+  | 'internal_error';
+
+export interface ErrorMessage {
+  v: number;
+  type: 'error';
+  id?: string;
+  code: RealtimeErrorCode;
+  message: string;
+  form_id?: string;
+  topic?: RealtimeTopic;
+}
+
+export interface ResponseFeedItem {
+  id: string;
+  form_id: string;
+  responses: Record<string, any>;
+  redacted?: string[];
+  submitted_at: string;
+  started_at?: string;
+  client?: { browser: string; os: string; device: string; country?: string };
+}
+
+export interface EventMessage {
+  v: number;
+  type:
+    | 'analytics-delta'
+    | 'timeseries-update'
+    | 'form-update'
+    | 'response-created'
+    | 'responses-replay'
+    | 'responses-imported'
+    | 'field-op'
+    | 'presence';
+  topic?: RealtimeTopic;
+  form_id: string;
+  delta?: any;
+  update?: any;
+  form?: any;
+  response?: ResponseFeedItem;
+  responses?: ResponseFeedItem[];
+  import?: any;
+  operation?: FieldOperation;
+  editors?: EditorPresence[];
+  timestamp?: string;
+}
+
+export type ServerMessage = ConnectedMessage | AckMessage | ErrorMessage | EventMessage;
@@ -1,22 +1,39 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
 
 	"dune-takehome-server/database"
 	"dune-takehome-server/handlers"
 	"dune-takehome-server/middleware"
+	"dune-takehome-server/models"
 	"dune-takehome-server/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/websocket/v2"
 	"github.com/joho/godotenv"
 )
 
-var wsService *services.WebSocketService
+// importBodyLimit is the largest CSV file of responses that can be imported
+const importBodyLimit = 32 * 1024 * 1024
+
+// responseImportPath is the route importing responses, the only one taking bodies over Fiber's default limit
+var responseImportPath = regexp.MustCompile(`^/api/v1/forms/[^/]+/responses/import/?$`)
+
+var (
+	broker        services.Broker
+	wsService     *services.WebSocketService
+	streamService *services.EventStreamService
+)
 
 func main() {
 	// Load environment variables
@@ -34,17 +51,47 @@ func main() {
 		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
 	}
 
+	if err := database.EnsureIndexes(); err != nil {
+		log.Printf("⚠️ Failed to ensure MongoDB indexes: %v", err)
+	}
+
+	// Imports whose server stopped while they ran are failed once they missed
+	// their heartbeats, which also leaves those of other replicas running
+	time.AfterFunc(services.ImportStaleAfter, func() {
+		if failed, err := services.NewResponseImportService().FailStaleImportJobs(); err != nil {
+			log.Printf("⚠️ Failed to mark interrupted imports as failed: %v", err)
+		} else if failed > 0 {
+			log.Printf("📥 Marked %d interrupted imports as failed", failed)
+		}
+	})
+
+	// Forms created before workspaces existed move to their owner's personal workspace
+	if moved, err := services.NewWorkspaceService().MigrateLegacyForms(); err != nil {
+		log.Printf("⚠️ Failed to move forms into personal workspaces: %v", err)
+	} else if moved > 0 {
+		log.Printf("📁 Moved %d forms into personal workspaces", moved)
+	}
+
 	defer func() {
 		if err := database.Disconnect(); err != nil {
 			log.Printf("Error disconnecting from MongoDB: %v", err)
 		}
 	}()
 
-	// Initialize WebSocket service
-	wsService = services.NewWebSocketService()
+	// Initialize the real-time event broker and WebSocket service
+	var err error
+	broker, err = services.NewBroker()
+	if err != nil {
+		log.Fatalf("❌ Failed to start real-time broker: %v", err)
+	}
+	wsService = services.NewWebSocketService(broker)
+	streamService = services.NewEventStreamService(broker)
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
+		// Only imports of responses may send this much, other bodies are held
+		// to Fiber's default limit below
+		BodyLimit: importBodyLimit,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -60,10 +107,14 @@ func main() {
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "https://pretty-imagination-production-3bad.up.railway.app, http://localhost:3000",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
-		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, If-Match",
+		ExposeHeaders:    "ETag",
+		AllowMethods:     "GET, POST, PUT, PATCH, DELETE, OPTIONS",
 		AllowCredentials: true,
 	}))
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, func(c *fiber.Ctx) bool {
+		return c.Method() == fiber.MethodPost && responseImportPath.MatchString(c.Path())
+	}))
 
 	// Health check route
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -90,6 +141,9 @@ func main() {
 
 	// API routes
 	api := app.Group("/api/v1")
+	api.Get("/realtime/schema", func(c *fiber.Ctx) error {
+		return c.JSON(services.RealtimeProtocolSchema())
+	})
 	setupRoutes(api)
 
 	port := os.Getenv("PORT")
@@ -97,32 +151,133 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("🚀 Server starting on port %s", port)
-	log.Printf("🔌 WebSocket server ready at ws://localhost:%s/socket.io/", port)
-	log.Fatal(app.Listen(":" + port))
+	go func() {
+		log.Printf("🚀 Server starting on port %s", port)
+		log.Printf("🔌 WebSocket server ready at ws://localhost:%s/socket.io/", port)
+		if err := app.Listen(":" + port); err != nil {
+			log.Fatalf("❌ Server stopped: %v", err)
+		}
+	}()
+
+	// Wait for an interrupt, then close WebSocket connections and event streams
+	// before the HTTP server so clients get a close frame instead of a dropped
+	// socket, and the server does not wait on streams that never end
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	log.Println("🛑 Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	streamService.Shutdown()
+	if err := wsService.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ WebSocket connections did not close in time: %v", err)
+	}
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		log.Printf("⚠️ Server shutdown: %v", err)
+	}
+	if err := broker.Close(); err != nil {
+		log.Printf("⚠️ Failed to close real-time broker: %v", err)
+	}
 }
 
 func setupRoutes(api fiber.Router) {
 	// Initialize handlers
 	userHandler := handlers.NewUserHandler()
-	formHandler := handlers.NewFormHandler(wsService)
+	formHandler := handlers.NewFormHandler(broker, streamService)
+	workspaceHandler := handlers.NewWorkspaceHandler(broker)
 
 	// Auth routes
 	auth := api.Group("/auth")
 	auth.Post("/register", userHandler.Register)
 	auth.Post("/login", userHandler.Login)
 	auth.Get("/profile", middleware.AuthRequired(), userHandler.GetProfile)
+	auth.Put("/profile", middleware.AuthRequired(), userHandler.UpdateProfile)
+
+	// Workspace routes
+	workspaces := api.Group("/workspaces", middleware.AuthRequired())
+	workspaces.Get("/", workspaceHandler.GetUserWorkspaces)
+	workspaces.Post("/", workspaceHandler.CreateWorkspace)
+	workspaces.Get("/:id", middleware.WorkspaceAccess(models.PermissionViewForm), workspaceHandler.GetWorkspace)
+	workspaces.Put("/:id", middleware.WorkspaceAccess(models.PermissionManageWorkspace), workspaceHandler.UpdateWorkspace)
+	workspaces.Post("/:id/members", middleware.WorkspaceAccess(models.PermissionManageWorkspace), workspaceHandler.AddWorkspaceMember)
+	workspaces.Put("/:id/members/:userId", middleware.WorkspaceAccess(models.PermissionManageWorkspace), workspaceHandler.UpdateWorkspaceMember)
+	workspaces.Delete("/:id/members/:userId", middleware.WorkspaceAccess(models.PermissionViewForm), workspaceHandler.RemoveWorkspaceMember)
+
+	// Form routes. Each form route declares the permission it needs, which the
+	// user's role in the form's workspace must grant.
+	viewForm := middleware.FormAccess(models.PermissionViewForm)
+	viewResponses := middleware.FormAccess(models.PermissionViewResponses)
+	editForm := middleware.FormAccess(models.PermissionEditForm)
+	manageForm := middleware.FormAccess(models.PermissionManageForm)
+
+	// Registered before the forms group, whose authentication ignores query tokens
+	api.Get("/forms/:id/analytics/stream", middleware.EventStreamAuthRequired(), viewResponses, formHandler.StreamFormAnalytics)
 
-	// Form routes
 	forms := api.Group("/forms", middleware.AuthRequired())
 	forms.Get("/", formHandler.GetUserForms)
 	forms.Post("/", formHandler.CreateForm)
-	forms.Get("/:id", formHandler.GetFormByID)
-	forms.Put("/:id", formHandler.UpdateForm)
-	forms.Get("/:id/analytics", formHandler.GetFormAnalytics)
+	forms.Get("/folders", formHandler.GetFormFolders)
+	forms.Get("/tags", formHandler.GetFormTags)
+	forms.Post("/import", formHandler.ImportForm)
+	forms.Post("/lint", formHandler.LintFormRequest)
+	forms.Get("/:id", viewForm, formHandler.GetFormByID)
+	forms.Put("/:id", editForm, formHandler.UpdateForm)
+	forms.Patch("/:id", editForm, formHandler.PatchForm)
+	forms.Post("/:id/fields", editForm, formHandler.AddFormField)
+	forms.Patch("/:id/fields/:fieldId", editForm, formHandler.UpdateFormField)
+	forms.Post("/:id/fields/:fieldId/move", editForm, formHandler.MoveFormField)
+	forms.Delete("/:id/fields/:fieldId", editForm, formHandler.DeleteFormField)
+	forms.Post("/:id/collaborators", manageForm, formHandler.InviteFormCollaborator)
+	forms.Put("/:id/collaborators/:collaboratorId", manageForm, formHandler.UpdateFormCollaborator)
+	forms.Delete("/:id/collaborators/:collaboratorId", viewForm, formHandler.RemoveFormCollaborator)
+	forms.Post("/:id/transfer", manageForm, formHandler.TransferFormOwnership)
+	forms.Post("/:id/duplicate", viewForm, formHandler.DuplicateForm)
+	forms.Get("/:id/lint", viewForm, formHandler.LintForm)
+	forms.Get("/:id/definition", viewForm, formHandler.ExportForm)
+	forms.Put("/:id/definition", editForm, formHandler.ImportFormDefinition)
+	forms.Post("/:id/templates", viewForm, formHandler.SaveFormAsTemplate)
+	forms.Post("/:id/responses/import", editForm, formHandler.ImportResponses)
+	forms.Get("/:id/responses/imports", viewResponses, formHandler.GetResponseImports)
+	forms.Get("/:id/responses/imports/:importId", viewResponses, formHandler.GetResponseImport)
+	forms.Get("/:id/analytics", viewResponses, formHandler.GetFormAnalytics)
+	forms.Get("/:id/analytics/timeseries", viewResponses, formHandler.GetFormTimeSeries)
+	forms.Get("/:id/analytics/crosstab", viewResponses, formHandler.GetFormCrossTab)
+	forms.Get("/:id/analytics/sentiment", viewResponses, formHandler.GetFormTextSentiment)
+
+	// Invitations to collaborate on forms, sent to the user's email
+	invitations := api.Group("/invitations", middleware.AuthRequired())
+	invitations.Get("/", formHandler.GetInvitations)
+	invitations.Post("/:formId/accept", formHandler.AcceptInvitation)
+	invitations.Delete("/:formId", formHandler.DeclineInvitation)
+
+	// Templates to start forms from, built in or saved from forms
+	templates := api.Group("/templates", middleware.AuthRequired())
+	templates.Get("/", formHandler.GetTemplates)
+	templates.Get("/:id", middleware.TemplateAccess(models.PermissionViewForm), formHandler.GetTemplate)
+	templates.Delete("/:id", middleware.TemplateAccess(models.PermissionManageForm), formHandler.DeleteTemplate)
+	templates.Post("/:id/forms", middleware.TemplateAccess(models.PermissionViewForm), formHandler.CreateFormFromTemplate)
 
 	public := api.Group("/public")
 	public.Get("/forms/:shareUrl", formHandler.GetPublicForm)
+	public.Get("/forms/:shareUrl/schema", formHandler.GetPublicFormSchema)
+	public.Get("/forms/:shareUrl/openapi.json", formHandler.GetPublicFormOpenAPI)
+	// Every view stores a session, so views are limited per visitor and form
+	viewLimiter := limiter.New(limiter.Config{
+		Max:        30,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP() + "|" + c.Params("shareUrl")
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many views, try again later",
+			})
+		},
+	})
+	public.Post("/forms/:shareUrl/views", viewLimiter, formHandler.RecordPublicFormView)
+	public.Post("/forms/:shareUrl/starts", formHandler.RecordPublicFormStart)
 	public.Post("/forms/:shareUrl/responses", formHandler.SubmitPublicFormResponse)
 
 	forms.Post("/:id/responses", func(c *fiber.Ctx) error {
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"dune-takehome-server/services"
+)
+
+// realtime-schema writes the JSON Schema of the WebSocket protocol, which the
+// client generates its message types from. The copy checked in with the
+// client must be regenerated whenever the protocol changes:
+//
+//	go run ./cmd/realtime-schema -o ../client/src/types/realtime-protocol.schema.json
+func main() {
+	outFlag := flag.String("o", "", "Write the schema to a file instead of stdout")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(services.RealtimeProtocolSchema(), "", "  ")
+	if err != nil {
+		log.Fatalf("❌ Failed to encode schema: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *outFlag == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*outFlag, data, 0o644); err != nil {
+		log.Fatalf("❌ Failed to write schema: %v", err)
+	}
+}
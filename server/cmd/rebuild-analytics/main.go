@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"dune-takehome-server/database"
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rebuild-analytics recomputes the materialized analytics aggregates from the
+// responses collection. Run it after backfilling responses or changing how
+// aggregates are computed. With -text and -clients it first re-analyzes the
+// text answers or the user agents and IP addresses of every response, e.g.
+// for responses stored before those analytics existed.
+func main() {
+	formIDFlag := flag.String("form", "", "Rebuild a single form by ID (defaults to every form)")
+	textFlag := flag.Bool("text", false, "Re-analyze text answers before rebuilding")
+	clientsFlag := flag.Bool("clients", false, "Re-parse user agents and GeoIP countries before rebuilding")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	mongoURI := os.Getenv("MONGODB_URI")
+	if mongoURI == "" {
+		mongoURI = "mongodb://localhost:27017/dune-form-builder"
+	}
+
+	if err := database.Connect(mongoURI); err != nil {
+		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
+	}
+
+	defer func() {
+		if err := database.Disconnect(); err != nil {
+			log.Printf("Error disconnecting from MongoDB: %v", err)
+		}
+	}()
+
+	if err := database.EnsureIndexes(); err != nil {
+		log.Fatalf("❌ Failed to ensure MongoDB indexes: %v", err)
+	}
+
+	formService := services.NewFormService()
+	responseService := services.NewResponseService()
+
+	var forms []*models.Form
+	if *formIDFlag != "" {
+		formID, err := primitive.ObjectIDFromHex(*formIDFlag)
+		if err != nil {
+			log.Fatalf("❌ Invalid form ID: %s", *formIDFlag)
+		}
+
+		form, err := formService.GetFormByID(formID)
+		if err != nil {
+			log.Fatalf("❌ Failed to load form: %v", err)
+		}
+		if form == nil {
+			log.Fatalf("❌ Form not found: %s", *formIDFlag)
+		}
+		forms = append(forms, form)
+	} else {
+		var err error
+		forms, err = formService.GetAllForms()
+		if err != nil {
+			log.Fatalf("❌ Failed to load forms: %v", err)
+		}
+	}
+
+	failed := 0
+	for _, form := range forms {
+		if *textFlag {
+			analyzed, err := responseService.BackfillTextAnalysis(form)
+			if err != nil {
+				log.Printf("❌ Failed to analyze text answers for form %s: %v", form.ID.Hex(), err)
+				failed++
+				continue
+			}
+			log.Printf("📝 Analyzed text answers of %d responses for form %s", analyzed, form.ID.Hex())
+		}
+
+		if *clientsFlag {
+			parsed, err := responseService.BackfillClientInfo(form)
+			if err != nil {
+				log.Printf("❌ Failed to parse clients for form %s: %v", form.ID.Hex(), err)
+				failed++
+				continue
+			}
+			log.Printf("📱 Parsed clients of %d responses for form %s", parsed, form.ID.Hex())
+		}
+
+		if err := responseService.RebuildFormAnalytics(form); err != nil {
+			log.Printf("❌ Failed to rebuild analytics for form %s: %v", form.ID.Hex(), err)
+			failed++
+			continue
+		}
+		log.Printf("✅ Rebuilt analytics for form %s (%s)", form.ID.Hex(), form.Title)
+	}
+
+	if failed > 0 {
+		log.Fatalf("❌ %d of %d forms failed to rebuild", failed, len(forms))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -65,3 +66,80 @@ func Ping() error {
 
 	return Client.Ping(ctx, nil)
 }
+
+// EnsureIndexes creates the indexes the services rely on. Creating an index
+// that already exists is a no-op, so this is safe to run on every start.
+func EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	indexes := map[string][]mongo.IndexModel{
+		"responses": {
+			{Keys: bson.D{{Key: "form_id", Value: 1}, {Key: "submitted_at", Value: -1}}},
+		},
+		"response_imports": {
+			{Keys: bson.D{{Key: "form_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		"form_sessions": {
+			{Keys: bson.D{{Key: "form_id", Value: 1}, {Key: "viewed_at", Value: -1}}},
+			// Sessions in progress, left out of the stored funnel's abandoned count
+			{Keys: bson.D{{Key: "form_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		},
+		"forms": {
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+			{Keys: bson.D{{Key: "collaborators.user_id", Value: 1}}},
+			{Keys: bson.D{{Key: "collaborators.email", Value: 1}}},
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "folder", Value: 1}}},
+			{Keys: bson.D{{Key: "tags", Value: 1}}},
+			{
+				// Searched by GET /forms?q=, titles weighing most
+				Keys: bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}, {Key: "fields.label", Value: "text"}},
+				Options: options.Index().SetName("forms_text").SetWeights(bson.M{
+					"title":        10,
+					"fields.label": 3,
+					"description":  1,
+				}),
+			},
+		},
+		"workspaces": {
+			{Keys: bson.D{{Key: "members.user_id", Value: 1}}},
+			{
+				// One personal workspace per user, even when created concurrently
+				Keys:    bson.D{{Key: "created_by", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"personal": true}),
+			},
+		},
+		"templates": {
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}}},
+		},
+		"field_aggregates": {
+			{
+				Keys:    bson.D{{Key: "form_id", Value: 1}, {Key: "field_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+		"field_terms": {
+			{
+				Keys:    bson.D{{Key: "form_id", Value: 1}, {Key: "field_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "term", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			// Most frequent terms of a field first
+			{Keys: bson.D{{Key: "form_id", Value: 1}, {Key: "field_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "count", Value: -1}, {Key: "term", Value: 1}}},
+		},
+		"field_values": {
+			{
+				Keys:    bson.D{{Key: "form_id", Value: 1}, {Key: "field_id", Value: 1}, {Key: "value", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := Database.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
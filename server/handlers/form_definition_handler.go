@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// definitionFileNameChars are the characters replaced in the file names of exports
+var definitionFileNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ExportForm sends a form's definition as a versioned JSON document, or YAML
+// with format=yaml, to be kept in version control and imported again
+func (h *FormHandler) ExportForm(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	format, ok := services.FormDefinitionFormatOf(c.Query("format"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Format must be json or yaml",
+		})
+	}
+
+	data, err := services.EncodeFormDefinition(services.FormDefinitionOf(form), format)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export form",
+		})
+	}
+
+	name := strings.Trim(definitionFileNameChars.ReplaceAllString(strings.ToLower(form.Title), "-"), "-")
+	if name == "" {
+		name = form.ID.Hex()
+	}
+	contentType := fiber.MIMEApplicationJSONCharsetUTF8
+	if format == models.FormDefinitionYAML {
+		contentType = "application/yaml; charset=utf-8"
+	}
+
+	setFormETag(c, form)
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	return c.Send(data)
+}
+
+// ImportForm creates a draft form from a definition, in the workspace given as
+// workspace_id or the user's personal workspace. The definition is JSON, or
+// YAML when sent as application/yaml or with format=yaml.
+func (h *FormHandler) ImportForm(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	definition, errResponse := parseFormDefinition(c)
+	if definition == nil {
+		return errResponse
+	}
+
+	workspaceID, errResponse := h.targetWorkspace(c, user.ID, c.Query("workspace_id"))
+	if workspaceID.IsZero() {
+		return errResponse
+	}
+
+	form, err := h.formService.CreateForm(user.ID, workspaceID, definitionRequest(definition))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to import form",
+		})
+	}
+
+	setFormETag(c, form)
+	return c.Status(fiber.StatusCreated).JSON(editorResponse(form))
+}
+
+// ImportFormDefinition replaces a form's definition with an imported one,
+// keeping its status, share URL, collaborators and responses. If-Match is
+// optional, as importing is meant to overwrite the form.
+func (h *FormHandler) ImportFormDefinition(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	revision := form.Revision
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" {
+		var ok bool
+		if revision, ok = parseFormETag(ifMatch); !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid If-Match header",
+			})
+		}
+	}
+
+	definition, errResponse := parseFormDefinition(c)
+	if definition == nil {
+		return errResponse
+	}
+
+	req := definitionRequest(definition)
+	if ok, errResponse := checkPublishable(c, form.Status, req.Fields); !ok {
+		return errResponse
+	}
+
+	updated, err := h.formService.UpdateForm(form.ID, req, revision)
+	if errors.Is(err, services.ErrStaleRevision) {
+		return staleFormResponse(c, updated)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to import form",
+		})
+	}
+	if updated == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Form not found",
+		})
+	}
+
+	h.formUpdated(form, updated)
+	setFormETag(c, updated)
+	return c.JSON(editorResponse(updated))
+}
+
+// parseFormDefinition decodes the definition in the request body. When it is
+// invalid, the error response listing its problems is already sent and the
+// returned definition is nil.
+func parseFormDefinition(c *fiber.Ctx) (*models.FormDefinition, error) {
+	format, ok := services.FormDefinitionFormatOf(c.Query("format"))
+	if c.Query("format") == "" {
+		format, ok = services.FormDefinitionFormatOf(c.Get(fiber.HeaderContentType))
+	}
+	if !ok {
+		return nil, c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Send the definition as application/json or application/yaml",
+		})
+	}
+
+	definition, err := services.DecodeFormDefinition(c.Body(), format)
+	var invalid *services.InvalidDefinitionError
+	if errors.As(err, &invalid) {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":    "Invalid form definition",
+			"problems": invalid.Problems,
+		})
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to import form",
+		})
+	}
+	return definition, nil
+}
+
+// definitionRequest is the form request that creates or updates a form to
+// match a definition. The status is left out, so updates keep it.
+func definitionRequest(definition *models.FormDefinition) models.FormRequest {
+	req := models.FormRequest{
+		Title:       definition.Title,
+		Description: definition.Description,
+		Fields:      definition.Fields,
+		Folder:      &definition.Folder,
+		Tags:        definition.Tags,
+	}
+	if req.Tags == nil {
+		req.Tags = []string{} // Removes the current tags
+	}
+	return req
+}
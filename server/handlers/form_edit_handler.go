@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+	"dune-takehome-server/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// formPatchDocument is the part of a form patches apply to
+type formPatchDocument struct {
+	Title       string             `json:"title"`
+	Description string             `json:"description,omitempty"`
+	Fields      []models.FormField `json:"fields"`
+	Status      models.FormStatus  `json:"status,omitempty"`
+	Folder      string             `json:"folder,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+}
+
+// Content types of form patches
+const (
+	contentTypeJSONPatch  = "application/json-patch+json"
+	contentTypeMergePatch = "application/merge-patch+json"
+)
+
+// formPatchAttempts is how often a patch is reapplied when the form changes
+// while it is being applied
+const formPatchAttempts = 3
+
+// PatchForm applies a JSON Patch (RFC 6902) or JSON Merge Patch (RFC 7396) to
+// the editable part of a form: title, description, status, fields, folder and
+// tags. Members the patch does not mention are left as they are. If-Match is
+// optional, since patches apply to the current form; JSON Patch test
+// operations can guard them.
+func (h *FormHandler) PatchForm(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case contentTypeJSONPatch:
+		apply = utils.ApplyJSONPatch
+	case contentTypeMergePatch, fiber.MIMEApplicationJSON:
+		apply = utils.MergePatch
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Send a JSON Patch as " + contentTypeJSONPatch + " or a merge patch as " + contentTypeMergePatch,
+		})
+	}
+
+	var expected *int64
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" {
+		revision, ok := parseFormETag(ifMatch)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid If-Match header",
+			})
+		}
+		expected = &revision
+	}
+
+	for attempt := 0; attempt < formPatchAttempts; attempt++ {
+		if expected != nil && form.Revision != *expected {
+			return staleFormResponse(c, form)
+		}
+
+		doc, err := json.Marshal(formPatchDocument{
+			Title:       form.Title,
+			Description: form.Description,
+			Fields:      form.Fields,
+			Status:      form.Status,
+			Folder:      form.Folder,
+			Tags:        form.Tags,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update form",
+			})
+		}
+
+		patched, err := apply(doc, c.Body())
+		if errors.Is(err, utils.ErrPatchTestFailed) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+				"form":  form.ToResponse(),
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		// Only the editable members may be changed or added
+		var req formPatchDocument
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Patched form is invalid: " + err.Error(),
+			})
+		}
+		if strings.TrimSpace(req.Title) == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Form title is required",
+			})
+		}
+		if req.Status != "" && req.Status != models.FormStatusDraft && req.Status != models.FormStatusPublished {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Status must be draft or published",
+			})
+		}
+
+		// Folder and tags the patch removed are removed rather than kept
+		update := models.FormRequest{
+			Title:       req.Title,
+			Description: req.Description,
+			Fields:      req.Fields,
+			Status:      req.Status,
+			Folder:      &req.Folder,
+			Tags:        req.Tags,
+		}
+		if update.Tags == nil {
+			update.Tags = []string{}
+		}
+		if err := normalizeFormLabels(&update); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if ok, errResponse := checkPublishable(c, update.Status, update.Fields); !ok {
+			return errResponse
+		}
+
+		updated, err := h.formService.UpdateForm(form.ID, update, form.Revision)
+		if errors.Is(err, services.ErrStaleRevision) {
+			// Changed meanwhile, apply the patch to the new version
+			form = updated
+			continue
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update form",
+			})
+		}
+		if updated == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Form not found",
+			})
+		}
+
+		h.formUpdated(form, updated)
+		setFormETag(c, updated)
+		return c.JSON(editorResponse(updated))
+	}
+
+	return staleFormResponse(c, form)
+}
+
+// AddFormField adds a field to a form, at the end or at the position given by ?index=
+func (h *FormHandler) AddFormField(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	var field models.FormField
+	if err := c.BodyParser(&field); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if field.ID == "" {
+		field.ID = "field_" + primitive.NewObjectID().Hex()
+	}
+
+	op := models.FieldOperation{Op: models.FieldOperationAdd, FieldID: field.ID, Field: &field}
+	if c.Query("index") != "" {
+		index := c.QueryInt("index", -1)
+		op.Index = &index
+	}
+	return h.applyFieldOperation(c, form, op, fiber.StatusCreated)
+}
+
+// UpdateFormField sets properties of a field, such as its label or options,
+// leaving the others as they are
+func (h *FormHandler) UpdateFormField(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	var changes map[string]interface{}
+	if err := json.Unmarshal(c.Body(), &changes); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	op := models.FieldOperation{Op: models.FieldOperationUpdate, FieldID: c.Params("fieldId"), Changes: changes}
+	return h.applyFieldOperation(c, form, op, fiber.StatusOK)
+}
+
+// MoveFormField moves a field to the position given as index
+func (h *FormHandler) MoveFormField(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	var req struct {
+		Index *int `json:"index"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	op := models.FieldOperation{Op: models.FieldOperationMove, FieldID: c.Params("fieldId"), Index: req.Index}
+	return h.applyFieldOperation(c, form, op, fiber.StatusOK)
+}
+
+// DeleteFormField removes a field from a form. Its answers stay in the stored responses.
+func (h *FormHandler) DeleteFormField(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	op := models.FieldOperation{Op: models.FieldOperationDelete, FieldID: c.Params("fieldId")}
+	return h.applyFieldOperation(c, form, op, fiber.StatusOK)
+}
+
+// applyFieldOperation applies an operation atomically, without touching the
+// rest of the form, and relays it to the form's editors like one made over the
+// WebSocket. Operations leaving a published form with lint errors are refused
+// like publishing it would be. It responds with the form as it is afterwards.
+func (h *FormHandler) applyFieldOperation(c *fiber.Ctx, form *models.Form, op models.FieldOperation, status int) error {
+	op.UserID, _ = c.Locals("userID").(string)
+	op.AppliedAt = time.Now()
+
+	updated, err := h.formService.ApplyFieldOperation(form.ID, op)
+	var lintErr *services.PublishedLintError
+	switch {
+	case errors.As(err, &lintErr):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "The change would leave the published form with errors",
+			"lint":  lintErr.Lint,
+		})
+	case errors.Is(err, services.ErrStaleRevision):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "The form keeps changing, try again",
+		})
+	case errors.Is(err, services.ErrInvalidFieldOperation):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrFieldNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Field not found",
+		})
+	case errors.Is(err, services.ErrFieldExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A field with this ID already exists",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update form",
+		})
+	case updated == nil:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Form not found",
+		})
+	}
+
+	if op.Op == models.FieldOperationUpdate && fieldTypesChanged(form, updated) {
+		h.rebuildAnalytics(updated)
+	}
+	op.Revision = updated.Revision
+	h.publish(services.BrokerEvent{
+		Type:      services.EventFieldOperation,
+		FormID:    updated.ID,
+		Form:      updated,
+		Operation: &op,
+	})
+
+	setFormETag(c, updated)
+	return c.Status(status).JSON(editorResponse(updated))
+}
+
+// requestForm returns the form loaded by the middleware.FormAccess check of the route
+func requestForm(c *fiber.Ctx) *models.Form {
+	return c.Locals("form").(*models.Form)
+}
+
+// formUpdated rebuilds analytics when needed and tells real-time clients
+// about a form whose definition was replaced
+func (h *FormHandler) formUpdated(before, after *models.Form) {
+	if fieldTypesChanged(before, after) {
+		h.rebuildAnalytics(after)
+	}
+	h.publish(services.BrokerEvent{
+		Type:   services.EventFormUpdated,
+		FormID: after.ID,
+		Form:   after,
+	})
+}
+
+// rebuildAnalytics recomputes a form's aggregates in the background. They are
+// typed per field, so changing a field's type needs a rebuild.
+func (h *FormHandler) rebuildAnalytics(form *models.Form) {
+	go func() {
+		if err := h.responseService.RebuildFormAnalytics(form); err != nil {
+			log.Printf("❌ Failed to rebuild analytics for form %s: %v", form.ID.Hex(), err)
+		}
+	}()
+}
+
+// staleFormResponse refuses a write based on an old revision, sending the current form
+func staleFormResponse(c *fiber.Ctx, form *models.Form) error {
+	setFormETag(c, form)
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error": "Form was changed by someone else, apply your changes to the current version",
+		"form":  form.ToResponse(),
+	})
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	"dune-takehome-server/models"
 	"dune-takehome-server/services"
@@ -12,64 +18,33 @@ import (
 )
 
 type FormHandler struct {
-	formService     *services.FormService
-	responseService *services.ResponseService
-	wsService       *services.WebSocketService
+	formService      *services.FormService
+	responseService  *services.ResponseService
+	workspaceService *services.WorkspaceService
+	userService      *services.UserService
+	templateService  *services.TemplateService
+	imports          *services.ResponseImportService
+	authorization    *services.AuthorizationService
+	broker           services.Broker
+	streams          *services.EventStreamService
 }
 
-func NewFormHandler(wsService *services.WebSocketService) *FormHandler {
+func NewFormHandler(broker services.Broker, streams *services.EventStreamService) *FormHandler {
 	return &FormHandler{
-		formService:     services.NewFormService(),
-		responseService: services.NewResponseService(),
-		wsService:       wsService,
+		formService:      services.NewFormService(),
+		responseService:  services.NewResponseService(),
+		workspaceService: services.NewWorkspaceService(),
+		userService:      services.NewUserService(),
+		templateService:  services.NewTemplateService(),
+		imports:          services.NewResponseImportService(),
+		authorization:    services.NewAuthorizationService(),
+		broker:           broker,
+		streams:          streams,
 	}
 }
 
-// GetUserForms retrieves all forms for the authenticated user
-func (h *FormHandler) GetUserForms(c *fiber.Ctx) error {
-	// Get user ID from auth middleware
-	userIDStr := c.Locals("userID")
-	if userIDStr == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
-		})
-	}
-
-	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
-		})
-	}
-
-	// Check for status filter
-	var statusFilter *models.FormStatus
-	if statusQuery := c.Query("status"); statusQuery != "" {
-		status := models.FormStatus(statusQuery)
-		statusFilter = &status
-	}
-
-	// Get forms
-	forms, err := h.formService.GetUserForms(userID, statusFilter)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve forms",
-		})
-	}
-
-	// Convert to response format
-	var formResponses []models.FormResponse
-	for _, form := range forms {
-		formResponses = append(formResponses, form.ToResponse())
-	}
-
-	return c.JSON(fiber.Map{
-		"forms": formResponses,
-		"count": len(formResponses),
-	})
-}
-
-// CreateForm creates a new form for the authenticated user
+// CreateForm creates a new form in the given workspace, which the user must be
+// able to edit forms of, or in their personal workspace
 func (h *FormHandler) CreateForm(c *fiber.Ctx) error {
 	// Get user ID from auth middleware
 	userIDStr := c.Locals("userID")
@@ -101,98 +76,137 @@ func (h *FormHandler) CreateForm(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := normalizeFormLabels(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if ok, errResponse := checkPublishable(c, req.Status, req.Fields); !ok {
+		return errResponse
+	}
+
+	workspaceID, errResponse := h.targetWorkspace(c, userID, req.WorkspaceID)
+	if workspaceID.IsZero() {
+		return errResponse
+	}
+
 	// Create form
-	form, err := h.formService.CreateForm(userID, req)
+	form, err := h.formService.CreateForm(userID, workspaceID, req)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create form",
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(form.ToResponse())
+	setFormETag(c, form)
+	return c.Status(fiber.StatusCreated).JSON(editorResponse(form))
 }
 
-// GetFormByID retrieves a specific form
-func (h *FormHandler) GetFormByID(c *fiber.Ctx) error {
-	// Get form ID from URL params
-	formIDStr := c.Params("id")
-	formID, err := primitive.ObjectIDFromHex(formIDStr)
+// targetWorkspace resolves the workspace a form is created in. When the user
+// may not create forms there, the error response is already sent and the
+// returned ID is zero.
+func (h *FormHandler) targetWorkspace(c *fiber.Ctx, userID primitive.ObjectID, workspaceIDStr string) (primitive.ObjectID, error) {
+	if workspaceIDStr == "" {
+		workspace, err := h.workspaceService.EnsurePersonalWorkspace(userID)
+		if err != nil {
+			return primitive.NilObjectID, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create form",
+			})
+		}
+		return workspace.ID, nil
+	}
+
+	workspaceID, err := primitive.ObjectIDFromHex(workspaceIDStr)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid form ID",
+		return primitive.NilObjectID, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid workspace ID",
 		})
 	}
 
-	// Get user ID from auth middleware
-	userIDStr := c.Locals("userID")
-	if userIDStr == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
+	workspace, _, err := h.authorization.AuthorizeWorkspace(userID, workspaceID, models.PermissionEditForm)
+	if errors.Is(err, services.ErrForbidden) {
+		return primitive.NilObjectID, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Your role in this workspace does not allow creating forms",
 		})
 	}
-
-	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
+		return primitive.NilObjectID, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create form",
 		})
 	}
-
-	// Get form (ensure it belongs to the user)
-	form, err := h.formService.GetUserFormByID(userID, formID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve form",
+	if workspace == nil {
+		return primitive.NilObjectID, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Workspace not found",
 		})
 	}
+	return workspace.ID, nil
+}
 
-	if form == nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Form not found",
-		})
-	}
+// GetFormByID retrieves a specific form
+func (h *FormHandler) GetFormByID(c *fiber.Ctx) error {
+	form := requestForm(c)
 
-	return c.JSON(form.ToResponse())
+	setFormETag(c, form)
+	return c.JSON(editorResponse(form))
 }
 
-// UpdateForm updates an existing form
+// UpdateForm updates an existing form. Forms cannot be published, or stay
+// published, while linting finds errors in their fields.
 func (h *FormHandler) UpdateForm(c *fiber.Ctx) error {
-	formIDStr := c.Params("id")
-	formID, err := primitive.ObjectIDFromHex(formIDStr)
-	if err != nil {
+	existingForm := requestForm(c)
+
+	var req models.FormRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid form ID",
+			"error": "Invalid request body",
 		})
 	}
 
-	userIDStr := c.Locals("userID")
-	if userIDStr == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
+	if strings.TrimSpace(req.Title) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Form title is required",
 		})
 	}
 
-	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
-	if err != nil {
+	if err := normalizeFormLabels(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
+			"error": err.Error(),
 		})
 	}
 
-	var req models.FormRequest
-	if err := c.BodyParser(&req); err != nil {
+	if req.Status != "" && req.Status != models.FormStatusDraft && req.Status != models.FormStatusPublished {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
+			"error": "Status must be draft or published",
 		})
 	}
 
-	if strings.TrimSpace(req.Title) == "" {
+	// Writes must name the revision they were based on, so they cannot silently
+	// overwrite changes made since
+	if c.Get(fiber.HeaderIfMatch) == "" {
+		return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+			"error": "If-Match header with the form's ETag is required",
+		})
+	}
+	revision, ok := parseFormETag(c.Get(fiber.HeaderIfMatch))
+	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Form title is required",
+			"error": "Invalid If-Match header",
 		})
 	}
 
-	form, err := h.formService.UpdateForm(userID, formID, req)
+	status := req.Status
+	if status == "" {
+		status = existingForm.Status
+	}
+	if ok, errResponse := checkPublishable(c, status, req.Fields); !ok {
+		return errResponse
+	}
+
+	form, err := h.formService.UpdateForm(existingForm.ID, req, revision)
+	if errors.Is(err, services.ErrStaleRevision) {
+		return staleFormResponse(c, form)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update form",
@@ -205,7 +219,10 @@ func (h *FormHandler) UpdateForm(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(form.ToResponse())
+	h.formUpdated(existingForm, form)
+
+	setFormETag(c, form)
+	return c.JSON(editorResponse(form))
 }
 
 // GetPublicForm retrieves a form by share URL (no auth required)
@@ -241,7 +258,7 @@ func (h *FormHandler) GetPublicForm(c *fiber.Ctx) error {
 	}
 
 	log.Printf("Form found successfully: %s", form.Title)
-	return c.JSON(form.ToResponse())
+	return c.JSON(form.ToPublicResponse())
 }
 
 // SubmitPublicFormResponse handles form submissions (no auth required)
@@ -268,6 +285,20 @@ func (h *FormHandler) SubmitPublicFormResponse(c *fiber.Ctx) error {
 
 	log.Printf("✅ Form found: %s", form.Title)
 
+	// The same schema is served to integrators, so they cannot drift apart
+	var body interface{}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if problems := services.FormResponseSchema(form).Validate(body); len(problems) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":    "Response does not match the form",
+			"problems": problems,
+		})
+	}
+
 	var req models.FormResponseRequest
 	if err := c.BodyParser(&req); err != nil {
 		log.Printf("❌ Failed to parse request body: %v", err)
@@ -276,12 +307,10 @@ func (h *FormHandler) SubmitPublicFormResponse(c *fiber.Ctx) error {
 		})
 	}
 
-	log.Printf("📋 Request body parsed, responses: %+v", req.Responses)
-
 	ipAddress := c.IP()
 	userAgent := c.Get("User-Agent")
 
-	response, err := h.responseService.CreateResponse(form.ID, req, ipAddress, userAgent)
+	response, err := h.responseService.CreateResponse(form, req, ipAddress, userAgent)
 	if err != nil {
 		log.Printf("❌ Failed to save response: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -291,16 +320,12 @@ func (h *FormHandler) SubmitPublicFormResponse(c *fiber.Ctx) error {
 
 	log.Printf("✅ Response saved successfully with ID: %s", response.ID.Hex())
 
-	if h.wsService != nil {
-		go func() {
-			analytics, err := h.responseService.GetFormAnalytics(form)
-			if err != nil {
-				log.Printf("❌ Failed to generate analytics for broadcast: %v", err)
-				return
-			}
-			h.wsService.BroadcastNewResponse(form.ID, analytics)
-		}()
-	}
+	h.publish(services.BrokerEvent{
+		Type:     services.EventResponseCreated,
+		FormID:   form.ID,
+		Form:     form,
+		Response: response,
+	})
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message":     "Response submitted successfully",
@@ -309,49 +334,404 @@ func (h *FormHandler) SubmitPublicFormResponse(c *fiber.Ctx) error {
 	})
 }
 
+// RecordPublicFormView records a visit of a shared form and returns the
+// session ID to send with the started event and the submission (no auth required)
+func (h *FormHandler) RecordPublicFormView(c *fiber.Ctx) error {
+	form, err := h.formService.GetFormByShareURL(c.Params("shareUrl"))
+	if err != nil || form == nil || form.Status != models.FormStatusPublished {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Form not found",
+		})
+	}
+
+	session, err := h.responseService.RecordView(form)
+	if err != nil {
+		log.Printf("❌ Failed to record view for form %s: %v", form.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record view",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"session_id": session.ID.Hex(),
+	})
+}
+
+// RecordPublicFormStart records that a respondent started filling a shared
+// form, and the last field they answered when field_id is set (no auth required)
+func (h *FormHandler) RecordPublicFormStart(c *fiber.Ctx) error {
+	form, err := h.formService.GetFormByShareURL(c.Params("shareUrl"))
+	if err != nil || form == nil || form.Status != models.FormStatusPublished {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Form not found",
+		})
+	}
+
+	var req models.SessionEventRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.responseService.RecordStart(form, req); err != nil {
+		switch {
+		case errors.Is(err, services.ErrSessionNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Session not found",
+			})
+		case errors.Is(err, services.ErrInvalidSessionField):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Printf("❌ Failed to record start for form %s: %v", form.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record start",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 // GetFormAnalytics returns analytics data for a form
 func (h *FormHandler) GetFormAnalytics(c *fiber.Ctx) error {
-	formIDStr := c.Params("id")
-	formID, err := primitive.ObjectIDFromHex(formIDStr)
+	form := requestForm(c)
+
+	query, err := parseAnalyticsQuery(c)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid form ID",
+			"error": err.Error(),
 		})
 	}
 
-	userIDStr := c.Locals("userID")
-	if userIDStr == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
+	analytics, err := h.responseService.GetFormAnalytics(form, query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate analytics",
 		})
 	}
 
-	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
+	return c.JSON(analytics)
+}
+
+// GetFormCrossTab pivots the answers of one choice field against another
+func (h *FormHandler) GetFormCrossTab(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	rowFieldID := c.Query("row")
+	columnFieldID := c.Query("column")
+	if rowFieldID == "" || columnFieldID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Both row and column field IDs are required",
+		})
+	}
+
+	query, err := parseAnalyticsQuery(c)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
+			"error": err.Error(),
 		})
 	}
 
-	form, err := h.formService.GetUserFormByID(userID, formID)
+	crossTab, err := h.responseService.GetCrossTab(form, rowFieldID, columnFieldID, query)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve form",
+			"error": "Failed to generate cross-tabulation",
 		})
 	}
 
-	if form == nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Form not found",
+	return c.JSON(crossTab)
+}
+
+// GetFormTextSentiment lists the answers of a text field ordered by sentiment
+func (h *FormHandler) GetFormTextSentiment(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	fieldID := c.Query("field")
+	if fieldID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Field ID is required",
 		})
 	}
 
-	analytics, err := h.responseService.GetFormAnalytics(form)
+	query, err := parseAnalyticsQuery(c)
 	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	responses, err := h.responseService.GetTextResponses(form, fieldID, c.Query("sentiment"), c.QueryInt("limit", 20), query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate analytics",
+			"error": "Failed to retrieve text responses",
 		})
 	}
 
-	return c.JSON(analytics)
+	return c.JSON(fiber.Map{
+		"field_id":  fieldID,
+		"responses": responses,
+	})
+}
+
+// GetFormTimeSeries returns responses over time for a form. Buckets are always
+// in the owner's timezone, the one live time_series_update events use.
+func (h *FormHandler) GetFormTimeSeries(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	timezone, err := h.userService.FormTimezone(form)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate time series",
+		})
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate time series",
+		})
+	}
+
+	query := models.TimeSeriesQuery{
+		Interval: models.TimeSeriesInterval(c.Query("interval", string(models.TimeSeriesDay))),
+		Timezone: timezone,
+	}
+
+	if query.From, err = parseTimeQuery(c.Query("from"), loc); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid from date",
+		})
+	}
+	if query.To, err = parseTimeQuery(c.Query("to"), loc); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid to date",
+		})
+	}
+
+	series, err := h.responseService.GetFormTimeSeries(form, query)
+	if err != nil {
+		if err == services.ErrInvalidTimeSeriesInterval || err == services.ErrTimeSeriesTooLarge {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate time series",
+		})
+	}
+
+	return c.JSON(series)
+}
+
+// streamHeartbeatInterval keeps proxies from closing idle event streams and
+// detects clients that went away
+const streamHeartbeatInterval = 15 * time.Second
+
+// StreamFormAnalytics streams real-time analytics as Server-Sent Events, for
+// clients behind proxies that break WebSocket upgrades. Events are the same as
+// over WebSockets. A reconnecting EventSource sends Last-Event-ID and gets the
+// events it missed, or a resync event when they are no longer buffered. The
+// stream ends when the token expires or the user loses access to the form.
+func (h *FormHandler) StreamFormAnalytics(c *fiber.Ctx) error {
+	form := requestForm(c)
+	userID, _ := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+
+	sub, replay, resync, err := h.streams.Subscribe(form.ID, userID, c.Get("Last-Event-ID"))
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Server is shutting down",
+		})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// The writer runs after the handler returns, so it must not use c or strings from it
+	formIDHex := form.ID.Hex()
+	expiresAt, expires := c.Locals("tokenExpiresAt").(time.Time)
+	log.Printf("📡 Event stream opened for form: %s", formIDHex)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer func() {
+			h.streams.Unsubscribe(sub)
+			log.Printf("📡❌ Event stream closed for form: %s", formIDHex)
+		}()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if resync {
+			fmt.Fprintf(w, "event: resync\ndata: {\"form_id\":%q}\n\n", formIDHex)
+		}
+		for _, event := range replay {
+			writeStreamEvent(w, event)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		// The stream ends with the token, and the client reconnects with a new one
+		var expired <-chan time.Time
+		if expires {
+			expiry := time.NewTimer(time.Until(expiresAt))
+			defer expiry.Stop()
+			expired = expiry.C
+		}
+
+		for {
+			select {
+			case event := <-sub.Events:
+				writeStreamEvent(w, event)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case <-sub.Done:
+				return
+			case <-expired:
+				return
+			}
+			// A failed flush means the client disconnected
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeStreamEvent writes an event in the text/event-stream format. Data is
+// single-line JSON, so it needs no splitting across data lines.
+func writeStreamEvent(w *bufio.Writer, event services.StreamEvent) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
+
+// requestTimezone returns the timezone passed as tz, defaulting to the current user's
+func requestTimezone(c *fiber.Ctx) string {
+	if timezone := c.Query("tz"); timezone != "" {
+		return timezone
+	}
+	if user, ok := c.Locals("user").(*models.User); ok {
+		return user.TimezoneOrDefault()
+	}
+	return "UTC"
+}
+
+// parseAnalyticsQuery reads segment filters and a date range from the query string.
+// Filters use field:op:value, e.g. filter=plan:eq:Enterprise or filter=seats:in:10|50,
+// and may be repeated. Dates without a time are read in the request timezone.
+func parseAnalyticsQuery(c *fiber.Ctx) (models.AnalyticsQuery, error) {
+	var query models.AnalyticsQuery
+
+	loc, err := time.LoadLocation(requestTimezone(c))
+	if err != nil {
+		return query, errors.New("Invalid timezone")
+	}
+
+	if query.From, err = parseTimeQuery(c.Query("from"), loc); err != nil {
+		return query, errors.New("Invalid from date")
+	}
+	if query.To, err = parseTimeQuery(c.Query("to"), loc); err != nil {
+		return query, errors.New("Invalid to date")
+	}
+
+	for _, raw := range c.Context().QueryArgs().PeekMulti("filter") {
+		parts := strings.SplitN(string(raw), ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return query, fmt.Errorf("Invalid filter %q, expected field:op:value", string(raw))
+		}
+
+		filter := models.AnalyticsFilter{
+			FieldID:  parts[0],
+			Operator: models.FilterOperator(parts[1]),
+			Values:   []string{parts[2]},
+		}
+		if filter.Operator == models.FilterIn {
+			filter.Values = strings.Split(parts[2], "|")
+		}
+		query.Filters = append(query.Filters, filter)
+	}
+
+	return query, nil
+}
+
+// parseTimeQuery parses an RFC 3339 timestamp or a YYYY-MM-DD date in the given location
+func parseTimeQuery(value string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// setFormETag identifies the form's revision, for If-Match on later writes
+func setFormETag(c *fiber.Ctx, form *models.Form) {
+	c.Set(fiber.HeaderETag, `"`+strconv.FormatInt(form.Revision, 10)+`"`)
+}
+
+// parseFormETag returns the revision of an ETag set by setFormETag. If-Match
+// compares ETags strongly (RFC 9110), so weak ones are refused.
+func parseFormETag(etag string) (int64, bool) {
+	etag = strings.TrimSpace(etag)
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, false
+	}
+	revision, err := strconv.ParseInt(etag[1:len(etag)-1], 10, 64)
+	if err != nil || revision < 0 {
+		return 0, false
+	}
+	return revision, true
+}
+
+// fieldTypesChanged reports whether any field kept its ID but changed its type
+func fieldTypesChanged(before, after *models.Form) bool {
+	types := make(map[string]models.FieldType)
+	for _, field := range before.Fields {
+		types[field.ID] = field.Type
+	}
+
+	for _, field := range after.Fields {
+		if previous, exists := types[field.ID]; exists && previous != field.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publish sends a real-time event, which only logs on failure since the
+// change it describes is already saved
+func (h *FormHandler) publish(event services.BrokerEvent) {
+	if h.broker == nil {
+		return
+	}
+	if err := h.broker.Publish(event); err != nil {
+		log.Printf("❌ Failed to publish %s event for form %s: %v", event.Type, event.FormID.Hex(), err)
+	}
 }
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"dune-takehome-server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseFormETag(t *testing.T) {
+	tests := []struct {
+		etag     string
+		revision int64
+		ok       bool
+	}{
+		{`"3"`, 3, true},
+		{`W/"3"`, 0, false},
+		{` "12" `, 12, true},
+		{`"0"`, 0, true},
+		{`3`, 0, false},
+		{`W/3`, 0, false},
+		{`"-1"`, 0, false},
+		{`"three"`, 0, false},
+		{`""`, 0, false},
+		{`"`, 0, false},
+		{``, 0, false},
+		{`"3`, 0, false},
+		{`"9223372036854775808"`, 0, false},
+	}
+	for _, test := range tests {
+		revision, ok := parseFormETag(test.etag)
+		if revision != test.revision || ok != test.ok {
+			t.Errorf("parseFormETag(%q) = %v, %v, want %v, %v", test.etag, revision, ok, test.revision, test.ok)
+		}
+	}
+}
+
+func TestSetFormETag(t *testing.T) {
+	for _, revision := range []int64{0, 1, 42} {
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			setFormETag(c, &models.Form{Revision: revision})
+			return nil
+		})
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		etag := resp.Header.Get(fiber.HeaderETag)
+		if got, ok := parseFormETag(etag); !ok || got != revision {
+			t.Errorf("revision %d: ETag %q parses to %v, %v", revision, etag, got, ok)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LintForm lists the errors and warnings found in a form's fields
+func (h *FormHandler) LintForm(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	setFormETag(c, form)
+	return c.JSON(services.LintForm(form.Fields))
+}
+
+// LintFormRequest lints the fields of a form as sent to create or update it,
+// without saving it, so builders can show problems while editing
+func (h *FormHandler) LintFormRequest(c *fiber.Ctx) error {
+	var req models.FormRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	return c.JSON(services.LintForm(req.Fields))
+}
+
+// editorResponse is a form as sent to its editors, with what linting it found
+func editorResponse(form *models.Form) models.FormResponse {
+	response := form.ToResponse()
+	if lint := services.LintForm(form.Fields); !lint.IsEmpty() {
+		response.Lint = &lint
+	}
+	return response
+}
+
+// checkPublishable refuses a write that would leave a form published while
+// its fields have lint errors. When refused, the error response is already
+// sent and false is returned.
+func checkPublishable(c *fiber.Ctx, status models.FormStatus, fields []models.FormField) (bool, error) {
+	if status != models.FormStatusPublished {
+		return true, nil
+	}
+	lint := services.LintForm(fields)
+	if !lint.HasErrors() {
+		return true, nil
+	}
+	return false, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error": "Fix the form's errors before publishing it",
+		"lint":  lint,
+	})
+}
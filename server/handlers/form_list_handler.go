@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetUserForms retrieves a page of the forms of the authenticated user's
+// workspaces and those shared with them, or only the forms of the workspace
+// given as workspace_id. Forms can be narrowed by status, folder and tag,
+// searched with q, and ordered with sort and order. A response with a
+// next_cursor has more forms, which are requested with cursor.
+func (h *FormHandler) GetUserForms(c *fiber.Ctx) error {
+	scope, errResponse := h.formScope(c)
+	if scope == nil {
+		return errResponse
+	}
+
+	query := models.FormListQuery{
+		Tag:    strings.TrimSpace(c.Query("tag")),
+		Search: strings.TrimSpace(c.Query("q")),
+		Sort:   models.FormSort(c.Query("sort")),
+		Limit:  c.QueryInt("limit", services.DefaultFormPageSize),
+		Cursor: c.Query("cursor"),
+	}
+
+	// Check for status filter
+	if statusQuery := c.Query("status"); statusQuery != "" {
+		status := models.FormStatus(statusQuery)
+		query.Status = &status
+	}
+
+	// folder= with no value lists the forms in no folder
+	if c.Context().QueryArgs().Has("folder") {
+		folder, err := services.NormalizeFolder(c.Query("folder"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		query.Folder = &folder
+	}
+
+	// Best matches first when searching, otherwise the most recently updated
+	if query.Sort == "" {
+		query.Sort = models.FormSortUpdated
+		if query.Search != "" {
+			query.Sort = models.FormSortRelevance
+		}
+	}
+
+	// Dates newest first and titles A to Z unless asked otherwise
+	switch c.Query("order") {
+	case "asc":
+	case "desc":
+		query.Descending = true
+	case "":
+		query.Descending = query.Sort == models.FormSortUpdated || query.Sort == models.FormSortCreated
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Order must be asc or desc",
+		})
+	}
+
+	forms, nextCursor, err := h.formService.GetUserForms(*scope, query)
+	if errors.Is(err, services.ErrInvalidFormQuery) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve forms",
+		})
+	}
+
+	// Convert to response format
+	var formResponses []models.FormResponse
+	for _, form := range forms {
+		formResponses = append(formResponses, form.ToResponse())
+	}
+
+	response := fiber.Map{
+		"forms": formResponses,
+		"count": len(formResponses),
+	}
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
+	}
+	return c.JSON(response)
+}
+
+// GetFormFolders lists the folders of the forms the user can list, each with
+// the number of forms in it and its subfolders
+func (h *FormHandler) GetFormFolders(c *fiber.Ctx) error {
+	return h.formLabels(c, "folder", "folders")
+}
+
+// GetFormTags lists the tags of the forms the user can list, each with the
+// number of forms carrying it
+func (h *FormHandler) GetFormTags(c *fiber.Ctx) error {
+	return h.formLabels(c, "tags", "tags")
+}
+
+func (h *FormHandler) formLabels(c *fiber.Ctx, label, key string) error {
+	scope, errResponse := h.formScope(c)
+	if scope == nil {
+		return errResponse
+	}
+
+	counts, err := h.formService.CountFormLabels(*scope, label)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve " + key,
+		})
+	}
+
+	return c.JSON(fiber.Map{key: counts})
+}
+
+// formScope resolves the forms the authenticated user can list: those of
+// their workspaces, or of the one given as workspace_id, and those shared with
+// them unless a workspace is given. When it cannot, the error response is
+// already sent and the returned scope is nil.
+func (h *FormHandler) formScope(c *fiber.Ctx) (*services.FormScope, error) {
+	// Get user ID from auth middleware
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return nil, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	workspaces, err := h.workspaceService.GetUserWorkspaces(userID)
+	if err == nil && len(workspaces) == 0 {
+		// Users registered before workspaces existed get theirs on first use
+		var workspace *models.Workspace
+		if workspace, err = h.workspaceService.EnsurePersonalWorkspace(userID); err == nil {
+			workspaces = []*models.Workspace{workspace}
+		}
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve forms",
+		})
+	}
+
+	workspaceFilter := c.Query("workspace_id")
+	scope := &services.FormScope{UserID: userID, Shared: workspaceFilter == ""}
+	for _, workspace := range workspaces {
+		if workspaceFilter == "" || workspaceFilter == workspace.ID.Hex() {
+			scope.WorkspaceIDs = append(scope.WorkspaceIDs, workspace.ID)
+		}
+	}
+	if len(scope.WorkspaceIDs) == 0 {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Workspace not found",
+		})
+	}
+
+	return scope, nil
+}
+
+// normalizeFormLabels cleans up the folder and tags of a form request
+func normalizeFormLabels(req *models.FormRequest) error {
+	if req.Folder != nil {
+		folder, err := services.NormalizeFolder(*req.Folder)
+		if err != nil {
+			return err
+		}
+		req.Folder = &folder
+	}
+	if req.Tags != nil {
+		tags, err := services.NormalizeTags(req.Tags)
+		if err != nil {
+			return err
+		}
+		req.Tags = tags
+	}
+	return nil
+}
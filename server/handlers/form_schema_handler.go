@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPublicFormSchema sends the JSON Schema of submissions to a shared form,
+// which submissions are validated against (no auth required)
+func (h *FormHandler) GetPublicFormSchema(c *fiber.Ctx) error {
+	form, errResponse := h.publishedForm(c)
+	if form == nil {
+		return errResponse
+	}
+
+	return c.JSON(services.FormResponseSchema(form), "application/schema+json")
+}
+
+// GetPublicFormOpenAPI sends an OpenAPI document describing how to submit
+// responses to a shared form (no auth required)
+func (h *FormHandler) GetPublicFormOpenAPI(c *fiber.Ctx) error {
+	form, errResponse := h.publishedForm(c)
+	if form == nil {
+		return errResponse
+	}
+
+	return c.JSON(services.FormOpenAPI(form, c.BaseURL()+"/api/v1"))
+}
+
+// publishedForm loads the published form of the shareUrl param. When there is
+// none, the error response is already sent and the returned form is nil.
+func (h *FormHandler) publishedForm(c *fiber.Ctx) (*models.Form, error) {
+	form, err := h.formService.GetFormByShareURL(c.Params("shareUrl"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve form",
+		})
+	}
+	if form == nil || form.Status != models.FormStatusPublished {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Form not found",
+		})
+	}
+	return form, nil
+}
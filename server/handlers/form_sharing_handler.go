@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InviteFormCollaborator shares a form with a user by email, as an editor,
+// analyst or viewer. They do not need to be registered yet, and get access
+// once they accept the invitation.
+func (h *FormHandler) InviteFormCollaborator(c *fiber.Ctx) error {
+	form := requestForm(c)
+	user := c.Locals("user").(*models.User)
+
+	var req models.CollaboratorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !strings.Contains(req.Email, "@") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A valid email is required",
+		})
+	}
+	if !validCollaboratorRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be editor, analyst or viewer",
+		})
+	}
+
+	invitee, err := h.userService.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to share form",
+		})
+	}
+	if invitee != nil && invitee.ID == form.UserID {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": services.ErrAlreadyOwner.Error(),
+		})
+	}
+
+	updated, err := h.formService.InviteCollaborator(form, user.ID, req.Email, req.Role)
+	if err != nil {
+		return sharingErrorResponse(c, err, "Failed to share form")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(updated.ToResponse())
+}
+
+// UpdateFormCollaborator changes a collaborator's role
+func (h *FormHandler) UpdateFormCollaborator(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	collaboratorID, err := primitive.ObjectIDFromHex(c.Params("collaboratorId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid collaborator ID",
+		})
+	}
+
+	var req models.CollaboratorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !validCollaboratorRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be editor, analyst or viewer",
+		})
+	}
+
+	updated, err := h.formService.UpdateCollaboratorRole(form.ID, collaboratorID, req.Role)
+	if err != nil {
+		return sharingErrorResponse(c, err, "Failed to update collaborator")
+	}
+	h.accessChanged(form)
+
+	return c.JSON(updated.ToResponse())
+}
+
+// RemoveFormCollaborator stops sharing a form with a collaborator. Owners may
+// remove anyone and collaborators may leave.
+func (h *FormHandler) RemoveFormCollaborator(c *fiber.Ctx) error {
+	form := requestForm(c)
+	role, _ := c.Locals("formRole").(models.WorkspaceRole)
+	user := c.Locals("user").(*models.User)
+
+	collaboratorID, err := primitive.ObjectIDFromHex(c.Params("collaboratorId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid collaborator ID",
+		})
+	}
+
+	if !role.Can(models.PermissionManageForm) {
+		self := false
+		for _, collaborator := range form.Collaborators {
+			if collaborator.ID == collaboratorID && collaborator.UserID == user.ID {
+				self = true
+			}
+		}
+		if !self {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only owners can remove other collaborators",
+			})
+		}
+	}
+
+	if _, err := h.formService.RemoveCollaborator(form.ID, collaboratorID); err != nil {
+		return sharingErrorResponse(c, err, "Failed to remove collaborator")
+	}
+	h.accessChanged(form)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// TransferFormOwnership gives a form to another registered user, moving it to
+// their personal workspace. With keep_access, the previous owner stays on the
+// form as an editor.
+func (h *FormHandler) TransferFormOwnership(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	var req models.OwnershipTransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	newOwner, err := h.userService.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to transfer form",
+		})
+	}
+	if newOwner == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No user with this email",
+		})
+	}
+
+	workspace, err := h.workspaceService.EnsurePersonalWorkspace(newOwner.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to transfer form",
+		})
+	}
+
+	var previousOwner *models.User
+	if req.KeepAccess {
+		if previousOwner, err = h.userService.GetUserByID(form.UserID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to transfer form",
+			})
+		}
+	}
+
+	updated, err := h.formService.TransferOwnership(form, newOwner, workspace.ID, previousOwner)
+	if err != nil {
+		return sharingErrorResponse(c, err, "Failed to transfer form")
+	}
+	h.accessChanged(form)
+
+	return c.JSON(updated.ToResponse())
+}
+
+// GetInvitations lists the pending invitations to collaborate on forms sent
+// to the authenticated user's email
+func (h *FormHandler) GetInvitations(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	forms, err := h.formService.GetPendingInvitations(user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve invitations",
+		})
+	}
+
+	invitations := make([]models.InvitationResponse, 0, len(forms))
+	for _, form := range forms {
+		for _, collaborator := range form.Collaborators {
+			if collaborator.Accepted() || !strings.EqualFold(collaborator.Email, user.Email) {
+				continue
+			}
+			invitation := models.InvitationResponse{
+				FormID:    form.ID,
+				FormTitle: form.Title,
+				Role:      collaborator.Role,
+				InvitedAt: collaborator.InvitedAt,
+			}
+			if inviter, err := h.userService.GetUserByID(collaborator.InvitedBy); err == nil && inviter != nil {
+				invitation.InvitedBy = inviter.Name
+			}
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"invitations": invitations,
+		"count":       len(invitations),
+	})
+}
+
+// AcceptInvitation gives the authenticated user access to a form they were invited to
+func (h *FormHandler) AcceptInvitation(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	formID, err := primitive.ObjectIDFromHex(c.Params("formId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid form ID",
+		})
+	}
+
+	form, err := h.formService.AcceptInvitation(formID, user.ID, user.Email)
+	if err != nil {
+		return sharingErrorResponse(c, err, "Failed to accept invitation")
+	}
+
+	setFormETag(c, form)
+	return c.JSON(form.ToResponse())
+}
+
+// DeclineInvitation removes an invitation sent to the authenticated user
+func (h *FormHandler) DeclineInvitation(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	formID, err := primitive.ObjectIDFromHex(c.Params("formId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid form ID",
+		})
+	}
+
+	if err := h.formService.DeclineInvitation(formID, user.Email); err != nil {
+		return sharingErrorResponse(c, err, "Failed to decline invitation")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// accessChanged tells real-time services to check their subscriptions to a
+// form again, since its sharing or owner changed
+func (h *FormHandler) accessChanged(form *models.Form) {
+	h.publish(services.BrokerEvent{Type: services.EventAccessChanged, FormID: form.ID})
+}
+
+// validCollaboratorRole reports whether a form can be shared with a role.
+// Owning a form is only possible through its workspace or a transfer.
+func validCollaboratorRole(role models.WorkspaceRole) bool {
+	return role.Valid() && role != models.RoleOwner
+}
+
+// sharingErrorResponse sends the response for an error changing who has access to a form
+func sharingErrorResponse(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrCollaboratorNotFound), errors.Is(err, services.ErrInvitationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrCollaboratorExists), errors.Is(err, services.ErrAlreadyOwner), errors.Is(err, services.ErrOwnerChanged):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DuplicateForm creates a draft copy of a form, in the workspace given as
+// workspace_id or the user's personal workspace. The copy's fields get fresh
+// IDs, and it is neither published nor shared with anyone.
+func (h *FormHandler) DuplicateForm(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	req, ok := parseFormCopyRequest(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	folder := form.Folder
+	return h.createFormCopy(c, req, models.FormRequest{
+		Title:       fmt.Sprintf("Copy of %s", form.Title),
+		Description: form.Description,
+		Fields:      services.CopyFields(form.Fields, true),
+		Folder:      &folder,
+		Tags:        form.Tags,
+	})
+}
+
+// SaveFormAsTemplate saves a form's definition as a private template, or as a
+// template of its workspace, which the user must be able to edit forms of
+func (h *FormHandler) SaveFormAsTemplate(c *fiber.Ctx) error {
+	form := requestForm(c)
+	user := c.Locals("user").(*models.User)
+
+	var req models.TemplateRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	switch req.Visibility {
+	case "":
+		req.Visibility = models.TemplateVisibilityPrivate
+	case models.TemplateVisibilityPrivate:
+	case models.TemplateVisibilityWorkspace:
+		if form.WorkspaceID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Form is not in a workspace",
+			})
+		}
+		// Collaborators can see the form without being members of its workspace
+		workspace, _, err := h.authorization.AuthorizeWorkspace(user.ID, form.WorkspaceID, models.PermissionEditForm)
+		if errors.Is(err, services.ErrForbidden) || (err == nil && workspace == nil) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only editors of the form's workspace can save workspace templates",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save template",
+			})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Visibility must be private or workspace",
+		})
+	}
+
+	if strings.TrimSpace(req.Title) == "" {
+		req.Title = form.Title
+	}
+	if req.Description == "" {
+		req.Description = form.Description
+	}
+
+	template, err := h.templateService.CreateTemplate(user.ID, form, req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save template",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(template.ToResponse())
+}
+
+// GetTemplates lists the templates the authenticated user can create forms
+// from: the built-in ones, their private ones and those of their workspaces
+func (h *FormHandler) GetTemplates(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	workspaces, err := h.workspaceService.GetUserWorkspaces(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve templates",
+		})
+	}
+	workspaceIDs := make([]primitive.ObjectID, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		workspaceIDs = append(workspaceIDs, workspace.ID)
+	}
+
+	templates, err := h.templateService.GetTemplates(user.ID, workspaceIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve templates",
+		})
+	}
+
+	templateResponses := make([]models.TemplateResponse, 0, len(templates))
+	for _, template := range templates {
+		templateResponses = append(templateResponses, template.ToResponse())
+	}
+
+	return c.JSON(fiber.Map{
+		"templates": templateResponses,
+		"count":     len(templateResponses),
+	})
+}
+
+// GetTemplate retrieves a specific template
+func (h *FormHandler) GetTemplate(c *fiber.Ctx) error {
+	template := c.Locals("template").(*models.FormTemplate)
+
+	return c.JSON(template.ToResponse())
+}
+
+// DeleteTemplate deletes a saved template. Built-in templates cannot be deleted.
+func (h *FormHandler) DeleteTemplate(c *fiber.Ctx) error {
+	template := c.Locals("template").(*models.FormTemplate)
+
+	if err := h.templateService.DeleteTemplate(template.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete template",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateFormFromTemplate creates a draft form with a template's definition, in
+// the workspace given as workspace_id or the user's personal workspace
+func (h *FormHandler) CreateFormFromTemplate(c *fiber.Ctx) error {
+	template := c.Locals("template").(*models.FormTemplate)
+
+	req, ok := parseFormCopyRequest(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	return h.createFormCopy(c, req, models.FormRequest{
+		Title:       template.Title,
+		Description: template.Description,
+		Fields:      services.CopyFields(template.Fields, false),
+		Tags:        template.Tags,
+	})
+}
+
+// createFormCopy creates a draft form from a copied definition, with the title,
+// folder and workspace of the request when given
+func (h *FormHandler) createFormCopy(c *fiber.Ctx, req models.FormCopyRequest, form models.FormRequest) error {
+	user := c.Locals("user").(*models.User)
+
+	if strings.TrimSpace(req.Title) != "" {
+		form.Title = req.Title
+	}
+	if req.Folder != nil {
+		form.Folder = req.Folder
+	}
+	form.Status = models.FormStatusDraft
+
+	if err := normalizeFormLabels(&form); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	workspaceID, errResponse := h.targetWorkspace(c, user.ID, req.WorkspaceID)
+	if workspaceID.IsZero() {
+		return errResponse
+	}
+
+	created, err := h.formService.CreateForm(user.ID, workspaceID, form)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create form",
+		})
+	}
+
+	setFormETag(c, created)
+	return c.Status(fiber.StatusCreated).JSON(editorResponse(created))
+}
+
+// parseFormCopyRequest parses the optional body of a request to copy a form
+func parseFormCopyRequest(c *fiber.Ctx) (models.FormCopyRequest, bool) {
+	var req models.FormCopyRequest
+	if len(c.Body()) == 0 {
+		return req, true
+	}
+	err := c.BodyParser(&req)
+	return req, err == nil
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImportResponses imports responses from a CSV file sent as the multipart
+// field file, read with the JSON import options in the field options. It only
+// reports which rows would be imported and why the others are rejected, unless
+// commit=true is given. Committed imports of more than a few rows run in the
+// background; their job is returned to be followed.
+func (h *FormHandler) ImportResponses(c *fiber.Ctx) error {
+	form := requestForm(c)
+	user := c.Locals("user").(*models.User)
+
+	var opts models.ResponseImportOptions
+	if raw := c.FormValue("options"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid import options",
+			})
+		}
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Send the CSV file as the multipart field file",
+		})
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read the file",
+		})
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read the file",
+		})
+	}
+
+	report, responses, err := services.ReadResponseCSV(form, data, opts)
+	if errors.Is(err, services.ErrInvalidImport) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read the file",
+		})
+	}
+
+	if !c.QueryBool("commit") {
+		return c.JSON(report)
+	}
+	if len(responses) == 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":  "No rows can be imported",
+			"report": report,
+		})
+	}
+
+	// Background imports read the file again instead of holding the responses
+	background := len(responses) > services.BackgroundImportRows
+	var upload []byte
+	if background {
+		upload, responses = data, nil
+	}
+	job, err := h.imports.CreateImportJob(form, user.ID, *report, upload)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start import",
+		})
+	}
+
+	if background {
+		accepted := *job // The job changes as it runs
+		go h.runImport(form, job, func() error {
+			return h.imports.RunImportUpload(form, job, opts)
+		})
+		return c.Status(fiber.StatusAccepted).JSON(accepted)
+	}
+
+	if err := h.runImport(form, job, func() error {
+		return h.imports.RunImportJob(form, job, responses)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to import responses",
+			"job":   job,
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(job)
+}
+
+// runImport runs an import, then tells real-time clients once about
+// everything it stored
+func (h *FormHandler) runImport(form *models.Form, job *models.ResponseImportJob, run func() error) error {
+	err := run()
+	if err != nil {
+		log.Printf("❌ Import %s for form %s failed: %v", job.ID.Hex(), form.ID.Hex(), err)
+	}
+	if job.Report.ImportedRows > 0 {
+		h.publish(services.BrokerEvent{
+			Type:   services.EventResponsesImported,
+			FormID: form.ID,
+			Form:   form,
+			Import: job,
+		})
+	}
+	return err
+}
+
+// GetResponseImports lists the imports of responses to a form, without their rejected rows
+func (h *FormHandler) GetResponseImports(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	jobs, err := h.imports.GetImportJobs(form.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch imports",
+		})
+	}
+
+	return c.JSON(jobs)
+}
+
+// GetResponseImport returns an import of responses, to follow one running in the background
+func (h *FormHandler) GetResponseImport(c *fiber.Ctx) error {
+	form := requestForm(c)
+
+	jobID, err := primitive.ObjectIDFromHex(c.Params("importId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid import ID",
+		})
+	}
+
+	job, err := h.imports.GetImportJob(form.ID, jobID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch import",
+		})
+	}
+	if job == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Import not found",
+		})
+	}
+
+	return c.JSON(job)
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"log"
 	"strings"
+	"time"
 
 	"dune-takehome-server/models"
 	"dune-takehome-server/services"
@@ -12,12 +14,14 @@ import (
 )
 
 type UserHandler struct {
-	userService *services.UserService
+	userService      *services.UserService
+	workspaceService *services.WorkspaceService
 }
 
 func NewUserHandler() *UserHandler {
 	return &UserHandler{
-		userService: services.NewUserService(),
+		userService:      services.NewUserService(),
+		workspaceService: services.NewWorkspaceService(),
 	}
 }
 
@@ -49,6 +53,14 @@ func (h *UserHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid timezone",
+			})
+		}
+	}
+
 	// Create user
 	user, err := h.userService.CreateUser(req)
 	if err != nil {
@@ -62,6 +74,11 @@ func (h *UserHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	// Workspaces are also created on first use, so this is not fatal
+	if _, err := h.workspaceService.EnsurePersonalWorkspace(user.ID); err != nil {
+		log.Printf("⚠️ Failed to create personal workspace for user %s: %v", user.ID.Hex(), err)
+	}
+
 	// Generate JWT token
 	token, err := utils.GenerateJWT(user)
 	if err != nil {
@@ -141,3 +158,50 @@ func (h *UserHandler) GetProfile(c *fiber.Ctx) error {
 
 	return c.JSON(user.ToResponse())
 }
+
+// UpdateProfile updates the current user's name and timezone
+func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
+	userID := c.Locals("userID")
+	if userID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req models.ProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid timezone",
+			})
+		}
+	}
+
+	user, err := h.userService.UpdateProfile(objectID, req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update profile",
+		})
+	}
+
+	if user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(user.ToResponse())
+}
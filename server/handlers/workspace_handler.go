@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WorkspaceHandler struct {
+	workspaceService *services.WorkspaceService
+	userService      *services.UserService
+	broker           services.Broker
+}
+
+func NewWorkspaceHandler(broker services.Broker) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceService: services.NewWorkspaceService(),
+		userService:      services.NewUserService(),
+		broker:           broker,
+	}
+}
+
+// GetUserWorkspaces lists the workspaces the authenticated user is a member of
+func (h *WorkspaceHandler) GetUserWorkspaces(c *fiber.Ctx) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if _, err := h.workspaceService.EnsurePersonalWorkspace(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve workspaces",
+		})
+	}
+
+	workspaces, err := h.workspaceService.GetUserWorkspaces(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve workspaces",
+		})
+	}
+
+	workspaceResponses := make([]models.WorkspaceResponse, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		workspaceResponses = append(workspaceResponses, h.workspaceResponse(workspace, workspace.MemberRole(userID)))
+	}
+
+	return c.JSON(fiber.Map{
+		"workspaces": workspaceResponses,
+		"count":      len(workspaceResponses),
+	})
+}
+
+// CreateWorkspace creates a shared workspace owned by the authenticated user
+func (h *WorkspaceHandler) CreateWorkspace(c *fiber.Ctx) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req models.WorkspaceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Workspace name is required",
+		})
+	}
+
+	workspace, err := h.workspaceService.CreateWorkspace(userID, req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create workspace",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(h.workspaceResponse(workspace, models.RoleOwner))
+}
+
+// GetWorkspace returns a workspace and its members
+func (h *WorkspaceHandler) GetWorkspace(c *fiber.Ctx) error {
+	workspace, role := requestWorkspace(c)
+	return c.JSON(h.workspaceResponse(workspace, role))
+}
+
+// UpdateWorkspace renames a workspace
+func (h *WorkspaceHandler) UpdateWorkspace(c *fiber.Ctx) error {
+	workspace, role := requestWorkspace(c)
+
+	var req models.WorkspaceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Workspace name is required",
+		})
+	}
+
+	updated, err := h.workspaceService.RenameWorkspace(workspace.ID, req)
+	if err != nil || updated == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update workspace",
+		})
+	}
+
+	return c.JSON(h.workspaceResponse(updated, role))
+}
+
+// AddWorkspaceMember adds a registered user, found by email, to a workspace
+func (h *WorkspaceHandler) AddWorkspaceMember(c *fiber.Ctx) error {
+	workspace, role := requestWorkspace(c)
+
+	var req models.WorkspaceMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !req.Role.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be owner, editor, analyst or viewer",
+		})
+	}
+
+	user, err := h.userService.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add member",
+		})
+	}
+	if user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No user with this email",
+		})
+	}
+
+	updated, err := h.workspaceService.AddMember(workspace, user.ID, req.Role)
+	if err != nil {
+		return memberErrorResponse(c, err, "Failed to add member")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(h.workspaceResponse(updated, role))
+}
+
+// UpdateWorkspaceMember changes a member's role
+func (h *WorkspaceHandler) UpdateWorkspaceMember(c *fiber.Ctx) error {
+	workspace, _ := requestWorkspace(c)
+
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req models.WorkspaceMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !req.Role.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be owner, editor, analyst or viewer",
+		})
+	}
+
+	updated, err := h.workspaceService.UpdateMemberRole(workspace, memberID, req.Role)
+	if err != nil {
+		return memberErrorResponse(c, err, "Failed to update member")
+	}
+	h.accessChanged(memberID)
+
+	// Owners may change their own role
+	userID, _ := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	return c.JSON(h.workspaceResponse(updated, updated.MemberRole(userID)))
+}
+
+// RemoveWorkspaceMember removes a member from a workspace. Owners may remove
+// anyone and other members may leave.
+func (h *WorkspaceHandler) RemoveWorkspaceMember(c *fiber.Ctx) error {
+	workspace, role := requestWorkspace(c)
+
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if userID, _ := c.Locals("userID").(string); memberID.Hex() != userID && !role.Can(models.PermissionManageWorkspace) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only owners can remove other members",
+		})
+	}
+
+	if _, err := h.workspaceService.RemoveMember(workspace, memberID); err != nil {
+		return memberErrorResponse(c, err, "Failed to remove member")
+	}
+	h.accessChanged(memberID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// accessChanged tells real-time services to check a member's subscriptions
+// again, since their role changed or they left. It only logs on failure since
+// the change itself succeeded.
+func (h *WorkspaceHandler) accessChanged(userID primitive.ObjectID) {
+	if err := h.broker.Publish(services.BrokerEvent{Type: services.EventAccessChanged, UserID: userID}); err != nil {
+		log.Printf("❌ Failed to publish access change of user %s: %v", userID.Hex(), err)
+	}
+}
+
+// workspaceResponse converts a workspace for responses, along with its
+// members' names and emails
+func (h *WorkspaceHandler) workspaceResponse(workspace *models.Workspace, role models.WorkspaceRole) models.WorkspaceResponse {
+	members := make([]models.WorkspaceMemberResponse, 0, len(workspace.Members))
+	for _, member := range workspace.Members {
+		memberResponse := models.WorkspaceMemberResponse{
+			UserID:  member.UserID,
+			Role:    member.Role,
+			AddedAt: member.AddedAt,
+		}
+		if user, err := h.userService.GetUserByID(member.UserID); err == nil && user != nil {
+			memberResponse.Email = user.Email
+			memberResponse.Name = user.Name
+		}
+		members = append(members, memberResponse)
+	}
+
+	return models.WorkspaceResponse{
+		ID:        workspace.ID,
+		Name:      workspace.Name,
+		Personal:  workspace.Personal,
+		Role:      role,
+		Members:   members,
+		CreatedAt: workspace.CreatedAt,
+		UpdatedAt: workspace.UpdatedAt,
+	}
+}
+
+// memberErrorResponse sends the response for an error changing members
+func memberErrorResponse(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrMemberNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrMemberExists), errors.Is(err, services.ErrLastOwner), errors.Is(err, services.ErrPersonalWorkspace):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// requestWorkspace returns the workspace loaded by the middleware.WorkspaceAccess
+// check of the route, along with the user's role in it
+func requestWorkspace(c *fiber.Ctx) (*models.Workspace, models.WorkspaceRole) {
+	workspace := c.Locals("workspace").(*models.Workspace)
+	role, _ := c.Locals("workspaceRole").(models.WorkspaceRole)
+	return workspace, role
+}
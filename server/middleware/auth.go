@@ -12,9 +12,23 @@ import (
 
 // AuthRequired middleware validates JWT token and sets user info in context
 func AuthRequired() fiber.Handler {
+	return authRequired(false)
+}
+
+// EventStreamAuthRequired is AuthRequired for event streams. Browsers cannot
+// set headers on EventSource requests, so the token may come in the query
+// instead. Query tokens end up in access logs, so no other route accepts them.
+func EventStreamAuthRequired() fiber.Handler {
+	return authRequired(true)
+}
+
+func authRequired(queryToken bool) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
+		if authHeader == "" && queryToken && c.Query("token") != "" {
+			authHeader = "Bearer " + c.Query("token")
+		}
 		if authHeader == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Authorization header is required",
@@ -57,6 +71,9 @@ func AuthRequired() fiber.Handler {
 		c.Locals("userID", claims.UserID.Hex())
 		c.Locals("userEmail", claims.Email)
 		c.Locals("user", user)
+		if claims.ExpiresAt != nil {
+			c.Locals("tokenExpiresAt", claims.ExpiresAt.Time)
+		}
 
 		return c.Next()
 	}
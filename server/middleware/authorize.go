@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"errors"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FormAccess middleware loads the form named by the id param when the
+// authenticated user's role grants the permission, and sets it in context as
+// "form" along with the role as "formRole". It must follow AuthRequired.
+func FormAccess(permission models.Permission) fiber.Handler {
+	authorization := services.NewAuthorizationService()
+
+	return func(c *fiber.Ctx) error {
+		formID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid form ID",
+			})
+		}
+
+		userID := GetCurrentUser(c)
+		if userID == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		form, role, err := authorization.AuthorizeForm(*userID, formID, permission)
+		if errors.Is(err, services.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Your role on this form (" + string(role) + ") does not allow this",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to retrieve form",
+			})
+		}
+		if form == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Form not found",
+			})
+		}
+
+		c.Locals("form", form)
+		c.Locals("formRole", role)
+		return c.Next()
+	}
+}
+
+// WorkspaceAccess middleware loads the workspace named by the id param when
+// the authenticated user's role grants the permission, and sets it in context
+// as "workspace" along with the role as "workspaceRole"
+func WorkspaceAccess(permission models.Permission) fiber.Handler {
+	authorization := services.NewAuthorizationService()
+
+	return func(c *fiber.Ctx) error {
+		workspaceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid workspace ID",
+			})
+		}
+
+		userID := GetCurrentUser(c)
+		if userID == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		workspace, role, err := authorization.AuthorizeWorkspace(*userID, workspaceID, permission)
+		if errors.Is(err, services.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Your role in this workspace (" + string(role) + ") does not allow this",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to retrieve workspace",
+			})
+		}
+		if workspace == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Workspace not found",
+			})
+		}
+
+		c.Locals("workspace", workspace)
+		c.Locals("workspaceRole", role)
+		return c.Next()
+	}
+}
+
+// TemplateAccess middleware loads the template named by the id param when the
+// authenticated user's role grants the permission, and sets it in context as
+// "template"
+func TemplateAccess(permission models.Permission) fiber.Handler {
+	authorization := services.NewAuthorizationService()
+
+	return func(c *fiber.Ctx) error {
+		userID := GetCurrentUser(c)
+		if userID == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		template, role, err := authorization.AuthorizeTemplate(*userID, c.Params("id"), permission)
+		if errors.Is(err, services.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Your role on this template (" + string(role) + ") does not allow this",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to retrieve template",
+			})
+		}
+		if template == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Template not found",
+			})
+		}
+
+		c.Locals("template", template)
+		return c.Next()
+	}
+}
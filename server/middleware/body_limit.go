@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit rejects requests whose body is larger than limit bytes, unless
+// allowLarger lets a route take more. The server's own BodyLimit is then the
+// most any route takes, so only the routes allowed it can send that much.
+func BodyLimit(limit int, allowLarger func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(c.Request().Body()) > limit && (allowLarger == nil || !allowLarger(c)) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": fmt.Sprintf("Request body must be at most %d MB", limit/(1024*1024)),
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FormAggregate holds the materialized form-level analytics counters
+type FormAggregate struct {
+	FormID         primitive.ObjectID `json:"form_id" bson:"_id"`
+	TotalResponses int64              `json:"total_responses" bson:"total_responses"`
+	LastResponseAt time.Time          `json:"last_response_at" bson:"last_response_at"`
+	// Responses per client attribute, see ClientInfo
+	Devices          map[string]int64 `json:"devices,omitempty" bson:"devices,omitempty"`
+	Browsers         map[string]int64 `json:"browsers,omitempty" bson:"browsers,omitempty"`
+	OperatingSystems map[string]int64 `json:"operating_systems,omitempty" bson:"operating_systems,omitempty"`
+	Countries        map[string]int64 `json:"countries,omitempty" bson:"countries,omitempty"`
+	// Funnel counters of the form's sessions, see FormSession
+	Views             int64            `json:"views" bson:"views"`
+	Starts            int64            `json:"starts" bson:"starts"`
+	Submissions       int64            `json:"submissions" bson:"submissions"`
+	CompletionSeconds map[string]int64 `json:"completion_seconds,omitempty" bson:"completion_seconds,omitempty"` // Started sessions submitted, per whole seconds taken
+	OpenSessions      map[string]int64 `json:"open_sessions,omitempty" bson:"open_sessions,omitempty"`           // Started sessions not submitted, per last field answered
+	OpenWithoutField  int64            `json:"open_without_field" bson:"open_without_field"`                     // Started sessions not submitted that answered no field
+	UpdatedAt         time.Time        `json:"updated_at" bson:"updated_at"`
+}
+
+// FieldAggregate holds the materialized analytics counters for a single field.
+// Documents are updated with $inc/$min/$max every time a response is stored.
+type FieldAggregate struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FormID        primitive.ObjectID `json:"form_id" bson:"form_id"`
+	FieldID       string             `json:"field_id" bson:"field_id"`
+	FieldType     FieldType          `json:"field_type" bson:"field_type"`
+	AnsweredCount int64              `json:"answered_count" bson:"answered_count"` // Non-empty answers of any shape
+	ValueCount    int64              `json:"value_count" bson:"value_count"`       // Answers that were valid for the field type
+	Sum           float64            `json:"sum" bson:"sum"`
+	Min           *float64           `json:"min,omitempty" bson:"min,omitempty"`
+	Max           *float64           `json:"max,omitempty" bson:"max,omitempty"`
+	TotalLength   int64              `json:"total_length" bson:"total_length"`
+	Distribution  map[string]int64   `json:"distribution,omitempty" bson:"distribution,omitempty"`
+	// Frequency of each numeric value, for medians and percentiles. There is one
+	// per distinct answer, so they are stored as FieldValue documents.
+	ValueCounts map[string]int64 `json:"value_counts,omitempty" bson:"-"`
+	// Text and textarea fields only, counted once per answer. Terms and bigrams
+	// are unbounded, so they are stored as FieldTerm documents and only the most
+	// frequent are loaded.
+	Terms          map[string]int64 `json:"terms,omitempty" bson:"-"`
+	Bigrams        map[string]int64 `json:"bigrams,omitempty" bson:"-"`
+	Languages      map[string]int64 `json:"languages,omitempty" bson:"languages,omitempty"`
+	Sentiments     map[string]int64 `json:"sentiments,omitempty" bson:"sentiments,omitempty"` // Answers per sentiment label
+	SentimentSum   float64          `json:"sentiment_sum" bson:"sentiment_sum"`
+	SentimentCount int64            `json:"sentiment_count" bson:"sentiment_count"` // Answers whose sentiment was scored
+	UpdatedAt      time.Time        `json:"updated_at" bson:"updated_at"`
+}
+
+// TermKind tells single terms and bigrams apart in the field_terms collection
+type TermKind string
+
+const (
+	TermKindTerm   TermKind = "term"
+	TermKindBigram TermKind = "bigram"
+)
+
+// FieldTerm counts the answers of a text field containing a term or bigram
+type FieldTerm struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FormID  primitive.ObjectID `json:"form_id" bson:"form_id"`
+	FieldID string             `json:"field_id" bson:"field_id"`
+	Kind    TermKind           `json:"kind" bson:"kind"`
+	Term    string             `json:"term" bson:"term"`
+	Count   int64              `json:"count" bson:"count"`
+}
+
+// FieldValue counts the answers of a number or rating field with a value
+type FieldValue struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FormID  primitive.ObjectID `json:"form_id" bson:"form_id"`
+	FieldID string             `json:"field_id" bson:"field_id"`
+	Value   float64            `json:"value" bson:"value"`
+	Count   int64              `json:"count" bson:"count"`
+}
+
+// HistogramBin is a half-open [Start, End) range of numeric answers, except
+// for the last bin which also includes End
+type HistogramBin struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Count int64   `json:"count"`
+}
+
+// FieldDelta describes how a single response changes a field's aggregate
+type FieldDelta struct {
+	FieldID  string        `json:"field_id"`
+	Answered bool          `json:"answered"`
+	Counted  bool          `json:"counted"`
+	Value    *float64      `json:"value,omitempty"`   // For number and rating fields
+	Length   int           `json:"length,omitempty"`  // For text fields
+	Options  []string      `json:"options,omitempty"` // Distribution buckets to increment
+	Text     *TextAnalysis `json:"text,omitempty"`    // For text and textarea fields
+}
+
+// AnalyticsDelta describes how a single response changes a form's analytics
+type AnalyticsDelta struct {
+	FormID      primitive.ObjectID `json:"form_id"`
+	ResponseID  primitive.ObjectID `json:"response_id"`
+	SubmittedAt time.Time          `json:"submitted_at"`
+	Client      *ClientInfo        `json:"client,omitempty"`
+	Fields      []FieldDelta       `json:"fields"`
+}
+
+// TimeSeriesInterval is the bucket size of a time series
+type TimeSeriesInterval string
+
+const (
+	TimeSeriesHour TimeSeriesInterval = "hour"
+	TimeSeriesDay  TimeSeriesInterval = "day"
+	TimeSeriesWeek TimeSeriesInterval = "week"
+)
+
+// TimeSeriesQuery holds the options of a time series request
+type TimeSeriesQuery struct {
+	Interval TimeSeriesInterval
+	Timezone string
+	From     *time.Time
+	To       *time.Time
+}
+
+// TimeSeriesBucket holds the responses submitted within one interval
+type TimeSeriesBucket struct {
+	Start      time.Time `json:"start"`
+	Count      int64     `json:"count"`
+	Cumulative int64     `json:"cumulative"`
+}
+
+// TrendPoint holds the average value of a field within one interval
+type TrendPoint struct {
+	Start   time.Time `json:"start"`
+	Average float64   `json:"average"`
+	Count   int64     `json:"count"`
+}
+
+// FieldTrend holds the per-interval averages of a number or rating field
+type FieldTrend struct {
+	FieldID    string       `json:"field_id"`
+	FieldLabel string       `json:"field_label"`
+	FieldType  string       `json:"field_type"`
+	Points     []TrendPoint `json:"points"`
+}
+
+// FormTimeSeries represents responses over time for a form. Heatmap is indexed
+// by day of week (0 = Sunday) and hour of day in the requested timezone.
+type FormTimeSeries struct {
+	FormID      primitive.ObjectID `json:"form_id"`
+	Interval    TimeSeriesInterval `json:"interval"`
+	Timezone    string             `json:"timezone"`
+	Buckets     []TimeSeriesBucket `json:"buckets"`
+	Heatmap     [7][24]int64       `json:"heatmap"`
+	FieldTrends []FieldTrend       `json:"field_trends"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// TimeSeriesUpdate describes the buckets a new response falls into, so live
+// dashboards can increment them without refetching the series
+type TimeSeriesUpdate struct {
+	FormID      primitive.ObjectID               `json:"form_id"`
+	Timezone    string                           `json:"timezone"`
+	Buckets     map[TimeSeriesInterval]time.Time `json:"buckets"`
+	DayOfWeek   int                              `json:"day_of_week"`
+	Hour        int                              `json:"hour"`
+	Values      map[string]float64               `json:"values,omitempty"` // Number and rating values for field trends
+	SubmittedAt time.Time                        `json:"submitted_at"`
+}
+
+// FilterOperator is a comparison used to segment responses
+type FilterOperator string
+
+const (
+	FilterEquals         FilterOperator = "eq"
+	FilterNotEquals      FilterOperator = "ne"
+	FilterIn             FilterOperator = "in"
+	FilterGreaterThan    FilterOperator = "gt"
+	FilterGreaterOrEqual FilterOperator = "gte"
+	FilterLessThan       FilterOperator = "lt"
+	FilterLessOrEqual    FilterOperator = "lte"
+	FilterContains       FilterOperator = "contains"
+)
+
+// AnalyticsFilter restricts analytics to responses whose answer to a field
+// matches the predicate. Checkbox fields match when any selected option does.
+type AnalyticsFilter struct {
+	FieldID  string         `json:"field_id"`
+	Operator FilterOperator `json:"op"`
+	Values   []string       `json:"values"`
+}
+
+// AnalyticsQuery segments analytics by field predicates and a submission date range
+type AnalyticsQuery struct {
+	Filters []AnalyticsFilter `json:"filters,omitempty"`
+	From    *time.Time        `json:"from,omitempty"`
+	To      *time.Time        `json:"to,omitempty"`
+}
+
+// IsEmpty reports whether the query selects every response
+func (q AnalyticsQuery) IsEmpty() bool {
+	return len(q.Filters) == 0 && q.From == nil && q.To == nil
+}
+
+// CrossTabField identifies one side of a cross-tabulation
+type CrossTabField struct {
+	FieldID    string `json:"field_id"`
+	FieldLabel string `json:"field_label"`
+	FieldType  string `json:"field_type"`
+}
+
+// CrossTab pivots the answers of one choice field against another. Counts,
+// RowPercentages and ColumnPercentages are indexed [row][column]. The chi-square
+// test is left out when either field is a checkbox, as a response is then counted
+// in several cells and the test does not apply.
+type CrossTab struct {
+	FormID            primitive.ObjectID `json:"form_id"`
+	RowField          CrossTabField      `json:"row_field"`
+	ColumnField       CrossTabField      `json:"column_field"`
+	Rows              []string           `json:"rows"`
+	Columns           []string           `json:"columns"`
+	Counts            [][]int64          `json:"counts"`
+	RowTotals         []int64            `json:"row_totals"`
+	ColumnTotals      []int64            `json:"column_totals"`
+	Total             int64              `json:"total"`
+	RowPercentages    [][]float64        `json:"row_percentages"`
+	ColumnPercentages [][]float64        `json:"column_percentages"`
+	ChiSquare         *float64           `json:"chi_square,omitempty"`
+	DegreesOfFreedom  *int               `json:"degrees_of_freedom,omitempty"`
+	PValue            *float64           `json:"p_value,omitempty"`
+	Significant       *bool              `json:"significant,omitempty"` // p < 0.05
+	Query             *AnalyticsQuery    `json:"query,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+}
+
+// FormSession tracks one visit of a shared form from view to submission
+type FormSession struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	FormID      primitive.ObjectID  `json:"form_id" bson:"form_id"`
+	ViewedAt    time.Time           `json:"viewed_at" bson:"viewed_at"`
+	StartedAt   *time.Time          `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	SubmittedAt *time.Time          `json:"submitted_at,omitempty" bson:"submitted_at,omitempty"`
+	ResponseID  *primitive.ObjectID `json:"response_id,omitempty" bson:"response_id,omitempty"`
+	LastFieldID string              `json:"last_field_id,omitempty" bson:"last_field_id,omitempty"` // Last field the respondent answered
+	UpdatedAt   time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// SessionEventRequest represents the request payload for a started event
+type SessionEventRequest struct {
+	SessionID string `json:"session_id"`
+	FieldID   string `json:"field_id,omitempty"` // Field just answered, to locate abandonment
+}
+
+// FormFunnel describes how visits of a form convert from view to submission.
+// Rates are percentages.
+type FormFunnel struct {
+	Views                   int64              `json:"views"`
+	Starts                  int64              `json:"starts"`
+	Submissions             int64              `json:"submissions"`
+	StartRate               float64            `json:"start_rate"`      // Views that started
+	CompletionRate          float64            `json:"completion_rate"` // Starts that submitted
+	ConversionRate          float64            `json:"conversion_rate"` // Views that submitted
+	MedianCompletionSeconds *float64           `json:"median_completion_seconds"`
+	Abandoned               int64              `json:"abandoned"`
+	AbandonedAt             []AbandonmentPoint `json:"abandoned_at"`
+}
+
+// AbandonmentPoint counts abandoned sessions by the last field answered. An
+// empty field ID means the respondent started without answering anything.
+type AbandonmentPoint struct {
+	FieldID    string `json:"field_id"`
+	FieldLabel string `json:"field_label"`
+	Count      int64  `json:"count"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// FieldOperationType is a kind of change to a single form field
+type FieldOperationType string
+
+const (
+	FieldOperationAdd    FieldOperationType = "add"
+	FieldOperationUpdate FieldOperationType = "update"
+	FieldOperationMove   FieldOperationType = "move"
+	FieldOperationDelete FieldOperationType = "delete"
+)
+
+// FieldOperation is a change to a single field of a form. Operations are
+// applied atomically to the stored form, so editors changing different fields
+// never overwrite each other, and concurrent changes to the same property of
+// a field resolve to the last one applied.
+type FieldOperation struct {
+	ID      string                 `json:"id,omitempty" bson:"id,omitempty"` // Chosen by the client to recognize its own operations
+	Op      FieldOperationType     `json:"op" bson:"op"`
+	FieldID string                 `json:"field_id" bson:"field_id"`
+	Field   *FormField             `json:"field,omitempty" bson:"field,omitempty"`     // add; in broadcasts, the field after the operation
+	Index   *int                   `json:"index,omitempty" bson:"index,omitempty"`     // add, move; in broadcasts, the field's position after the operation
+	Changes map[string]interface{} `json:"changes,omitempty" bson:"changes,omitempty"` // update, the field properties to set
+	// Set by the server
+	UserID    string    `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	ClientID  string    `json:"client_id,omitempty" bson:"client_id,omitempty"`
+	AppliedAt time.Time `json:"applied_at,omitempty" bson:"applied_at,omitempty"`
+	Revision  int64     `json:"revision,omitempty" bson:"revision,omitempty"` // Of the form after the operation
+}
+
+// EditorPresence describes an editor connected to a form's edit topic
+type EditorPresence struct {
+	ClientID string    `json:"client_id"`
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email"`
+	FieldID  string    `json:"field_id,omitempty"` // Field being edited, if any
+	Since    time.Time `json:"since"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FormCollaborator is a user a single form is shared with, outside of its
+// workspace. Collaborators have the same roles as workspace members, except
+// owner. They are invited by email, and the invitation is pending until the
+// user with that email accepts it.
+type FormCollaborator struct {
+	ID         primitive.ObjectID `json:"id" bson:"id"`
+	Email      string             `json:"email" bson:"email"`                         // Lowercased
+	UserID     primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"` // Set on acceptance
+	Role       WorkspaceRole      `json:"role" bson:"role"`
+	InvitedBy  primitive.ObjectID `json:"invited_by" bson:"invited_by"`
+	InvitedAt  time.Time          `json:"invited_at" bson:"invited_at"`
+	AcceptedAt *time.Time         `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+}
+
+// Accepted reports whether the invitation was accepted
+func (c *FormCollaborator) Accepted() bool {
+	return c.AcceptedAt != nil
+}
+
+// CollaboratorRequest represents the request payload for inviting a
+// collaborator or changing their role
+type CollaboratorRequest struct {
+	Email string        `json:"email,omitempty"` // When inviting
+	Role  WorkspaceRole `json:"role"`
+}
+
+// OwnershipTransferRequest represents the request payload for giving a form to another user
+type OwnershipTransferRequest struct {
+	Email string `json:"email"`
+	// Whether the previous owner stays on the form as an editor
+	KeepAccess bool `json:"keep_access,omitempty"`
+}
+
+// InvitationResponse is a pending invitation to collaborate on a form
+type InvitationResponse struct {
+	FormID    primitive.ObjectID `json:"form_id"`
+	FormTitle string             `json:"form_title"`
+	Role      WorkspaceRole      `json:"role"`
+	InvitedBy string             `json:"invited_by"` // Name of the user who sent it
+	InvitedAt time.Time          `json:"invited_at"`
+}
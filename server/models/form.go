@@ -18,14 +18,14 @@ const (
 type FieldType string
 
 const (
-	FieldTypeText       FieldType = "text"
-	FieldTypeTextarea   FieldType = "textarea"
-	FieldTypeEmail      FieldType = "email"
-	FieldTypeNumber     FieldType = "number"
-	FieldTypeSelect     FieldType = "select"
-	FieldTypeRadio      FieldType = "radio"
-	FieldTypeCheckbox   FieldType = "checkbox"
-	FieldTypeRating     FieldType = "rating"
+	FieldTypeText     FieldType = "text"
+	FieldTypeTextarea FieldType = "textarea"
+	FieldTypeEmail    FieldType = "email"
+	FieldTypeNumber   FieldType = "number"
+	FieldTypeSelect   FieldType = "select"
+	FieldTypeRadio    FieldType = "radio"
+	FieldTypeCheckbox FieldType = "checkbox"
+	FieldTypeRating   FieldType = "rating"
 )
 
 // FormField represents a field in a form
@@ -38,19 +38,27 @@ type FormField struct {
 	Options     []string          `json:"options,omitempty" bson:"options,omitempty"` // For select, radio, checkbox
 	Validation  map[string]string `json:"validation,omitempty" bson:"validation,omitempty"`
 	Order       int               `json:"order" bson:"order"`
+	Sensitive   bool              `json:"sensitive,omitempty" bson:"sensitive,omitempty"` // Redacted from the live response feed
 }
 
 // Form represents a form document
 type Form struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
-	Title       string             `json:"title" bson:"title"`
-	Description string             `json:"description,omitempty" bson:"description,omitempty"`
-	Fields      []FormField        `json:"fields" bson:"fields"`
-	Status      FormStatus         `json:"status" bson:"status"`
-	ShareURL    string             `json:"share_url,omitempty" bson:"share_url,omitempty"`
-	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"user_id"`                     // Owner; the creator unless ownership was transferred
+	WorkspaceID   primitive.ObjectID `json:"workspace_id" bson:"workspace_id,omitempty"` // Unset on forms created before workspaces
+	Title         string             `json:"title" bson:"title"`
+	Description   string             `json:"description,omitempty" bson:"description,omitempty"`
+	Fields        []FormField        `json:"fields" bson:"fields"`
+	Status        FormStatus         `json:"status" bson:"status"`
+	Folder        string             `json:"folder,omitempty" bson:"folder,omitempty"` // Slash-separated path, e.g. "Marketing/Q3"
+	Tags          []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	ShareURL      string             `json:"share_url,omitempty" bson:"share_url,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+	Revision      int64              `json:"revision" bson:"revision"`                               // Incremented by every update and field operation, not by sharing changes, sent as the form's ETag
+	Collaborators []FormCollaborator `json:"collaborators,omitempty" bson:"collaborators,omitempty"` // Users the form is shared with outside its workspace
+	// Written with each field operation, so change streams can relay it to other replicas
+	LastOperation *FieldOperation `json:"-" bson:"last_operation,omitempty"`
 }
 
 // FormRequest represents the request payload for creating/updating forms
@@ -59,30 +67,69 @@ type FormRequest struct {
 	Description string      `json:"description,omitempty"`
 	Fields      []FormField `json:"fields"`
 	Status      FormStatus  `json:"status,omitempty"`
+	Folder      *string     `json:"folder,omitempty"`       // On updates, the current folder is kept when missing
+	Tags        []string    `json:"tags,omitempty"`         // On updates, the current tags are kept when missing
+	WorkspaceID string      `json:"workspace_id,omitempty"` // On creation, defaults to the creator's personal workspace
 }
 
 // FormResponse represents the response payload for form data
 type FormResponse struct {
+	ID            primitive.ObjectID `json:"id"`
+	UserID        primitive.ObjectID `json:"user_id"`
+	WorkspaceID   primitive.ObjectID `json:"workspace_id"`
+	Title         string             `json:"title"`
+	Description   string             `json:"description,omitempty"`
+	Fields        []FormField        `json:"fields"`
+	Status        FormStatus         `json:"status"`
+	Folder        string             `json:"folder,omitempty"`
+	Tags          []string           `json:"tags,omitempty"`
+	ShareURL      string             `json:"share_url,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+	Revision      int64              `json:"revision"`
+	Collaborators []FormCollaborator `json:"collaborators,omitempty"`
+	Lint          *FormLint          `json:"lint,omitempty"` // What linting the form found, in responses to its editors
+}
+
+// PublicFormResponse is what respondents are sent of a shared form, leaving out
+// who owns it and who edits it
+type PublicFormResponse struct {
 	ID          primitive.ObjectID `json:"id"`
 	Title       string             `json:"title"`
 	Description string             `json:"description,omitempty"`
 	Fields      []FormField        `json:"fields"`
 	Status      FormStatus         `json:"status"`
 	ShareURL    string             `json:"share_url,omitempty"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
 }
 
 // ToResponse converts Form to FormResponse
 func (f *Form) ToResponse() FormResponse {
 	return FormResponse{
+		ID:            f.ID,
+		UserID:        f.UserID,
+		WorkspaceID:   f.WorkspaceID,
+		Title:         f.Title,
+		Description:   f.Description,
+		Fields:        f.Fields,
+		Status:        f.Status,
+		Folder:        f.Folder,
+		Tags:          f.Tags,
+		ShareURL:      f.ShareURL,
+		CreatedAt:     f.CreatedAt,
+		UpdatedAt:     f.UpdatedAt,
+		Revision:      f.Revision,
+		Collaborators: f.Collaborators,
+	}
+}
+
+// ToPublicResponse converts Form to PublicFormResponse
+func (f *Form) ToPublicResponse() PublicFormResponse {
+	return PublicFormResponse{
 		ID:          f.ID,
 		Title:       f.Title,
 		Description: f.Description,
 		Fields:      f.Fields,
 		Status:      f.Status,
 		ShareURL:    f.ShareURL,
-		CreatedAt:   f.CreatedAt,
-		UpdatedAt:   f.UpdatedAt,
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,32 @@
+package models
+
+// FormDefinitionVersion is the version of the form definition format written
+// by exports. Imports read this version and older ones.
+const FormDefinitionVersion = 1
+
+// FormDefinitionFormat is how a form definition is encoded
+type FormDefinitionFormat string
+
+const (
+	FormDefinitionJSON FormDefinitionFormat = "json"
+	FormDefinitionYAML FormDefinitionFormat = "yaml"
+)
+
+// FormDefinition is a portable, self-contained description of a form, meant
+// to be kept in version control. It holds what makes up the form but nothing
+// tied to where it is stored: no IDs, owner, workspace, status or share URL.
+type FormDefinition struct {
+	Version     int         `json:"version"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	Folder      string      `json:"folder,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	Fields      []FormField `json:"fields"`
+}
+
+// DefinitionProblem is something wrong with an imported form definition, at
+// a path such as "fields[2].options"
+type DefinitionProblem struct {
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
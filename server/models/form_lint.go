@@ -0,0 +1,33 @@
+package models
+
+// LintSeverity says whether a lint issue blocks publishing
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"   // Blocks publishing
+	LintWarning LintSeverity = "warning" // Likely a mistake, but the form works
+)
+
+// LintIssue is a problem found in a form's definition
+type LintIssue struct {
+	Severity LintSeverity `json:"severity"`
+	Rule     string       `json:"rule"`           // e.g. "duplicate-field-id"
+	Path     string       `json:"path,omitempty"` // e.g. "fields[2].options"
+	Message  string       `json:"message"`
+}
+
+// FormLint is what linting a form found, errors first
+type FormLint struct {
+	Errors   []LintIssue `json:"errors"`
+	Warnings []LintIssue `json:"warnings"`
+}
+
+// HasErrors reports whether the form cannot be published
+func (l FormLint) HasErrors() bool {
+	return len(l.Errors) > 0
+}
+
+// IsEmpty reports whether nothing was found
+func (l FormLint) IsEmpty() bool {
+	return len(l.Errors) == 0 && len(l.Warnings) == 0
+}
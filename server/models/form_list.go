@@ -0,0 +1,29 @@
+package models
+
+// FormSort is an order of the forms list
+type FormSort string
+
+const (
+	FormSortUpdated   FormSort = "updated_at"
+	FormSortCreated   FormSort = "created_at"
+	FormSortTitle     FormSort = "title"
+	FormSortRelevance FormSort = "relevance" // Best search matches first, only with a search
+)
+
+// FormListQuery selects and orders a page of the forms list
+type FormListQuery struct {
+	Status     *FormStatus
+	Folder     *string // Forms in this folder or its subfolders; "" for forms in no folder
+	Tag        string
+	Search     string // Words searched in titles, descriptions and field labels
+	Sort       FormSort
+	Descending bool
+	Limit      int
+	Cursor     string // From the previous page, continues after its last form
+}
+
+// FormLabelCount is a folder or tag with the number of forms carrying it
+type FormLabelCount struct {
+	Name  string `json:"name" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
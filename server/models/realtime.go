@@ -0,0 +1,136 @@
+package models
+
+import (
+	"time"
+)
+
+// RealtimeProtocolVersion is the version of the WebSocket message protocol.
+// Clients send it as "v"; messages without it are read as the current version.
+const RealtimeProtocolVersion = 1
+
+// RealtimeTopicName is a kind of real-time event feed
+type RealtimeTopicName string
+
+const (
+	TopicFormAnalytics RealtimeTopicName = "form-analytics" // Analytics deltas, time series and form updates
+	TopicFormResponses RealtimeTopicName = "form-responses" // Individual submissions, redacted
+	TopicFormEdits     RealtimeTopicName = "form-edits"     // Changes to the form definition, field operations and editor presence
+)
+
+// RealtimeTopic is a feed of events about one form
+type RealtimeTopic struct {
+	Name   RealtimeTopicName `json:"name"`
+	FormID string            `json:"form_id"`
+}
+
+// Key identifies the topic's room
+func (t RealtimeTopic) Key() string {
+	return string(t.Name) + ":" + t.FormID
+}
+
+// Types of the messages clients send
+const (
+	MessageAuth        = "auth"
+	MessageSubscribe   = "subscribe"
+	MessageUnsubscribe = "unsubscribe"
+	// Shorthands for subscribing to and unsubscribing from a form's analytics
+	// or response feed
+	MessageJoinAnalytics        = "join-analytics"
+	MessageLeaveAnalytics       = "leave-analytics"
+	MessageSubscribeResponses   = "subscribe-responses"
+	MessageUnsubscribeResponses = "unsubscribe-responses"
+	// Collaborative editing, for subscribers of a form's edits. The server
+	// relays field operations and presence to editors with the same types.
+	MessageFieldOperation = "field-op"
+	MessagePresence       = "presence"
+)
+
+// ClientMessage is a message sent by a WebSocket client. Requests carrying an
+// ID are answered with an ack or an error echoing it.
+type ClientMessage struct {
+	Version   int             `json:"v,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Type      string          `json:"type"`
+	Token     string          `json:"token,omitempty"`     // auth
+	Topics    []RealtimeTopic `json:"topics,omitempty"`    // subscribe, unsubscribe
+	FormID    string          `json:"form_id,omitempty"`   // Shorthands, field-op and presence naming a single form
+	Operation *FieldOperation `json:"operation,omitempty"` // field-op
+	FieldID   string          `json:"field_id,omitempty"`  // presence, the field being edited or empty for none
+}
+
+// Types of the messages the server sends
+const (
+	MessageConnected         = "connected"
+	MessageAck               = "ack"
+	MessageError             = "error"
+	MessageAnalyticsDelta    = "analytics-delta"
+	MessageTimeSeriesUpdate  = "timeseries-update"
+	MessageFormUpdate        = "form-update"
+	MessageResponseCreated   = "response-created"
+	MessageResponsesReplay   = "responses-replay"
+	MessageResponsesImported = "responses-imported"
+)
+
+// Error codes of error messages
+const (
+	RealtimeErrorBadRequest         = "bad_request"
+	RealtimeErrorUnsupportedVersion = "unsupported_version"
+	RealtimeErrorUnknownTopic       = "unknown_topic"
+	RealtimeErrorUnauthorized       = "unauthorized"
+	RealtimeErrorTokenExpired       = "token_expired"
+	RealtimeErrorInvalidFormID      = "invalid_form_id"
+	RealtimeErrorForbidden          = "forbidden"
+	RealtimeErrorConflict           = "conflict"
+	RealtimeErrorInternal           = "internal_error"
+)
+
+// ConnectedMessage is sent once a connection is open
+type ConnectedMessage struct {
+	Version  int    `json:"v"`
+	Type     string `json:"type"`
+	ClientID string `json:"client_id"`
+}
+
+// AckMessage confirms a request was applied
+type AckMessage struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Request string          `json:"request"`           // Type of the request acknowledged
+	UserID  string          `json:"user_id,omitempty"` // auth
+	Topics  []RealtimeTopic `json:"topics,omitempty"`  // subscribe, unsubscribe
+}
+
+// ErrorMessage reports a request that failed
+type ErrorMessage struct {
+	Version int            `json:"v"`
+	Type    string         `json:"type"`
+	ID      string         `json:"id,omitempty"`
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	FormID  string         `json:"form_id,omitempty"`
+	Topic   *RealtimeTopic `json:"topic,omitempty"`
+}
+
+// EventMessage is an event pushed to the subscribers of a topic. Which
+// payload is set depends on the type. A client subscribing to the response
+// feed first gets a responses-replay of the latest responses, which may
+// overlap the first response-created events. An import sends a single
+// responses-imported once it finished, after which clients refetch what they
+// show instead of receiving every imported response. Field operations are
+// relayed to every editor, including the one who sent them.
+type EventMessage struct {
+	Version   int                `json:"v"`
+	Type      string             `json:"type"`
+	Topic     *RealtimeTopic     `json:"topic,omitempty"` // Omitted on event streams, which have a single topic
+	FormID    string             `json:"form_id"`
+	Delta     *AnalyticsDelta    `json:"delta,omitempty"`     // analytics-delta
+	Update    *TimeSeriesUpdate  `json:"update,omitempty"`    // timeseries-update
+	Form      *FormResponse      `json:"form,omitempty"`      // form-update
+	Response  *ResponseFeedItem  `json:"response,omitempty"`  // response-created
+	Responses []ResponseFeedItem `json:"responses,omitempty"` // responses-replay, most recent first
+	Import    *ResponseImportJob `json:"import,omitempty"`    // responses-imported, without its rejected rows
+	Operation *FieldOperation    `json:"operation,omitempty"` // field-op
+	Editors   []EditorPresence   `json:"editors,omitempty"`   // presence, everyone editing the form
+	Timestamp *time.Time         `json:"timestamp,omitempty"`
+}
@@ -14,11 +14,48 @@ type FormUserResponse struct {
 	IPAddress   string                 `json:"ip_address,omitempty" bson:"ip_address,omitempty"`
 	UserAgent   string                 `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
 	SubmittedAt time.Time              `json:"submitted_at" bson:"submitted_at"`
+	StartedAt   *time.Time             `json:"started_at,omitempty" bson:"started_at,omitempty"` // From the respondent's session, when tracked
+	Client      *ClientInfo            `json:"client,omitempty" bson:"client,omitempty"`         // Parsed from the user agent and IP address
+	// Keyed by field ID, for text and textarea answers
+	TextAnalysis map[string]TextAnalysis `json:"text_analysis,omitempty" bson:"text_analysis,omitempty"`
+	// The import job that stored the response, for responses imported from a file
+	ImportID *primitive.ObjectID `json:"import_id,omitempty" bson:"import_id,omitempty"`
+}
+
+// ClientInfo describes the device a response was submitted from
+type ClientInfo struct {
+	Browser string `json:"browser" bson:"browser"`
+	OS      string `json:"os" bson:"os"`
+	Device  string `json:"device" bson:"device"`                       // desktop, mobile, tablet, bot or unknown
+	Country string `json:"country,omitempty" bson:"country,omitempty"` // ISO code, when a GeoIP database is configured
+}
+
+// TextAnalysis holds the language, terms and sentiment of a free-text answer.
+// It is computed once when the response is stored.
+type TextAnalysis struct {
+	Language       string   `json:"language" bson:"language"`
+	Terms          []string `json:"terms,omitempty" bson:"terms,omitempty"`                     // Distinct terms, stop words removed
+	Bigrams        []string `json:"bigrams,omitempty" bson:"bigrams,omitempty"`                 // Distinct pairs of consecutive terms
+	Sentiment      float64  `json:"sentiment" bson:"sentiment"`                                 // From -1 (negative) to 1 (positive), 0 when not scored
+	SentimentLabel string   `json:"sentiment_label,omitempty" bson:"sentiment_label,omitempty"` // Empty when the language has no lexicon
+}
+
+// ResponseFeedItem is a response as shown in the live response feed, with
+// sensitive answers redacted and without the IP address and raw user agent
+type ResponseFeedItem struct {
+	ID          primitive.ObjectID     `json:"id"`
+	FormID      primitive.ObjectID     `json:"form_id"`
+	Responses   map[string]interface{} `json:"responses"`
+	Redacted    []string               `json:"redacted,omitempty"` // IDs of the fields whose answers were redacted or masked
+	SubmittedAt time.Time              `json:"submitted_at"`
+	StartedAt   *time.Time             `json:"started_at,omitempty"`
+	Client      *ClientInfo            `json:"client,omitempty"`
 }
 
 // FormResponseRequest represents the request payload for form submissions
 type FormResponseRequest struct {
 	Responses map[string]interface{} `json:"responses"`
+	SessionID string                 `json:"session_id,omitempty"` // Returned when the view was recorded
 }
 
 // FormResponseSummary represents aggregated response data
@@ -43,5 +80,32 @@ type FormAnalytics struct {
 	FormTitle      string             `json:"form_title"`
 	TotalResponses int64              `json:"total_responses"`
 	FieldAnalytics []FieldAnalytics   `json:"field_analytics"`
+	Funnel         *FormFunnel        `json:"funnel,omitempty"` // Omitted when filtering on answers
+	Clients        *ClientBreakdown   `json:"clients,omitempty"`
+	Query          *AnalyticsQuery    `json:"query,omitempty"` // Set when the analytics are segmented
 	CreatedAt      time.Time          `json:"created_at"`
 }
+
+// ClientBreakdown counts responses by device class, browser, operating system and country
+type ClientBreakdown struct {
+	Devices          map[string]int64 `json:"devices"`
+	Browsers         map[string]int64 `json:"browsers"`
+	OperatingSystems map[string]int64 `json:"operating_systems"`
+	Countries        map[string]int64 `json:"countries"`
+}
+
+// TermCount is a term or bigram and the number of answers mentioning it
+type TermCount struct {
+	Term  string `json:"term"`
+	Count int64  `json:"count"`
+}
+
+// TextResponseSentiment is a free-text answer with its sentiment, for triage
+type TextResponseSentiment struct {
+	ResponseID     primitive.ObjectID `json:"response_id" bson:"_id"`
+	Text           string             `json:"text" bson:"text"`
+	Language       string             `json:"language" bson:"language"`
+	Sentiment      float64            `json:"sentiment" bson:"sentiment"`
+	SentimentLabel string             `json:"sentiment_label" bson:"sentiment_label"`
+	SubmittedAt    time.Time          `json:"submitted_at" bson:"submitted_at"`
+}
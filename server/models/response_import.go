@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ResponseImportOptions describes how the columns of a CSV file of responses
+// are read
+type ResponseImportOptions struct {
+	// Column header to field ID. Columns left out are matched to a field by
+	// ID or label; mapping a column to "" ignores it.
+	Mapping map[string]string `json:"mapping,omitempty"`
+	// Column with the original submission times. Defaults to a column named
+	// like submitted_at or Timestamp; without one, responses are dated now.
+	SubmittedAtColumn string `json:"submitted_at_column,omitempty"`
+	// Go time layout of submission times, e.g. "02/01/2006 15:04". Common
+	// layouts are recognized when left out.
+	TimeLayout string `json:"time_layout,omitempty"`
+	// Time zone of submission times without an offset. Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Separator of the options of checkbox answers. Defaults to ",".
+	ListSeparator string `json:"list_separator,omitempty"`
+}
+
+// RejectedRow is a CSV row that cannot be imported, with every reason why
+type RejectedRow struct {
+	Line   int      `json:"line" bson:"line"` // Line of the file the row starts on; the header is line 1
+	Errors []string `json:"errors" bson:"errors"`
+}
+
+// ResponseImportReport describes what importing a CSV file of responses does,
+// or did
+type ResponseImportReport struct {
+	DryRun            bool              `json:"dry_run" bson:"dry_run"`
+	Columns           map[string]string `json:"columns" bson:"columns"`                                             // Column header to the field ID it is imported into
+	IgnoredColumns    []string          `json:"ignored_columns,omitempty" bson:"ignored_columns,omitempty"`         // Columns matching no field
+	MissingFields     []string          `json:"missing_fields,omitempty" bson:"missing_fields,omitempty"`           // IDs of fields no column is imported into
+	SubmittedAtColumn string            `json:"submitted_at_column,omitempty" bson:"submitted_at_column,omitempty"` // Empty when responses are dated now
+	TotalRows         int               `json:"total_rows" bson:"total_rows"`
+	ValidRows         int               `json:"valid_rows" bson:"valid_rows"`
+	ImportedRows      int               `json:"imported_rows" bson:"imported_rows"`
+	RejectedRows      int               `json:"rejected_rows" bson:"rejected_rows"`
+	Rejected          []RejectedRow     `json:"rejected,omitempty" bson:"rejected,omitempty"` // The first rejected rows
+}
+
+// ImportJobStatus is the state of a background import
+type ImportJobStatus string
+
+const (
+	ImportJobRunning   ImportJobStatus = "running"
+	ImportJobCompleted ImportJobStatus = "completed"
+	ImportJobFailed    ImportJobStatus = "failed"
+)
+
+// ResponseImportJob is an import of responses running in the background. Its
+// ID is also the import_id of the responses it stores.
+type ResponseImportJob struct {
+	ID         primitive.ObjectID   `json:"id" bson:"_id"`
+	FormID     primitive.ObjectID   `json:"form_id" bson:"form_id"`
+	UserID     primitive.ObjectID   `json:"user_id" bson:"user_id"`
+	Status     ImportJobStatus      `json:"status" bson:"status"`
+	Report     ResponseImportReport `json:"report" bson:"report"` // ImportedRows grows as the job runs
+	Error      string               `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt  time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at" bson:"updated_at"` // Kept current while the job runs
+	FinishedAt *time.Time           `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
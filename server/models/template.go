@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TemplateVisibility is who can see and use a template
+type TemplateVisibility string
+
+const (
+	TemplateVisibilityPrivate   TemplateVisibility = "private"   // Only its creator
+	TemplateVisibilityWorkspace TemplateVisibility = "workspace" // Every member of its workspace
+	TemplateVisibilityBuiltIn   TemplateVisibility = "builtin"   // Everyone; shipped with the server
+)
+
+// FormTemplate is a form definition new forms can be created from. Templates
+// saved by users are stored; built-in ones are not, and have a readable Key
+// instead of an ID.
+type FormTemplate struct {
+	ID          primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	Key         string             `json:"-" bson:"-"` // Built-in templates only
+	Visibility  TemplateVisibility `json:"visibility" bson:"visibility"`
+	UserID      primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`           // Creator
+	WorkspaceID primitive.ObjectID `json:"workspace_id,omitempty" bson:"workspace_id,omitempty"` // Workspace templates only
+	Title       string             `json:"title" bson:"title"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	Fields      []FormField        `json:"fields" bson:"fields"`
+	Tags        []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// TemplateRequest represents the request payload for saving a form as a template
+type TemplateRequest struct {
+	Title       string             `json:"title,omitempty"`       // Defaults to the form's title
+	Description string             `json:"description,omitempty"` // Defaults to the form's description
+	Visibility  TemplateVisibility `json:"visibility,omitempty"`  // private or workspace; defaults to private
+}
+
+// FormCopyRequest represents the request payload for duplicating a form or
+// creating one from a template
+type FormCopyRequest struct {
+	Title       string  `json:"title,omitempty"`
+	Folder      *string `json:"folder,omitempty"`       // Defaults to the folder of the copied form
+	WorkspaceID string  `json:"workspace_id,omitempty"` // Defaults to the creator's personal workspace
+}
+
+// TemplateResponse represents the response payload for template data
+type TemplateResponse struct {
+	ID          string              `json:"id"` // The key of built-in templates
+	Visibility  TemplateVisibility  `json:"visibility"`
+	UserID      *primitive.ObjectID `json:"user_id,omitempty"`
+	WorkspaceID *primitive.ObjectID `json:"workspace_id,omitempty"`
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Fields      []FormField         `json:"fields"`
+	Tags        []string            `json:"tags,omitempty"`
+	CreatedAt   *time.Time          `json:"created_at,omitempty"`
+}
+
+// ToResponse converts FormTemplate to TemplateResponse
+func (t *FormTemplate) ToResponse() TemplateResponse {
+	response := TemplateResponse{
+		ID:          t.Key,
+		Visibility:  t.Visibility,
+		Title:       t.Title,
+		Description: t.Description,
+		Fields:      t.Fields,
+		Tags:        t.Tags,
+	}
+	if t.Key == "" {
+		response.ID = t.ID.Hex()
+		response.UserID = &t.UserID
+		response.CreatedAt = &t.CreatedAt
+	}
+	if !t.WorkspaceID.IsZero() {
+		response.WorkspaceID = &t.WorkspaceID
+	}
+	return response
+}
@@ -12,6 +12,7 @@ type User struct {
 	Email     string             `json:"email" bson:"email"`
 	Password  string             `json:"-" bson:"password"`
 	Name      string             `json:"name" bson:"name"`
+	Timezone  string             `json:"timezone,omitempty" bson:"timezone,omitempty"` // IANA name, e.g. America/New_York
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 }
@@ -21,6 +22,13 @@ type UserRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Name     string `json:"name,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// ProfileRequest represents the request payload for updating a user's profile
+type ProfileRequest struct {
+	Name     string `json:"name,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
 }
 
 // UserResponse represents the response payload for user data
@@ -28,6 +36,7 @@ type UserResponse struct {
 	ID        primitive.ObjectID `json:"id"`
 	Email     string             `json:"email"`
 	Name      string             `json:"name"`
+	Timezone  string             `json:"timezone"`
 	CreatedAt time.Time          `json:"created_at"`
 }
 
@@ -43,6 +52,15 @@ func (u *User) ToResponse() UserResponse {
 		ID:        u.ID,
 		Email:     u.Email,
 		Name:      u.Name,
+		Timezone:  u.TimezoneOrDefault(),
 		CreatedAt: u.CreatedAt,
 	}
 }
+
+// TimezoneOrDefault returns the user's timezone, falling back to UTC
+func (u *User) TimezoneOrDefault() string {
+	if u.Timezone == "" {
+		return "UTC"
+	}
+	return u.Timezone
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WorkspaceRole is what a member may do with a workspace's forms
+type WorkspaceRole string
+
+const (
+	RoleOwner   WorkspaceRole = "owner"   // Everything, including managing members
+	RoleEditor  WorkspaceRole = "editor"  // Create and edit forms, read their analytics and responses
+	RoleAnalyst WorkspaceRole = "analyst" // Read forms, analytics and responses
+	RoleViewer  WorkspaceRole = "viewer"  // Read forms
+)
+
+// Permission is an action on a form or workspace
+type Permission string
+
+const (
+	PermissionViewForm        Permission = "view-form"
+	PermissionViewResponses   Permission = "view-responses"
+	PermissionEditForm        Permission = "edit-form"
+	PermissionManageForm      Permission = "manage-form" // Share it and transfer its ownership
+	PermissionManageWorkspace Permission = "manage-workspace"
+)
+
+var rolePermissions = map[WorkspaceRole][]Permission{
+	RoleOwner:   {PermissionViewForm, PermissionViewResponses, PermissionEditForm, PermissionManageForm, PermissionManageWorkspace},
+	RoleEditor:  {PermissionViewForm, PermissionViewResponses, PermissionEditForm},
+	RoleAnalyst: {PermissionViewForm, PermissionViewResponses},
+	RoleViewer:  {PermissionViewForm},
+}
+
+// roleRanks orders roles by what they allow, each granting everything the
+// ones below it do
+var roleRanks = map[WorkspaceRole]int{
+	RoleViewer:  1,
+	RoleAnalyst: 2,
+	RoleEditor:  3,
+	RoleOwner:   4,
+}
+
+// HigherRole returns the role that allows more of the two, either of which may be ""
+func HigherRole(a, b WorkspaceRole) WorkspaceRole {
+	if roleRanks[b] > roleRanks[a] {
+		return b
+	}
+	return a
+}
+
+// Valid reports whether the role is one of the known roles
+func (r WorkspaceRole) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants a permission
+func (r WorkspaceRole) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkspaceMember is a user's membership of a workspace
+type WorkspaceMember struct {
+	UserID  primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role    WorkspaceRole      `json:"role" bson:"role"`
+	AddedAt time.Time          `json:"added_at" bson:"added_at"`
+}
+
+// Workspace groups forms shared by its members. Every user has a personal
+// workspace, where their forms go unless they pick another one.
+type Workspace struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Personal  bool               `json:"personal" bson:"personal"`
+	CreatedBy primitive.ObjectID `json:"created_by" bson:"created_by"`
+	Members   []WorkspaceMember  `json:"members" bson:"members"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// MemberRole returns a user's role in the workspace, or "" when they are not a member
+func (w *Workspace) MemberRole(userID primitive.ObjectID) WorkspaceRole {
+	for _, member := range w.Members {
+		if member.UserID == userID {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// WorkspaceRequest represents the request payload for creating/renaming workspaces
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+// WorkspaceMemberRequest represents the request payload for adding a member or changing their role
+type WorkspaceMemberRequest struct {
+	Email string        `json:"email,omitempty"` // When adding a member
+	Role  WorkspaceRole `json:"role"`
+}
+
+// WorkspaceMemberResponse is a member along with their profile
+type WorkspaceMemberResponse struct {
+	UserID  primitive.ObjectID `json:"user_id"`
+	Email   string             `json:"email"`
+	Name    string             `json:"name"`
+	Role    WorkspaceRole      `json:"role"`
+	AddedAt time.Time          `json:"added_at"`
+}
+
+// WorkspaceResponse represents the response payload for workspace data
+type WorkspaceResponse struct {
+	ID        primitive.ObjectID        `json:"id"`
+	Name      string                    `json:"name"`
+	Personal  bool                      `json:"personal"`
+	Role      WorkspaceRole             `json:"role"` // Of the requesting user
+	Members   []WorkspaceMemberResponse `json:"members"`
+	CreatedAt time.Time                 `json:"created_at"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// clientInfo describes the client a response was submitted from
+func clientInfo(ipAddress, userAgent string) *models.ClientInfo {
+	info := utils.ParseUserAgent(userAgent)
+	info.Country = utils.LookupCountry(ipAddress)
+	return &info
+}
+
+// clientIncrements returns the form aggregate counters a client increments
+func clientIncrements(client *models.ClientInfo) bson.M {
+	inc := bson.M{}
+	if client == nil {
+		return inc
+	}
+	inc["devices."+encodeAggregateKey(client.Device)] = 1
+	inc["browsers."+encodeAggregateKey(client.Browser)] = 1
+	inc["operating_systems."+encodeAggregateKey(client.OS)] = 1
+	if client.Country != "" {
+		inc["countries."+encodeAggregateKey(client.Country)] = 1
+	}
+	return inc
+}
+
+// clientBreakdown decodes the client counters of a form aggregate
+func clientBreakdown(agg *models.FormAggregate) *models.ClientBreakdown {
+	return &models.ClientBreakdown{
+		Devices:          decodeCounts(agg.Devices),
+		Browsers:         decodeCounts(agg.Browsers),
+		OperatingSystems: decodeCounts(agg.OperatingSystems),
+		Countries:        decodeCounts(agg.Countries),
+	}
+}
+
+func decodeCounts(counts map[string]int64) map[string]int64 {
+	decoded := make(map[string]int64)
+	for key, count := range counts {
+		decoded[decodeAggregateKey(key)] += count
+	}
+	return decoded
+}
+
+// clientFacet builds the $facet branch counting responses per client
+func clientFacet() bson.A {
+	return bson.A{
+		bson.M{"$match": bson.M{"client": bson.M{"$type": "object"}}},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"device":  "$client.device",
+				"browser": "$client.browser",
+				"os":      "$client.os",
+				"country": "$client.country",
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+}
+
+// decodeClientFacet fills the client counters of a form aggregate from clientFacet
+func decodeClientFacet(result bson.Raw, agg *models.FormAggregate) error {
+	var groups []struct {
+		Client models.ClientInfo `bson:"_id"`
+		Count  int64             `bson:"count"`
+	}
+	if err := result.Lookup("clients").Unmarshal(&groups); err != nil {
+		return err
+	}
+
+	agg.Devices = make(map[string]int64)
+	agg.Browsers = make(map[string]int64)
+	agg.OperatingSystems = make(map[string]int64)
+	agg.Countries = make(map[string]int64)
+	for _, group := range groups {
+		agg.Devices[encodeAggregateKey(group.Client.Device)] += group.Count
+		agg.Browsers[encodeAggregateKey(group.Client.Browser)] += group.Count
+		agg.OperatingSystems[encodeAggregateKey(group.Client.OS)] += group.Count
+		if group.Client.Country != "" {
+			agg.Countries[encodeAggregateKey(group.Client.Country)] += group.Count
+		}
+	}
+
+	return nil
+}
+
+// BackfillClientInfo parses the stored user agent and IP address of every
+// response of a form. Aggregates must be rebuilt afterwards.
+func (s *AnalyticsService) BackfillClientInfo(form *models.Form) (int, error) {
+	return s.backfillResponses(form, bson.M{"ip_address": 1, "user_agent": 1}, func(response *models.FormUserResponse) bson.M {
+		return bson.M{"$set": bson.M{"client": clientInfo(response.IPAddress, response.UserAgent)}}
+	})
+}
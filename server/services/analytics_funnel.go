@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sessionAbandonAfter is how long a started session stays idle before it
+// counts as abandoned rather than in progress
+const sessionAbandonAfter = 30 * time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+var ErrInvalidSessionField = errors.New("field does not belong to the form")
+
+// RecordView starts a session for a visit of a shared form
+func (s *AnalyticsService) RecordView(form *models.Form) (*models.FormSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	session := &models.FormSession{
+		ID:        primitive.NewObjectID(),
+		FormID:    form.ID,
+		ViewedAt:  now,
+		UpdatedAt: now,
+	}
+
+	if _, err := s.sessions.InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+	s.incFunnel(form.ID, bson.M{"views": 1})
+
+	return session, nil
+}
+
+// RecordStart marks a session as started the first time it is called. Calling
+// it again with the field just answered keeps track of the respondent's
+// progress, so abandoned sessions can be located.
+func (s *AnalyticsService) RecordStart(form *models.Form, req models.SessionEventRequest) error {
+	sessionID, err := primitive.ObjectIDFromHex(req.SessionID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.FieldID != "" {
+		if !formHasField(form, req.FieldID) {
+			return ErrInvalidSessionField
+		}
+		set["last_field_id"] = req.FieldID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var before models.FormSession
+	err = s.sessions.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": sessionID, "form_id": form.ID, "submitted_at": bson.M{"$exists": false}},
+		bson.M{
+			"$min": bson.M{"started_at": time.Now()},
+			"$set": set,
+		},
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// The session moves to the open counter of the field just answered
+	lastFieldID := before.LastFieldID
+	if req.FieldID != "" {
+		lastFieldID = req.FieldID
+	}
+	inc := bson.M{}
+	if before.StartedAt == nil {
+		inc["starts"] = 1
+		inc[openSessionKey(lastFieldID)] = 1
+	} else if lastFieldID != before.LastFieldID {
+		inc[openSessionKey(before.LastFieldID)] = -1
+		inc[openSessionKey(lastFieldID)] = 1
+	}
+	if len(inc) > 0 {
+		s.incFunnel(form.ID, inc)
+	}
+
+	return nil
+}
+
+// CompleteSession marks a session as submitted by a stored response and returns
+// when the respondent started, or nil when the session never recorded a start
+func (s *AnalyticsService) CompleteSession(form *models.Form, sessionIDHex string, response *models.FormUserResponse) (*time.Time, error) {
+	sessionID, err := primitive.ObjectIDFromHex(sessionIDHex)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var session models.FormSession
+	err = s.sessions.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": sessionID, "form_id": form.ID, "submitted_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{
+			"submitted_at": response.SubmittedAt,
+			"response_id":  response.ID,
+			"updated_at":   time.Now(),
+		}},
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inc := bson.M{"submissions": 1}
+	if session.StartedAt != nil {
+		seconds := completionSeconds(*session.StartedAt, response.SubmittedAt)
+		inc[openSessionKey(session.LastFieldID)] = -1
+		inc["completion_seconds."+encodeAggregateKey(valueCountKey(seconds))] = 1
+	}
+	s.incFunnel(form.ID, inc)
+
+	return session.StartedAt, nil
+}
+
+// incFunnel applies funnel counter changes to a form's aggregate. The session
+// is already stored, so a failure only leaves the funnel stale until the form
+// is rebuilt.
+func (s *AnalyticsService) incFunnel(formID primitive.ObjectID, inc bson.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.formAggregates.UpdateOne(
+		ctx,
+		bson.M{"_id": formID},
+		bson.M{"$inc": inc, "$set": bson.M{"updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("❌ Failed to update funnel counters for form %s: %v", formID.Hex(), err)
+	}
+}
+
+// openSessionKey is the aggregate counter of started, unsubmitted sessions
+// whose last answered field is fieldID
+func openSessionKey(fieldID string) string {
+	if fieldID == "" {
+		return "open_without_field"
+	}
+	return "open_sessions." + encodeAggregateKey(fieldID)
+}
+
+// completionSeconds rounds the time a respondent took the way the funnel
+// pipeline does: from millisecond dates, halves to even
+func completionSeconds(startedAt, submittedAt time.Time) float64 {
+	elapsed := submittedAt.Truncate(time.Millisecond).Sub(startedAt.Truncate(time.Millisecond))
+	return math.RoundToEven(float64(elapsed.Milliseconds()) / 1000)
+}
+
+// GetFormFunnel computes view, start and submit counts for the sessions of a
+// form viewed within the query's date range. Answer filters do not apply since
+// sessions that never submitted have no answers.
+func (s *AnalyticsService) GetFormFunnel(form *models.Form, query models.AnalyticsQuery) (*models.FormFunnel, error) {
+	match := bson.M{"form_id": form.ID}
+	viewedAt := bson.M{}
+	if query.From != nil {
+		viewedAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		viewedAt["$lt"] = *query.To
+	}
+	if len(viewedAt) > 0 {
+		match["viewed_at"] = viewedAt
+	}
+
+	counters, err := s.sessionCounters(match, time.Now().Add(-sessionAbandonAfter))
+	if err != nil {
+		return nil, err
+	}
+	return funnelFromCounters(form, counters), nil
+}
+
+// storedFormFunnel builds the funnel of all of a form's sessions from its
+// aggregate. Open sessions active within sessionAbandonAfter are in progress
+// rather than abandoned, so those few are looked up and left out.
+func (s *AnalyticsService) storedFormFunnel(form *models.Form, formAgg *models.FormAggregate) (*models.FormFunnel, error) {
+	inProgress, err := s.sessionCounters(bson.M{
+		"form_id":      form.ID,
+		"updated_at":   bson.M{"$gte": time.Now().Add(-sessionAbandonAfter)},
+		"started_at":   bson.M{"$type": "date"},
+		"submitted_at": bson.M{"$exists": false},
+	}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	counters := *formAgg
+	counters.OpenSessions = make(map[string]int64)
+	for key, count := range formAgg.OpenSessions {
+		counters.OpenSessions[key] = count - inProgress.OpenSessions[key]
+	}
+	counters.OpenWithoutField -= inProgress.OpenWithoutField
+
+	return funnelFromCounters(form, &counters), nil
+}
+
+// sessionCounters counts the sessions matching the filter into the funnel
+// counters of a form aggregate. Open sessions only count when idle since
+// before openBefore, unless it is zero.
+func (s *AnalyticsService) sessionCounters(match bson.M, openBefore time.Time) (*models.FormAggregate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	isDate := func(path string) bson.M {
+		return bson.M{"$eq": bson.A{bson.M{"$type": path}, "date"}}
+	}
+
+	open := bson.M{
+		"started_at":   bson.M{"$type": "date"},
+		"submitted_at": bson.M{"$exists": false},
+	}
+	if !openBefore.IsZero() {
+		open["updated_at"] = bson.M{"$lt": openBefore}
+	}
+
+	cursor, err := s.sessions.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$facet": bson.M{
+			"counts": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":         nil,
+					"views":       bson.M{"$sum": 1},
+					"starts":      bson.M{"$sum": bson.M{"$cond": bson.A{isDate("$started_at"), 1, 0}}},
+					"submissions": bson.M{"$sum": bson.M{"$cond": bson.A{isDate("$submitted_at"), 1, 0}}},
+				}},
+				bson.M{"$project": bson.M{"_id": 0}},
+			},
+			// Whole seconds keep the number of groups small for long-running forms
+			"durations": bson.A{
+				bson.M{"$match": bson.M{"started_at": bson.M{"$type": "date"}, "submitted_at": bson.M{"$type": "date"}}},
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$round": bson.A{
+						bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{"$submitted_at", "$started_at"}}, 1000}},
+						0,
+					}},
+					"count": bson.M{"$sum": 1},
+				}},
+			},
+			"open": bson.A{
+				bson.M{"$match": open},
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"$ifNull": bson.A{"$last_field_id", ""}},
+					"count": bson.M{"$sum": 1},
+				}},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []bson.Raw
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("funnel pipeline returned no result")
+	}
+	result := results[0]
+
+	counters := &models.FormAggregate{}
+	if err := decodeFirstFacetDocument(result, "counts", counters); err != nil {
+		return nil, err
+	}
+
+	var durations []struct {
+		Seconds float64 `bson:"_id"`
+		Count   int64   `bson:"count"`
+	}
+	if err := result.Lookup("durations").Unmarshal(&durations); err != nil {
+		return nil, err
+	}
+	counters.CompletionSeconds = make(map[string]int64)
+	for _, duration := range durations {
+		counters.CompletionSeconds[encodeAggregateKey(valueCountKey(duration.Seconds))] = duration.Count
+	}
+
+	var openSessions []struct {
+		FieldID string `bson:"_id"`
+		Count   int64  `bson:"count"`
+	}
+	if err := result.Lookup("open").Unmarshal(&openSessions); err != nil {
+		return nil, err
+	}
+	counters.OpenSessions = make(map[string]int64)
+	for _, point := range openSessions {
+		if point.FieldID == "" {
+			counters.OpenWithoutField = point.Count
+		} else {
+			counters.OpenSessions[encodeAggregateKey(point.FieldID)] = point.Count
+		}
+	}
+
+	return counters, nil
+}
+
+// funnelFromCounters builds a funnel from session counters, counting open
+// sessions as abandoned
+func funnelFromCounters(form *models.Form, counters *models.FormAggregate) *models.FormFunnel {
+	funnel := &models.FormFunnel{
+		Views:          counters.Views,
+		Starts:         counters.Starts,
+		Submissions:    counters.Submissions,
+		StartRate:      rate(counters.Starts, counters.Views),
+		CompletionRate: rate(counters.Submissions, counters.Starts),
+		ConversionRate: rate(counters.Submissions, counters.Views),
+		AbandonedAt:    []models.AbandonmentPoint{},
+	}
+
+	var values []valueCount
+	var total int64
+	for value, count := range decodeValueCounts(counters.CompletionSeconds) {
+		if count > 0 {
+			values = append(values, valueCount{value: value, count: count})
+			total += count
+		}
+	}
+	if total > 0 {
+		sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+		median := percentile(values, total, 0.5)
+		funnel.MedianCompletionSeconds = &median
+	}
+
+	labels := make(map[string]string)
+	for _, field := range form.Fields {
+		labels[field.ID] = field.Label
+	}
+	abandoned := map[string]int64{"": counters.OpenWithoutField}
+	for key, count := range counters.OpenSessions {
+		abandoned[decodeAggregateKey(key)] += count
+	}
+	for fieldID, count := range abandoned {
+		if count <= 0 {
+			continue
+		}
+		funnel.Abandoned += count
+		funnel.AbandonedAt = append(funnel.AbandonedAt, models.AbandonmentPoint{
+			FieldID:    fieldID,
+			FieldLabel: labels[fieldID],
+			Count:      count,
+		})
+	}
+	sort.Slice(funnel.AbandonedAt, func(i, j int) bool {
+		if funnel.AbandonedAt[i].Count != funnel.AbandonedAt[j].Count {
+			return funnel.AbandonedAt[i].Count > funnel.AbandonedAt[j].Count
+		}
+		return funnel.AbandonedAt[i].FieldID < funnel.AbandonedAt[j].FieldID
+	})
+
+	return funnel
+}
+
+// rate returns part as a percentage of whole
+func rate(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+func formHasField(form *models.Form, fieldID string) bool {
+	for _, field := range form.Fields {
+		if field.ID == fieldID {
+			return true
+		}
+	}
+	return false
+}
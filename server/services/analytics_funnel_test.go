@@ -0,0 +1,82 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+)
+
+func TestFunnelFromCounters(t *testing.T) {
+	form := &models.Form{Fields: []models.FormField{
+		{ID: "email", Label: "Email"},
+		{ID: "plan.tier", Label: "Plan"},
+	}}
+	counters := &models.FormAggregate{
+		Views:       10,
+		Starts:      5,
+		Submissions: 2,
+		CompletionSeconds: map[string]int64{
+			encodeAggregateKey(valueCountKey(30)):  1,
+			encodeAggregateKey(valueCountKey(90)):  1,
+			encodeAggregateKey(valueCountKey(600)): 0,
+		},
+		OpenSessions: map[string]int64{
+			encodeAggregateKey("plan.tier"): 2,
+			encodeAggregateKey("email"):     0, // Only in progress
+		},
+		OpenWithoutField: 1,
+	}
+
+	funnel := funnelFromCounters(form, counters)
+	if funnel.Views != 10 || funnel.Starts != 5 || funnel.Submissions != 2 {
+		t.Errorf("counts = %d, %d, %d", funnel.Views, funnel.Starts, funnel.Submissions)
+	}
+	if funnel.StartRate != 50 || funnel.CompletionRate != 40 || funnel.ConversionRate != 20 {
+		t.Errorf("rates = %v, %v, %v", funnel.StartRate, funnel.CompletionRate, funnel.ConversionRate)
+	}
+	if funnel.MedianCompletionSeconds == nil || *funnel.MedianCompletionSeconds != 60 {
+		t.Errorf("median = %v, want 60", funnel.MedianCompletionSeconds)
+	}
+	want := []models.AbandonmentPoint{
+		{FieldID: "plan.tier", FieldLabel: "Plan", Count: 2},
+		{FieldID: "", Count: 1},
+	}
+	if funnel.Abandoned != 3 || !reflect.DeepEqual(funnel.AbandonedAt, want) {
+		t.Errorf("abandoned = %d at %+v, want 3 at %+v", funnel.Abandoned, funnel.AbandonedAt, want)
+	}
+
+	empty := funnelFromCounters(form, &models.FormAggregate{})
+	if empty.MedianCompletionSeconds != nil || empty.StartRate != 0 || len(empty.AbandonedAt) != 0 {
+		t.Errorf("empty funnel = %+v", empty)
+	}
+}
+
+func TestCompletionSeconds(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{42 * time.Second, 42},
+		{1499 * time.Millisecond, 1},
+		{1500 * time.Millisecond, 2}, // Halves to even, like $round
+		{2500 * time.Millisecond, 2},
+		{2500*time.Millisecond + 900*time.Microsecond, 2}, // Dates are stored in milliseconds
+	}
+	for _, test := range tests {
+		if got := completionSeconds(start, start.Add(test.elapsed)); got != test.want {
+			t.Errorf("completionSeconds(%v) = %v, want %v", test.elapsed, got, test.want)
+		}
+	}
+}
+
+func TestOpenSessionKey(t *testing.T) {
+	if got := openSessionKey(""); got != "open_without_field" {
+		t.Errorf("openSessionKey(\"\") = %q", got)
+	}
+	if got, want := openSessionKey("plan.tier"), "open_sessions."+encodeAggregateKey("plan.tier"); got != want {
+		t.Errorf("openSessionKey = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ComputeFormAnalytics generates analytics for the responses of a form matching
+// the query with a single $facet aggregation, without reading from the aggregates
+func (s *AnalyticsService) ComputeFormAnalytics(form *models.Form, query models.AnalyticsQuery) (*models.FormAnalytics, error) {
+	match, err := analyticsMatch(form, query)
+	if err != nil {
+		return nil, err
+	}
+
+	formAgg, fieldAggs, err := s.aggregateCounters(form, match)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics := &models.FormAnalytics{
+		FormID:         form.ID,
+		FormTitle:      form.Title,
+		TotalResponses: formAgg.TotalResponses,
+		FieldAnalytics: []models.FieldAnalytics{},
+		Clients:        clientBreakdown(formAgg),
+		CreatedAt:      time.Now(),
+	}
+	if !query.IsEmpty() {
+		analytics.Query = &query
+	}
+
+	for _, field := range form.Fields {
+		analytics.FieldAnalytics = append(analytics.FieldAnalytics, fieldAnalyticsFromAggregate(field, fieldAggs[field.ID]))
+	}
+
+	return analytics, nil
+}
+
+// aggregateCounters runs the analytics pipeline over the responses matching
+// the filter and returns the same counters the materialized aggregates hold
+func (s *AnalyticsService) aggregateCounters(form *models.Form, match bson.M) (*models.FormAggregate, map[string]*models.FieldAggregate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	facets := bson.M{
+		"total": bson.A{
+			bson.M{"$group": bson.M{
+				"_id":              nil,
+				"total_responses":  bson.M{"$sum": 1},
+				"last_response_at": bson.M{"$max": "$submitted_at"},
+			}},
+			bson.M{"$project": bson.M{"_id": 0}},
+		},
+		"clients": clientFacet(),
+	}
+	for i, field := range form.Fields {
+		stats, distribution := fieldCounterFacets(field)
+		facets[statsFacetName(i)] = stats
+		facets[distributionFacetName(i)] = distribution
+		if field.Type == models.FieldTypeNumber || field.Type == models.FieldTypeRating {
+			facets[valuesFacetName(i)] = fieldValuesFacet(field)
+		}
+		if isFreeTextField(field.Type) {
+			facets[termsFacetName(i)], facets[bigramsFacetName(i)], facets[textSummaryFacetName(i)] = fieldTextFacets(field)
+		}
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$facet": facets},
+	}
+
+	cursor, err := s.responses.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []bson.Raw
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil, fmt.Errorf("analytics pipeline returned no result")
+	}
+	result := results[0]
+
+	formAgg := &models.FormAggregate{FormID: form.ID, UpdatedAt: time.Now()}
+	if err := decodeFirstFacetDocument(result, "total", formAgg); err != nil {
+		return nil, nil, err
+	}
+	formAgg.FormID = form.ID
+	if err := decodeClientFacet(result, formAgg); err != nil {
+		return nil, nil, err
+	}
+
+	fieldAggs := make(map[string]*models.FieldAggregate)
+	for i, field := range form.Fields {
+		agg := &models.FieldAggregate{}
+		if err := decodeFirstFacetDocument(result, statsFacetName(i), agg); err != nil {
+			return nil, nil, err
+		}
+		agg.FormID = form.ID
+		agg.FieldID = field.ID
+		agg.FieldType = field.Type
+		agg.UpdatedAt = formAgg.UpdatedAt
+
+		var buckets []struct {
+			Option string `bson:"_id"`
+			Count  int64  `bson:"count"`
+		}
+		if err := result.Lookup(distributionFacetName(i)).Unmarshal(&buckets); err != nil {
+			return nil, nil, err
+		}
+		for _, bucket := range buckets {
+			if agg.Distribution == nil {
+				agg.Distribution = make(map[string]int64)
+			}
+			agg.Distribution[encodeAggregateKey(bucket.Option)] = bucket.Count
+		}
+
+		if field.Type == models.FieldTypeNumber || field.Type == models.FieldTypeRating {
+			var values []struct {
+				Value float64 `bson:"_id"`
+				Count int64   `bson:"count"`
+			}
+			if err := result.Lookup(valuesFacetName(i)).Unmarshal(&values); err != nil {
+				return nil, nil, err
+			}
+			for _, value := range values {
+				if agg.ValueCounts == nil {
+					agg.ValueCounts = make(map[string]int64)
+				}
+				agg.ValueCounts[encodeAggregateKey(valueCountKey(value.Value))] = value.Count
+			}
+		}
+
+		if isFreeTextField(field.Type) {
+			if err := decodeTextFacets(result, i, agg); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		fieldAggs[field.ID] = agg
+	}
+
+	return formAgg, fieldAggs, nil
+}
+
+// fieldCounterFacets builds the $facet branches for a field. The first branch
+// produces the scalar counters and the second one the option distribution.
+func fieldCounterFacets(field models.FormField) (bson.A, bson.A) {
+	extract := fieldExtractStages(field)
+
+	stats := append(bson.A{}, extract...)
+	stats = append(stats,
+		bson.M{"$group": bson.M{
+			"_id":            nil,
+			"answered_count": bson.M{"$sum": bson.M{"$cond": bson.A{"$answered", 1, 0}}},
+			"value_count":    bson.M{"$sum": bson.M{"$cond": bson.A{"$counted", 1, 0}}},
+			"sum":            bson.M{"$sum": "$n"},
+			"min":            bson.M{"$min": "$n"},
+			"max":            bson.M{"$max": "$n"},
+			"total_length":   bson.M{"$sum": "$len"},
+		}},
+		bson.M{"$project": bson.M{"_id": 0}},
+	)
+
+	distribution := append(bson.A{}, extract...)
+	distribution = append(distribution,
+		bson.M{"$unwind": "$options"},
+		bson.M{"$group": bson.M{"_id": "$options", "count": bson.M{"$sum": 1}}},
+	)
+
+	return stats, distribution
+}
+
+// fieldValuesFacet builds the $facet branch that counts each distinct numeric value
+func fieldValuesFacet(field models.FormField) bson.A {
+	values := append(bson.A{}, fieldExtractStages(field)...)
+	return append(values,
+		bson.M{"$match": bson.M{"n": bson.M{"$ne": nil}}},
+		bson.M{"$group": bson.M{"_id": "$n", "count": bson.M{"$sum": 1}}},
+	)
+}
+
+// fieldExpressions holds the aggregation expressions that interpret a field's answer
+type fieldExpressions struct {
+	answered interface{} // Non-empty answer of any shape
+	counted  interface{} // Answer valid for the field type
+	number   interface{} // Numeric value for number and rating fields, otherwise null
+	length   interface{} // Byte length for text fields, otherwise 0
+	options  interface{} // Distribution buckets the answer falls into
+}
+
+// fieldValueExpression reads a field's answer from the responses map. $getField
+// keeps field IDs containing dots or dollar signs from being read as paths.
+func fieldValueExpression(fieldID string) bson.M {
+	return bson.M{"$getField": bson.M{
+		"field": bson.M{"$literal": fieldID},
+		"input": "$responses",
+	}}
+}
+
+// buildFieldExpressions interprets the answer held in v (a field path such as
+// "$v") with the same rules as buildFieldDelta
+func buildFieldExpressions(field models.FormField, v string) fieldExpressions {
+	valueType := bson.M{"$type": v}
+
+	nonEmptyString := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{valueType, "string"}},
+		bson.M{"$ne": bson.A{v, ""}},
+	}}
+
+	// Literal defaults, since bare booleans and numbers mean inclusion flags in $project
+	exprs := fieldExpressions{
+		answered: bson.M{"$and": bson.A{
+			bson.M{"$not": bson.A{bson.M{"$in": bson.A{valueType, bson.A{"missing", "null"}}}}},
+			bson.M{"$ne": bson.A{v, ""}},
+		}},
+		counted: bson.M{"$literal": false},
+		number:  bson.M{"$literal": nil},
+		length:  bson.M{"$literal": 0},
+		options: bson.M{"$literal": bson.A{}},
+	}
+
+	switch field.Type {
+	case models.FieldTypeText, models.FieldTypeTextarea, models.FieldTypeEmail:
+		exprs.counted = nonEmptyString
+		exprs.length = bson.M{"$cond": bson.A{nonEmptyString, bson.M{"$strLenBytes": v}, 0}}
+	case models.FieldTypeNumber:
+		number := bson.M{"$switch": bson.M{
+			"branches": bson.A{
+				bson.M{"case": bson.M{"$isNumber": v}, "then": bson.M{"$toDouble": v}},
+				bson.M{"case": bson.M{"$eq": bson.A{valueType, "string"}}, "then": bson.M{"$convert": bson.M{
+					"input":   v,
+					"to":      "double",
+					"onError": nil,
+					"onNull":  nil,
+				}}},
+			},
+			"default": nil,
+		}}
+		// Drops infinities and NaN like numericValue; NaN sorts below every number
+		exprs.number = bson.M{"$let": bson.M{
+			"vars": bson.M{"number": number},
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"$gt": bson.A{"$$number", math.Inf(-1)}},
+					bson.M{"$lt": bson.A{"$$number", math.Inf(1)}},
+				}},
+				"$$number",
+				nil,
+			}},
+		}}
+		exprs.counted = bson.M{"$ne": bson.A{exprs.number, nil}}
+	case models.FieldTypeSelect, models.FieldTypeRadio:
+		exprs.counted = nonEmptyString
+		exprs.options = bson.M{"$cond": bson.A{nonEmptyString, bson.A{v}, bson.A{}}}
+	case models.FieldTypeCheckbox:
+		isArray := bson.M{"$isArray": v}
+		exprs.counted = bson.M{"$cond": bson.A{isArray, bson.M{"$gt": bson.A{bson.M{"$size": v}, 0}}, false}}
+		exprs.options = bson.M{"$cond": bson.A{
+			isArray,
+			bson.M{"$filter": bson.M{
+				"input": v,
+				"cond": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$type": "$$this"}, "string"}},
+					bson.M{"$ne": bson.A{"$$this", ""}},
+				}},
+			}},
+			bson.A{},
+		}}
+	case models.FieldTypeRating:
+		inRange := bson.M{"$cond": bson.A{
+			bson.M{"$isNumber": v},
+			bson.M{"$and": bson.A{bson.M{"$gte": bson.A{v, 1}}, bson.M{"$lte": bson.A{v, 5}}}},
+			false,
+		}}
+		exprs.counted = inRange
+		exprs.number = bson.M{"$cond": bson.A{inRange, bson.M{"$toDouble": v}, nil}}
+		exprs.options = bson.M{"$cond": bson.A{
+			inRange,
+			bson.A{bson.M{"$toString": bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$toDouble": v}, 0}}}}},
+			bson.A{},
+		}}
+	}
+
+	return exprs
+}
+
+// fieldExtractStages projects a field's answer of each response into answered,
+// counted, n (numeric value), len (text length) and options, keeping submitted_at
+func fieldExtractStages(field models.FormField) bson.A {
+	exprs := buildFieldExpressions(field, "$v")
+
+	return bson.A{
+		bson.M{"$project": bson.M{"v": fieldValueExpression(field.ID), "submitted_at": 1}},
+		bson.M{"$project": bson.M{
+			"submitted_at": 1,
+			"answered":     exprs.answered,
+			"counted":      exprs.counted,
+			"n":            exprs.number,
+			"len":          exprs.length,
+			"options":      exprs.options,
+		}},
+	}
+}
+
+func statsFacetName(index int) string {
+	return fmt.Sprintf("field_%d", index)
+}
+
+func distributionFacetName(index int) string {
+	return fmt.Sprintf("field_%d_distribution", index)
+}
+
+func valuesFacetName(index int) string {
+	return fmt.Sprintf("field_%d_values", index)
+}
+
+// decodeFirstFacetDocument decodes the first document of a $facet branch.
+// Empty branches leave the target untouched.
+func decodeFirstFacetDocument(result bson.Raw, facet string, target interface{}) error {
+	var docs []bson.Raw
+	if err := result.Lookup(facet).Unmarshal(&docs); err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	return bson.Unmarshal(docs[0], target)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"dune-takehome-server/database"
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const benchmarkResponseCount = 100000
+
+// BenchmarkFormAnalytics compares counting decoded responses in Go with the
+// $facet pipeline. It seeds a scratch database and needs MongoDB 5.0 or newer:
+//
+//	MONGODB_TEST_URI=mongodb://localhost:27017 go test ./services -run '^$' -bench FormAnalytics -benchtime 5x
+func BenchmarkFormAnalytics(b *testing.B) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		b.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	if err := database.Connect(uri); err != nil {
+		b.Fatalf("failed to connect to MongoDB: %v", err)
+	}
+	defer database.Disconnect()
+
+	database.Database = database.Client.Database("dune-form-builder-bench")
+	defer database.Database.Drop(context.Background())
+
+	form := benchmarkForm()
+	if err := seedBenchmarkResponses(form, benchmarkResponseCount); err != nil {
+		b.Fatalf("failed to seed responses: %v", err)
+	}
+
+	service := NewResponseService()
+
+	inMemory, err := service.computeFormAnalyticsInMemory(form)
+	if err != nil {
+		b.Fatalf("in-memory analytics failed: %v", err)
+	}
+	pipeline, err := service.ComputeFormAnalytics(form)
+	if err != nil {
+		b.Fatalf("pipeline analytics failed: %v", err)
+	}
+	if inMemory.TotalResponses != pipeline.TotalResponses {
+		b.Fatalf("total responses differ: in-memory %d, pipeline %d", inMemory.TotalResponses, pipeline.TotalResponses)
+	}
+	for i := range form.Fields {
+		want, got := inMemory.FieldAnalytics[i], pipeline.FieldAnalytics[i]
+		if want.ResponseCount != got.ResponseCount {
+			b.Fatalf("response count for %s differs: in-memory %d, pipeline %d", form.Fields[i].ID, want.ResponseCount, got.ResponseCount)
+		}
+		if !analyticsDataEqual(want.Data, got.Data) {
+			b.Fatalf("analytics of %s differ:\nin-memory %v\npipeline  %v", form.Fields[i].ID, want.Data, got.Data)
+		}
+	}
+
+	b.Run("InMemory", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := service.computeFormAnalyticsInMemory(form); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Pipeline", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := service.ComputeFormAnalytics(form); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// analyticsDataEqual compares field analytics as they are sent, decoded from
+// JSON so the Go types each path builds them with do not matter. Numbers may
+// differ in the last bits, as the paths sum in different orders.
+func analyticsDataEqual(a, b map[string]interface{}) bool {
+	return jsonValuesEqual(decodeJSON(a), decodeJSON(b))
+}
+
+func decodeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	return decoded
+}
+
+func jsonValuesEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		return ok && math.Abs(a-b) <= 1e-9*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonValuesEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			if other, ok := b[key]; !ok || !jsonValuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func benchmarkForm() *models.Form {
+	return &models.Form{
+		ID:    primitive.NewObjectID(),
+		Title: "Benchmark form",
+		Fields: []models.FormField{
+			{ID: "name", Type: models.FieldTypeText, Label: "Name"},
+			{ID: "employees", Type: models.FieldTypeNumber, Label: "Employees"},
+			{ID: "plan", Type: models.FieldTypeSelect, Label: "Plan", Options: []string{"Free", "Team", "Enterprise"}},
+			{ID: "features", Type: models.FieldTypeCheckbox, Label: "Features", Options: []string{"SSO", "Audit logs", "API"}},
+			{ID: "rating", Type: models.FieldTypeRating, Label: "Rating"},
+		},
+	}
+}
+
+func seedBenchmarkResponses(form *models.Form, count int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	random := rand.New(rand.NewSource(1))
+	plans := form.Fields[2].Options
+	features := form.Fields[3].Options
+	collection := database.Database.Collection("responses")
+
+	const batchSize = 5000
+	for start := 0; start < count; start += batchSize {
+		var docs []interface{}
+		for i := start; i < start+batchSize && i < count; i++ {
+			var selected []interface{}
+			for _, feature := range features {
+				if random.Intn(2) == 0 {
+					selected = append(selected, feature)
+				}
+			}
+
+			docs = append(docs, models.FormUserResponse{
+				ID:     primitive.NewObjectID(),
+				FormID: form.ID,
+				Responses: map[string]interface{}{
+					"name":      fmt.Sprintf("Respondent %d", i),
+					"employees": float64(random.Intn(5000)),
+					"plan":      plans[random.Intn(len(plans))],
+					"features":  selected,
+					"rating":    float64(random.Intn(5) + 1),
+				},
+				SubmittedAt: time.Now().Add(-time.Duration(i) * time.Minute),
+			})
+		}
+
+		if _, err := collection.InsertMany(ctx, docs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestAnalyticsDataEqual(t *testing.T) {
+	inMemory := map[string]interface{}{
+		"average":      3.0000000000000004,
+		"distribution": map[string]int{"Free": 2, "Team": 1},
+		"values":       []float64{1, 2},
+	}
+	pipeline := map[string]interface{}{
+		"average":      3.0,
+		"distribution": map[string]interface{}{"Free": int64(2), "Team": int32(1)},
+		"values":       []interface{}{1.0, 2.0},
+	}
+	if !analyticsDataEqual(inMemory, pipeline) {
+		t.Error("equal analytics differ")
+	}
+
+	pipeline["distribution"] = map[string]interface{}{"Free": 2, "Team": 2}
+	if analyticsDataEqual(inMemory, pipeline) {
+		t.Error("different distributions are equal")
+	}
+	if analyticsDataEqual(inMemory, map[string]interface{}{"average": 3.0}) {
+		t.Error("missing keys are equal")
+	}
+}
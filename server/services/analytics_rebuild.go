@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// rebuildGrace is how long a rebuild waits after locking a form, so the
+	// responses being recorded when it started are counted before it reads them.
+	// It matches the timeout of RecordResponse.
+	rebuildGrace = 10 * time.Second
+	// rebuildStaleAfter is when a rebuild lock is considered left behind by a
+	// server that stopped, and taken over
+	rebuildStaleAfter = 30 * time.Minute
+)
+
+// rebuildLock marks a form whose analytics are being rebuilt, in the
+// analytics_rebuilds collection. Rerun is set when another rebuild was asked
+// for meanwhile, e.g. because a field changed type again.
+type rebuildLock struct {
+	FormID    primitive.ObjectID `bson:"_id"`
+	StartedAt time.Time          `bson:"started_at"`
+	Rerun     bool               `bson:"rerun,omitempty"`
+}
+
+// RebuildFormAnalytics recomputes the aggregates of a form from its stored responses
+// and sessions with the analytics pipelines. Responses submitted meanwhile are
+// marked pending instead of being counted, and counted once the rebuild is done.
+// A rebuild asked for while one is running makes the running one start over
+// with the current form.
+func (s *AnalyticsService) RebuildFormAnalytics(form *models.Form) error {
+	locked, err := s.lockRebuild(form.ID)
+	if err != nil || !locked {
+		return err
+	}
+
+	time.Sleep(rebuildGrace)
+	for {
+		if err := s.rebuildLocked(form.ID); err != nil {
+			s.unlockRebuild(form.ID)
+			return err
+		}
+
+		done, err := s.finishRebuild(form.ID)
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+
+	return s.recordPendingResponses(form.ID)
+}
+
+// rebuildLocked replaces the aggregates of a form while its rebuild lock is held
+func (s *AnalyticsService) rebuildLocked(formID primitive.ObjectID) error {
+	// The form is read again, as the one the rebuild was asked for may be stale
+	form, err := s.currentForm(formID)
+	if err != nil || form == nil {
+		return err
+	}
+
+	formAgg, fieldAggs, err := s.aggregateCounters(form, bson.M{"form_id": form.ID, "analytics_pending": bson.M{"$ne": true}})
+	if err != nil {
+		return err
+	}
+	sessions, err := s.sessionCounters(bson.M{"form_id": form.ID}, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := s.fieldAggregates.DeleteMany(ctx, bson.M{"form_id": form.ID}); err != nil {
+		return err
+	}
+
+	var docs []interface{}
+	for _, agg := range fieldAggs {
+		agg.ID = primitive.NewObjectID()
+		docs = append(docs, agg)
+	}
+	if len(docs) > 0 {
+		if _, err := s.fieldAggregates.InsertMany(ctx, docs); err != nil {
+			return err
+		}
+	}
+	if err := s.replaceFieldTerms(ctx, form.ID, fieldAggs); err != nil {
+		return err
+	}
+	if err := s.replaceFieldValues(ctx, form.ID, fieldAggs); err != nil {
+		return err
+	}
+
+	_, err = s.formAggregates.UpdateOne(ctx, bson.M{"_id": form.ID}, rebuiltFormAggregate(formAgg, sessions), options.Update().SetUpsert(true))
+	return err
+}
+
+// rebuiltFormAggregate replaces the response counters of a form aggregate. The
+// funnel counters keep being incremented during a rebuild, so the ones counted
+// from the sessions are only stored when the aggregate has none yet.
+func rebuiltFormAggregate(formAgg, sessions *models.FormAggregate) mongo.Pipeline {
+	counts := func(counts map[string]int64) bson.M {
+		if counts == nil {
+			counts = map[string]int64{}
+		}
+		return bson.M{"$literal": counts}
+	}
+	ifMissing := func(name string, value interface{}) bson.M {
+		return bson.M{"$ifNull": bson.A{"$" + name, value}}
+	}
+
+	set := bson.M{
+		"total_responses":    formAgg.TotalResponses,
+		"last_response_at":   formAgg.LastResponseAt,
+		"devices":            counts(formAgg.Devices),
+		"browsers":           counts(formAgg.Browsers),
+		"operating_systems":  counts(formAgg.OperatingSystems),
+		"countries":          counts(formAgg.Countries),
+		"views":              ifMissing("views", sessions.Views),
+		"starts":             ifMissing("starts", sessions.Starts),
+		"submissions":        ifMissing("submissions", sessions.Submissions),
+		"completion_seconds": ifMissing("completion_seconds", counts(sessions.CompletionSeconds)),
+		"open_sessions":      ifMissing("open_sessions", counts(sessions.OpenSessions)),
+		"open_without_field": ifMissing("open_without_field", sessions.OpenWithoutField),
+		"updated_at":         time.Now(),
+	}
+	return mongo.Pipeline{{{Key: "$set", Value: set}}}
+}
+
+// currentForm reads a form, or returns nil when it was deleted
+func (s *AnalyticsService) currentForm(formID primitive.ObjectID) (*models.Form, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var form models.Form
+	if err := s.forms.FindOne(ctx, bson.M{"_id": formID}).Decode(&form); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &form, nil
+}
+
+// lockRebuild takes the rebuild lock of a form. When another rebuild holds it,
+// that rebuild is asked to run again and false is returned.
+func (s *AnalyticsService) lockRebuild(formID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if _, err := s.rebuilds.DeleteOne(ctx, bson.M{"_id": formID, "started_at": bson.M{"$lt": now.Add(-rebuildStaleAfter)}}); err != nil {
+		return false, err
+	}
+
+	_, err := s.rebuilds.InsertOne(ctx, rebuildLock{FormID: formID, StartedAt: now})
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = s.rebuilds.UpdateOne(ctx, bson.M{"_id": formID}, bson.M{"$set": bson.M{"rerun": true}})
+		return false, err
+	}
+	return err == nil, err
+}
+
+// finishRebuild releases the rebuild lock of a form, unless another rebuild was
+// asked for meanwhile. Then it is kept and false is returned.
+func (s *AnalyticsService) finishRebuild(formID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := s.rebuilds.DeleteOne(ctx, bson.M{"_id": formID, "rerun": bson.M{"$ne": true}})
+	if err != nil || result.DeletedCount == 1 {
+		return err == nil, err
+	}
+	_, err = s.rebuilds.UpdateOne(ctx, bson.M{"_id": formID}, bson.M{
+		"$set":   bson.M{"started_at": time.Now()},
+		"$unset": bson.M{"rerun": ""},
+	})
+	return false, err
+}
+
+// unlockRebuild releases the rebuild lock of a form after a failed rebuild.
+// Responses left pending are counted by the next rebuild of the form.
+func (s *AnalyticsService) unlockRebuild(formID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.rebuilds.DeleteOne(ctx, bson.M{"_id": formID}); err != nil {
+		log.Printf("⚠️ Failed to release the analytics rebuild lock of form %s: %v", formID.Hex(), err)
+	}
+}
+
+// rebuilding tells whether the analytics of a form are being rebuilt
+func (s *AnalyticsService) rebuilding(ctx context.Context, formID primitive.ObjectID) (bool, error) {
+	count, err := s.rebuilds.CountDocuments(ctx, bson.M{
+		"_id":        formID,
+		"started_at": bson.M{"$gte": time.Now().Add(-rebuildStaleAfter)},
+	})
+	return count > 0, err
+}
+
+// deferWhileRebuilding marks a stored response pending when its form is being
+// rebuilt, and returns true when the response must not be counted now. A rebuild
+// that ended meanwhile has its pending responses counted by whoever claims them
+// first, this call or the rebuild.
+func (s *AnalyticsService) deferWhileRebuilding(ctx context.Context, formID, responseID primitive.ObjectID) (bool, error) {
+	if rebuilding, err := s.rebuilding(ctx, formID); err != nil || !rebuilding {
+		return false, err
+	}
+	if _, err := s.responses.UpdateOne(ctx, bson.M{"_id": responseID}, bson.M{"$set": bson.M{"analytics_pending": true}}); err != nil {
+		return false, err
+	}
+	if rebuilding, err := s.rebuilding(ctx, formID); err != nil || rebuilding {
+		return true, err
+	}
+	claimed, err := s.claimPendingResponse(ctx, responseID)
+	return !claimed, err
+}
+
+// claimPendingResponse clears the pending mark of a response, and returns false
+// when it was already cleared by someone else
+func (s *AnalyticsService) claimPendingResponse(ctx context.Context, responseID primitive.ObjectID) (bool, error) {
+	result, err := s.responses.UpdateOne(ctx,
+		bson.M{"_id": responseID, "analytics_pending": true},
+		bson.M{"$unset": bson.M{"analytics_pending": ""}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// recordPendingResponses counts the responses of a form stored while it was rebuilt
+func (s *AnalyticsService) recordPendingResponses(formID primitive.ObjectID) error {
+	form, err := s.currentForm(formID)
+	if err != nil || form == nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	cursor, err := s.responses.Find(ctx, bson.M{"form_id": formID, "analytics_pending": true})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var response models.FormUserResponse
+		if err := cursor.Decode(&response); err != nil {
+			return err
+		}
+		claimed, err := s.claimPendingResponse(ctx, response.ID)
+		if err != nil {
+			return err
+		}
+		if claimed {
+			if err := s.applyDeltas(ctx, form, []*models.AnalyticsDelta{BuildAnalyticsDelta(form, &response)}); err != nil {
+				return err
+			}
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRebuiltFormAggregate(t *testing.T) {
+	formAgg := &models.FormAggregate{
+		TotalResponses: 3,
+		Devices:        map[string]int64{"desktop": 3},
+	}
+	sessions := &models.FormAggregate{Views: 10, Starts: 4, OpenSessions: map[string]int64{"email": 1}}
+
+	pipeline := rebuiltFormAggregate(formAgg, sessions)
+	if len(pipeline) != 1 || pipeline[0][0].Key != "$set" {
+		t.Fatalf("pipeline = %v, want a single $set stage", pipeline)
+	}
+	set := pipeline[0][0].Value.(bson.M)
+
+	// Response counters are replaced
+	if set["total_responses"] != int64(3) {
+		t.Errorf("total_responses = %v, want 3", set["total_responses"])
+	}
+	if want := (bson.M{"$literal": map[string]int64{"desktop": 3}}); !reflect.DeepEqual(set["devices"], want) {
+		t.Errorf("devices = %v, want %v", set["devices"], want)
+	}
+	// Missing counts are cleared rather than kept
+	if want := (bson.M{"$literal": map[string]int64{}}); !reflect.DeepEqual(set["countries"], want) {
+		t.Errorf("countries = %v, want %v", set["countries"], want)
+	}
+
+	// Funnel counters incremented meanwhile are kept
+	if want := (bson.M{"$ifNull": bson.A{"$views", int64(10)}}); !reflect.DeepEqual(set["views"], want) {
+		t.Errorf("views = %v, want %v", set["views"], want)
+	}
+	if want := (bson.M{"$ifNull": bson.A{"$open_sessions", bson.M{"$literal": map[string]int64{"email": 1}}}}); !reflect.DeepEqual(set["open_sessions"], want) {
+		t.Errorf("open_sessions = %v, want %v", set["open_sessions"], want)
+	}
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+// significanceLevel is the p-value below which a cross-tabulation is significant
+const significanceLevel = 0.05
+
+// analyticsMatch builds the $match stage selecting a form's responses that satisfy the query
+func analyticsMatch(form *models.Form, query models.AnalyticsQuery) (bson.M, error) {
+	match := bson.M{"form_id": form.ID}
+
+	submittedAt := bson.M{}
+	if query.From != nil {
+		submittedAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		submittedAt["$lt"] = *query.To
+	}
+	if len(submittedAt) > 0 {
+		match["submitted_at"] = submittedAt
+	}
+
+	fields := make(map[string]models.FormField)
+	for _, field := range form.Fields {
+		fields[field.ID] = field
+	}
+
+	var predicates bson.A
+	for _, filter := range query.Filters {
+		field, exists := fields[filter.FieldID]
+		if !exists {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidAnalyticsQuery, filter.FieldID)
+		}
+
+		predicate, err := filterExpression(field, filter)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+	}
+	if len(predicates) > 0 {
+		match["$expr"] = bson.M{"$and": predicates}
+	}
+
+	return match, nil
+}
+
+// filterExpression converts a filter into an aggregation expression over one response
+func filterExpression(field models.FormField, filter models.AnalyticsFilter) (bson.M, error) {
+	if len(filter.Values) == 0 {
+		return nil, fmt.Errorf("%w: filter on %q needs a value", ErrInvalidAnalyticsQuery, field.ID)
+	}
+	if filter.Operator != models.FilterIn && len(filter.Values) != 1 {
+		return nil, fmt.Errorf("%w: only the in operator accepts several values", ErrInvalidAnalyticsQuery)
+	}
+
+	exprs := buildFieldExpressions(field, "$$v")
+	unsupported := fmt.Errorf("%w: operator %q is not supported for %s fields", ErrInvalidAnalyticsQuery, filter.Operator, field.Type)
+
+	var predicate interface{}
+	switch field.Type {
+	case models.FieldTypeNumber, models.FieldTypeRating:
+		var numbers bson.A
+		for _, value := range filter.Values {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not a number", ErrInvalidAnalyticsQuery, value)
+			}
+			numbers = append(numbers, number)
+		}
+
+		comparison := map[models.FilterOperator]string{
+			models.FilterEquals:         "$eq",
+			models.FilterNotEquals:      "$ne",
+			models.FilterGreaterThan:    "$gt",
+			models.FilterGreaterOrEqual: "$gte",
+			models.FilterLessThan:       "$lt",
+			models.FilterLessOrEqual:    "$lte",
+		}
+		switch op, ok := comparison[filter.Operator]; {
+		case filter.Operator == models.FilterIn:
+			predicate = bson.M{"$in": bson.A{exprs.number, numbers}}
+		case ok && filter.Operator == models.FilterNotEquals:
+			predicate = bson.M{"$ne": bson.A{exprs.number, numbers[0]}}
+		case ok:
+			// null sorts below every number, so unanswered responses must be excluded explicitly
+			predicate = bson.M{"$and": bson.A{
+				bson.M{"$ne": bson.A{exprs.number, nil}},
+				bson.M{op: bson.A{exprs.number, numbers[0]}},
+			}}
+		default:
+			return nil, unsupported
+		}
+
+	case models.FieldTypeCheckbox:
+		values := stringValues(filter.Values)
+		selected := bson.M{"$gt": bson.A{bson.M{"$size": bson.M{"$setIntersection": bson.A{exprs.options, values}}}, 0}}
+		switch filter.Operator {
+		case models.FilterEquals, models.FilterIn:
+			predicate = selected
+		case models.FilterNotEquals:
+			predicate = bson.M{"$not": bson.A{selected}}
+		default:
+			return nil, unsupported
+		}
+
+	default:
+		isString := bson.M{"$eq": bson.A{bson.M{"$type": "$$v"}, "string"}}
+		switch filter.Operator {
+		case models.FilterEquals:
+			predicate = bson.M{"$eq": bson.A{"$$v", bson.M{"$literal": filter.Values[0]}}}
+		case models.FilterNotEquals:
+			predicate = bson.M{"$ne": bson.A{"$$v", bson.M{"$literal": filter.Values[0]}}}
+		case models.FilterIn:
+			predicate = bson.M{"$in": bson.A{"$$v", stringValues(filter.Values)}}
+		case models.FilterContains:
+			predicate = bson.M{"$cond": bson.A{
+				isString,
+				bson.M{"$regexMatch": bson.M{
+					"input":   "$$v",
+					"regex":   regexp.QuoteMeta(filter.Values[0]),
+					"options": "i",
+				}},
+				false,
+			}}
+		default:
+			return nil, unsupported
+		}
+	}
+
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"v": fieldValueExpression(field.ID)},
+		"in":   predicate,
+	}}, nil
+}
+
+// stringValues wraps user input in $literal so values starting with $ are not read as field paths
+func stringValues(values []string) bson.M {
+	var result bson.A
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return bson.M{"$literal": result}
+}
+
+// GetCrossTab pivots the answers of two choice fields against each other for
+// the responses matching the query. Checkbox answers count once per selected option.
+func (s *AnalyticsService) GetCrossTab(form *models.Form, rowFieldID, columnFieldID string, query models.AnalyticsQuery) (*models.CrossTab, error) {
+	rowField, err := crossTabField(form, rowFieldID)
+	if err != nil {
+		return nil, err
+	}
+	columnField, err := crossTabField(form, columnFieldID)
+	if err != nil {
+		return nil, err
+	}
+	if rowField.ID == columnField.ID {
+		return nil, fmt.Errorf("%w: row and column must be different fields", ErrInvalidAnalyticsQuery)
+	}
+
+	match, err := analyticsMatch(form, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	cursor, err := s.responses.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$project": bson.M{
+			"r": fieldValueExpression(rowField.ID),
+			"c": fieldValueExpression(columnField.ID),
+		}},
+		bson.M{"$project": bson.M{
+			"row":    buildFieldExpressions(rowField, "$r").options,
+			"column": buildFieldExpressions(columnField, "$c").options,
+		}},
+		bson.M{"$unwind": "$row"},
+		bson.M{"$unwind": "$column"},
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"row": "$row", "column": "$column"},
+			"count": bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var cells []struct {
+		ID struct {
+			Row    string `bson:"row"`
+			Column string `bson:"column"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &cells); err != nil {
+		return nil, err
+	}
+
+	rowSeen := make(map[string]bool)
+	columnSeen := make(map[string]bool)
+	for _, cell := range cells {
+		rowSeen[cell.ID.Row] = true
+		columnSeen[cell.ID.Column] = true
+	}
+	rows := crossTabCategories(rowField, rowSeen)
+	columns := crossTabCategories(columnField, columnSeen)
+
+	rowIndex := make(map[string]int)
+	for i, row := range rows {
+		rowIndex[row] = i
+	}
+	columnIndex := make(map[string]int)
+	for i, column := range columns {
+		columnIndex[column] = i
+	}
+
+	crossTab := &models.CrossTab{
+		FormID:            form.ID,
+		RowField:          models.CrossTabField{FieldID: rowField.ID, FieldLabel: rowField.Label, FieldType: string(rowField.Type)},
+		ColumnField:       models.CrossTabField{FieldID: columnField.ID, FieldLabel: columnField.Label, FieldType: string(columnField.Type)},
+		Rows:              rows,
+		Columns:           columns,
+		Counts:            make([][]int64, len(rows)),
+		RowTotals:         make([]int64, len(rows)),
+		ColumnTotals:      make([]int64, len(columns)),
+		RowPercentages:    make([][]float64, len(rows)),
+		ColumnPercentages: make([][]float64, len(rows)),
+		CreatedAt:         time.Now(),
+	}
+	if !query.IsEmpty() {
+		crossTab.Query = &query
+	}
+
+	for i := range rows {
+		crossTab.Counts[i] = make([]int64, len(columns))
+		crossTab.RowPercentages[i] = make([]float64, len(columns))
+		crossTab.ColumnPercentages[i] = make([]float64, len(columns))
+	}
+
+	for _, cell := range cells {
+		i, j := rowIndex[cell.ID.Row], columnIndex[cell.ID.Column]
+		crossTab.Counts[i][j] += cell.Count
+		crossTab.RowTotals[i] += cell.Count
+		crossTab.ColumnTotals[j] += cell.Count
+		crossTab.Total += cell.Count
+	}
+
+	for i := range rows {
+		for j := range columns {
+			count := float64(crossTab.Counts[i][j])
+			if crossTab.RowTotals[i] > 0 {
+				crossTab.RowPercentages[i][j] = count / float64(crossTab.RowTotals[i]) * 100
+			}
+			if crossTab.ColumnTotals[j] > 0 {
+				crossTab.ColumnPercentages[i][j] = count / float64(crossTab.ColumnTotals[j]) * 100
+			}
+		}
+	}
+
+	// Checkbox answers are unwound into one cell per option checked, so the
+	// cells are not independent observations
+	if rowField.Type != models.FieldTypeCheckbox && columnField.Type != models.FieldTypeCheckbox {
+		chiSquare, degreesOfFreedom, pValue := chiSquareTest(crossTab.Counts, crossTab.RowTotals, crossTab.ColumnTotals, crossTab.Total)
+		significant := degreesOfFreedom > 0 && pValue < significanceLevel
+		crossTab.ChiSquare, crossTab.DegreesOfFreedom, crossTab.PValue, crossTab.Significant = &chiSquare, &degreesOfFreedom, &pValue, &significant
+	}
+
+	return crossTab, nil
+}
+
+// crossTabField looks up a field that can be pivoted
+func crossTabField(form *models.Form, fieldID string) (models.FormField, error) {
+	for _, field := range form.Fields {
+		if field.ID != fieldID {
+			continue
+		}
+		switch field.Type {
+		case models.FieldTypeSelect, models.FieldTypeRadio, models.FieldTypeCheckbox, models.FieldTypeRating:
+			return field, nil
+		}
+		return field, fmt.Errorf("%w: field %q is not a choice or rating field", ErrInvalidAnalyticsQuery, fieldID)
+	}
+	return models.FormField{}, fmt.Errorf("%w: unknown field %q", ErrInvalidAnalyticsQuery, fieldID)
+}
+
+// crossTabCategories lists a field's categories in form order, followed by any
+// answered values that are no longer options
+func crossTabCategories(field models.FormField, seen map[string]bool) []string {
+	categories := []string{}
+	listed := make(map[string]bool)
+
+	options := field.Options
+	if field.Type == models.FieldTypeRating {
+		options = []string{"1", "2", "3", "4", "5"}
+	}
+	for _, option := range options {
+		if !listed[option] {
+			categories = append(categories, option)
+			listed[option] = true
+		}
+	}
+
+	var extra []string
+	for value := range seen {
+		if !listed[value] {
+			extra = append(extra, value)
+		}
+	}
+	sort.Strings(extra)
+
+	return append(categories, extra...)
+}
@@ -0,0 +1,569 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"dune-takehome-server/database"
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AnalyticsService maintains materialized analytics aggregates so reads never
+// have to scan the responses collection
+type AnalyticsService struct {
+	formAggregates  *mongo.Collection
+	fieldAggregates *mongo.Collection
+	fieldTerms      *mongo.Collection
+	fieldValues     *mongo.Collection
+	responses       *mongo.Collection
+	sessions        *mongo.Collection
+	forms           *mongo.Collection
+	rebuilds        *mongo.Collection
+}
+
+func NewAnalyticsService() *AnalyticsService {
+	return &AnalyticsService{
+		formAggregates:  database.Database.Collection("form_aggregates"),
+		fieldAggregates: database.Database.Collection("field_aggregates"),
+		fieldTerms:      database.Database.Collection("field_terms"),
+		fieldValues:     database.Database.Collection("field_values"),
+		responses:       database.Database.Collection("responses"),
+		sessions:        database.Database.Collection("form_sessions"),
+		forms:           database.Database.Collection("forms"),
+		rebuilds:        database.Database.Collection("analytics_rebuilds"),
+	}
+}
+
+// BuildAnalyticsDelta describes how a response changes the analytics of its form
+func BuildAnalyticsDelta(form *models.Form, response *models.FormUserResponse) *models.AnalyticsDelta {
+	delta := &models.AnalyticsDelta{
+		FormID:      form.ID,
+		ResponseID:  response.ID,
+		SubmittedAt: response.SubmittedAt,
+		Client:      response.Client,
+		Fields:      []models.FieldDelta{},
+	}
+
+	for _, field := range form.Fields {
+		fieldDelta := buildFieldDelta(field, response.Responses[field.ID])
+		if analysis, ok := response.TextAnalysis[field.ID]; ok && fieldDelta.Counted && isFreeTextField(field.Type) {
+			fieldDelta.Text = &analysis
+		}
+		delta.Fields = append(delta.Fields, fieldDelta)
+	}
+
+	return delta
+}
+
+// buildFieldDelta mirrors the rules of the analyze*Field functions for a single value
+func buildFieldDelta(field models.FormField, value interface{}) models.FieldDelta {
+	delta := models.FieldDelta{
+		FieldID:  field.ID,
+		Answered: value != nil && value != "",
+	}
+
+	switch field.Type {
+	case models.FieldTypeText, models.FieldTypeTextarea, models.FieldTypeEmail:
+		if str, ok := value.(string); ok && str != "" {
+			delta.Counted = true
+			delta.Length = len(str)
+		}
+	case models.FieldTypeNumber:
+		if num, ok := numericValue(value, true); ok {
+			delta.Counted = true
+			delta.Value = &num
+		}
+	case models.FieldTypeSelect, models.FieldTypeRadio:
+		if str, ok := value.(string); ok && str != "" {
+			delta.Counted = true
+			delta.Options = []string{str}
+		}
+	case models.FieldTypeCheckbox:
+		if arr, ok := arrayValue(value); ok {
+			for _, item := range arr {
+				if str, ok := item.(string); ok && str != "" {
+					delta.Options = append(delta.Options, str)
+				}
+			}
+			delta.Counted = len(arr) > 0
+		}
+	case models.FieldTypeRating:
+		if rating, ok := numericValue(value, false); ok && rating >= 1 && rating <= 5 {
+			delta.Counted = true
+			delta.Value = &rating
+			delta.Options = []string{fmt.Sprintf("%.0f", rating)}
+		}
+	}
+
+	return delta
+}
+
+// RecordResponse applies a stored response to the form and field aggregates.
+// While the form is being rebuilt the response is left for the rebuild to count.
+func (s *AnalyticsService) RecordResponse(form *models.Form, response *models.FormUserResponse) (*models.AnalyticsDelta, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	delta := BuildAnalyticsDelta(form, response)
+	deferred, err := s.deferWhileRebuilding(ctx, form.ID, response.ID)
+	if err != nil || deferred {
+		return delta, err
+	}
+	return delta, s.applyDeltas(ctx, form, []*models.AnalyticsDelta{delta})
+}
+
+// RecordResponses applies a batch of stored responses to the form and field
+// aggregates, merging their deltas into one update per aggregate. While the
+// form is being rebuilt the responses are left for the rebuild to count.
+func (s *AnalyticsService) RecordResponses(form *models.Form, responses []*models.FormUserResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	deltas := make([]*models.AnalyticsDelta, 0, len(responses))
+	for _, response := range responses {
+		deltas = append(deltas, BuildAnalyticsDelta(form, response))
+	}
+
+	rebuilding, err := s.rebuilding(ctx, form.ID)
+	if err != nil {
+		return err
+	}
+	if !rebuilding {
+		return s.applyDeltas(ctx, form, deltas)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(responses))
+	for _, response := range responses {
+		ids = append(ids, response.ID)
+	}
+	if _, err := s.responses.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{"analytics_pending": true}}); err != nil {
+		return err
+	}
+	if rebuilding, err := s.rebuilding(ctx, form.ID); err != nil || rebuilding {
+		return err
+	}
+	// The rebuild ended meanwhile, and may have counted some of the responses
+	for _, delta := range deltas {
+		claimed, err := s.claimPendingResponse(ctx, delta.ResponseID)
+		if err != nil {
+			return err
+		}
+		if claimed {
+			if err := s.applyDeltas(ctx, form, []*models.AnalyticsDelta{delta}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyDeltas increments the aggregates of a form by the deltas of responses
+func (s *AnalyticsService) applyDeltas(ctx context.Context, form *models.Form, deltas []*models.AnalyticsDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	now := time.Now()
+
+	fieldTypes := make(map[string]models.FieldType)
+	for _, field := range form.Fields {
+		fieldTypes[field.ID] = field.Type
+	}
+
+	formUpdate := bson.M{}
+	var fieldWrites, termWrites, valueWrites []mongo.WriteModel
+	for _, delta := range deltas {
+		formInc := clientIncrements(delta.Client)
+		formInc["total_responses"] = 1
+		mergeUpdate(formUpdate, bson.M{
+			"$inc": formInc,
+			"$max": bson.M{"last_response_at": delta.SubmittedAt},
+			"$set": bson.M{"updated_at": now},
+		})
+
+		for _, fieldDelta := range delta.Fields {
+			fieldWrites = append(fieldWrites, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"form_id": form.ID, "field_id": fieldDelta.FieldID}).
+				SetUpdate(fieldDeltaUpdate(fieldDelta, fieldTypes[fieldDelta.FieldID], now)).
+				SetUpsert(true))
+		}
+		termWrites = append(termWrites, fieldTermWrites(form.ID, delta)...)
+		valueWrites = append(valueWrites, fieldValueWrites(form.ID, delta)...)
+	}
+
+	if _, err := s.formAggregates.UpdateOne(ctx, bson.M{"_id": form.ID}, formUpdate, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+	for _, bulk := range []struct {
+		collection *mongo.Collection
+		writes     []mongo.WriteModel
+	}{
+		{s.fieldAggregates, fieldWrites},
+		{s.fieldTerms, termWrites},
+		{s.fieldValues, valueWrites},
+	} {
+		if len(bulk.writes) == 0 {
+			continue
+		}
+		if _, err := bulk.collection.BulkWrite(ctx, mergeUpdateWrites(bulk.writes), options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fieldDeltaUpdate converts a field delta into an atomic aggregate update
+func fieldDeltaUpdate(delta models.FieldDelta, fieldType models.FieldType, now time.Time) bson.M {
+	inc := bson.M{}
+	if delta.Answered {
+		inc["answered_count"] = 1
+	}
+	if delta.Counted {
+		inc["value_count"] = 1
+	}
+	if delta.Length > 0 {
+		inc["total_length"] = delta.Length
+	}
+	for _, option := range delta.Options {
+		inc["distribution."+encodeAggregateKey(option)] = 1
+	}
+	if delta.Text != nil {
+		inc["languages."+encodeAggregateKey(delta.Text.Language)] = 1
+		if delta.Text.SentimentLabel != "" {
+			inc["sentiments."+encodeAggregateKey(delta.Text.SentimentLabel)] = 1
+			inc["sentiment_sum"] = delta.Text.Sentiment
+			inc["sentiment_count"] = 1
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{"field_type": fieldType, "updated_at": now},
+	}
+	if delta.Value != nil {
+		inc["sum"] = *delta.Value
+		update["$min"] = bson.M{"min": *delta.Value}
+		update["$max"] = bson.M{"max": *delta.Value}
+	}
+	if len(inc) > 0 {
+		update["$inc"] = inc
+	}
+
+	return update
+}
+
+// mergeUpdate adds the operators of an update to another, so applying the
+// merged update once has the effect of applying both
+func mergeUpdate(into, update bson.M) {
+	for operator, fields := range update {
+		merged, ok := into[operator].(bson.M)
+		if !ok {
+			merged = bson.M{}
+			into[operator] = merged
+		}
+		for name, value := range fields.(bson.M) {
+			current, exists := merged[name]
+			switch {
+			case !exists, operator == "$set":
+				merged[name] = value
+			case operator == "$inc":
+				merged[name] = addNumbers(current, value)
+			case operator == "$min" && lessThan(value, current), operator == "$max" && lessThan(current, value):
+				merged[name] = value
+			}
+		}
+	}
+}
+
+// mergeUpdateWrites merges the update writes that share a filter into one
+func mergeUpdateWrites(writes []mongo.WriteModel) []mongo.WriteModel {
+	var merged []mongo.WriteModel
+	byFilter := make(map[string]*mongo.UpdateOneModel)
+	for _, write := range writes {
+		model := write.(*mongo.UpdateOneModel)
+		key := fmt.Sprint(model.Filter)
+		if existing, ok := byFilter[key]; ok {
+			mergeUpdate(existing.Update.(bson.M), model.Update.(bson.M))
+			continue
+		}
+
+		update := bson.M{}
+		mergeUpdate(update, model.Update.(bson.M))
+		copied := *model
+		copied.Update = update
+		byFilter[key] = &copied
+		merged = append(merged, &copied)
+	}
+	return merged
+}
+
+// addNumbers adds two $inc amounts, keeping integers as integers
+func addNumbers(a, b interface{}) interface{} {
+	switch a := a.(type) {
+	case int:
+		if b, ok := b.(int); ok {
+			return a + b
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return a + b
+		}
+	}
+	x, _ := numericValue(a, false)
+	y, _ := numericValue(b, false)
+	return x + y
+}
+
+// lessThan compares two $min or $max operands, numbers or times
+func lessThan(a, b interface{}) bool {
+	if a, ok := a.(time.Time); ok {
+		b, _ := b.(time.Time)
+		return a.Before(b)
+	}
+	x, _ := numericValue(a, false)
+	y, _ := numericValue(b, false)
+	return x < y
+}
+
+// GetFormAnalytics builds the analytics for a form from its materialized aggregates
+func (s *AnalyticsService) GetFormAnalytics(form *models.Form) (*models.FormAnalytics, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var formAgg models.FormAggregate
+	err := s.formAggregates.FindOne(ctx, bson.M{"_id": form.ID}).Decode(&formAgg)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	cursor, err := s.fieldAggregates.Find(ctx, bson.M{"form_id": form.ID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var fieldAggs []*models.FieldAggregate
+	if err = cursor.All(ctx, &fieldAggs); err != nil {
+		return nil, err
+	}
+
+	byField := make(map[string]*models.FieldAggregate)
+	for _, agg := range fieldAggs {
+		byField[agg.FieldID] = agg
+	}
+
+	analytics := &models.FormAnalytics{
+		FormID:         form.ID,
+		FormTitle:      form.Title,
+		TotalResponses: formAgg.TotalResponses,
+		FieldAnalytics: []models.FieldAnalytics{},
+		Clients:        clientBreakdown(&formAgg),
+		CreatedAt:      time.Now(),
+	}
+
+	for _, field := range form.Fields {
+		agg := byField[field.ID]
+		if agg == nil {
+			agg = &models.FieldAggregate{FieldID: field.ID, FieldType: field.Type}
+		}
+		if agg.FieldType != field.Type {
+			log.Printf("⚠️ Aggregate for field %s of form %s was built as %s, rebuild analytics for the form", field.ID, form.ID.Hex(), agg.FieldType)
+			agg = &models.FieldAggregate{FieldID: field.ID, FieldType: field.Type}
+		}
+		if isFreeTextField(field.Type) {
+			if agg.Terms, err = s.topFieldTerms(ctx, form.ID, field.ID, models.TermKindTerm, topTermsLimit); err != nil {
+				return nil, err
+			}
+			if agg.Bigrams, err = s.topFieldTerms(ctx, form.ID, field.ID, models.TermKindBigram, topBigramsLimit); err != nil {
+				return nil, err
+			}
+		}
+		if field.Type == models.FieldTypeNumber || field.Type == models.FieldTypeRating {
+			if agg.ValueCounts, err = s.fieldValueCounts(ctx, form.ID, field.ID); err != nil {
+				return nil, err
+			}
+		}
+		analytics.FieldAnalytics = append(analytics.FieldAnalytics, fieldAnalyticsFromAggregate(field, agg))
+	}
+
+	if analytics.Funnel, err = s.storedFormFunnel(form, &formAgg); err != nil {
+		return nil, err
+	}
+
+	return analytics, nil
+}
+
+// fieldAnalyticsFromAggregate produces the same data shapes as the analyze*Field functions
+func fieldAnalyticsFromAggregate(field models.FormField, agg *models.FieldAggregate) models.FieldAnalytics {
+	data := make(map[string]interface{})
+	count := int(agg.ValueCount)
+
+	distribution := make(map[string]int)
+	for key, value := range agg.Distribution {
+		distribution[decodeAggregateKey(key)] = int(value)
+	}
+
+	switch field.Type {
+	case models.FieldTypeText, models.FieldTypeTextarea, models.FieldTypeEmail:
+		if count > 0 {
+			data["average_length"] = float64(agg.TotalLength) / float64(count)
+		} else {
+			data["average_length"] = 0
+		}
+		data["response_count"] = count
+		if isFreeTextField(field.Type) {
+			for key, value := range textFieldData(agg) {
+				data[key] = value
+			}
+		}
+	case models.FieldTypeNumber:
+		if count > 0 && agg.Min != nil && agg.Max != nil {
+			data["average"] = agg.Sum / float64(count)
+			data["min"] = *agg.Min
+			data["max"] = *agg.Max
+		} else {
+			data["average"] = 0
+			data["min"] = 0
+			data["max"] = 0
+		}
+		data["response_count"] = count
+		for key, value := range numericStatistics(decodeValueCounts(agg.ValueCounts)) {
+			data[key] = value
+		}
+	case models.FieldTypeSelect, models.FieldTypeRadio, models.FieldTypeCheckbox:
+		data["distribution"] = distribution
+		data["response_count"] = count
+	case models.FieldTypeRating:
+		if count > 0 {
+			data["average_rating"] = agg.Sum / float64(count)
+		} else {
+			data["average_rating"] = 0
+		}
+		data["distribution"] = distribution
+		data["response_count"] = count
+		for key, value := range numericStatistics(decodeValueCounts(agg.ValueCounts)) {
+			data[key] = value
+		}
+	}
+
+	return models.FieldAnalytics{
+		FieldID:       field.ID,
+		FieldLabel:    field.Label,
+		FieldType:     string(field.Type),
+		ResponseCount: agg.AnsweredCount,
+		Data:          data,
+	}
+}
+
+// backfillResponses rewrites every stored response of a form with the update
+// returned for it, in batches. Only the projected fields are decoded.
+func (s *AnalyticsService) backfillResponses(form *models.Form, projection bson.M, update func(*models.FormUserResponse) bson.M) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cursor, err := s.responses.Find(ctx, bson.M{"form_id": form.ID}, options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	const batchSize = 500
+	updated := 0
+	var writes []mongo.WriteModel
+
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		if _, err := s.responses.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+		updated += len(writes)
+		writes = writes[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var response models.FormUserResponse
+		if err := cursor.Decode(&response); err != nil {
+			return updated, err
+		}
+
+		writes = append(writes, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": response.ID}).SetUpdate(update(&response)))
+		if len(writes) == batchSize {
+			if err := flush(); err != nil {
+				return updated, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+
+	return updated, flush()
+}
+
+// aggregateKeyReplacer escapes characters MongoDB does not allow in field names
+var aggregateKeyReplacer = strings.NewReplacer(".", "．", "$", "＄")
+var aggregateKeyRestorer = strings.NewReplacer("．", ".", "＄", "$")
+
+func encodeAggregateKey(key string) string {
+	return aggregateKeyReplacer.Replace(key)
+}
+
+func decodeAggregateKey(key string) string {
+	return aggregateKeyRestorer.Replace(key)
+}
+
+// numericValue extracts a finite number from a decoded JSON or BSON value.
+// Infinities and NaN are dropped, since they would poison sums and histograms.
+func numericValue(value interface{}, allowString bool) (float64, bool) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case float32:
+		number = float64(v)
+	case int:
+		number = float64(v)
+	case int32:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case string:
+		if !allowString {
+			return 0, false
+		}
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false
+		}
+		number = parsed
+	default:
+		return 0, false
+	}
+	if math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, false
+	}
+	return number, true
+}
+
+// arrayValue extracts a list from a decoded JSON or BSON value
+func arrayValue(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case primitive.A:
+		return []interface{}(v), true
+	}
+	return nil, false
+}
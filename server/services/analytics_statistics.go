@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxHistogramBins caps the number of bins Sturges' rule can produce
+const maxHistogramBins = 20
+
+// valueCount is one distinct numeric answer and how many times it was given
+type valueCount struct {
+	value float64
+	count int64
+}
+
+// numericStatistics computes distribution statistics from value frequencies.
+// Percentiles interpolate linearly between ranks, the standard deviation is
+// the population one and outliers fall outside Tukey's fences (1.5 × IQR).
+func numericStatistics(frequencies map[float64]int64) map[string]interface{} {
+	stats := map[string]interface{}{
+		"median":        0,
+		"std_dev":       0,
+		"percentiles":   map[string]float64{"p25": 0, "p75": 0, "p90": 0},
+		"histogram":     []models.HistogramBin{},
+		"outlier_count": 0,
+	}
+
+	var values []valueCount
+	var total int64
+	var sum float64
+	for value, count := range frequencies {
+		if count <= 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+			continue
+		}
+		values = append(values, valueCount{value: value, count: count})
+		total += count
+		sum += value * float64(count)
+	}
+	if total == 0 {
+		return stats
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+
+	mean := sum / float64(total)
+	var squares float64
+	for _, vc := range values {
+		squares += float64(vc.count) * (vc.value - mean) * (vc.value - mean)
+	}
+
+	p25 := percentile(values, total, 0.25)
+	p75 := percentile(values, total, 0.75)
+	iqr := p75 - p25
+	lowerFence := p25 - 1.5*iqr
+	upperFence := p75 + 1.5*iqr
+
+	var outliers int64
+	for _, vc := range values {
+		if vc.value < lowerFence || vc.value > upperFence {
+			outliers += vc.count
+		}
+	}
+
+	stats["median"] = percentile(values, total, 0.5)
+	stats["std_dev"] = math.Sqrt(squares / float64(total))
+	stats["percentiles"] = map[string]float64{
+		"p25": p25,
+		"p75": p75,
+		"p90": percentile(values, total, 0.9),
+	}
+	stats["histogram"] = histogram(values, total)
+	stats["outlier_count"] = outliers
+
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted value frequencies
+func percentile(values []valueCount, total int64, p float64) float64 {
+	rank := p * float64(total-1)
+	lower := int64(math.Floor(rank))
+	upper := int64(math.Ceil(rank))
+
+	lowerValue := valueAtRank(values, lower)
+	upperValue := valueAtRank(values, upper)
+
+	return lowerValue + (upperValue-lowerValue)*(rank-float64(lower))
+}
+
+// valueAtRank returns the value at a zero-based position of the expanded, sorted list
+func valueAtRank(values []valueCount, rank int64) float64 {
+	var seen int64
+	for _, vc := range values {
+		seen += vc.count
+		if rank < seen {
+			return vc.value
+		}
+	}
+	return values[len(values)-1].value
+}
+
+// histogram bins sorted value frequencies with Sturges' rule
+func histogram(values []valueCount, total int64) []models.HistogramBin {
+	min := values[0].value
+	max := values[len(values)-1].value
+	if min == max {
+		return []models.HistogramBin{{Start: min, End: max, Count: total}}
+	}
+
+	binCount := int(math.Ceil(math.Log2(float64(total)))) + 1
+	if binCount > maxHistogramBins {
+		binCount = maxHistogramBins
+	}
+	if binCount > len(values) {
+		binCount = len(values)
+	}
+	width := (max - min) / float64(binCount)
+	edge := func(i int) float64 { return min + float64(i)*width }
+	if math.IsInf(width, 0) {
+		// Values span most of float64, so divide and interpolate without overflowing
+		width = max/float64(binCount) - min/float64(binCount)
+		edge = func(i int) float64 {
+			f := float64(i) / float64(binCount)
+			return min*(1-f) + max*f
+		}
+	}
+
+	bins := make([]models.HistogramBin, binCount)
+	for i := range bins {
+		bins[i].Start = edge(i)
+		bins[i].End = edge(i + 1)
+	}
+	bins[binCount-1].End = max
+
+	for _, vc := range values {
+		// Clamped to the bins, since the offset from min can still overflow
+		position := (vc.value - min) / width
+		index := binCount - 1
+		if position < float64(binCount-1) {
+			index = int(position)
+		}
+		if index < 0 {
+			index = 0
+		}
+		bins[index].Count += vc.count
+	}
+
+	return bins
+}
+
+// valueCountKey formats a numeric value as a frequency map key
+func valueCountKey(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// decodeValueCounts converts stored value frequencies back to numbers
+func decodeValueCounts(valueCounts map[string]int64) map[float64]int64 {
+	frequencies := make(map[float64]int64)
+	for key, count := range valueCounts {
+		value, err := strconv.ParseFloat(decodeAggregateKey(key), 64)
+		if err != nil {
+			continue
+		}
+		frequencies[value] += count
+	}
+	return frequencies
+}
+
+// fieldValueWrites counts the numeric answers of a response, one field_values
+// document per distinct value
+func fieldValueWrites(formID primitive.ObjectID, delta *models.AnalyticsDelta) []mongo.WriteModel {
+	var writes []mongo.WriteModel
+	for _, fieldDelta := range delta.Fields {
+		if fieldDelta.Value != nil {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"form_id": formID, "field_id": fieldDelta.FieldID, "value": *fieldDelta.Value}).
+				SetUpdate(bson.M{"$inc": bson.M{"count": 1}}).
+				SetUpsert(true))
+		}
+	}
+	return writes
+}
+
+// fieldValueCounts loads the value frequencies of a number or rating field,
+// keyed like the other aggregate maps
+func (s *AnalyticsService) fieldValueCounts(ctx context.Context, formID primitive.ObjectID, fieldID string) (map[string]int64, error) {
+	cursor, err := s.fieldValues.Find(ctx, bson.M{"form_id": formID, "field_id": fieldID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var values []models.FieldValue
+	if err := cursor.All(ctx, &values); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(values))
+	for _, value := range values {
+		counts[encodeAggregateKey(valueCountKey(value.Value))] = value.Count
+	}
+	return counts, nil
+}
+
+// replaceFieldValues replaces the stored value frequencies of a form with rebuilt ones
+func (s *AnalyticsService) replaceFieldValues(ctx context.Context, formID primitive.ObjectID, fieldAggs map[string]*models.FieldAggregate) error {
+	if _, err := s.fieldValues.DeleteMany(ctx, bson.M{"form_id": formID}); err != nil {
+		return err
+	}
+
+	var docs []interface{}
+	for _, agg := range fieldAggs {
+		for value, count := range decodeValueCounts(agg.ValueCounts) {
+			docs = append(docs, models.FieldValue{FormID: formID, FieldID: agg.FieldID, Value: value, Count: count})
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	_, err := s.fieldValues.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// chiSquareTest runs Pearson's chi-square test of independence on a contingency
+// table. Empty rows and columns do not count towards the degrees of freedom.
+func chiSquareTest(counts [][]int64, rowTotals, columnTotals []int64, total int64) (float64, int, float64) {
+	if total == 0 {
+		return 0, 0, 1
+	}
+
+	var chiSquare float64
+	for i, rowTotal := range rowTotals {
+		for j, columnTotal := range columnTotals {
+			expected := float64(rowTotal) * float64(columnTotal) / float64(total)
+			if expected == 0 {
+				continue
+			}
+			diff := float64(counts[i][j]) - expected
+			chiSquare += diff * diff / expected
+		}
+	}
+
+	nonEmptyRows, nonEmptyColumns := 0, 0
+	for _, rowTotal := range rowTotals {
+		if rowTotal > 0 {
+			nonEmptyRows++
+		}
+	}
+	for _, columnTotal := range columnTotals {
+		if columnTotal > 0 {
+			nonEmptyColumns++
+		}
+	}
+
+	df := (nonEmptyRows - 1) * (nonEmptyColumns - 1)
+	if df <= 0 {
+		return chiSquare, 0, 1
+	}
+
+	return chiSquare, df, 1 - regularizedGammaP(float64(df)/2, chiSquare/2)
+}
+
+// regularizedGammaP is the regularized lower incomplete gamma function P(a, x),
+// evaluated with its series expansion below a+1 and a continued fraction above
+func regularizedGammaP(a, x float64) float64 {
+	const epsilon = 1e-14
+	const maxIterations = 1000
+
+	if x <= 0 {
+		return 0
+	}
+
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		term := 1 / a
+		sum := term
+		for n := 1; n < maxIterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return sum * prefix
+	}
+
+	// Lentz's method for the continued fraction of Q(a, x)
+	tiny := 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < maxIterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return 1 - prefix*h
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func closeTo(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-9*math.Max(1, math.Abs(want))
+}
+
+func TestPercentile(t *testing.T) {
+	evenly := []valueCount{{1, 1}, {2, 1}, {3, 1}, {4, 1}}
+	repeated := []valueCount{{1, 3}, {10, 1}}
+	tests := []struct {
+		name   string
+		values []valueCount
+		p      float64
+		want   float64
+	}{
+		{"median between ranks", evenly, 0.5, 2.5},
+		{"p25", evenly, 0.25, 1.75},
+		{"p90", evenly, 0.9, 3.7},
+		{"minimum", evenly, 0, 1},
+		{"maximum", evenly, 1, 4},
+		{"median within a repeated value", repeated, 0.5, 1},
+		{"p90 across a repeated value", repeated, 0.9, 7.3},
+		{"single value", []valueCount{{5, 1}}, 0.75, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var total int64
+			for _, vc := range test.values {
+				total += vc.count
+			}
+			if got := percentile(test.values, total, test.p); !closeTo(got, test.want) {
+				t.Errorf("percentile(%v) = %v, want %v", test.p, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []valueCount
+		counts []int64
+	}{
+		// Sturges: ceil(log2 5) + 1 = 4 bins of width 24.75
+		{"outlier in the last bin", []valueCount{{1, 1}, {2, 1}, {3, 1}, {4, 1}, {100, 1}}, []int64{4, 0, 0, 1}},
+		{"one bin per distinct value at most", []valueCount{{1, 10}, {2, 10}}, []int64{10, 10}},
+		{"single value", []valueCount{{7, 3}}, []int64{3}},
+		{"capped bins", spread(30, 1<<15), nil},
+		{"values spanning float64", []valueCount{{-math.MaxFloat64, 1}, {0, 1}, {math.MaxFloat64, 1}}, []int64{1, 1, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var total int64
+			for _, vc := range test.values {
+				total += vc.count
+			}
+			bins := histogram(test.values, total)
+
+			var binned int64
+			counts := []int64{}
+			for i, bin := range bins {
+				if math.IsInf(bin.Start, 0) || math.IsNaN(bin.Start) || math.IsInf(bin.End, 0) || math.IsNaN(bin.End) {
+					t.Errorf("bin %d = %+v is not finite", i, bin)
+				}
+				binned += bin.Count
+				counts = append(counts, bin.Count)
+			}
+			if binned != total {
+				t.Errorf("binned %d of %d values", binned, total)
+			}
+			if test.counts != nil && !reflect.DeepEqual(counts, test.counts) {
+				t.Errorf("counts = %v, want %v", counts, test.counts)
+			}
+			if test.counts == nil && len(bins) != maxHistogramBins {
+				t.Errorf("%d bins, want %d", len(bins), maxHistogramBins)
+			}
+			if first, last := bins[0], bins[len(bins)-1]; first.Start != test.values[0].value || last.End != test.values[len(test.values)-1].value {
+				t.Errorf("bins span %v to %v", first.Start, last.End)
+			}
+		})
+	}
+}
+
+func spread(n int, count int64) []valueCount {
+	values := make([]valueCount, n)
+	for i := range values {
+		values[i] = valueCount{float64(i), count}
+	}
+	return values
+}
+
+func TestNumericStatistics(t *testing.T) {
+	stats := numericStatistics(map[float64]int64{1: 1, 2: 1, 3: 1, 4: 1, 100: 1, 50: 0})
+
+	if median := stats["median"].(float64); median != 3 {
+		t.Errorf("median = %v, want 3", median)
+	}
+	// Mean 22, squared deviations 441 + 400 + 361 + 324 + 6084
+	if stdDev := stats["std_dev"].(float64); !closeTo(stdDev, math.Sqrt(7610.0/5)) {
+		t.Errorf("std_dev = %v, want %v", stdDev, math.Sqrt(7610.0/5))
+	}
+	wantPercentiles := map[string]float64{"p25": 2, "p75": 4, "p90": 61.6}
+	for name, want := range wantPercentiles {
+		if got := stats["percentiles"].(map[string]float64)[name]; !closeTo(got, want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	// Tukey's fences are 2 - 3 and 4 + 3
+	if outliers := stats["outlier_count"].(int64); outliers != 1 {
+		t.Errorf("outlier_count = %v, want 1", outliers)
+	}
+	if bins := stats["histogram"].([]models.HistogramBin); len(bins) != 4 {
+		t.Errorf("histogram = %+v", bins)
+	}
+}
+
+func TestNumericStatisticsSkipsNonFinite(t *testing.T) {
+	stats := numericStatistics(map[float64]int64{math.Inf(1): 2, math.Inf(-1): 1, math.NaN(): 1, 2: 3})
+	if median := stats["median"].(float64); median != 2 {
+		t.Errorf("median = %v, want 2", median)
+	}
+	if stdDev := stats["std_dev"].(float64); stdDev != 0 {
+		t.Errorf("std_dev = %v, want 0", stdDev)
+	}
+	want := []models.HistogramBin{{Start: 2, End: 2, Count: 3}}
+	if bins := stats["histogram"].([]models.HistogramBin); !reflect.DeepEqual(bins, want) {
+		t.Errorf("histogram = %+v, want %+v", bins, want)
+	}
+
+	empty := numericStatistics(map[float64]int64{math.NaN(): 4})
+	if bins := empty["histogram"].([]models.HistogramBin); len(bins) != 0 || empty["median"] != 0 {
+		t.Errorf("only non-finite values: %v", empty)
+	}
+}
+
+func TestFieldValueWrites(t *testing.T) {
+	formID := primitive.NewObjectID()
+	age, rating := 42.0, 4.0
+	delta := &models.AnalyticsDelta{Fields: []models.FieldDelta{
+		{FieldID: "age", Value: &age},
+		{FieldID: "email", Length: 12},
+		{FieldID: "rating", Value: &rating},
+	}}
+
+	var got []interface{}
+	for _, write := range fieldValueWrites(formID, delta) {
+		got = append(got, write.(*mongo.UpdateOneModel).Filter)
+	}
+	want := []interface{}{
+		bson.M{"form_id": formID, "field_id": "age", "value": 42.0},
+		bson.M{"form_id": formID, "field_id": "rating", "value": 4.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filters = %v, want %v", got, want)
+	}
+
+	// Values are not counted in the field aggregate itself
+	if update := fieldDeltaUpdate(delta.Fields[0], models.FieldTypeNumber, time.Time{}); len(update["$inc"].(bson.M)) != 1 {
+		t.Errorf("aggregate increments = %v, want only the sum", update["$inc"])
+	}
+}
+
+func TestMergeUpdateWrites(t *testing.T) {
+	formID := primitive.NewObjectID()
+	now := time.Now()
+	write := func(fieldID string, value float64) mongo.WriteModel {
+		delta := buildFieldDelta(models.FormField{ID: fieldID, Type: models.FieldTypeRating}, value)
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"form_id": formID, "field_id": fieldID}).
+			SetUpdate(fieldDeltaUpdate(delta, models.FieldTypeRating, now)).
+			SetUpsert(true)
+	}
+
+	merged := mergeUpdateWrites([]mongo.WriteModel{write("speed", 4.0), write("price", 1.0), write("speed", 2.0)})
+	if len(merged) != 2 {
+		t.Fatalf("writes = %d, want 2", len(merged))
+	}
+	update := merged[0].(*mongo.UpdateOneModel).Update.(bson.M)
+	wantInc := bson.M{"answered_count": 2, "value_count": 2, "sum": 6.0, "distribution.4": 1, "distribution.2": 1}
+	if !reflect.DeepEqual(update["$inc"], wantInc) {
+		t.Errorf("$inc = %v, want %v", update["$inc"], wantInc)
+	}
+	if want := (bson.M{"min": 2.0}); !reflect.DeepEqual(update["$min"], want) {
+		t.Errorf("$min = %v, want %v", update["$min"], want)
+	}
+	if want := (bson.M{"max": 4.0}); !reflect.DeepEqual(update["$max"], want) {
+		t.Errorf("$max = %v, want %v", update["$max"], want)
+	}
+	if price := merged[1].(*mongo.UpdateOneModel).Update.(bson.M)["$inc"].(bson.M); price["sum"] != 1.0 {
+		t.Errorf("price sum = %v, want 1", price["sum"])
+	}
+
+	// The latest submission time is kept
+	formUpdate := bson.M{}
+	mergeUpdate(formUpdate, bson.M{"$max": bson.M{"last_response_at": now}})
+	mergeUpdate(formUpdate, bson.M{"$max": bson.M{"last_response_at": now.Add(-time.Hour)}})
+	if got := formUpdate["$max"].(bson.M)["last_response_at"]; got != now {
+		t.Errorf("last_response_at = %v, want %v", got, now)
+	}
+}
+
+func TestNumericValue(t *testing.T) {
+	tests := []struct {
+		value       interface{}
+		allowString bool
+		want        float64
+		ok          bool
+	}{
+		{4.5, false, 4.5, true},
+		{int32(3), false, 3, true},
+		{"12", true, 12, true},
+		{"12", false, 0, false},
+		{"many", true, 0, false},
+		{math.Inf(1), false, 0, false},
+		{math.NaN(), false, 0, false},
+		{"Inf", true, 0, false},
+		{"NaN", true, 0, false},
+		{true, false, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := numericValue(test.value, test.allowString)
+		if got != test.want || ok != test.ok {
+			t.Errorf("numericValue(%#v, %v) = %v, %v, want %v, %v", test.value, test.allowString, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestRegularizedGammaP(t *testing.T) {
+	tests := []struct {
+		a, x float64
+		want float64
+	}{
+		{1, 0.5, 1 - math.Exp(-0.5)}, // P(1, x) = 1 - e^-x
+		{1, 10, 1 - math.Exp(-10)},
+		{0.5, 0.3, math.Erf(math.Sqrt(0.3))}, // P(1/2, x) = erf(√x)
+		{0.5, 4, math.Erf(2)},
+		{2, 3, 1 - 4*math.Exp(-3)}, // P(2, x) = 1 - (1 + x)e^-x
+		{3, 0, 0},
+	}
+	for _, test := range tests {
+		if got := regularizedGammaP(test.a, test.x); !closeTo(got, test.want) {
+			t.Errorf("P(%v, %v) = %v, want %v", test.a, test.x, got, test.want)
+		}
+	}
+}
+
+// Critical values of the chi-square distribution, from standard tables
+func TestChiSquarePValue(t *testing.T) {
+	tests := []struct {
+		chiSquare float64
+		df        int
+		want      float64
+	}{
+		{3.841458820694124, 1, 0.05},
+		{6.634896601021213, 1, 0.01},
+		{9.487729036781154, 4, 0.05},
+		{13.276704135987622, 4, 0.01},
+		{1.063623216792, 4, 0.9},
+		{18.307038053275146, 10, 0.05},
+	}
+	for _, test := range tests {
+		got := 1 - regularizedGammaP(float64(test.df)/2, test.chiSquare/2)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("p(χ² = %v, df = %d) = %v, want %v", test.chiSquare, test.df, got, test.want)
+		}
+	}
+}
+
+func TestChiSquareTest(t *testing.T) {
+	tests := []struct {
+		name      string
+		counts    [][]int64
+		chiSquare float64
+		df        int
+		pValue    float64
+	}{
+		// Every expected count is 25, so χ² = 4 × 5²/25
+		{"2×2", [][]int64{{20, 30}, {30, 20}}, 4, 1, math.Erfc(math.Sqrt(2))},
+		{"independent", [][]int64{{10, 20}, {20, 40}}, 0, 1, 1},
+		{"empty row ignored", [][]int64{{20, 30}, {0, 0}, {30, 20}}, 4, 1, math.Erfc(math.Sqrt(2))},
+		{"single column", [][]int64{{5}, {7}}, 0, 0, 1},
+		{"no responses", [][]int64{{0, 0}, {0, 0}}, 0, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rowTotals := make([]int64, len(test.counts))
+			columnTotals := make([]int64, len(test.counts[0]))
+			var total int64
+			for i, row := range test.counts {
+				for j, count := range row {
+					rowTotals[i] += count
+					columnTotals[j] += count
+					total += count
+				}
+			}
+
+			chiSquare, df, pValue := chiSquareTest(test.counts, rowTotals, columnTotals, total)
+			if !closeTo(chiSquare, test.chiSquare) || df != test.df || !closeTo(pValue, test.pValue) {
+				t.Errorf("chiSquareTest = %v, %d, %v, want %v, %d, %v", chiSquare, df, pValue, test.chiSquare, test.df, test.pValue)
+			}
+		})
+	}
+}
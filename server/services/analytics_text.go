@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Word cloud sizes returned with text field analytics
+const (
+	topTermsLimit   = 50
+	topBigramsLimit = 25
+)
+
+// maxSentimentResponses caps how many answers a sentiment triage request returns
+const maxSentimentResponses = 100
+
+// AnalyzeText tokenizes a free-text answer, detects its language and scores its
+// sentiment. Terms and bigrams are deduplicated so an answer counts once per term.
+// Answers in a language the sentiment lexicon does not cover are not scored.
+func AnalyzeText(text string) models.TextAnalysis {
+	tokens := utils.Tokenize(text)
+	language := utils.DetectLanguage(tokens)
+	terms := utils.RemoveStopWords(tokens, language)
+
+	analysis := models.TextAnalysis{
+		Language: language,
+		Terms:    distinct(terms),
+		Bigrams:  distinct(utils.Bigrams(terms)),
+	}
+	if utils.SentimentSupported(language) {
+		analysis.Sentiment = utils.SentimentScore(tokens)
+		analysis.SentimentLabel = utils.SentimentLabel(analysis.Sentiment)
+	}
+	return analysis
+}
+
+// analyzeResponseText analyzes every text and textarea answer of a response
+func analyzeResponseText(form *models.Form, answers map[string]interface{}) map[string]models.TextAnalysis {
+	analyses := make(map[string]models.TextAnalysis)
+	for _, field := range form.Fields {
+		if !isFreeTextField(field.Type) {
+			continue
+		}
+		if str, ok := answers[field.ID].(string); ok && str != "" {
+			analyses[field.ID] = AnalyzeText(str)
+		}
+	}
+	if len(analyses) == 0 {
+		return nil
+	}
+	return analyses
+}
+
+// isFreeTextField reports whether a field type gets text analytics. Email
+// fields are excluded since their words carry no meaning.
+func isFreeTextField(fieldType models.FieldType) bool {
+	return fieldType == models.FieldTypeText || fieldType == models.FieldTypeTextarea
+}
+
+func distinct(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// textFieldData builds the word cloud, language and sentiment data of a text field
+func textFieldData(agg *models.FieldAggregate) map[string]interface{} {
+	languages := make(map[string]int64)
+	for key, count := range agg.Languages {
+		languages[decodeAggregateKey(key)] = count
+	}
+
+	average := 0.0
+	if agg.SentimentCount > 0 {
+		average = agg.SentimentSum / float64(agg.SentimentCount)
+	}
+
+	return map[string]interface{}{
+		"top_terms":   topTerms(agg.Terms, topTermsLimit),
+		"top_bigrams": topTerms(agg.Bigrams, topBigramsLimit),
+		"languages":   languages,
+		"sentiment": map[string]interface{}{
+			"average":        average,
+			"analyzed_count": agg.SentimentCount,
+			"positive":       agg.Sentiments[utils.SentimentPositive],
+			"neutral":        agg.Sentiments[utils.SentimentNeutral],
+			"negative":       agg.Sentiments[utils.SentimentNegative],
+		},
+	}
+}
+
+// topTerms returns the most frequent terms, ties broken alphabetically
+func topTerms(counts map[string]int64, limit int) []models.TermCount {
+	terms := []models.TermCount{}
+	for key, count := range counts {
+		terms = append(terms, models.TermCount{Term: decodeAggregateKey(key), Count: count})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+	return terms
+}
+
+// fieldTermWrites counts the terms and bigrams of a response's text answers,
+// one field_terms document per term
+func fieldTermWrites(formID primitive.ObjectID, delta *models.AnalyticsDelta) []mongo.WriteModel {
+	var writes []mongo.WriteModel
+	count := func(fieldID string, kind models.TermKind, terms []string) {
+		for _, term := range terms {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"form_id": formID, "field_id": fieldID, "kind": kind, "term": term}).
+				SetUpdate(bson.M{"$inc": bson.M{"count": 1}}).
+				SetUpsert(true))
+		}
+	}
+	for _, fieldDelta := range delta.Fields {
+		if fieldDelta.Text != nil {
+			count(fieldDelta.FieldID, models.TermKindTerm, fieldDelta.Text.Terms)
+			count(fieldDelta.FieldID, models.TermKindBigram, fieldDelta.Text.Bigrams)
+		}
+	}
+	return writes
+}
+
+// topFieldTerms loads the most frequent terms or bigrams of a text field, keyed
+// like the other aggregate maps
+func (s *AnalyticsService) topFieldTerms(ctx context.Context, formID primitive.ObjectID, fieldID string, kind models.TermKind, limit int) (map[string]int64, error) {
+	cursor, err := s.fieldTerms.Find(ctx,
+		bson.M{"form_id": formID, "field_id": fieldID, "kind": kind},
+		options.Find().
+			SetSort(bson.D{{Key: "count", Value: -1}, {Key: "term", Value: 1}}).
+			SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var terms []models.FieldTerm
+	if err := cursor.All(ctx, &terms); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(terms))
+	for _, term := range terms {
+		counts[encodeAggregateKey(term.Term)] = term.Count
+	}
+	return counts, nil
+}
+
+// replaceFieldTerms replaces the stored term counts of a form with rebuilt ones
+func (s *AnalyticsService) replaceFieldTerms(ctx context.Context, formID primitive.ObjectID, fieldAggs map[string]*models.FieldAggregate) error {
+	if _, err := s.fieldTerms.DeleteMany(ctx, bson.M{"form_id": formID}); err != nil {
+		return err
+	}
+
+	var docs []interface{}
+	add := func(fieldID string, kind models.TermKind, counts map[string]int64) {
+		for key, count := range counts {
+			docs = append(docs, models.FieldTerm{FormID: formID, FieldID: fieldID, Kind: kind, Term: decodeAggregateKey(key), Count: count})
+		}
+	}
+	for _, agg := range fieldAggs {
+		add(agg.FieldID, models.TermKindTerm, agg.Terms)
+		add(agg.FieldID, models.TermKindBigram, agg.Bigrams)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	_, err := s.fieldTerms.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// textAnalysisExpression reads a field's stored text analysis from a response
+func textAnalysisExpression(fieldID string) bson.M {
+	return bson.M{"$getField": bson.M{
+		"field": bson.M{"$literal": fieldID},
+		"input": "$text_analysis",
+	}}
+}
+
+// fieldTextFacets builds the $facet branches counting terms, bigrams and the
+// language and sentiment of a text field's analyzed answers
+func fieldTextFacets(field models.FormField) (bson.A, bson.A, bson.A) {
+	extract := bson.A{
+		bson.M{"$project": bson.M{"t": textAnalysisExpression(field.ID)}},
+		bson.M{"$match": bson.M{"t": bson.M{"$type": "object"}}},
+	}
+
+	terms := append(bson.A{}, extract...)
+	terms = append(terms,
+		bson.M{"$unwind": "$t.terms"},
+		bson.M{"$group": bson.M{"_id": "$t.terms", "count": bson.M{"$sum": 1}}},
+	)
+
+	bigrams := append(bson.A{}, extract...)
+	bigrams = append(bigrams,
+		bson.M{"$unwind": "$t.bigrams"},
+		bson.M{"$group": bson.M{"_id": "$t.bigrams", "count": bson.M{"$sum": 1}}},
+	)
+
+	summary := append(bson.A{}, extract...)
+	summary = append(summary,
+		bson.M{"$group": bson.M{
+			"_id":           bson.M{"language": "$t.language", "label": "$t.sentiment_label"},
+			"count":         bson.M{"$sum": 1},
+			"sentiment_sum": bson.M{"$sum": "$t.sentiment"},
+		}},
+	)
+
+	return terms, bigrams, summary
+}
+
+// decodeTextFacets fills a field aggregate from the branches built by fieldTextFacets
+func decodeTextFacets(result bson.Raw, index int, agg *models.FieldAggregate) error {
+	var terms, bigrams []struct {
+		Term  string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := result.Lookup(termsFacetName(index)).Unmarshal(&terms); err != nil {
+		return err
+	}
+	if err := result.Lookup(bigramsFacetName(index)).Unmarshal(&bigrams); err != nil {
+		return err
+	}
+
+	var summary []struct {
+		ID struct {
+			Language string `bson:"language"`
+			Label    string `bson:"label"`
+		} `bson:"_id"`
+		Count        int64   `bson:"count"`
+		SentimentSum float64 `bson:"sentiment_sum"`
+	}
+	if err := result.Lookup(textSummaryFacetName(index)).Unmarshal(&summary); err != nil {
+		return err
+	}
+
+	agg.Terms = make(map[string]int64)
+	for _, term := range terms {
+		agg.Terms[encodeAggregateKey(term.Term)] = term.Count
+	}
+	agg.Bigrams = make(map[string]int64)
+	for _, bigram := range bigrams {
+		agg.Bigrams[encodeAggregateKey(bigram.Term)] = bigram.Count
+	}
+	agg.Languages = make(map[string]int64)
+	agg.Sentiments = make(map[string]int64)
+	for _, group := range summary {
+		agg.Languages[encodeAggregateKey(group.ID.Language)] += group.Count
+		if group.ID.Label == "" {
+			continue // Not scored
+		}
+		agg.Sentiments[encodeAggregateKey(group.ID.Label)] += group.Count
+		agg.SentimentSum += group.SentimentSum
+		agg.SentimentCount += group.Count
+	}
+
+	return nil
+}
+
+func termsFacetName(index int) string {
+	return fmt.Sprintf("field_%d_terms", index)
+}
+
+func bigramsFacetName(index int) string {
+	return fmt.Sprintf("field_%d_bigrams", index)
+}
+
+func textSummaryFacetName(index int) string {
+	return fmt.Sprintf("field_%d_text", index)
+}
+
+// GetTextResponses lists the analyzed answers of a text field matching the
+// query, most negative first, or most positive first when filtering on the
+// positive label, so open-ended feedback can be triaged without reading it all
+func (s *AnalyticsService) GetTextResponses(form *models.Form, fieldID, label string, limit int, query models.AnalyticsQuery) ([]models.TextResponseSentiment, error) {
+	var field *models.FormField
+	for i := range form.Fields {
+		if form.Fields[i].ID == fieldID {
+			field = &form.Fields[i]
+		}
+	}
+	if field == nil {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidAnalyticsQuery, fieldID)
+	}
+	if !isFreeTextField(field.Type) {
+		return nil, fmt.Errorf("%w: field %q is not a text or textarea field", ErrInvalidAnalyticsQuery, fieldID)
+	}
+	switch label {
+	case "", utils.SentimentPositive, utils.SentimentNeutral, utils.SentimentNegative:
+	default:
+		return nil, fmt.Errorf("%w: sentiment must be positive, neutral or negative", ErrInvalidAnalyticsQuery)
+	}
+	if limit <= 0 || limit > maxSentimentResponses {
+		limit = maxSentimentResponses
+	}
+
+	match, err := analyticsMatch(form, query)
+	if err != nil {
+		return nil, err
+	}
+
+	order := 1
+	if label == utils.SentimentPositive {
+		order = -1
+	}
+
+	analyzed := bson.M{"t": bson.M{"$type": "object"}, "t.sentiment_label": bson.M{"$exists": true}}
+	if label != "" {
+		analyzed["t.sentiment_label"] = label
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := s.responses.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$project": bson.M{
+			"submitted_at": 1,
+			"text":         fieldValueExpression(field.ID),
+			"t":            textAnalysisExpression(field.ID),
+		}},
+		bson.M{"$match": analyzed},
+		bson.M{"$sort": bson.D{{Key: "t.sentiment", Value: order}, {Key: "submitted_at", Value: -1}}},
+		bson.M{"$limit": limit},
+		bson.M{"$project": bson.M{
+			"submitted_at":    1,
+			"text":            1,
+			"language":        "$t.language",
+			"sentiment":       "$t.sentiment",
+			"sentiment_label": "$t.sentiment_label",
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	responses := []models.TextResponseSentiment{}
+	if err := cursor.All(ctx, &responses); err != nil {
+		return nil, err
+	}
+
+	return responses, nil
+}
+
+// BackfillTextAnalysis analyzes the text answers of every stored response of a
+// form, for responses submitted before text analytics existed or after the
+// lexicon changed. Aggregates must be rebuilt afterwards.
+func (s *AnalyticsService) BackfillTextAnalysis(form *models.Form) (int, error) {
+	return s.backfillResponses(form, bson.M{"responses": 1}, func(response *models.FormUserResponse) bson.M {
+		if analyses := analyzeResponseText(form, response.Responses); analyses != nil {
+			return bson.M{"$set": bson.M{"text_analysis": analyses}}
+		}
+		return bson.M{"$unset": bson.M{"text_analysis": ""}}
+	})
+}
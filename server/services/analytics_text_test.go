@@ -0,0 +1,64 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAnalyzeText(t *testing.T) {
+	english := AnalyzeText("The support was terrible, terrible support")
+	if english.Language != "en" || english.SentimentLabel != utils.SentimentNegative || english.Sentiment >= 0 {
+		t.Errorf("English answer = %+v", english)
+	}
+	if want := []string{"support", "terrible"}; !reflect.DeepEqual(english.Terms, want) {
+		t.Errorf("terms = %q, want %q", english.Terms, want)
+	}
+	if want := []string{"support terrible", "terrible terrible", "terrible support"}; !reflect.DeepEqual(english.Bigrams, want) {
+		t.Errorf("bigrams = %q, want %q", english.Bigrams, want)
+	}
+
+	// The lexicon is English, so other languages are not scored
+	french := AnalyzeText("Le service est très bien, merci")
+	if french.Language != "fr" || french.SentimentLabel != "" || french.Sentiment != 0 {
+		t.Errorf("French answer = %+v", french)
+	}
+	if want := []string{"service", "merci"}; !reflect.DeepEqual(french.Terms, want) {
+		t.Errorf("terms = %q, want %q", french.Terms, want)
+	}
+
+	if short := AnalyzeText("great app"); short.SentimentLabel != utils.SentimentPositive {
+		t.Errorf("undetermined answer = %+v", short)
+	}
+}
+
+func TestFieldTermWrites(t *testing.T) {
+	formID := primitive.NewObjectID()
+	delta := &models.AnalyticsDelta{Fields: []models.FieldDelta{
+		{FieldID: "age"},
+		{FieldID: "feedback", Text: &models.TextAnalysis{Terms: []string{"slow", "checkout"}, Bigrams: []string{"slow checkout"}}},
+	}}
+
+	var got []interface{}
+	for _, write := range fieldTermWrites(formID, delta) {
+		got = append(got, write.(*mongo.UpdateOneModel).Filter)
+	}
+	want := []interface{}{
+		bsonFilter(formID, "feedback", models.TermKindTerm, "slow"),
+		bsonFilter(formID, "feedback", models.TermKindTerm, "checkout"),
+		bsonFilter(formID, "feedback", models.TermKindBigram, "slow checkout"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filters = %v, want %v", got, want)
+	}
+}
+
+func bsonFilter(formID primitive.ObjectID, fieldID string, kind models.TermKind, term string) interface{} {
+	return bson.M{"form_id": formID, "field_id": fieldID, "kind": kind, "term": term}
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxTimeSeriesBuckets caps the number of buckets a single series can return
+const maxTimeSeriesBuckets = 5000
+
+var ErrInvalidTimeSeriesInterval = errors.New("interval must be hour, day or week")
+var ErrTimeSeriesTooLarge = fmt.Errorf("time series would exceed %d buckets, narrow the date range or use a larger interval", maxTimeSeriesBuckets)
+
+// GetFormTimeSeries returns responses over time for a form, bucketed by the
+// query interval in the query timezone, with a day-of-week by hour heatmap and
+// the per-bucket average of every number and rating field
+func (s *AnalyticsService) GetFormTimeSeries(form *models.Form, query models.TimeSeriesQuery) (*models.FormTimeSeries, error) {
+	loc, err := time.LoadLocation(query.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	if !validTimeSeriesInterval(query.Interval) {
+		return nil, ErrInvalidTimeSeriesInterval
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	match := bson.M{"form_id": form.ID}
+	submittedAt := bson.M{}
+	if query.From != nil {
+		submittedAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		submittedAt["$lt"] = *query.To
+	}
+	if len(submittedAt) > 0 {
+		match["submitted_at"] = submittedAt
+	}
+
+	bucket := bucketExpression(query.Interval, query.Timezone)
+	facets := bson.M{
+		"buckets": bson.A{
+			bson.M{"$group": bson.M{"_id": bucket, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.M{"_id": 1}},
+		},
+		"heatmap": bson.A{
+			bson.M{"$group": bson.M{
+				"_id": bson.M{
+					"day_of_week": bson.M{"$dayOfWeek": bson.M{"date": "$submitted_at", "timezone": query.Timezone}},
+					"hour":        bson.M{"$hour": bson.M{"date": "$submitted_at", "timezone": query.Timezone}},
+				},
+				"count": bson.M{"$sum": 1},
+			}},
+		},
+	}
+
+	var trendFields []models.FormField
+	for _, field := range form.Fields {
+		if field.Type != models.FieldTypeNumber && field.Type != models.FieldTypeRating {
+			continue
+		}
+		stages := append(bson.A{}, fieldExtractStages(field)...)
+		stages = append(stages,
+			bson.M{"$match": bson.M{"n": bson.M{"$ne": nil}}},
+			bson.M{"$group": bson.M{
+				"_id":     bucket,
+				"average": bson.M{"$avg": "$n"},
+				"count":   bson.M{"$sum": 1},
+			}},
+			bson.M{"$sort": bson.M{"_id": 1}},
+			bson.M{"$project": bson.M{"_id": 0, "start": "$_id", "average": 1, "count": 1}},
+		)
+		facets[trendFacetName(len(trendFields))] = stages
+		trendFields = append(trendFields, field)
+	}
+
+	cursor, err := s.responses.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$facet": facets},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []bson.Raw
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("time series pipeline returned no result")
+	}
+	result := results[0]
+
+	var buckets []struct {
+		Start time.Time `bson:"_id"`
+		Count int64     `bson:"count"`
+	}
+	if err := result.Lookup("buckets").Unmarshal(&buckets); err != nil {
+		return nil, err
+	}
+
+	var cells []struct {
+		ID struct {
+			DayOfWeek int `bson:"day_of_week"`
+			Hour      int `bson:"hour"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := result.Lookup("heatmap").Unmarshal(&cells); err != nil {
+		return nil, err
+	}
+
+	series := &models.FormTimeSeries{
+		FormID:      form.ID,
+		Interval:    query.Interval,
+		Timezone:    query.Timezone,
+		Buckets:     []models.TimeSeriesBucket{},
+		FieldTrends: []models.FieldTrend{},
+		CreatedAt:   time.Now(),
+	}
+
+	for _, cell := range cells {
+		// $dayOfWeek is 1 (Sunday) through 7 (Saturday)
+		series.Heatmap[cell.ID.DayOfWeek-1][cell.ID.Hour] = cell.Count
+	}
+
+	// Cumulative counts include responses submitted before the requested range
+	var cumulative int64
+	if query.From != nil {
+		cumulative, err = s.responses.CountDocuments(ctx, bson.M{
+			"form_id":      form.ID,
+			"submitted_at": bson.M{"$lt": *query.From},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	counts := make(map[int64]int64)
+	for _, bucket := range buckets {
+		counts[bucket.Start.Unix()] = bucket.Count
+	}
+	if len(buckets) > 0 {
+		last := buckets[len(buckets)-1].Start.In(loc)
+		for start := buckets[0].Start.In(loc); !start.After(last); start = nextBucketStart(start, query.Interval, loc) {
+			if len(series.Buckets) == maxTimeSeriesBuckets {
+				return nil, ErrTimeSeriesTooLarge
+			}
+			count := counts[start.Unix()]
+			cumulative += count
+			series.Buckets = append(series.Buckets, models.TimeSeriesBucket{
+				Start:      start,
+				Count:      count,
+				Cumulative: cumulative,
+			})
+		}
+	}
+
+	for i, field := range trendFields {
+		var points []models.TrendPoint
+		if err := result.Lookup(trendFacetName(i)).Unmarshal(&points); err != nil {
+			return nil, err
+		}
+		for j := range points {
+			points[j].Start = points[j].Start.In(loc)
+		}
+		if points == nil {
+			points = []models.TrendPoint{}
+		}
+
+		series.FieldTrends = append(series.FieldTrends, models.FieldTrend{
+			FieldID:    field.ID,
+			FieldLabel: field.Label,
+			FieldType:  string(field.Type),
+			Points:     points,
+		})
+	}
+
+	return series, nil
+}
+
+// BuildTimeSeriesUpdate describes the buckets a response falls into in the given timezone
+func BuildTimeSeriesUpdate(form *models.Form, response *models.FormUserResponse, timezone string) (*models.TimeSeriesUpdate, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	local := response.SubmittedAt.In(loc)
+	update := &models.TimeSeriesUpdate{
+		FormID:   form.ID,
+		Timezone: timezone,
+		Buckets: map[models.TimeSeriesInterval]time.Time{
+			models.TimeSeriesHour: bucketStart(local, models.TimeSeriesHour, loc),
+			models.TimeSeriesDay:  bucketStart(local, models.TimeSeriesDay, loc),
+			models.TimeSeriesWeek: bucketStart(local, models.TimeSeriesWeek, loc),
+		},
+		DayOfWeek:   int(local.Weekday()),
+		Hour:        local.Hour(),
+		Values:      make(map[string]float64),
+		SubmittedAt: response.SubmittedAt,
+	}
+
+	for _, fieldDelta := range BuildAnalyticsDelta(form, response).Fields {
+		if fieldDelta.Value != nil {
+			update.Values[fieldDelta.FieldID] = *fieldDelta.Value
+		}
+	}
+
+	return update, nil
+}
+
+func validTimeSeriesInterval(interval models.TimeSeriesInterval) bool {
+	switch interval {
+	case models.TimeSeriesHour, models.TimeSeriesDay, models.TimeSeriesWeek:
+		return true
+	}
+	return false
+}
+
+// bucketExpression truncates submitted_at to the start of its bucket. Weeks
+// start on Monday, matching bucketStart.
+func bucketExpression(interval models.TimeSeriesInterval, timezone string) bson.M {
+	trunc := bson.M{
+		"date":     "$submitted_at",
+		"unit":     string(interval),
+		"timezone": timezone,
+	}
+	if interval == models.TimeSeriesWeek {
+		trunc["startOfWeek"] = "monday"
+	}
+	return bson.M{"$dateTrunc": trunc}
+}
+
+// bucketStart is the Go equivalent of bucketExpression
+func bucketStart(t time.Time, interval models.TimeSeriesInterval, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch interval {
+	case models.TimeSeriesHour:
+		// Subtracting avoids time.Date, which is ambiguous in the repeated hour of a DST change
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case models.TimeSeriesWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucketStart returns the start of the bucket after the one starting at
+// start. Days are added in loc, since they are 23 or 25 hours long around DST
+// changes.
+func nextBucketStart(start time.Time, interval models.TimeSeriesInterval, loc *time.Location) time.Time {
+	start = start.In(loc)
+	switch interval {
+	case models.TimeSeriesHour:
+		return bucketStart(start.Add(time.Hour), interval, loc)
+	case models.TimeSeriesWeek:
+		return bucketStart(start.AddDate(0, 0, 7), interval, loc)
+	default:
+		return bucketStart(start.AddDate(0, 0, 1), interval, loc)
+	}
+}
+
+func trendFacetName(index int) string {
+	return fmt.Sprintf("trend_%d", index)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+)
+
+// New York springs forward at 2024-03-10 02:00 and falls back at 2024-11-03
+// 02:00, repeating the hour from 01:00
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	return loc
+}
+
+func utc(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestBucketStartAcrossDST(t *testing.T) {
+	loc := newYork(t)
+	tests := []struct {
+		name     string
+		at       time.Time
+		interval models.TimeSeriesInterval
+		want     time.Time
+	}{
+		{"hour before the spring gap", utc(2024, 3, 10, 6, 59), models.TimeSeriesHour, utc(2024, 3, 10, 6, 0)},
+		{"hour after the spring gap", utc(2024, 3, 10, 7, 15), models.TimeSeriesHour, utc(2024, 3, 10, 7, 0)},
+		{"first 01:30 in the fall", utc(2024, 11, 3, 5, 30), models.TimeSeriesHour, utc(2024, 11, 3, 5, 0)},
+		{"repeated 01:30 in the fall", utc(2024, 11, 3, 6, 30), models.TimeSeriesHour, utc(2024, 11, 3, 6, 0)},
+		{"spring day", utc(2024, 3, 10, 19, 0), models.TimeSeriesDay, utc(2024, 3, 10, 5, 0)},
+		{"fall day", utc(2024, 11, 4, 4, 0), models.TimeSeriesDay, utc(2024, 11, 3, 4, 0)},
+		{"week ending on the spring change", utc(2024, 3, 10, 12, 0), models.TimeSeriesWeek, utc(2024, 3, 4, 5, 0)},
+		{"week after the spring change", utc(2024, 3, 13, 16, 0), models.TimeSeriesWeek, utc(2024, 3, 11, 4, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := bucketStart(test.at, test.interval, loc); !got.Equal(test.want) {
+				t.Errorf("bucketStart(%v, %s) = %v, want %v", test.at, test.interval, got.UTC(), test.want)
+			}
+		})
+	}
+}
+
+func TestNextBucketStartAcrossDST(t *testing.T) {
+	loc := newYork(t)
+	tests := []struct {
+		name     string
+		start    time.Time
+		interval models.TimeSeriesInterval
+		want     time.Time
+	}{
+		{"hour into the spring gap", utc(2024, 3, 10, 6, 0), models.TimeSeriesHour, utc(2024, 3, 10, 7, 0)},
+		{"hour into the repeated hour", utc(2024, 11, 3, 5, 0), models.TimeSeriesHour, utc(2024, 11, 3, 6, 0)},
+		{"23-hour day", utc(2024, 3, 10, 5, 0), models.TimeSeriesDay, utc(2024, 3, 11, 4, 0)},
+		{"25-hour day", utc(2024, 11, 3, 4, 0), models.TimeSeriesDay, utc(2024, 11, 4, 5, 0)},
+		{"week across the spring change", utc(2024, 3, 4, 5, 0), models.TimeSeriesWeek, utc(2024, 3, 11, 4, 0)},
+		{"week across the fall change", utc(2024, 10, 28, 4, 0), models.TimeSeriesWeek, utc(2024, 11, 4, 5, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nextBucketStart(test.start, test.interval, loc); !got.Equal(test.want) {
+				t.Errorf("nextBucketStart(%v, %s) = %v, want %v", test.start, test.interval, got.UTC(), test.want)
+			}
+		})
+	}
+}
+
+func TestHourlyBucketsPerDSTDay(t *testing.T) {
+	loc := newYork(t)
+	for day, want := range map[int]int{10: 23, 11: 24} {
+		start := time.Date(2024, 3, day, 0, 0, 0, 0, loc)
+		end := nextBucketStart(start, models.TimeSeriesDay, loc)
+		if got := countBuckets(start, end, loc); got != want {
+			t.Errorf("March %d: %d hourly buckets, want %d", day, got, want)
+		}
+	}
+	start := time.Date(2024, 11, 3, 0, 0, 0, 0, loc)
+	if got := countBuckets(start, nextBucketStart(start, models.TimeSeriesDay, loc), loc); got != 25 {
+		t.Errorf("November 3: %d hourly buckets, want 25", got)
+	}
+}
+
+func countBuckets(start, end time.Time, loc *time.Location) int {
+	count := 0
+	for bucket := start; bucket.Before(end); bucket = nextBucketStart(bucket, models.TimeSeriesHour, loc) {
+		count++
+	}
+	return count
+}
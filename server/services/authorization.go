@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrForbidden is returned when a user can see a form or workspace but their
+// role does not grant what they asked for
+var ErrForbidden = errors.New("your role does not allow this")
+
+// AuthorizationService decides what users may do with forms and workspaces.
+// Every form and workspace endpoint goes through it rather than filtering on
+// the user itself.
+type AuthorizationService struct {
+	forms      *FormService
+	workspaces *WorkspaceService
+	templates  *TemplateService
+}
+
+func NewAuthorizationService() *AuthorizationService {
+	return &AuthorizationService{
+		forms:      NewFormService(),
+		workspaces: NewWorkspaceService(),
+		templates:  NewTemplateService(),
+	}
+}
+
+// AuthorizeForm loads a form the user needs a permission on. The form is nil
+// when it does not exist or the user has no access to it at all, so callers
+// do not reveal which forms exist. When the user's role does not grant the
+// permission, ErrForbidden is returned along with the form and the role.
+func (s *AuthorizationService) AuthorizeForm(userID, formID primitive.ObjectID, permission models.Permission) (*models.Form, models.WorkspaceRole, error) {
+	form, err := s.forms.GetFormByID(formID)
+	if err != nil || form == nil {
+		return nil, "", err
+	}
+
+	role, err := s.FormRole(userID, form)
+	if err != nil || role == "" {
+		return nil, "", err
+	}
+	if !role.Can(permission) {
+		return form, role, ErrForbidden
+	}
+	return form, role, nil
+}
+
+// FormRole returns the user's role on a form, or "" when they have none. It
+// is the higher of their role in the form's workspace and the one they were
+// given as a collaborator. Forms created before workspaces, which have not
+// been moved to their owner's personal workspace yet, belong to the owner.
+func (s *AuthorizationService) FormRole(userID primitive.ObjectID, form *models.Form) (models.WorkspaceRole, error) {
+	var role models.WorkspaceRole
+	if form.WorkspaceID.IsZero() {
+		if form.UserID == userID {
+			role = models.RoleOwner
+		}
+	} else {
+		workspace, err := s.workspaces.GetWorkspaceByID(form.WorkspaceID)
+		if err != nil {
+			return "", err
+		}
+		if workspace != nil {
+			role = workspace.MemberRole(userID)
+		}
+	}
+
+	for _, collaborator := range form.Collaborators {
+		if collaborator.Accepted() && collaborator.UserID == userID {
+			role = models.HigherRole(role, collaborator.Role)
+		}
+	}
+	return role, nil
+}
+
+// AuthorizeWorkspace loads a workspace the user needs a permission on, with
+// the same results as AuthorizeForm
+func (s *AuthorizationService) AuthorizeWorkspace(userID, workspaceID primitive.ObjectID, permission models.Permission) (*models.Workspace, models.WorkspaceRole, error) {
+	workspace, err := s.workspaces.GetWorkspaceByID(workspaceID)
+	if err != nil || workspace == nil {
+		return nil, "", err
+	}
+
+	role := workspace.MemberRole(userID)
+	if role == "" {
+		return nil, "", nil
+	}
+	if !role.Can(permission) {
+		return workspace, role, ErrForbidden
+	}
+	return workspace, role, nil
+}
+
+// AuthorizeTemplate loads a template the user needs a permission on, with the
+// same results as AuthorizeForm. Viewing a template is enough to create forms
+// from it, and managing it to delete it.
+func (s *AuthorizationService) AuthorizeTemplate(userID primitive.ObjectID, templateID string, permission models.Permission) (*models.FormTemplate, models.WorkspaceRole, error) {
+	template, err := s.templates.GetTemplateByID(templateID)
+	if err != nil || template == nil {
+		return nil, "", err
+	}
+
+	role, err := s.TemplateRole(userID, template)
+	if err != nil || role == "" {
+		return nil, "", err
+	}
+	if !role.Can(permission) {
+		return template, role, ErrForbidden
+	}
+	return template, role, nil
+}
+
+// TemplateRole returns the user's role on a template, or "" when they have
+// none. Everyone may view built-in templates, and private ones belong to their
+// creator. Workspace templates have the role of the user in their workspace,
+// except that their creator may manage them while still a member.
+func (s *AuthorizationService) TemplateRole(userID primitive.ObjectID, template *models.FormTemplate) (models.WorkspaceRole, error) {
+	switch template.Visibility {
+	case models.TemplateVisibilityBuiltIn:
+		return models.RoleViewer, nil
+	case models.TemplateVisibilityWorkspace:
+		workspace, err := s.workspaces.GetWorkspaceByID(template.WorkspaceID)
+		if err != nil || workspace == nil {
+			return "", err
+		}
+		role := workspace.MemberRole(userID)
+		if role != "" && template.UserID == userID {
+			role = models.RoleOwner
+		}
+		return role, nil
+	}
+	if template.UserID == userID {
+		return models.RoleOwner, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRolePermissions(t *testing.T) {
+	tests := []struct {
+		role    models.WorkspaceRole
+		allowed []models.Permission
+		denied  []models.Permission
+	}{
+		{models.RoleOwner, []models.Permission{models.PermissionManageWorkspace, models.PermissionManageForm, models.PermissionEditForm}, nil},
+		{models.RoleEditor, []models.Permission{models.PermissionEditForm, models.PermissionViewResponses}, []models.Permission{models.PermissionManageForm}},
+		{models.RoleAnalyst, []models.Permission{models.PermissionViewResponses, models.PermissionViewForm}, []models.Permission{models.PermissionEditForm}},
+		{models.RoleViewer, []models.Permission{models.PermissionViewForm}, []models.Permission{models.PermissionViewResponses}},
+		{"", nil, []models.Permission{models.PermissionViewForm}},
+	}
+	for _, tt := range tests {
+		for _, permission := range tt.allowed {
+			if !tt.role.Can(permission) {
+				t.Errorf("%q should be allowed %s", tt.role, permission)
+			}
+		}
+		for _, permission := range tt.denied {
+			if tt.role.Can(permission) {
+				t.Errorf("%q should not be allowed %s", tt.role, permission)
+			}
+		}
+	}
+
+	if role := models.HigherRole(models.RoleAnalyst, models.RoleEditor); role != models.RoleEditor {
+		t.Errorf("HigherRole(analyst, editor) = %q", role)
+	}
+	if role := models.HigherRole(models.RoleViewer, ""); role != models.RoleViewer {
+		t.Errorf("HigherRole(viewer, \"\") = %q", role)
+	}
+}
+
+// Forms outside workspaces need no lookups, so the service works without a database
+func TestFormRoleOfCollaborators(t *testing.T) {
+	owner, accepted, pending, stranger := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Now()
+	form := &models.Form{
+		UserID: owner,
+		Collaborators: []models.FormCollaborator{
+			{UserID: accepted, Role: models.RoleAnalyst, AcceptedAt: &now},
+			{UserID: pending, Role: models.RoleEditor},
+		},
+	}
+
+	s := &AuthorizationService{}
+	for user, want := range map[primitive.ObjectID]models.WorkspaceRole{
+		owner:    models.RoleOwner,
+		accepted: models.RoleAnalyst,
+		pending:  "",
+		stranger: "",
+	} {
+		role, err := s.FormRole(user, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != want {
+			t.Errorf("role = %q, want %q", role, want)
+		}
+	}
+}
+
+// Built-in and private templates need no lookups either
+func TestTemplateRole(t *testing.T) {
+	creator, other := primitive.NewObjectID(), primitive.NewObjectID()
+	private := &models.FormTemplate{Visibility: models.TemplateVisibilityPrivate, UserID: creator}
+	builtIn := BuiltInTemplates()[0]
+
+	s := &AuthorizationService{}
+	tests := []struct {
+		template *models.FormTemplate
+		user     primitive.ObjectID
+		want     models.WorkspaceRole
+	}{
+		{private, creator, models.RoleOwner},
+		{private, other, ""},
+		{builtIn, other, models.RoleViewer},
+	}
+	for _, tt := range tests {
+		role, err := s.TemplateRole(tt.user, tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != tt.want {
+			t.Errorf("%s template role = %q, want %q", tt.template.Visibility, role, tt.want)
+		}
+	}
+	if models.RoleViewer.Can(models.PermissionManageForm) {
+		t.Error("built-in templates should not be deletable")
+	}
+}
+
+// Forms created before workspaces have no workspace and belong to their creator
+func TestFormRoleOfLegacyForms(t *testing.T) {
+	owner, collaborator, stranger := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Now()
+	legacy := &models.Form{UserID: owner}
+	shared := &models.Form{
+		UserID:        owner,
+		Collaborators: []models.FormCollaborator{{UserID: collaborator, Role: models.RoleEditor, AcceptedAt: &now}},
+	}
+
+	s := &AuthorizationService{}
+	tests := []struct {
+		name string
+		form *models.Form
+		user primitive.ObjectID
+		want models.WorkspaceRole
+	}{
+		{"creator", legacy, owner, models.RoleOwner},
+		{"other user", legacy, stranger, ""},
+		{"collaborator", shared, collaborator, models.RoleEditor},
+		{"creator of a shared form", shared, owner, models.RoleOwner},
+	}
+	for _, tt := range tests {
+		role, err := s.FormRole(tt.user, tt.form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != tt.want {
+			t.Errorf("%s: role = %q, want %q", tt.name, role, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"dune-takehome-server/database"
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of the events carried by a Broker
+const (
+	EventResponseCreated   = "response-created"
+	EventFormUpdated       = "form-updated"
+	EventFieldOperation    = "field-operation"
+	EventResponsesImported = "responses-imported"
+	EventAccessChanged     = "access-changed"
+)
+
+// ErrUnsupportedEvent is returned when a broker cannot carry an event type
+var ErrUnsupportedEvent = errors.New("unsupported event type")
+
+// BrokerEvent is a change that real-time clients are told about
+type BrokerEvent struct {
+	Type      string
+	FormID    primitive.ObjectID
+	Form      *models.Form              // May be nil when the event came from another replica
+	Response  *models.FormUserResponse  // Set for EventResponseCreated
+	Operation *models.FieldOperation    // Set for EventFieldOperation
+	Import    *models.ResponseImportJob // Set for EventResponsesImported, once the import finished
+	UserID    primitive.ObjectID        // Set for EventAccessChanged when only one user's access changed
+}
+
+// AccessChanged tells whether an access change may concern a user's access to
+// a form. FormID is zero for a change to a workspace's members, which concerns
+// every form, and UserID is zero when any user may be concerned.
+func (e BrokerEvent) AccessChanged(userID, formID primitive.ObjectID) bool {
+	return e.Type == EventAccessChanged &&
+		(e.UserID.IsZero() || e.UserID == userID) &&
+		(e.FormID.IsZero() || e.FormID == formID)
+}
+
+// Broker fans events out to every server replica. Subscribers receive the
+// events published by any replica, including their own.
+type Broker interface {
+	Publish(event BrokerEvent) error
+	Subscribe(handler func(BrokerEvent))
+	Close() error
+}
+
+// NewBroker returns the broker named by REALTIME_BROKER: "memory" (the default)
+// for a single replica, or "mongo" to fan out through MongoDB change streams
+func NewBroker() (Broker, error) {
+	switch os.Getenv("REALTIME_BROKER") {
+	case "", "memory":
+		return NewInProcessBroker(), nil
+	case "mongo":
+		return NewMongoBroker(database.Database)
+	default:
+		return nil, fmt.Errorf("unknown REALTIME_BROKER %q, expected memory or mongo", os.Getenv("REALTIME_BROKER"))
+	}
+}
+
+// brokerSubscribers is the subscriber list shared by the broker implementations
+type brokerSubscribers struct {
+	mutex    sync.RWMutex
+	handlers []func(BrokerEvent)
+}
+
+func (s *brokerSubscribers) Subscribe(handler func(BrokerEvent)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers = append(s.handlers, handler)
+}
+
+func (s *brokerSubscribers) deliver(event BrokerEvent) {
+	s.mutex.RLock()
+	handlers := s.handlers
+	s.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// InProcessBroker delivers events to the subscribers of this process only
+type InProcessBroker struct {
+	brokerSubscribers
+}
+
+func NewInProcessBroker() *InProcessBroker {
+	return &InProcessBroker{}
+}
+
+// Publish delivers an event synchronously
+func (b *InProcessBroker) Publish(event BrokerEvent) error {
+	b.deliver(event)
+	return nil
+}
+
+func (b *InProcessBroker) Close() error {
+	return nil
+}
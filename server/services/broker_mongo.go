@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoBrokerRetryDelay is how long the broker waits before reopening a failed change stream
+const mongoBrokerRetryDelay = 2 * time.Second
+
+// mongoFormDefinitionFields are the form fields whose updates are relayed.
+// Sharing, folders and tags change nothing dashboards or editors show.
+var mongoFormDefinitionFields = []string{"title", "description", "fields", "status", "last_operation"}
+
+// Updates to the fields matching these, or to their elements, change who may
+// access a form or the forms of a workspace
+var (
+	mongoFormAccessFields      = regexp.MustCompile(`^(collaborators|workspace_id|user_id)(\.|$)`)
+	mongoWorkspaceAccessFields = regexp.MustCompile(`^members(\.|$)`)
+	mongoFormDefinitionPaths   = regexp.MustCompile(`^(` + strings.Join(mongoFormDefinitionFields, "|") + `)(\.|$)`)
+)
+
+// MongoBroker fans events out through a MongoDB change stream, so replicas
+// sharing a database need no other infrastructure. Responses submitted to the
+// responses collection, definition changes in the forms collection and
+// finished imports in the response_imports collection are the events
+// themselves: every replica watching the stream delivers them, and publishing
+// them is a no-op. A form update that writes last_operation is a field
+// operation. Imported responses are relayed once per import rather than one
+// by one. Changes to a form's sharing or owner, or to a workspace's members,
+// are access changes. Change streams need a replica set.
+type MongoBroker struct {
+	brokerSubscribers
+	db     *mongo.Database
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMongoBroker opens the change stream, failing when the deployment does not support it
+func NewMongoBroker(db *mongo.Database) (*MongoBroker, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &MongoBroker{
+		db:     db,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	stream, err := b.watch(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go b.run(ctx, stream)
+	log.Println("📡 Real-time events fan out through MongoDB change streams")
+	return b, nil
+}
+
+// Publish accepts the events the change stream already carries
+func (b *MongoBroker) Publish(event BrokerEvent) error {
+	switch event.Type {
+	case EventResponseCreated, EventFormUpdated, EventFieldOperation, EventResponsesImported, EventAccessChanged:
+		return nil
+	default:
+		return ErrUnsupportedEvent
+	}
+}
+
+// Close stops watching the change stream
+func (b *MongoBroker) Close() error {
+	b.cancel()
+	<-b.done
+	return nil
+}
+
+// watch opens the change stream, resuming after the last event seen when there is one
+func (b *MongoBroker) watch(ctx context.Context, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	definitionChanged := bson.A{}
+	for _, field := range mongoFormDefinitionFields {
+		definitionChanged = append(definitionChanged, bson.M{"updateDescription.updatedFields." + field: bson.M{"$exists": true}})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"ns.coll": "responses", "operationType": "insert", "fullDocument.import_id": bson.M{"$exists": false}},
+			bson.M{"ns.coll": "forms", "operationType": "replace"},
+			bson.M{"ns.coll": "forms", "operationType": "update", "$or": definitionChanged},
+			bson.M{"ns.coll": "forms", "operationType": "update", "$expr": updatedFieldsMatch(mongoFormAccessFields)},
+			bson.M{"ns.coll": "workspaces", "operationType": "update", "$expr": updatedFieldsMatch(mongoWorkspaceAccessFields)},
+			bson.M{"ns.coll": "response_imports", "operationType": "replace", "fullDocument.status": bson.M{"$ne": models.ImportJobRunning}, "fullDocument.report.imported_rows": bson.M{"$gt": 0}},
+		}}}},
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+
+	return b.db.Watch(ctx, pipeline, opts)
+}
+
+// run delivers change stream events until the broker is closed, reopening the
+// stream after errors such as a primary stepping down
+func (b *MongoBroker) run(ctx context.Context, stream *mongo.ChangeStream) {
+	defer close(b.done)
+
+	var resumeToken bson.Raw
+	for {
+		for stream.Next(ctx) {
+			b.handleChange(stream.Current)
+			resumeToken = stream.ResumeToken()
+		}
+		err := stream.Err()
+		stream.Close(context.Background())
+
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("⚠️ MongoDB change stream failed, reopening: %v", err)
+		if resumeTokenLost(err) {
+			resumeToken = nil
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(mongoBrokerRetryDelay):
+			}
+
+			stream, err = b.watch(ctx, resumeToken)
+			if err == nil {
+				break
+			}
+			log.Printf("❌ Failed to reopen MongoDB change stream: %v", err)
+			// Other failures, such as an election, are retried from the same point
+			if resumeTokenLost(err) {
+				resumeToken = nil
+			}
+		}
+	}
+}
+
+// changeStreamHistoryLost is the error code of a resume point that left the oplog
+const changeStreamHistoryLost = 286
+
+// resumeTokenLost tells whether a change stream cannot resume from its token,
+// so it has to pick up from now instead and miss the events in between
+func resumeTokenLost(err error) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(changeStreamHistoryLost) {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "resume token was not found")
+}
+
+// updatedFieldsMatch is true for update events that set or removed a field whose path matches
+func updatedFieldsMatch(pattern *regexp.Regexp) bson.M {
+	paths := bson.M{"$concatArrays": bson.A{
+		bson.M{"$map": bson.M{"input": bson.M{"$objectToArray": "$updateDescription.updatedFields"}, "in": "$$this.k"}},
+		bson.M{"$ifNull": bson.A{"$updateDescription.removedFields", bson.A{}}},
+	}}
+	return bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+		"input": paths,
+		"in":    bson.M{"$regexMatch": bson.M{"input": "$$this", "regex": pattern.String()}},
+	}}}}
+}
+
+// changeUpdates is the update description of a change event
+type changeUpdates struct {
+	UpdatedFields bson.Raw `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// touches tells whether the update set or removed a field whose path matches.
+// Replacements have no update description and touch nothing.
+func (u changeUpdates) touches(pattern *regexp.Regexp) bool {
+	elements, _ := u.UpdatedFields.Elements()
+	for _, element := range elements {
+		if pattern.MatchString(element.Key()) {
+			return true
+		}
+	}
+	for _, path := range u.RemovedFields {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *MongoBroker) handleChange(raw bson.Raw) {
+	var change struct {
+		Namespace struct {
+			Collection string `bson:"coll"`
+		} `bson:"ns"`
+		OperationType     string        `bson:"operationType"`
+		FullDocument      bson.Raw      `bson:"fullDocument"`
+		UpdateDescription changeUpdates `bson:"updateDescription"`
+	}
+	if err := bson.Unmarshal(raw, &change); err != nil {
+		log.Printf("❌ Failed to decode change event: %v", err)
+		return
+	}
+	// Update lookups find nothing when the document was deleted since
+	if change.FullDocument == nil {
+		return
+	}
+
+	switch change.Namespace.Collection {
+	case "responses":
+		var response models.FormUserResponse
+		if err := bson.Unmarshal(change.FullDocument, &response); err != nil {
+			log.Printf("❌ Failed to decode response from change event: %v", err)
+			return
+		}
+		b.deliver(BrokerEvent{Type: EventResponseCreated, FormID: response.FormID, Response: &response})
+	case "forms":
+		var form models.Form
+		if err := bson.Unmarshal(change.FullDocument, &form); err != nil {
+			log.Printf("❌ Failed to decode form from change event: %v", err)
+			return
+		}
+		if change.UpdateDescription.touches(mongoFormAccessFields) {
+			b.deliver(BrokerEvent{Type: EventAccessChanged, FormID: form.ID})
+		}
+		if change.OperationType == "update" && !change.UpdateDescription.touches(mongoFormDefinitionPaths) {
+			return
+		}
+		// The looked up form may already include later operations, the update itself has this one
+		if value, err := change.UpdateDescription.UpdatedFields.LookupErr("last_operation"); err == nil {
+			var op models.FieldOperation
+			if err := value.Unmarshal(&op); err != nil {
+				log.Printf("❌ Failed to decode field operation from change event: %v", err)
+				return
+			}
+			b.deliver(BrokerEvent{Type: EventFieldOperation, FormID: form.ID, Form: &form, Operation: &op})
+			return
+		}
+		b.deliver(BrokerEvent{Type: EventFormUpdated, FormID: form.ID, Form: &form})
+	case "response_imports":
+		var job models.ResponseImportJob
+		if err := bson.Unmarshal(change.FullDocument, &job); err != nil {
+			log.Printf("❌ Failed to decode import from change event: %v", err)
+			return
+		}
+		b.deliver(BrokerEvent{Type: EventResponsesImported, FormID: job.FormID, Import: &job})
+	case "workspaces":
+		// Members may have lost access to any form of the workspace
+		b.deliver(BrokerEvent{Type: EventAccessChanged})
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBrokerEventAccessChanged(t *testing.T) {
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+	form, otherForm := primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		event BrokerEvent
+		want  bool
+	}{
+		{"form shared", BrokerEvent{Type: EventAccessChanged, FormID: form}, true},
+		{"other form shared", BrokerEvent{Type: EventAccessChanged, FormID: otherForm}, false},
+		{"member removed", BrokerEvent{Type: EventAccessChanged, UserID: user}, true},
+		{"other member removed", BrokerEvent{Type: EventAccessChanged, UserID: other}, false},
+		{"workspace members changed", BrokerEvent{Type: EventAccessChanged}, true},
+		{"form updated", BrokerEvent{Type: EventFormUpdated, FormID: form}, false},
+	}
+	for _, test := range tests {
+		if got := test.event.AccessChanged(user, form); got != test.want {
+			t.Errorf("%s: AccessChanged = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestChangeUpdatesTouches(t *testing.T) {
+	updated := func(fields bson.M) bson.Raw {
+		raw, _ := bson.Marshal(fields)
+		return raw
+	}
+
+	tests := []struct {
+		name    string
+		updates changeUpdates
+		access  bool
+		defined bool
+	}{
+		{"collaborator role", changeUpdates{UpdatedFields: updated(bson.M{"collaborators.1.role": "viewer", "updated_at": 1})}, true, false},
+		{"collaborator removed", changeUpdates{UpdatedFields: updated(bson.M{"collaborators": bson.A{}})}, true, false},
+		{"last collaborator unset", changeUpdates{RemovedFields: []string{"collaborators"}}, true, false},
+		{"ownership transferred", changeUpdates{UpdatedFields: updated(bson.M{"user_id": 1, "workspace_id": 2})}, true, false},
+		{"field label", changeUpdates{UpdatedFields: updated(bson.M{"fields.2.label": "Email"})}, false, true},
+		{"fields prefix", changeUpdates{UpdatedFields: updated(bson.M{"fieldset": 1, "collaborators_count": 1})}, false, false},
+		{"replacement", changeUpdates{}, false, false},
+	}
+	for _, test := range tests {
+		if got := test.updates.touches(mongoFormAccessFields); got != test.access {
+			t.Errorf("%s: touches access = %v, want %v", test.name, got, test.access)
+		}
+		if got := test.updates.touches(mongoFormDefinitionPaths); got != test.defined {
+			t.Errorf("%s: touches definition = %v, want %v", test.name, got, test.defined)
+		}
+	}
+}
+
+func TestResumeTokenLost(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{mongo.CommandError{Code: changeStreamHistoryLost, Message: "Resume of change stream was not possible"}, true},
+		{fmt.Errorf("reopen: %w", mongo.CommandError{Code: changeStreamHistoryLost}), true},
+		{errors.New("cannot resume stream; the resume token was not found"), true},
+		{mongo.CommandError{Code: 10107, Message: "not primary"}, false},
+		{errors.New("connection reset by peer"), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := resumeTokenLost(test.err); got != test.want {
+			t.Errorf("resumeTokenLost(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
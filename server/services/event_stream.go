@@ -0,0 +1,287 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event stream limits. Rooms keep their replay buffer for a while after the
+// last subscriber leaves, so a client reconnecting after a network blip or a
+// slow-client drop can catch up.
+const (
+	streamReplaySize       = 100
+	streamRoomIdleTimeout  = 5 * time.Minute
+	streamSubscriberBuffer = 64
+)
+
+// ErrStreamsClosed is returned when subscribing while the server shuts down
+var ErrStreamsClosed = errors.New("event streams are closed")
+
+// StreamEvent is an event sent on an analytics stream. IDs start with the
+// server instance, since they are only meaningful to the replica that issued them.
+type StreamEvent struct {
+	ID   string
+	Type string
+	Data []byte // JSON message, the same as sent over WebSockets
+}
+
+// StreamSubscription receives the events of a form until Done is closed,
+// either because the subscriber fell behind, lost access to the form or the
+// server is shutting down
+type StreamSubscription struct {
+	Events chan StreamEvent
+	Done   chan struct{}
+	roomID string
+	formID primitive.ObjectID
+	userID primitive.ObjectID
+	once   sync.Once
+}
+
+func (s *StreamSubscription) close() {
+	s.once.Do(func() { close(s.Done) })
+}
+
+type streamRoom struct {
+	events      []StreamEvent // Oldest first, at most streamReplaySize
+	since       uint64        // Events after this sequence number are all buffered
+	subscribers map[*StreamSubscription]struct{}
+	idleSince   time.Time
+}
+
+// EventStreamService feeds Server-Sent Events streams for clients that cannot
+// use WebSockets. It relays the same broker events as WebSocketService and
+// keeps recent events per form for Last-Event-ID replay.
+type EventStreamService struct {
+	relay      *realtimeRelay
+	authorizer *AuthorizationService
+	instance   string
+	mutex      sync.Mutex
+	sequence   uint64
+	rooms      map[string]*streamRoom
+	closing    bool
+}
+
+// NewEventStreamService creates the service and subscribes it to the broker's events
+func NewEventStreamService(broker Broker) *EventStreamService {
+	s := newEventStreamService(&realtimeRelay{formService: NewFormService(), userService: NewUserService()})
+	s.authorizer = NewAuthorizationService()
+	broker.Subscribe(s.handleEvent)
+	return s
+}
+
+func newEventStreamService(relay *realtimeRelay) *EventStreamService {
+	return &EventStreamService{
+		relay:    relay,
+		instance: primitive.NewObjectID().Hex(),
+		rooms:    make(map[string]*streamRoom),
+	}
+}
+
+// Subscribe opens a stream for a form on behalf of a user. When lastEventID is
+// set, the events missed since then are returned for replay; resync is true
+// when they are no longer available and the client should reload its
+// analytics instead.
+func (s *EventStreamService) Subscribe(formID, userID primitive.ObjectID, lastEventID string) (sub *StreamSubscription, replay []StreamEvent, resync bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closing {
+		return nil, nil, false, ErrStreamsClosed
+	}
+	s.sweepIdleRooms()
+
+	roomID := formID.Hex()
+	room := s.rooms[roomID]
+	if room == nil {
+		room = &streamRoom{since: s.sequence, subscribers: make(map[*StreamSubscription]struct{})}
+		s.rooms[roomID] = room
+	}
+
+	if lastEventID != "" {
+		last, ok := s.parseEventID(lastEventID)
+		if !ok || last < room.since {
+			resync = true
+		} else {
+			for _, event := range room.events {
+				if seq, _ := s.parseEventID(event.ID); seq > last {
+					replay = append(replay, event)
+				}
+			}
+		}
+	}
+
+	sub = &StreamSubscription{
+		Events: make(chan StreamEvent, streamSubscriberBuffer),
+		Done:   make(chan struct{}),
+		roomID: roomID,
+		formID: formID,
+		userID: userID,
+	}
+	room.subscribers[sub] = struct{}{}
+	return sub, replay, resync, nil
+}
+
+// Unsubscribe closes a stream. The room's replay buffer is kept for a while.
+func (s *EventStreamService) Unsubscribe(sub *StreamSubscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sub.close()
+	if room, ok := s.rooms[sub.roomID]; ok {
+		delete(room.subscribers, sub)
+		if len(room.subscribers) == 0 {
+			room.idleSince = time.Now()
+		}
+	}
+}
+
+// Shutdown ends every stream and refuses new ones
+func (s *EventStreamService) Shutdown() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closing = true
+	for _, room := range s.rooms {
+		for sub := range room.subscribers {
+			sub.close()
+		}
+	}
+}
+
+// handleEvent relays a broker event to the streams of its form, when the form
+// has a room on this replica
+func (s *EventStreamService) handleEvent(event BrokerEvent) {
+	if event.Type == EventAccessChanged {
+		s.revalidateAccess(event)
+		return
+	}
+
+	roomID := event.FormID.Hex()
+
+	s.mutex.Lock()
+	s.sweepIdleRooms()
+	_, watched := s.rooms[roomID]
+	s.mutex.Unlock()
+	if !watched {
+		return
+	}
+
+	s.relay.relay(event, func(message models.EventMessage) {
+		// Streams carry analytics only, not the response feed
+		for _, topic := range eventTopics(message) {
+			if topic == models.TopicFormAnalytics {
+				s.publish(roomID, message)
+				return
+			}
+		}
+	})
+}
+
+// revalidateAccess checks the streams an access change concerns again, and
+// ends those whose user may no longer view the form's responses
+func (s *EventStreamService) revalidateAccess(event BrokerEvent) {
+	if s.authorizer == nil {
+		return
+	}
+
+	var concerned []*StreamSubscription
+	s.mutex.Lock()
+	for _, room := range s.rooms {
+		for sub := range room.subscribers {
+			if event.AccessChanged(sub.userID, sub.formID) {
+				concerned = append(concerned, sub)
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, sub := range concerned {
+		form, _, err := s.authorizer.AuthorizeForm(sub.userID, sub.formID, models.PermissionViewResponses)
+		if err != nil && !errors.Is(err, ErrForbidden) {
+			log.Printf("❌ Failed to check form access for an event stream of form %s: %v", sub.roomID, err)
+			continue
+		}
+		if err != nil || form == nil {
+			log.Printf("🔒 Event stream subscriber for form %s lost access, disconnecting", sub.roomID)
+			s.Unsubscribe(sub)
+		}
+	}
+}
+
+// publish buffers a message and sends it to the room's subscribers. A
+// subscriber that has fallen behind is closed; it can reconnect and replay.
+func (s *EventStreamService) publish(roomID string, message models.EventMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("❌ Failed to encode stream event: %v", err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	room := s.rooms[roomID]
+	if room == nil {
+		return
+	}
+
+	s.sequence++
+	event := StreamEvent{
+		ID:   fmt.Sprintf("%s-%d", s.instance, s.sequence),
+		Type: message.Type,
+		Data: data,
+	}
+
+	room.events = append(room.events, event)
+	if len(room.events) > streamReplaySize {
+		evicted, _ := s.parseEventID(room.events[0].ID)
+		room.since = evicted
+		room.events = room.events[1:]
+	}
+
+	for sub := range room.subscribers {
+		select {
+		case sub.Events <- event:
+		default:
+			log.Printf("🐢 Event stream subscriber for form %s fell behind, disconnecting", roomID)
+			sub.close()
+			delete(room.subscribers, sub)
+			if len(room.subscribers) == 0 {
+				room.idleSince = time.Now()
+			}
+		}
+	}
+}
+
+// sweepIdleRooms drops the buffers of rooms without subscribers for a while.
+// The caller must hold the mutex.
+func (s *EventStreamService) sweepIdleRooms() {
+	for roomID, room := range s.rooms {
+		if len(room.subscribers) == 0 && time.Since(room.idleSince) > streamRoomIdleTimeout {
+			delete(s.rooms, roomID)
+		}
+	}
+}
+
+// parseEventID returns the sequence number of an event ID issued by this instance
+func (s *EventStreamService) parseEventID(id string) (uint64, bool) {
+	instance, seq, found := strings.Cut(id, "-")
+	if !found || instance != s.instance {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n > s.sequence {
+		return 0, false
+	}
+	return n, true
+}
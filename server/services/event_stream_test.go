@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func publishTestEvents(s *EventStreamService, formID primitive.ObjectID, n int) {
+	for i := 0; i < n; i++ {
+		s.publish(formID.Hex(), models.EventMessage{Version: 1, Type: "test", FormID: fmt.Sprint(i)})
+	}
+}
+
+func TestEventStreamReplaysMissedEvents(t *testing.T) {
+	s := newEventStreamService(nil)
+	formID := primitive.NewObjectID()
+
+	sub, replay, resync, err := s.Subscribe(formID, primitive.NilObjectID, "")
+	if err != nil || len(replay) != 0 || resync {
+		t.Fatalf("first subscribe: replay %d, resync %v, err %v", len(replay), resync, err)
+	}
+	publishTestEvents(s, formID, 3)
+
+	var lastSeen StreamEvent
+	for i := 0; i < 2; i++ {
+		lastSeen = <-sub.Events
+	}
+	s.Unsubscribe(sub)
+	publishTestEvents(s, formID, 2)
+
+	_, replay, resync, err = s.Subscribe(formID, primitive.NilObjectID, lastSeen.ID)
+	if err != nil || resync {
+		t.Fatalf("reconnect: resync %v, err %v", resync, err)
+	}
+	if len(replay) != 3 {
+		t.Fatalf("expected the 3 missed events to be replayed, got %d", len(replay))
+	}
+	if want := string(replay[0].Data); want != `{"v":1,"type":"test","form_id":"2"}` {
+		t.Errorf("replay starts with %s, want the event after the last one seen", want)
+	}
+}
+
+func TestEventStreamResyncsWhenEventsAreGone(t *testing.T) {
+	s := newEventStreamService(nil)
+	formID := primitive.NewObjectID()
+
+	sub, _, _, _ := s.Subscribe(formID, primitive.NilObjectID, "")
+	publishTestEvents(s, formID, 1)
+	first := <-sub.Events
+	s.Unsubscribe(sub)
+
+	// Push the first event out of the replay buffer
+	publishTestEvents(s, formID, streamReplaySize+1)
+
+	for _, lastEventID := range []string{
+		first.ID,
+		"another-instance-1",
+		fmt.Sprintf("%s-%d", s.instance, 1_000_000),
+		"garbage",
+	} {
+		_, replay, resync, err := s.Subscribe(formID, primitive.NilObjectID, lastEventID)
+		if err != nil {
+			t.Fatalf("subscribe: %v", err)
+		}
+		if !resync || len(replay) != 0 {
+			t.Errorf("Last-Event-ID %q: resync %v with %d events, want a resync", lastEventID, resync, len(replay))
+		}
+	}
+}
+
+func TestEventStreamDropsSlowSubscriber(t *testing.T) {
+	s := newEventStreamService(nil)
+	formID := primitive.NewObjectID()
+
+	slow, _, _, _ := s.Subscribe(formID, primitive.NilObjectID, "")
+	publishTestEvents(s, formID, streamSubscriberBuffer+1)
+
+	select {
+	case <-slow.Done:
+	default:
+		t.Fatal("subscriber with a full buffer was not closed")
+	}
+
+	// The dropped subscriber can still catch up from the replay buffer
+	_, replay, resync, _ := s.Subscribe(formID, primitive.NilObjectID, fmt.Sprintf("%s-%d", s.instance, streamSubscriberBuffer))
+	if resync || len(replay) != 1 {
+		t.Errorf("got resync %v with %d events, want the 1 event that did not fit", resync, len(replay))
+	}
+}
+
+func TestEventStreamShutdown(t *testing.T) {
+	s := newEventStreamService(nil)
+	formID := primitive.NewObjectID()
+
+	sub, _, _, _ := s.Subscribe(formID, primitive.NilObjectID, "")
+	s.Shutdown()
+
+	select {
+	case <-sub.Done:
+	default:
+		t.Error("open stream was not closed on shutdown")
+	}
+	if _, _, _, err := s.Subscribe(formID, primitive.NilObjectID, ""); err != ErrStreamsClosed {
+		t.Errorf("subscribe after shutdown returned %v, want ErrStreamsClosed", err)
+	}
+}
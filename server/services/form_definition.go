@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"dune-takehome-server/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InvalidDefinitionError is returned for form definitions that cannot be
+// imported, with everything found wrong in them
+type InvalidDefinitionError struct {
+	Problems []models.DefinitionProblem
+}
+
+func (e *InvalidDefinitionError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.Message
+		if problem.Path != "" {
+			messages[i] = problem.Path + ": " + problem.Message
+		}
+	}
+	return "invalid form definition: " + strings.Join(messages, "; ")
+}
+
+// choiceFieldTypes are the field types answered by picking options
+var choiceFieldTypes = map[models.FieldType]bool{
+	models.FieldTypeSelect:   true,
+	models.FieldTypeRadio:    true,
+	models.FieldTypeCheckbox: true,
+}
+
+// FormDefinitionOf describes a form as a portable definition
+func FormDefinitionOf(form *models.Form) models.FormDefinition {
+	return models.FormDefinition{
+		Version:     models.FormDefinitionVersion,
+		Title:       form.Title,
+		Description: form.Description,
+		Folder:      form.Folder,
+		Tags:        form.Tags,
+		Fields:      form.Fields,
+	}
+}
+
+// EncodeFormDefinition encodes a form definition as JSON or YAML. YAML has the
+// same properties as JSON, in the same order.
+func EncodeFormDefinition(definition models.FormDefinition, format models.FormDefinitionFormat) ([]byte, error) {
+	data, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case models.FormDefinitionJSON:
+		return append(data, '\n'), nil
+	case models.FormDefinitionYAML:
+		// JSON is YAML, so the JSON document converts to a YAML one that keeps
+		// the order of properties. Only its flow style and quotes are dropped;
+		// strings that would read as something else stay quoted.
+		var document yaml.Node
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		resetYAMLStyle(&document)
+
+		var out bytes.Buffer
+		encoder := yaml.NewEncoder(&out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&document); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown form definition format %q", format)
+}
+
+// DecodeFormDefinition decodes and validates a form definition in JSON or
+// YAML. Problems are returned as an *InvalidDefinitionError.
+func DecodeFormDefinition(data []byte, format models.FormDefinitionFormat) (*models.FormDefinition, error) {
+	switch format {
+	case models.FormDefinitionJSON:
+	case models.FormDefinitionYAML:
+		// Decoded through JSON, so both formats are read by the same rules
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, invalidDefinition("", strings.TrimPrefix(err.Error(), "yaml: "))
+		}
+		converted, err := json.Marshal(document)
+		if err != nil {
+			return nil, invalidDefinition("", "keys must be strings")
+		}
+		data = converted
+	default:
+		return nil, fmt.Errorf("unknown form definition format %q", format)
+	}
+
+	// The version decides how the rest is read, so it is checked first
+	var header struct {
+		Version json.RawMessage `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, definitionDecodeError(err)
+	}
+	var version int
+	if len(header.Version) == 0 || string(header.Version) == "null" {
+		return nil, invalidDefinition("version", "is required")
+	}
+	if err := json.Unmarshal(header.Version, &version); err != nil || version < 1 {
+		return nil, invalidDefinition("version", "must be a positive integer")
+	}
+	if version > models.FormDefinitionVersion {
+		return nil, invalidDefinition("version", fmt.Sprintf("%d is newer than this server reads (%d)", version, models.FormDefinitionVersion))
+	}
+
+	var definition models.FormDefinition
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, definitionDecodeError(err)
+	}
+
+	if problems := ValidateFormDefinition(&definition); len(problems) > 0 {
+		return nil, &InvalidDefinitionError{Problems: problems}
+	}
+	return &definition, nil
+}
+
+// ValidateFormDefinition lists what is wrong with a form definition: a missing
+// title, folder or tags that cannot be stored, and fields without a unique ID,
+// a known type or a label, or choice fields without proper options. Folder
+// and tags are normalized.
+func ValidateFormDefinition(definition *models.FormDefinition) []models.DefinitionProblem {
+	var problems []models.DefinitionProblem
+	problem := func(path, format string, args ...interface{}) {
+		problems = append(problems, models.DefinitionProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(definition.Title) == "" {
+		problem("title", "is required")
+	}
+	if folder, err := NormalizeFolder(definition.Folder); err != nil {
+		problem("folder", "%s", strings.TrimPrefix(err.Error(), ErrInvalidFormLabels.Error()+": "))
+	} else {
+		definition.Folder = folder
+	}
+	if definition.Tags != nil {
+		if tags, err := NormalizeTags(definition.Tags); err != nil {
+			problem("tags", "%s", strings.TrimPrefix(err.Error(), ErrInvalidFormLabels.Error()+": "))
+		} else {
+			definition.Tags = tags
+		}
+	}
+	if definition.Fields == nil {
+		problem("fields", "is required")
+	}
+
+	ids := map[string]int{}
+	for i, field := range definition.Fields {
+		path := fmt.Sprintf("fields[%d]", i)
+		if field.ID == "" {
+			problem(path+".id", "is required")
+		} else if first, ok := ids[field.ID]; ok {
+			problem(path+".id", "%q is already the ID of fields[%d]", field.ID, first)
+		} else {
+			ids[field.ID] = i
+		}
+		if !validFieldTypes[field.Type] {
+			problem(path+".type", "unknown field type %q", field.Type)
+		}
+		if strings.TrimSpace(field.Label) == "" {
+			problem(path+".label", "is required")
+		}
+
+		if !choiceFieldTypes[field.Type] {
+			continue
+		}
+		if len(field.Options) == 0 {
+			problem(path+".options", "a %s field needs at least one option", field.Type)
+		}
+		options := map[string]bool{}
+		for j, option := range field.Options {
+			switch {
+			case strings.TrimSpace(option) == "":
+				problem(fmt.Sprintf("%s.options[%d]", path, j), "is empty")
+			case options[option]:
+				problem(fmt.Sprintf("%s.options[%d]", path, j), "%q is listed twice", option)
+			}
+			options[option] = true
+		}
+	}
+	return problems
+}
+
+// FormDefinitionFormatOf picks the format of a definition from a content type
+// or a format name, defaulting to JSON
+func FormDefinitionFormatOf(value string) (models.FormDefinitionFormat, bool) {
+	mediaType, _, _ := strings.Cut(value, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "", "json", "application/json":
+		return models.FormDefinitionJSON, true
+	case "yaml", "yml", "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return models.FormDefinitionYAML, true
+	}
+	return "", false
+}
+
+func invalidDefinition(path, message string) error {
+	return &InvalidDefinitionError{Problems: []models.DefinitionProblem{{Path: path, Message: message}}}
+}
+
+// definitionDecodeError describes why a definition could not be decoded
+func definitionDecodeError(err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		return invalidDefinition("", fmt.Sprintf("malformed JSON at offset %d: %s", syntaxError.Offset, syntaxError.Error()))
+	case errors.As(err, &typeError):
+		return invalidDefinition(definitionPath(typeError.Field), fmt.Sprintf("must be %s, not %s", jsonTypeName(typeError.Type), typeError.Value))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return invalidDefinition("", "unknown property "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return invalidDefinition("", strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// definitionPath writes a path of the JSON decoder, like "fields.0.required",
+// the way problems are reported: "fields[0].required"
+func definitionPath(field string) string {
+	var path strings.Builder
+	for i, segment := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(segment); err == nil {
+			path.WriteString("[" + segment + "]")
+			continue
+		}
+		if i > 0 {
+			path.WriteByte('.')
+		}
+		path.WriteString(segment)
+	}
+	return path.String()
+}
+
+// jsonTypeName names the JSON type a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a number"
+}
+
+// yaml11Booleans are strings that YAML 1.1 parsers read as booleans
+var yaml11Booleans = map[string]bool{"y": true, "yes": true, "n": true, "no": true, "on": true, "off": true}
+
+// resetYAMLStyle drops the styles of a YAML document decoded from JSON, so it
+// is written in block style without needless quotes. Strings that older YAML
+// parsers would read as booleans stay quoted.
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && yaml11Booleans[strings.ToLower(node.Value)] {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dune-takehome-server/models"
+)
+
+// Every field property set, with values YAML would read as other types
+func sampleDefinition() models.FormDefinition {
+	return models.FormDefinition{
+		Version:     models.FormDefinitionVersion,
+		Title:       "Signup: 2024",
+		Description: "yes",
+		Folder:      "Marketing/Q3",
+		Tags:        []string{"events", "true"},
+		Fields: []models.FormField{
+			{
+				ID:          "age",
+				Type:        models.FieldTypeNumber,
+				Label:       "Age",
+				Placeholder: "0",
+				Required:    true,
+				Validation:  map[string]string{"min": "18", "max": "1e3", "pattern": "^[0-9]+$"},
+				Order:       0,
+				Sensitive:   true,
+			},
+			{
+				ID:      "plan",
+				Type:    models.FieldTypeRadio,
+				Label:   "Plan # 'quoted'",
+				Options: []string{"no", "null", "- Pro", ""},
+				Order:   1,
+			},
+		},
+	}
+}
+
+func TestFormDefinitionRoundTrip(t *testing.T) {
+	definition := sampleDefinition()
+	definition.Fields[1].Options = definition.Fields[1].Options[:3] // Empty options are invalid
+
+	for _, format := range []models.FormDefinitionFormat{models.FormDefinitionJSON, models.FormDefinitionYAML} {
+		data, err := EncodeFormDefinition(definition, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		decoded, err := DecodeFormDefinition(data, format)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", format, err, data)
+		}
+		if !reflect.DeepEqual(*decoded, definition) {
+			t.Errorf("%s round trip = %+v, want %+v\n%s", format, *decoded, definition, data)
+		}
+	}
+}
+
+func TestFormDefinitionYAMLIsBlockStyle(t *testing.T) {
+	data, err := EncodeFormDefinition(sampleDefinition(), models.FormDefinitionYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "version: 1\ntitle: ") {
+		t.Errorf("YAML does not start with the version and title:\n%s", data)
+	}
+	if !strings.Contains(string(data), `description: "yes"`) {
+		t.Errorf("YAML 1.1 boolean is not quoted:\n%s", data)
+	}
+	if strings.Contains(string(data), "{") {
+		t.Errorf("YAML has flow style:\n%s", data)
+	}
+}
+
+func TestDecodeFormDefinitionProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   models.FormDefinitionFormat
+		document string
+		want     []string
+	}{
+		{"no version", models.FormDefinitionJSON, `{"title": "A", "fields": []}`, []string{"version: is required"}},
+		{"newer version", models.FormDefinitionYAML, "version: 9\ntitle: A\nfields: []", []string{"version: 9 is newer"}},
+		{"malformed", models.FormDefinitionJSON, `{"version": 1,`, []string{"malformed JSON"}},
+		{"malformed YAML", models.FormDefinitionYAML, "version: 1\n  title: [", []string{"line"}},
+		{"unknown property", models.FormDefinitionJSON, `{"version": 1, "title": "A", "fields": [], "owner": "x"}`, []string{`unknown property "owner"`}},
+		{"wrong type", models.FormDefinitionYAML, "version: 1\ntitle: A\nfields:\n  - id: a\n    type: text\n    label: A\n    required: maybe\n", []string{"fields[0].required: must be a boolean, not string"}},
+		{"field problems", models.FormDefinitionYAML, `
+version: 1
+title: ""
+fields:
+  - id: a
+    type: text
+    label: A
+  - id: a
+    type: dropdown
+    label: B
+  - id: c
+    type: select
+    label: C
+  - id: d
+    type: checkbox
+    label: D
+    options: [x, x, " "]
+`, []string{
+			"title: is required",
+			`fields[1].id: "a" is already the ID of fields[0]`,
+			`fields[1].type: unknown field type "dropdown"`,
+			"fields[2].options: a select field needs at least one option",
+			`fields[3].options[1]: "x" is listed twice`,
+			"fields[3].options[2]: is empty",
+		}},
+	}
+	for _, tt := range tests {
+		_, err := DecodeFormDefinition([]byte(tt.document), tt.format)
+		var invalid *InvalidDefinitionError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: error = %v, want an invalid definition", tt.name, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.name, err, want)
+			}
+		}
+	}
+}
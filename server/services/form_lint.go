@@ -0,0 +1,169 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dune-takehome-server/models"
+)
+
+// fieldValidationRules are the validation rules each field type applies
+var fieldValidationRules = map[models.FieldType]map[string]bool{
+	models.FieldTypeText:     {"minLength": true, "maxLength": true, "pattern": true},
+	models.FieldTypeTextarea: {"minLength": true, "maxLength": true, "pattern": true},
+	models.FieldTypeEmail:    {"minLength": true, "maxLength": true, "pattern": true},
+	models.FieldTypeNumber:   {"min": true, "max": true},
+}
+
+// LintForm checks a form's fields for problems. Errors make the form behave
+// wrongly, such as duplicate field IDs, choice fields without options,
+// negative orders and validation rules that cannot be applied, and block
+// publishing. Warnings point out what is likely a mistake, such as rules the
+// field type ignores. Forms are a single page without conditions, so there is
+// no branching to check.
+func LintForm(fields []models.FormField) models.FormLint {
+	lint := models.FormLint{Errors: []models.LintIssue{}, Warnings: []models.LintIssue{}}
+	issue := func(severity models.LintSeverity, rule, path, format string, args ...interface{}) {
+		found := models.LintIssue{Severity: severity, Rule: rule, Path: path, Message: fmt.Sprintf(format, args...)}
+		if severity == models.LintError {
+			lint.Errors = append(lint.Errors, found)
+		} else {
+			lint.Warnings = append(lint.Warnings, found)
+		}
+	}
+
+	if len(fields) == 0 {
+		issue(models.LintWarning, "no-fields", "fields", "the form has no fields to answer")
+	}
+
+	ids := map[string]int{}
+	labels := map[string]int{}
+	orders := map[int]int{}
+	for i, field := range fields {
+		path := fmt.Sprintf("fields[%d]", i)
+
+		switch first, ok := ids[field.ID]; {
+		case field.ID == "":
+			issue(models.LintError, "missing-field-id", path+".id", "the field has no ID, so its answers cannot be stored")
+		case ok:
+			issue(models.LintError, "duplicate-field-id", path+".id", "%q is already the ID of fields[%d], so their answers would be mixed up", field.ID, first)
+		default:
+			ids[field.ID] = i
+		}
+		if !validFieldTypes[field.Type] {
+			issue(models.LintError, "unknown-field-type", path+".type", "unknown field type %q", field.Type)
+		}
+
+		label := strings.ToLower(strings.TrimSpace(field.Label))
+		if label == "" {
+			issue(models.LintError, "missing-label", path+".label", "the field has no label, so respondents cannot tell what to answer")
+		} else if first, ok := labels[label]; ok {
+			issue(models.LintWarning, "duplicate-label", path+".label", "fields[%d] has the same label, so their answers are hard to tell apart", first)
+		} else {
+			labels[label] = i
+		}
+
+		if field.Order < 0 {
+			issue(models.LintError, "negative-order", path+".order", "order must not be negative, not %d", field.Order)
+		} else if first, ok := orders[field.Order]; ok {
+			issue(models.LintWarning, "duplicate-order", path+".order", "fields[%d] has the same order, so which comes first is undefined", first)
+		} else {
+			orders[field.Order] = i
+		}
+
+		lintOptions(field, path, issue)
+		lintValidation(field, path, issue)
+	}
+	return lint
+}
+
+type lintReporter func(severity models.LintSeverity, rule, path, format string, args ...interface{})
+
+func lintOptions(field models.FormField, path string, issue lintReporter) {
+	if !choiceFieldTypes[field.Type] {
+		if len(field.Options) > 0 {
+			issue(models.LintWarning, "unused-options", path+".options", "a %s field does not use options", field.Type)
+		}
+		return
+	}
+
+	if len(field.Options) == 0 {
+		issue(models.LintError, "missing-options", path+".options", "a %s field needs at least one option", field.Type)
+	} else if len(field.Options) == 1 && field.Type != models.FieldTypeCheckbox {
+		issue(models.LintWarning, "single-option", path+".options", "a %s field with one option leaves nothing to choose", field.Type)
+	}
+	options := map[string]bool{}
+	for j, option := range field.Options {
+		optionPath := fmt.Sprintf("%s.options[%d]", path, j)
+		switch {
+		case strings.TrimSpace(option) == "":
+			issue(models.LintError, "empty-option", optionPath, "the option is empty")
+		case options[option]:
+			issue(models.LintError, "duplicate-option", optionPath, "%q is listed twice", option)
+		}
+		options[option] = true
+	}
+}
+
+func lintValidation(field models.FormField, path string, issue lintReporter) {
+	rules := fieldValidationRules[field.Type]
+	names := make([]string, 0, len(field.Validation))
+	for rule := range field.Validation {
+		names = append(names, rule)
+	}
+	sort.Strings(names) // Issues in a stable order
+	for _, rule := range names {
+		if !rules[rule] {
+			issue(models.LintWarning, "unused-validation", path+".validation."+rule, "a %s field ignores the %s rule", field.Type, rule)
+		}
+	}
+
+	if pattern, ok := field.Validation["pattern"]; ok && rules["pattern"] {
+		if _, err := regexp.Compile(pattern); err != nil {
+			issue(models.LintError, "invalid-pattern", path+".validation.pattern", "%s", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+		}
+	}
+
+	min, minOK := lintNumberRule(field, "min", path, issue)
+	max, maxOK := lintNumberRule(field, "max", path, issue)
+	if minOK && maxOK && min > max {
+		issue(models.LintError, "empty-range", path+".validation", "min %s is above max %s, so no number is accepted", field.Validation["min"], field.Validation["max"])
+	}
+
+	minLength, minOK := lintLengthRule(field, "minLength", path, issue)
+	maxLength, maxOK := lintLengthRule(field, "maxLength", path, issue)
+	if minOK && maxOK && minLength > maxLength {
+		issue(models.LintError, "empty-range", path+".validation", "minLength %d is above maxLength %d, so no answer is accepted", minLength, maxLength)
+	}
+}
+
+// lintNumberRule reads a min or max rule of a field that applies it
+func lintNumberRule(field models.FormField, rule, path string, issue lintReporter) (float64, bool) {
+	value, ok := field.Validation[rule]
+	if !ok || !fieldValidationRules[field.Type][rule] {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		issue(models.LintError, "invalid-rule", path+".validation."+rule, "%s must be a number, not %q", rule, value)
+		return 0, false
+	}
+	return n, true
+}
+
+// lintLengthRule reads a minLength or maxLength rule of a field that applies it
+func lintLengthRule(field models.FormField, rule, path string, issue lintReporter) (int, bool) {
+	value, ok := field.Validation[rule]
+	if !ok || !fieldValidationRules[field.Type][rule] {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		issue(models.LintError, "invalid-rule", path+".validation."+rule, "%s must be a whole number of at least 0, not %q", rule, value)
+		return 0, false
+	}
+	return n, true
+}
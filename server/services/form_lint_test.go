@@ -0,0 +1,71 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"dune-takehome-server/models"
+)
+
+func lintRules(issues []models.LintIssue) []string {
+	rules := []string{}
+	for _, issue := range issues {
+		rules = append(rules, issue.Rule+" "+issue.Path)
+	}
+	return rules
+}
+
+func TestLintForm(t *testing.T) {
+	fields := []models.FormField{
+		{ID: "name", Type: models.FieldTypeText, Label: "Name", Order: 0, Validation: map[string]string{"pattern": "[a-z", "min": "1"}},
+		{ID: "name", Type: models.FieldTypeSelect, Label: "Plan", Order: -1},
+		{ID: "age", Type: models.FieldTypeNumber, Label: "name", Order: 0, Options: []string{"x"}, Validation: map[string]string{"min": "10", "max": "5"}},
+		{ID: "", Type: "date", Label: " ", Order: 3},
+		{ID: "topics", Type: models.FieldTypeRadio, Label: "Topics", Order: 4, Options: []string{"A", "", "A"}},
+		{ID: "bio", Type: models.FieldTypeTextarea, Label: "Bio", Order: 5, Validation: map[string]string{"minLength": "-1", "maxLength": "many"}},
+	}
+
+	lint := LintForm(fields)
+	wantErrors := []string{
+		"invalid-pattern fields[0].validation.pattern",
+		"duplicate-field-id fields[1].id",
+		"negative-order fields[1].order",
+		"missing-options fields[1].options",
+		"empty-range fields[2].validation",
+		"missing-field-id fields[3].id",
+		"unknown-field-type fields[3].type",
+		"missing-label fields[3].label",
+		"empty-option fields[4].options[1]",
+		"duplicate-option fields[4].options[2]",
+		"invalid-rule fields[5].validation.minLength",
+		"invalid-rule fields[5].validation.maxLength",
+	}
+	wantWarnings := []string{
+		"unused-validation fields[0].validation.min",
+		"duplicate-label fields[2].label",
+		"duplicate-order fields[2].order",
+		"unused-options fields[2].options",
+	}
+	if got := lintRules(lint.Errors); !reflect.DeepEqual(got, wantErrors) {
+		t.Errorf("errors = %v\nwant %v", got, wantErrors)
+	}
+	if got := lintRules(lint.Warnings); !reflect.DeepEqual(got, wantWarnings) {
+		t.Errorf("warnings = %v\nwant %v", got, wantWarnings)
+	}
+	if !lint.HasErrors() {
+		t.Error("HasErrors() = false")
+	}
+}
+
+func TestLintFormClean(t *testing.T) {
+	for _, template := range BuiltInTemplates() {
+		if lint := LintForm(template.Fields); !lint.IsEmpty() {
+			t.Errorf("template %s: errors %v, warnings %v", template.Key, lintRules(lint.Errors), lintRules(lint.Warnings))
+		}
+	}
+
+	lint := LintForm(nil)
+	if lint.HasErrors() || !reflect.DeepEqual(lintRules(lint.Warnings), []string{"no-fields fields"}) {
+		t.Errorf("empty form: errors %v, warnings %v", lintRules(lint.Errors), lintRules(lint.Warnings))
+	}
+}
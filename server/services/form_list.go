@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidFormQuery is returned for list parameters that cannot be applied
+var ErrInvalidFormQuery = errors.New("invalid form list query")
+
+// ErrInvalidFormLabels is returned for folders and tags that cannot be stored
+var ErrInvalidFormLabels = errors.New("invalid folder or tags")
+
+// Forms list page sizes
+const (
+	DefaultFormPageSize = 50
+	MaxFormPageSize     = 100
+)
+
+// Folder and tag limits
+const (
+	maxFolderLength = 200
+	maxTags         = 20
+	maxTagLength    = 40
+)
+
+// FormScope is the set of forms a user can list: those of their workspaces,
+// and those shared with them when Shared is set
+type FormScope struct {
+	UserID       primitive.ObjectID
+	WorkspaceIDs []primitive.ObjectID
+	Shared       bool
+}
+
+// filter matches the forms in the scope, including those the user created
+// before workspaces existed
+func (scope FormScope) filter() bson.M {
+	sources := bson.A{
+		bson.M{"workspace_id": bson.M{"$in": scope.WorkspaceIDs}},
+		bson.M{"user_id": scope.UserID, "workspace_id": bson.M{"$exists": false}},
+	}
+	if scope.Shared {
+		sources = append(sources, bson.M{"collaborators": bson.M{"$elemMatch": bson.M{
+			"user_id":     scope.UserID,
+			"accepted_at": bson.M{"$ne": nil},
+		}}})
+	}
+	return bson.M{"$or": sources}
+}
+
+// formCursor is where a page of the forms list ends. It is handed to clients
+// encoded, and only continues a list with the same sort.
+type formCursor struct {
+	Sort   models.FormSort    `json:"s"`
+	Desc   bool               `json:"d,omitempty"`
+	Time   *time.Time         `json:"t,omitempty"`
+	Title  *string            `json:"v,omitempty"`
+	ID     primitive.ObjectID `json:"id,omitempty"`
+	Offset int                `json:"o,omitempty"` // Relevance scores cannot be compared in a filter
+}
+
+// GetUserForms retrieves a page of the forms in a scope. It returns the
+// cursor of the next page, or "" on the last page.
+func (s *FormService) GetUserForms(scope FormScope, query models.FormListQuery) ([]*models.Form, string, error) {
+	if query.Sort == "" {
+		query.Sort = models.FormSortUpdated
+		if query.Search != "" {
+			query.Sort = models.FormSortRelevance
+		}
+	}
+	if query.Sort == models.FormSortRelevance && query.Search == "" {
+		return nil, "", fmt.Errorf("%w: relevance sort needs a search", ErrInvalidFormQuery)
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultFormPageSize
+	}
+	if query.Limit > MaxFormPageSize {
+		query.Limit = MaxFormPageSize
+	}
+
+	conditions := bson.A{scope.filter()}
+	if query.Status != nil {
+		conditions = append(conditions, bson.M{"status": *query.Status})
+	}
+	if query.Folder != nil {
+		if *query.Folder == "" {
+			conditions = append(conditions, bson.M{"folder": bson.M{"$exists": false}})
+		} else {
+			// The folder itself and its subfolders
+			pattern := "^" + regexp.QuoteMeta(*query.Folder) + "(/|$)"
+			conditions = append(conditions, bson.M{"folder": primitive.Regex{Pattern: pattern}})
+		}
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, bson.M{"tags": strings.ToLower(query.Tag)})
+	}
+	if query.Search != "" {
+		conditions = append(conditions, bson.M{"$text": bson.M{"$search": query.Search}})
+	}
+
+	var cursor *formCursor
+	if query.Cursor != "" {
+		var err error
+		if cursor, err = decodeFormCursor(query.Cursor, query.Sort, query.Descending); err != nil {
+			return nil, "", err
+		}
+	}
+
+	opts := options.Find().SetLimit(int64(query.Limit + 1))
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+	switch query.Sort {
+	case models.FormSortUpdated, models.FormSortCreated, models.FormSortTitle:
+		key := string(query.Sort)
+		opts.SetSort(bson.D{{Key: key, Value: direction}, {Key: "_id", Value: direction}})
+		if cursor != nil {
+			var value interface{}
+			switch {
+			case query.Sort == models.FormSortTitle && cursor.Title != nil:
+				value = *cursor.Title
+			case query.Sort != models.FormSortTitle && cursor.Time != nil:
+				value = *cursor.Time
+			}
+			if value == nil || cursor.ID.IsZero() {
+				return nil, "", fmt.Errorf("%w: invalid cursor", ErrInvalidFormQuery)
+			}
+			after := "$gt"
+			if query.Descending {
+				after = "$lt"
+			}
+			conditions = append(conditions, bson.M{"$or": bson.A{
+				bson.M{key: bson.M{after: value}},
+				bson.M{key: value, "_id": bson.M{after: cursor.ID}},
+			}})
+		}
+	case models.FormSortRelevance:
+		opts.SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: 1}})
+		if cursor != nil {
+			opts.SetSkip(int64(cursor.Offset))
+		}
+	default:
+		return nil, "", fmt.Errorf("%w: sort must be updated_at, created_at, title or relevance", ErrInvalidFormQuery)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	results, err := s.collection.Find(ctx, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer results.Close(ctx)
+
+	var forms []*models.Form
+	if err = results.All(ctx, &forms); err != nil {
+		return nil, "", err
+	}
+	if len(forms) <= query.Limit {
+		return forms, "", nil
+	}
+
+	forms = forms[:query.Limit]
+	last := forms[len(forms)-1]
+	next := formCursor{Sort: query.Sort, Desc: query.Descending, ID: last.ID}
+	switch query.Sort {
+	case models.FormSortUpdated:
+		next.Time = &last.UpdatedAt
+	case models.FormSortCreated:
+		next.Time = &last.CreatedAt
+	case models.FormSortTitle:
+		next.Title = &last.Title
+	case models.FormSortRelevance:
+		next.Offset = query.Limit
+		if cursor != nil {
+			next.Offset += cursor.Offset
+		}
+	}
+	return forms, encodeFormCursor(next), nil
+}
+
+// CountFormLabels counts the forms in a scope per folder or per tag, given as
+// label "folder" or "tags". Folders are counted with the forms of their
+// subfolders.
+func (s *FormService) CountFormLabels(scope FormScope, label string) ([]models.FormLabelCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"$and": bson.A{scope.filter(), bson.M{label: bson.M{"$exists": true}}}}},
+	}
+	switch label {
+	case "tags":
+		pipeline = append(pipeline, bson.M{"$unwind": "$tags"}, bson.M{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}})
+	case "folder":
+		// Every ancestor of a form's folder counts it too
+		pipeline = append(pipeline,
+			bson.M{"$set": bson.M{"parts": bson.M{"$split": bson.A{"$folder", "/"}}}},
+			bson.M{"$set": bson.M{"ancestors": bson.M{"$map": bson.M{
+				"input": bson.M{"$range": bson.A{1, bson.M{"$add": bson.A{bson.M{"$size": "$parts"}, 1}}}},
+				"as":    "n",
+				"in": bson.M{"$reduce": bson.M{
+					"input":        bson.M{"$slice": bson.A{"$parts", "$$n"}},
+					"initialValue": "",
+					"in": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{"$$value", ""}},
+						"$$this",
+						bson.M{"$concat": bson.A{"$$value", "/", "$$this"}},
+					}},
+				}},
+			}}}},
+			bson.M{"$unwind": "$ancestors"},
+			bson.M{"$group": bson.M{"_id": "$ancestors", "count": bson.M{"$sum": 1}}},
+		)
+	default:
+		return nil, fmt.Errorf("%w: unknown label %q", ErrInvalidFormQuery, label)
+	}
+	pipeline = append(pipeline, bson.M{"$sort": bson.M{"_id": 1}})
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := []models.FormLabelCount{}
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// NormalizeFolder cleans up a folder path: segments are trimmed and empty
+// ones dropped, so " Marketing //Q3/" becomes "Marketing/Q3"
+func NormalizeFolder(folder string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(folder, "/") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	folder = strings.Join(segments, "/")
+	if len(folder) > maxFolderLength {
+		return "", fmt.Errorf("%w: folder must be at most %d characters", ErrInvalidFormLabels, maxFolderLength)
+	}
+	return folder, nil
+}
+
+// NormalizeTags trims and lowercases tags, dropping empty ones and duplicates
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: tags must be at most %d characters", ErrInvalidFormLabels, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("%w: a form can have at most %d tags", ErrInvalidFormLabels, maxTags)
+	}
+	return normalized, nil
+}
+
+func encodeFormCursor(cursor formCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFormCursor(encoded string, sort models.FormSort, descending bool) (*formCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidFormQuery)
+	}
+	var cursor formCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidFormQuery)
+	}
+	if cursor.Sort != sort || cursor.Desc != descending {
+		return nil, fmt.Errorf("%w: cursor belongs to a list with another sort", ErrInvalidFormQuery)
+	}
+	return &cursor, nil
+}
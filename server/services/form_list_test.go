@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNormalizeFormLabels(t *testing.T) {
+	folder, err := NormalizeFolder(" Marketing //Q3/ ")
+	if err != nil || folder != "Marketing/Q3" {
+		t.Errorf("NormalizeFolder = %q, %v", folder, err)
+	}
+
+	tags, err := NormalizeTags([]string{"NPS", " nps", "", "Q3 "})
+	if err != nil || !reflect.DeepEqual(tags, []string{"nps", "q3"}) {
+		t.Errorf("NormalizeTags = %q, %v", tags, err)
+	}
+
+	tooMany := make([]string, maxTags+1)
+	for i := range tooMany {
+		tooMany[i] = string(rune('a' + i))
+	}
+	if _, err := NormalizeTags(tooMany); !errors.Is(err, ErrInvalidFormLabels) {
+		t.Errorf("NormalizeTags with %d tags: %v", len(tooMany), err)
+	}
+}
+
+func TestFormCursor(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cursor := formCursor{Sort: models.FormSortUpdated, Desc: true, Time: &updated, ID: primitive.NewObjectID()}
+	encoded := encodeFormCursor(cursor)
+
+	decoded, err := decodeFormCursor(encoded, models.FormSortUpdated, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Time.Equal(updated) || decoded.ID != cursor.ID {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+
+	// A cursor only continues the list it came from
+	if _, err := decodeFormCursor(encoded, models.FormSortTitle, true); !errors.Is(err, ErrInvalidFormQuery) {
+		t.Errorf("cursor of another sort: %v", err)
+	}
+	if _, err := decodeFormCursor(encoded, models.FormSortUpdated, false); !errors.Is(err, ErrInvalidFormQuery) {
+		t.Errorf("cursor of another order: %v", err)
+	}
+	if _, err := decodeFormCursor("not a cursor", models.FormSortUpdated, true); !errors.Is(err, ErrInvalidFormQuery) {
+		t.Errorf("garbage cursor: %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned by ApplyFieldOperation
+var (
+	ErrInvalidFieldOperation = errors.New("invalid field operation")
+	ErrFieldNotFound         = errors.New("field not found")
+	ErrFieldExists           = errors.New("field already exists")
+)
+
+// publishedOperationAttempts is how often an operation on a published form is
+// linted again when other operations were applied meanwhile
+const publishedOperationAttempts = 3
+
+// PublishedLintError is returned for a field operation that would leave a
+// published form with lint errors, with what linting the result found
+type PublishedLintError struct {
+	Lint models.FormLint
+}
+
+func (e *PublishedLintError) Error() string {
+	messages := make([]string, len(e.Lint.Errors))
+	for i, issue := range e.Lint.Errors {
+		messages[i] = issue.Path + ": " + issue.Message
+	}
+	return "the published form would have errors: " + strings.Join(messages, "; ")
+}
+
+// updatableFieldProperties are the field properties an update operation may
+// set. IDs identify fields across operations and orders follow positions.
+var updatableFieldProperties = map[string]bool{
+	"type":        true,
+	"label":       true,
+	"placeholder": true,
+	"required":    true,
+	"options":     true,
+	"validation":  true,
+	"sensitive":   true,
+}
+
+var validFieldTypes = map[models.FieldType]bool{
+	models.FieldTypeText:     true,
+	models.FieldTypeTextarea: true,
+	models.FieldTypeEmail:    true,
+	models.FieldTypeNumber:   true,
+	models.FieldTypeSelect:   true,
+	models.FieldTypeRadio:    true,
+	models.FieldTypeCheckbox: true,
+	models.FieldTypeRating:   true,
+}
+
+// ApplyFieldOperation applies an operation to a form in a single atomic
+// update, so concurrent operations on other fields are never lost. It needs
+// no revision and increments the form's. Operations on a published form are
+// linted first and refused with a PublishedLintError when the form would have
+// errors; they are only applied to the revision linted, or ErrStaleRevision
+// is returned when it kept changing. The form is returned as it is after the
+// operation, or nil when it does not exist.
+func (s *FormService) ApplyFieldOperation(formID primitive.ObjectID, op models.FieldOperation) (*models.Form, error) {
+	filter, pipeline, err := fieldOperationUpdate(formID, op)
+	if err != nil {
+		return nil, err
+	}
+
+	draft := bson.M{"status": bson.M{"$ne": models.FormStatusPublished}}
+	for key, value := range filter {
+		draft[key] = value
+	}
+	form, err := s.updateFields(draft, pipeline)
+	if form != nil || err != nil {
+		return form, err
+	}
+
+	// The form is published, or the filter's field check failed
+	for attempt := 0; attempt < publishedOperationAttempts; attempt++ {
+		existing, err := s.GetFormByID(formID)
+		if err != nil || existing == nil {
+			return nil, err
+		}
+		fields, err := applyFieldOperation(existing.Fields, op)
+		if err != nil {
+			return nil, err
+		}
+		if existing.Status == models.FormStatusPublished {
+			if lint := LintForm(fields); lint.HasErrors() {
+				return nil, &PublishedLintError{Lint: lint}
+			}
+		}
+
+		linted := bson.M{"revision": revisionFilter(existing.Revision)}
+		for key, value := range filter {
+			linted[key] = value
+		}
+		form, err := s.updateFields(linted, pipeline)
+		if form != nil || err != nil {
+			return form, err
+		}
+	}
+	return nil, ErrStaleRevision
+}
+
+// updateFields applies a field operation's pipeline to the form matching the
+// filter, returning it as it is afterwards, or nil when none matched
+func (s *FormService) updateFields(filter bson.M, pipeline mongo.Pipeline) (*models.Form, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var form models.Form
+	err := s.collection.FindOneAndUpdate(ctx, filter, pipeline,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&form)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &form, nil
+}
+
+// applyFieldOperation returns the fields a validated operation leaves, as the
+// update built by fieldOperationUpdate does, so they can be linted first
+func applyFieldOperation(fields []models.FormField, op models.FieldOperation) ([]models.FormField, error) {
+	index := -1
+	for i, field := range fields {
+		if field.ID == op.FieldID {
+			index = i
+		}
+	}
+	if op.Op == models.FieldOperationAdd && index >= 0 {
+		return nil, ErrFieldExists
+	}
+	if op.Op != models.FieldOperationAdd && index < 0 {
+		return nil, ErrFieldNotFound
+	}
+
+	insert := func(fields []models.FormField, at int, field models.FormField) []models.FormField {
+		if at > len(fields) {
+			at = len(fields)
+		}
+		result := append([]models.FormField{}, fields[:at]...)
+		result = append(result, field)
+		return append(result, fields[at:]...)
+	}
+	without := func() []models.FormField {
+		return append(append([]models.FormField{}, fields[:index]...), fields[index+1:]...)
+	}
+
+	var result []models.FormField
+	switch op.Op {
+	case models.FieldOperationAdd:
+		field := *op.Field
+		field.ID = op.FieldID
+		at := len(fields)
+		if op.Index != nil {
+			at = *op.Index
+		}
+		result = insert(fields, at, field)
+	case models.FieldOperationUpdate:
+		changes, err := fieldChanges(op.Changes)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := mergeFieldChanges(fields[index], changes)
+		if err != nil {
+			return nil, err
+		}
+		result = append([]models.FormField{}, fields...)
+		result[index] = updated
+	case models.FieldOperationMove:
+		result = insert(without(), *op.Index, fields[index])
+	case models.FieldOperationDelete:
+		result = without()
+	}
+
+	for i := range result {
+		result[i].Order = i
+	}
+	return result, nil
+}
+
+// mergeFieldChanges sets the changes of an update on a field, like $mergeObjects
+func mergeFieldChanges(field models.FormField, changes bson.M) (models.FormField, error) {
+	var merged bson.M
+	data, err := bson.Marshal(field)
+	if err == nil {
+		err = bson.Unmarshal(data, &merged)
+	}
+	if err != nil {
+		return field, err
+	}
+	for property, value := range changes {
+		merged[property] = value
+	}
+
+	var updated models.FormField
+	if data, err = bson.Marshal(merged); err == nil {
+		err = bson.Unmarshal(data, &updated)
+	}
+	return updated, err
+}
+
+// fieldOperationUpdate validates an operation and builds the filter and
+// aggregation pipeline applying it. Values from the client are wrapped in
+// $literal so strings starting with $ are not read as expressions.
+func fieldOperationUpdate(formID primitive.ObjectID, op models.FieldOperation) (bson.M, mongo.Pipeline, error) {
+	if op.FieldID == "" {
+		return nil, nil, fmt.Errorf("%w: field_id is required", ErrInvalidFieldOperation)
+	}
+	if op.Index != nil && *op.Index < 0 {
+		return nil, nil, fmt.Errorf("%w: index must not be negative", ErrInvalidFieldOperation)
+	}
+
+	filter := bson.M{"_id": formID, "fields.id": op.FieldID}
+	var fields interface{}
+	// Forms created without fields store null, which array operators reject
+	stored := bson.M{"$ifNull": bson.A{"$fields", bson.A{}}}
+
+	switch op.Op {
+	case models.FieldOperationAdd:
+		if op.Field == nil {
+			return nil, nil, fmt.Errorf("%w: add needs a field", ErrInvalidFieldOperation)
+		}
+		field := *op.Field
+		if field.ID == "" {
+			field.ID = op.FieldID
+		}
+		if field.ID != op.FieldID {
+			return nil, nil, fmt.Errorf("%w: field id does not match field_id", ErrInvalidFieldOperation)
+		}
+		if !validFieldTypes[field.Type] {
+			return nil, nil, fmt.Errorf("%w: unknown field type %q", ErrInvalidFieldOperation, field.Type)
+		}
+		filter["fields.id"] = bson.M{"$ne": op.FieldID}
+		added := bson.A{bson.M{"$literal": field}}
+		if op.Index == nil {
+			fields = bson.M{"$concatArrays": bson.A{stored, added}}
+		} else {
+			fields = bson.M{"$concatArrays": bson.A{slicePrefix(stored, *op.Index), added, sliceSuffix(stored, *op.Index)}}
+		}
+
+	case models.FieldOperationUpdate:
+		changes, err := fieldChanges(op.Changes)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = bson.M{"$map": bson.M{
+			"input": stored,
+			"as":    "field",
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$$field.id", op.FieldID}},
+				bson.M{"$mergeObjects": bson.A{"$$field", bson.M{"$literal": changes}}},
+				"$$field",
+			}},
+		}}
+
+	case models.FieldOperationMove:
+		if op.Index == nil {
+			return nil, nil, fmt.Errorf("%w: move needs an index", ErrInvalidFieldOperation)
+		}
+		others := bson.M{"$filter": bson.M{"input": stored, "cond": bson.M{"$ne": bson.A{"$$this.id", op.FieldID}}}}
+		moved := bson.M{"$filter": bson.M{"input": stored, "cond": bson.M{"$eq": bson.A{"$$this.id", op.FieldID}}}}
+		fields = bson.M{"$let": bson.M{
+			"vars": bson.M{"others": others, "moved": moved},
+			"in":   bson.M{"$concatArrays": bson.A{slicePrefix("$$others", *op.Index), "$$moved", sliceSuffix("$$others", *op.Index)}},
+		}}
+
+	case models.FieldOperationDelete:
+		fields = bson.M{"$filter": bson.M{"input": stored, "cond": bson.M{"$ne": bson.A{"$$this.id", op.FieldID}}}}
+
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidFieldOperation, op.Op)
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"fields": fields}}},
+		// Orders follow positions, as when the builder saves the whole form
+		{{Key: "$set", Value: bson.M{"fields": bson.M{"$map": bson.M{
+			"input": bson.M{"$range": bson.A{0, bson.M{"$size": "$fields"}}},
+			"as":    "i",
+			"in":    bson.M{"$mergeObjects": bson.A{bson.M{"$arrayElemAt": bson.A{"$fields", "$$i"}}, bson.M{"order": "$$i"}}},
+		}}}}},
+		{{Key: "$set", Value: bson.M{
+			"updated_at": op.AppliedAt,
+			"revision":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$revision", 0}}, 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"last_operation": bson.M{"$mergeObjects": bson.A{bson.M{"$literal": op}, bson.M{"revision": "$revision"}}},
+		}}},
+	}
+	return filter, pipeline, nil
+}
+
+// fieldChanges checks the properties of an update against FormField, returning
+// them with the types they are stored with
+func fieldChanges(changes map[string]interface{}) (bson.M, error) {
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("%w: update needs changes", ErrInvalidFieldOperation)
+	}
+	for property := range changes {
+		if !updatableFieldProperties[property] {
+			return nil, fmt.Errorf("%w: %q cannot be changed", ErrInvalidFieldOperation, property)
+		}
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFieldOperation, err)
+	}
+	var field models.FormField
+	if err := json.Unmarshal(data, &field); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFieldOperation, err)
+	}
+	if _, ok := changes["type"]; ok && !validFieldTypes[field.Type] {
+		return nil, fmt.Errorf("%w: unknown field type %q", ErrInvalidFieldOperation, field.Type)
+	}
+
+	values := map[string]interface{}{
+		"type":        field.Type,
+		"label":       field.Label,
+		"placeholder": field.Placeholder,
+		"required":    field.Required,
+		"options":     field.Options,
+		"validation":  field.Validation,
+		"sensitive":   field.Sensitive,
+	}
+	set := bson.M{}
+	for property := range changes {
+		set[property] = values[property]
+	}
+	return set, nil
+}
+
+// slicePrefix is the expression for the first n elements of an array
+func slicePrefix(array interface{}, n int) interface{} {
+	if n == 0 {
+		return bson.A{}
+	}
+	return bson.M{"$slice": bson.A{array, n}}
+}
+
+// sliceSuffix is the expression for the elements of an array from position n
+func sliceSuffix(array interface{}, n int) interface{} {
+	return bson.M{"$slice": bson.A{array, n, bson.M{"$max": bson.A{bson.M{"$size": array}, 1}}}}
+}
+
+// fieldPosition returns a form's field with an ID and its index, or nil
+func fieldPosition(form *models.Form, fieldID string) (*models.FormField, int) {
+	for i := range form.Fields {
+		if form.Fields[i].ID == fieldID {
+			return &form.Fields[i], i
+		}
+	}
+	return nil, -1
+}
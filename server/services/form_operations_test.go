@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFieldOperationValidation(t *testing.T) {
+	index := func(i int) *int { return &i }
+	tests := []struct {
+		name  string
+		op    models.FieldOperation
+		valid bool
+	}{
+		{"add", models.FieldOperation{Op: "add", FieldID: "q1", Field: &models.FormField{Type: models.FieldTypeText, Label: "Name"}}, true},
+		{"add at index", models.FieldOperation{Op: "add", FieldID: "q1", Index: index(0), Field: &models.FormField{ID: "q1", Type: models.FieldTypeRating}}, true},
+		{"add without field", models.FieldOperation{Op: "add", FieldID: "q1"}, false},
+		{"add with other id", models.FieldOperation{Op: "add", FieldID: "q1", Field: &models.FormField{ID: "q2", Type: models.FieldTypeText}}, false},
+		{"add unknown type", models.FieldOperation{Op: "add", FieldID: "q1", Field: &models.FormField{Type: "signature"}}, false},
+		{"update", models.FieldOperation{Op: "update", FieldID: "q1", Changes: map[string]interface{}{"label": "Email", "required": true}}, true},
+		{"update options", models.FieldOperation{Op: "update", FieldID: "q1", Changes: map[string]interface{}{"options": []interface{}{"$set", "b"}}}, true},
+		{"update id", models.FieldOperation{Op: "update", FieldID: "q1", Changes: map[string]interface{}{"id": "q2"}}, false},
+		{"update mistyped", models.FieldOperation{Op: "update", FieldID: "q1", Changes: map[string]interface{}{"required": "yes"}}, false},
+		{"update unknown type", models.FieldOperation{Op: "update", FieldID: "q1", Changes: map[string]interface{}{"type": "signature"}}, false},
+		{"update nothing", models.FieldOperation{Op: "update", FieldID: "q1"}, false},
+		{"move", models.FieldOperation{Op: "move", FieldID: "q1", Index: index(2)}, true},
+		{"move without index", models.FieldOperation{Op: "move", FieldID: "q1"}, false},
+		{"move negative", models.FieldOperation{Op: "move", FieldID: "q1", Index: index(-1)}, false},
+		{"delete", models.FieldOperation{Op: "delete", FieldID: "q1"}, true},
+		{"delete without field id", models.FieldOperation{Op: "delete"}, false},
+		{"unknown", models.FieldOperation{Op: "rename", FieldID: "q1"}, false},
+	}
+
+	for _, tt := range tests {
+		_, _, err := fieldOperationUpdate(primitive.NewObjectID(), tt.op)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidFieldOperation) {
+			t.Errorf("%s: got %v, want ErrInvalidFieldOperation", tt.name, err)
+		}
+	}
+}
+
+func TestFieldChangesKeepStoredTypes(t *testing.T) {
+	changes, err := fieldChanges(map[string]interface{}{"required": true, "options": []interface{}{"a", "b"}})
+	if err != nil {
+		t.Fatalf("field changes: %v", err)
+	}
+	if len(changes) != 2 || changes["required"] != true {
+		t.Errorf("got changes %v", changes)
+	}
+	if options, ok := changes["options"].([]string); !ok || len(options) != 2 {
+		t.Errorf("got options %#v, want []string", changes["options"])
+	}
+	if _, ok := changes["label"]; ok {
+		t.Error("unchanged properties must not be set")
+	}
+}
+
+func TestFieldOperationMessage(t *testing.T) {
+	form := &models.Form{ID: primitive.NewObjectID(), Fields: []models.FormField{
+		{ID: "q1", Type: models.FieldTypeText, Label: "Name"},
+		{ID: "q2", Type: models.FieldTypeEmail, Label: "Work email", Order: 1},
+	}}
+
+	op := &models.FieldOperation{Op: "update", FieldID: "q2", Changes: map[string]interface{}{"label": "Work email"}, AppliedAt: time.Now()}
+	message := fieldOperationMessage(form, op)
+	if message.Type != models.MessageFieldOperation || message.Operation.Field == nil || message.Operation.Field.Label != "Work email" {
+		t.Fatalf("got %+v", message.Operation)
+	}
+	if *message.Operation.Index != 1 {
+		t.Errorf("got index %d, want 1", *message.Operation.Index)
+	}
+	if op.Field != nil {
+		t.Error("the published operation must not be modified")
+	}
+
+	deleted := fieldOperationMessage(form, &models.FieldOperation{Op: "delete", FieldID: "q3"})
+	if deleted.Operation.Field != nil || deleted.Operation.Index != nil {
+		t.Errorf("got field %+v for a deleted field", deleted.Operation.Field)
+	}
+}
+
+// Operations on published forms are linted on the fields they would leave
+func TestApplyFieldOperation(t *testing.T) {
+	index := func(i int) *int { return &i }
+	fields := []models.FormField{
+		{ID: "name", Type: models.FieldTypeText, Label: "Name", Order: 0},
+		{ID: "plan", Type: models.FieldTypeSelect, Label: "Plan", Options: []string{"Free", "Pro"}, Order: 1},
+		{ID: "score", Type: models.FieldTypeRating, Label: "Score", Order: 2},
+	}
+	tests := []struct {
+		name   string
+		op     models.FieldOperation
+		ids    []string
+		errors []string
+		err    error
+	}{
+		{"add at the end", models.FieldOperation{Op: "add", FieldID: "email", Field: &models.FormField{Type: models.FieldTypeEmail, Label: "Email"}},
+			[]string{"name", "plan", "score", "email"}, nil, nil},
+		{"add past the end", models.FieldOperation{Op: "add", FieldID: "email", Index: index(9), Field: &models.FormField{Type: models.FieldTypeEmail, Label: "Email"}},
+			[]string{"name", "plan", "score", "email"}, nil, nil},
+		{"add a choice without options", models.FieldOperation{Op: "add", FieldID: "size", Index: index(0), Field: &models.FormField{Type: models.FieldTypeRadio, Label: "Size"}},
+			[]string{"size", "name", "plan", "score"}, []string{"missing-options fields[0].options"}, nil},
+		{"update", models.FieldOperation{Op: "update", FieldID: "name", Changes: map[string]interface{}{"label": "Full name", "required": true}},
+			[]string{"name", "plan", "score"}, nil, nil},
+		{"clear a label", models.FieldOperation{Op: "update", FieldID: "name", Changes: map[string]interface{}{"label": ""}},
+			[]string{"name", "plan", "score"}, []string{"missing-label fields[0].label"}, nil},
+		{"drop the options", models.FieldOperation{Op: "update", FieldID: "plan", Changes: map[string]interface{}{"options": []interface{}{}}},
+			[]string{"name", "plan", "score"}, []string{"missing-options fields[1].options"}, nil},
+		{"move", models.FieldOperation{Op: "move", FieldID: "name", Index: index(2)},
+			[]string{"plan", "score", "name"}, nil, nil},
+		{"delete", models.FieldOperation{Op: "delete", FieldID: "plan"},
+			[]string{"name", "score"}, nil, nil},
+		{"add an existing field", models.FieldOperation{Op: "add", FieldID: "plan", Field: &models.FormField{Type: models.FieldTypeText, Label: "Plan"}},
+			nil, nil, ErrFieldExists},
+		{"delete a missing field", models.FieldOperation{Op: "delete", FieldID: "email"},
+			nil, nil, ErrFieldNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyFieldOperation(fields, tt.op)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			ids := []string(nil)
+			for i, field := range result {
+				ids = append(ids, field.ID)
+				if field.Order != i {
+					t.Errorf("%s has order %d at %d", field.ID, field.Order, i)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("fields = %v, want %v", ids, tt.ids)
+			}
+			if tt.err == nil && !reflect.DeepEqual(lintRules(LintForm(result).Errors), append([]string{}, tt.errors...)) {
+				t.Errorf("lint errors = %v, want %v", lintRules(LintForm(result).Errors), tt.errors)
+			}
+		})
+	}
+
+	if fields[0].Label != "Name" || fields[0].Order != 0 || len(fields) != 3 {
+		t.Errorf("the operations changed the form's fields: %+v", fields)
+	}
+	updated, _ := applyFieldOperation(fields, models.FieldOperation{Op: "update", FieldID: "plan", Changes: map[string]interface{}{"required": true}})
+	if want := (models.FormField{ID: "plan", Type: models.FieldTypeSelect, Label: "Plan", Options: []string{"Free", "Pro"}, Required: true, Order: 1}); !reflect.DeepEqual(updated[1], want) {
+		t.Errorf("updated field = %+v, want %+v", updated[1], want)
+	}
+}
+
+func TestFieldOperationOnFormWithoutFields(t *testing.T) {
+	index := func(i int) *int { return &i }
+	add := models.FieldOperation{Op: "add", FieldID: "email", Field: &models.FormField{Type: models.FieldTypeEmail, Label: "Email"}}
+
+	result, err := applyFieldOperation(nil, add)
+	if err != nil || len(result) != 1 || result[0].ID != "email" || result[0].Order != 0 {
+		t.Fatalf("applyFieldOperation(nil, add) = %+v, %v", result, err)
+	}
+
+	// Stored fields are null rather than empty, so each read must default them
+	withIndex := add
+	withIndex.Index = index(0)
+	for _, op := range []models.FieldOperation{
+		add,
+		withIndex,
+		{Op: "update", FieldID: "email", Changes: map[string]interface{}{"label": "Work email"}},
+		{Op: "move", FieldID: "email", Index: index(1)},
+		{Op: "delete", FieldID: "email"},
+	} {
+		_, pipeline, err := fieldOperationUpdate(primitive.NewObjectID(), op)
+		if err != nil {
+			t.Fatalf("%s: %v", op.Op, err)
+		}
+		if readsNullableFields(pipeline[0][0].Value) {
+			t.Errorf("%s reads $fields without a default: %v", op.Op, pipeline[0][0].Value)
+		}
+	}
+}
+
+// readsNullableFields reports whether an expression reads $fields outside of $ifNull
+func readsNullableFields(expression interface{}) bool {
+	switch e := expression.(type) {
+	case string:
+		return e == "$fields"
+	case bson.M:
+		if args, ok := e["$ifNull"].(bson.A); ok && len(args) > 0 && args[0] == "$fields" {
+			return false
+		}
+		for _, value := range e {
+			if readsNullableFields(value) {
+				return true
+			}
+		}
+	case bson.A:
+		for _, value := range e {
+			if readsNullableFields(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestPublishedLintError(t *testing.T) {
+	err := error(&PublishedLintError{Lint: LintForm([]models.FormField{{ID: "plan", Type: models.FieldTypeSelect, Label: "Plan"}})})
+	want := "the published form would have errors: fields[0].options: a select field needs at least one option"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
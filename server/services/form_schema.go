@@ -0,0 +1,210 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+)
+
+// Ratings are given as 1 to 5 stars
+const (
+	minRating = 1
+	maxRating = 5
+)
+
+// FormResponseSchema is the JSON Schema of a submission to a form: answers
+// keyed by field ID under responses, with the session_id of the recorded view.
+// Submissions are validated against it, so it is exactly what is accepted.
+func FormResponseSchema(form *models.Form) utils.JSONSchema {
+	fields := append([]models.FormField{}, form.Fields...)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Order < fields[j].Order })
+
+	properties := utils.JSONSchema{}
+	required := []string{}
+	for _, field := range fields {
+		properties[field.ID] = fieldSchema(field)
+		if field.Required {
+			required = append(required, field.ID)
+		}
+	}
+
+	responses := utils.JSONSchema{
+		"type":                 "object",
+		"description":          "Answers keyed by field ID. Optional fields can be left out.",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	return utils.JSONSchema{
+		"$schema": utils.JSONSchemaDraft,
+		"title":   form.Title,
+		"type":    "object",
+		"properties": utils.JSONSchema{
+			"responses": responses,
+			"session_id": utils.JSONSchema{
+				"type":        "string",
+				"description": "Returned when the view of the form was recorded",
+			},
+		},
+		"required":             []string{"responses"},
+		"additionalProperties": false,
+	}
+}
+
+// fieldSchema is the schema of the answer to a field, following its type and
+// validation rules. Rules that cannot be applied, such as an invalid pattern,
+// are left out.
+func fieldSchema(field models.FormField) utils.JSONSchema {
+	schema := utils.JSONSchema{"title": field.Label}
+	if field.Placeholder != "" {
+		schema["description"] = field.Placeholder
+	}
+
+	switch field.Type {
+	case models.FieldTypeNumber:
+		schema["type"] = "number"
+		setNumberRule(schema, "minimum", field.Validation["min"])
+		setNumberRule(schema, "maximum", field.Validation["max"])
+	case models.FieldTypeRating:
+		schema["type"] = "integer"
+		schema["minimum"] = minRating
+		schema["maximum"] = maxRating
+	case models.FieldTypeSelect, models.FieldTypeRadio:
+		schema["type"] = "string"
+		setOptions(schema, field.Options)
+	case models.FieldTypeCheckbox:
+		items := utils.JSONSchema{"type": "string"}
+		setOptions(items, field.Options)
+		schema["type"] = "array"
+		schema["items"] = items
+		schema["uniqueItems"] = true
+		if field.Required {
+			schema["minItems"] = 1
+		}
+	default: // text, textarea, email and types added later
+		schema["type"] = "string"
+		if field.Type == models.FieldTypeEmail {
+			schema["format"] = "email"
+		}
+		if field.Required {
+			schema["minLength"] = 1
+		}
+		setLengthRule(schema, "minLength", field.Validation["minLength"])
+		setLengthRule(schema, "maxLength", field.Validation["maxLength"])
+		if pattern := field.Validation["pattern"]; pattern != "" {
+			if _, err := regexp.Compile(pattern); err == nil {
+				schema["pattern"] = pattern
+			}
+		}
+	}
+	return schema
+}
+
+// setOptions limits answers to a field's options. Fields without options are
+// left unconstrained rather than impossible to answer.
+func setOptions(schema utils.JSONSchema, options []string) {
+	if len(options) > 0 {
+		schema["enum"] = options
+	}
+}
+
+func setNumberRule(schema utils.JSONSchema, keyword, value string) {
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		schema[keyword] = n
+	}
+}
+
+func setLengthRule(schema utils.JSONSchema, keyword, value string) {
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+		// A required field's minLength of 1 stays when the rule allows empty answers
+		if current, ok := schema[keyword].(int); !ok || n > current {
+			schema[keyword] = n
+		}
+	}
+}
+
+// FormOpenAPI describes submitting responses to a published form as an
+// OpenAPI 3.1 document, for generating clients. serverURL is the base of the
+// API, such as https://example.com/api/v1.
+func FormOpenAPI(form *models.Form, serverURL string) utils.JSONSchema {
+	request := FormResponseSchema(form)
+	delete(request, "$schema") // The document's dialect applies
+
+	errorSchema := utils.JSONSchema{
+		"type": "object",
+		"properties": utils.JSONSchema{
+			"error": utils.JSONSchema{"type": "string"},
+			"problems": utils.JSONSchema{
+				"type": "array",
+				"items": utils.JSONSchema{
+					"type": "object",
+					"properties": utils.JSONSchema{
+						"path":    utils.JSONSchema{"type": "string", "description": "JSON Pointer to the invalid value"},
+						"message": utils.JSONSchema{"type": "string"},
+					},
+				},
+			},
+		},
+		"required": []string{"error"},
+	}
+
+	return utils.JSONSchema{
+		"openapi":           "3.1.0",
+		"jsonSchemaDialect": utils.JSONSchemaDraft,
+		"info": utils.JSONSchema{
+			"title":   form.Title,
+			"version": strconv.FormatInt(form.Revision, 10),
+		},
+		"servers": []utils.JSONSchema{{"url": serverURL}},
+		"paths": utils.JSONSchema{
+			"/public/forms/" + form.ShareURL + "/responses": utils.JSONSchema{
+				"post": utils.JSONSchema{
+					"operationId": "submitResponse",
+					"summary":     "Submit a response to " + form.Title,
+					"requestBody": utils.JSONSchema{
+						"required": true,
+						"content": utils.JSONSchema{
+							"application/json": utils.JSONSchema{"schema": utils.JSONSchema{"$ref": "#/components/schemas/Submission"}},
+						},
+					},
+					"responses": utils.JSONSchema{
+						"201": utils.JSONSchema{
+							"description": "Response stored",
+							"content": utils.JSONSchema{
+								"application/json": utils.JSONSchema{"schema": utils.JSONSchema{
+									"type": "object",
+									"properties": utils.JSONSchema{
+										"message":     utils.JSONSchema{"type": "string"},
+										"response_id": utils.JSONSchema{"type": "string"},
+										"form_id":     utils.JSONSchema{"type": "string"},
+									},
+								}},
+							},
+						},
+						"400": utils.JSONSchema{
+							"description": "The submission does not match the schema; problems lists why",
+							"content": utils.JSONSchema{
+								"application/json": utils.JSONSchema{"schema": utils.JSONSchema{"$ref": "#/components/schemas/Error"}},
+							},
+						},
+						"404": utils.JSONSchema{
+							"description": "The form does not exist or is not published",
+							"content": utils.JSONSchema{
+								"application/json": utils.JSONSchema{"schema": utils.JSONSchema{"$ref": "#/components/schemas/Error"}},
+							},
+						},
+					},
+				},
+			},
+		},
+		"components": utils.JSONSchema{
+			"schemas": utils.JSONSchema{
+				"Submission": request,
+				"Error":      errorSchema,
+			},
+		},
+	}
+}
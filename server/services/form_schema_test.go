@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+)
+
+func TestFormResponseSchema(t *testing.T) {
+	form := &models.Form{
+		Title: "Signup",
+		Fields: []models.FormField{
+			{ID: "name", Type: models.FieldTypeText, Label: "Name", Required: true, Validation: map[string]string{"maxLength": "10"}},
+			{ID: "email", Type: models.FieldTypeEmail, Label: "Email"},
+			{ID: "age", Type: models.FieldTypeNumber, Label: "Age", Validation: map[string]string{"min": "18"}},
+			{ID: "plan", Type: models.FieldTypeRadio, Label: "Plan", Options: []string{"Free", "Pro"}},
+			{ID: "topics", Type: models.FieldTypeCheckbox, Label: "Topics", Required: true, Options: []string{"Go", "Rust"}},
+			{ID: "stars", Type: models.FieldTypeRating, Label: "Stars"},
+			{ID: "code", Type: models.FieldTypeText, Label: "Code", Validation: map[string]string{"pattern": "(unclosed"}},
+		},
+	}
+	schema := FormResponseSchema(form)
+
+	tests := []struct {
+		body  string
+		valid bool
+	}{
+		{`{"responses": {"name": "Ada", "topics": ["Go"]}}`, true},
+		{`{"responses": {"name": "Ada", "email": "ada@example.com", "age": 36, "plan": "Pro", "topics": ["Go", "Rust"], "stars": 5, "code": "x"}, "session_id": "abc"}`, true},
+		{`{"responses": {"topics": ["Go"]}}`, false},                          // Missing required field
+		{`{"responses": {"name": "", "topics": ["Go"]}}`, false},              // Empty required field
+		{`{"responses": {"name": "Ada", "topics": []}}`, false},               // No required choice
+		{`{"responses": {"name": "Ada Lovelace!", "topics": ["Go"]}}`, false}, // Too long
+		{`{"responses": {"name": "Ada", "topics": ["Go"], "age": "36"}}`, false},
+		{`{"responses": {"name": "Ada", "topics": ["Go"], "age": 17}}`, false},
+		{`{"responses": {"name": "Ada", "topics": ["Go"], "plan": "Team"}}`, false},
+		{`{"responses": {"name": "Ada", "topics": ["Go"], "stars": 6}}`, false},
+		{`{"responses": {"name": "Ada", "topics": ["Go"], "email": "ada"}}`, false},
+		{`{"responses": {"name": "Ada", "topics": ["Go"], "unknown": 1}}`, false},
+		{`{"responses": {"name": "Ada", "topics": ["Go"]}, "extra": true}`, false},
+		{`{}`, false},
+	}
+	for _, tt := range tests {
+		var body interface{}
+		if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+			t.Fatal(err)
+		}
+		violations := schema.Validate(body)
+		if (len(violations) == 0) != tt.valid {
+			t.Errorf("%s: valid = %v, want %v (%+v)", tt.body, len(violations) == 0, tt.valid, violations)
+		}
+	}
+
+	// What is served is what is validated, so the schema must survive encoding
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var served utils.JSONSchema
+	if err := json.Unmarshal(data, &served); err != nil {
+		t.Fatal(err)
+	}
+	var body interface{}
+	json.Unmarshal([]byte(`{"responses": {"name": "Ada", "topics": ["Go"], "plan": "Team"}}`), &body)
+	if violations := served.Validate(body); len(violations) != 1 || violations[0].Path != "/responses/plan" {
+		t.Errorf("violations = %+v", violations)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"time"
 
 	"dune-takehome-server/database"
@@ -12,9 +13,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrStaleRevision is returned when a form changed since the revision a write was based on
+var ErrStaleRevision = errors.New("form was changed by someone else")
+
 type FormService struct {
 	collection *mongo.Collection
 }
@@ -25,20 +28,12 @@ func NewFormService() *FormService {
 	}
 }
 
-// GetUserForms retrieves all forms for a specific user
-func (s *FormService) GetUserForms(userID primitive.ObjectID, status *models.FormStatus) ([]*models.Form, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// GetAllForms retrieves every form, regardless of owner
+func (s *FormService) GetAllForms() ([]*models.Form, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	filter := bson.M{"user_id": userID}
-	if status != nil {
-		filter["status"] = *status
-	}
-
-	// Sort by updated_at descending (most recent first)
-	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
-
-	cursor, err := s.collection.Find(ctx, filter, opts)
+	cursor, err := s.collection.Find(ctx, bson.M{})
 	if err != nil {
 		return nil, err
 	}
@@ -52,8 +47,8 @@ func (s *FormService) GetUserForms(userID primitive.ObjectID, status *models.For
 	return forms, nil
 }
 
-// CreateForm creates a new form
-func (s *FormService) CreateForm(userID primitive.ObjectID, req models.FormRequest) (*models.Form, error) {
+// CreateForm creates a new form in a workspace
+func (s *FormService) CreateForm(userID, workspaceID primitive.ObjectID, req models.FormRequest) (*models.Form, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -66,12 +61,19 @@ func (s *FormService) CreateForm(userID primitive.ObjectID, req models.FormReque
 	form := &models.Form{
 		ID:          primitive.NewObjectID(),
 		UserID:      userID,
+		WorkspaceID: workspaceID,
 		Title:       req.Title,
 		Description: req.Description,
 		Fields:      req.Fields,
 		Status:      status,
+		Tags:        req.Tags,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+		Revision:    1,
+	}
+
+	if req.Folder != nil {
+		form.Folder = *req.Folder
 	}
 
 	// Generate share URL if publishing
@@ -104,53 +106,41 @@ func (s *FormService) GetFormByID(formID primitive.ObjectID) (*models.Form, erro
 	return &form, nil
 }
 
-// GetUserFormByID retrieves a form by ID that belongs to a specific user
-func (s *FormService) GetUserFormByID(userID, formID primitive.ObjectID) (*models.Form, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var form models.Form
-	err := s.collection.FindOne(ctx, bson.M{
-		"_id":     formID,
-		"user_id": userID,
-	}).Decode(&form)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil // Form not found
-		}
-		return nil, err
-	}
-
-	return &form, nil
-}
-
-// UpdateForm updates an existing form
-func (s *FormService) UpdateForm(userID, formID primitive.ObjectID, req models.FormRequest) (*models.Form, error) {
+// UpdateForm updates an existing form when it is still at the given revision.
+// Otherwise ErrStaleRevision is returned along with the current form.
+func (s *FormService) UpdateForm(formID primitive.ObjectID, req models.FormRequest, revision int64) (*models.Form, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	status := req.Status
-	if status == "" {
-		status = models.FormStatusDraft
-	}
-
 	update := bson.M{
 		"$set": bson.M{
 			"title":       req.Title,
 			"description": req.Description,
 			"fields":      req.Fields,
-			"status":      status,
 			"updated_at":  time.Now(),
 		},
+		"$inc": bson.M{"revision": 1},
+	}
+
+	// A request without a status keeps the current one
+	if req.Status != "" {
+		update["$set"].(bson.M)["status"] = req.Status
+	}
+
+	// Likewise for the folder and tags, which the builder does not send
+	if req.Folder != nil && *req.Folder != "" {
+		update["$set"].(bson.M)["folder"] = *req.Folder
+	} else if req.Folder != nil {
+		update["$unset"] = bson.M{"folder": ""}
+	}
+	if req.Tags != nil {
+		update["$set"].(bson.M)["tags"] = req.Tags
 	}
 
 	// Generate share URL if publishing and doesn't already have one
-	if status == models.FormStatusPublished {
+	if req.Status == models.FormStatusPublished {
 		var existingForm models.Form
-		err := s.collection.FindOne(ctx, bson.M{
-			"_id":     formID,
-			"user_id": userID,
-		}).Decode(&existingForm)
+		err := s.collection.FindOne(ctx, bson.M{"_id": formID}).Decode(&existingForm)
 
 		if err == nil && existingForm.ShareURL == "" {
 			update["$set"].(bson.M)["share_url"] = generateShareURL()
@@ -159,7 +149,7 @@ func (s *FormService) UpdateForm(userID, formID primitive.ObjectID, req models.F
 
 	result, err := s.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": formID, "user_id": userID},
+		bson.M{"_id": formID, "revision": revisionFilter(revision)},
 		update,
 	)
 	if err != nil {
@@ -167,10 +157,14 @@ func (s *FormService) UpdateForm(userID, formID primitive.ObjectID, req models.F
 	}
 
 	if result.MatchedCount == 0 {
-		return nil, nil // Form not found or doesn't belong to user
+		current, err := s.GetFormByID(formID)
+		if err != nil || current == nil {
+			return nil, err // Form not found
+		}
+		return current, ErrStaleRevision
 	}
 
-	return s.GetUserFormByID(userID, formID)
+	return s.GetFormByID(formID)
 }
 
 // GetFormByShareURL retrieves a form by its share URL
@@ -190,6 +184,15 @@ func (s *FormService) GetFormByShareURL(shareURL string) (*models.Form, error) {
 	return &form, nil
 }
 
+// revisionFilter matches a revision. Forms created before revisions were
+// tracked have none, which counts as revision 0.
+func revisionFilter(revision int64) interface{} {
+	if revision == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return revision
+}
+
 func generateShareURL() string {
 	bytes := make([]byte, 16)
 	rand.Read(bytes)
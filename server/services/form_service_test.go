@@ -0,0 +1,28 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRevisionFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		revision int64
+		want     interface{}
+	}{
+		// A null in $in also matches documents without the field
+		{"zero matches forms without a revision", 0, bson.M{"$in": bson.A{0, nil}}},
+		{"first revision", 1, int64(1)},
+		{"later revision", 3, int64(3)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := revisionFilter(test.revision); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("revisionFilter(%d) = %#v, want %#v", test.revision, got, test.want)
+			}
+		})
+	}
+}
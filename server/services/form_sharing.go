@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned when sharing forms
+var (
+	ErrCollaboratorExists   = errors.New("form is already shared with this user")
+	ErrCollaboratorNotFound = errors.New("collaborator not found")
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrAlreadyOwner         = errors.New("user already owns the form")
+	ErrOwnerChanged         = errors.New("form owner changed meanwhile")
+)
+
+// InviteCollaborator shares a form with the user who has, or will register
+// with, an email. They get access once they accept.
+func (s *FormService) InviteCollaborator(form *models.Form, invitedBy primitive.ObjectID, email string, role models.WorkspaceRole) (*models.Form, error) {
+	email = normalizeEmail(email)
+	for _, collaborator := range form.Collaborators {
+		if collaborator.Email == email {
+			return nil, ErrCollaboratorExists
+		}
+	}
+
+	collaborator := models.FormCollaborator{
+		ID:        primitive.NewObjectID(),
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		InvitedAt: time.Now(),
+	}
+	updated, err := s.updateSharing(
+		bson.M{"_id": form.ID, "collaborators.email": bson.M{"$ne": email}},
+		bson.M{"$push": bson.M{"collaborators": collaborator}},
+	)
+	if err == nil && updated == nil {
+		return nil, ErrCollaboratorExists // Invited meanwhile
+	}
+	return updated, err
+}
+
+// UpdateCollaboratorRole changes the role of a collaborator or pending invitation
+func (s *FormService) UpdateCollaboratorRole(formID, collaboratorID primitive.ObjectID, role models.WorkspaceRole) (*models.Form, error) {
+	updated, err := s.updateSharing(
+		bson.M{"_id": formID, "collaborators.id": collaboratorID},
+		bson.M{"$set": bson.M{"collaborators.$.role": role}},
+	)
+	if err == nil && updated == nil {
+		return nil, ErrCollaboratorNotFound
+	}
+	return updated, err
+}
+
+// RemoveCollaborator stops sharing a form with a collaborator, or withdraws their invitation
+func (s *FormService) RemoveCollaborator(formID, collaboratorID primitive.ObjectID) (*models.Form, error) {
+	updated, err := s.updateSharing(
+		bson.M{"_id": formID, "collaborators.id": collaboratorID},
+		bson.M{"$pull": bson.M{"collaborators": bson.M{"id": collaboratorID}}},
+	)
+	if err == nil && updated == nil {
+		return nil, ErrCollaboratorNotFound
+	}
+	return updated, err
+}
+
+// GetPendingInvitations retrieves the forms with an invitation for an email
+// that has not been accepted yet
+func (s *FormService) GetPendingInvitations(email string) ([]*models.Form, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"collaborators": bson.M{"$elemMatch": bson.M{
+		"email":       normalizeEmail(email),
+		"accepted_at": nil,
+	}}}
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var forms []*models.Form
+	if err = cursor.All(ctx, &forms); err != nil {
+		return nil, err
+	}
+
+	return forms, nil
+}
+
+// AcceptInvitation gives the user with the invited email access to the form
+func (s *FormService) AcceptInvitation(formID, userID primitive.ObjectID, email string) (*models.Form, error) {
+	email = normalizeEmail(email)
+	pending := bson.M{"email": email, "accepted_at": nil}
+
+	updated, err := s.updateSharing(
+		bson.M{"_id": formID, "collaborators": bson.M{"$elemMatch": pending}},
+		bson.M{"$set": bson.M{
+			"collaborators.$[invitation].user_id":     userID,
+			"collaborators.$[invitation].accepted_at": time.Now(),
+		}},
+		options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"invitation.email": email, "invitation.accepted_at": nil}},
+		}),
+	)
+	if err == nil && updated == nil {
+		return nil, ErrInvitationNotFound
+	}
+	return updated, err
+}
+
+// DeclineInvitation removes a pending invitation for an email
+func (s *FormService) DeclineInvitation(formID primitive.ObjectID, email string) error {
+	pending := bson.M{"email": normalizeEmail(email), "accepted_at": nil}
+	updated, err := s.updateSharing(
+		bson.M{"_id": formID, "collaborators": bson.M{"$elemMatch": pending}},
+		bson.M{"$pull": bson.M{"collaborators": pending}},
+	)
+	if err == nil && updated == nil {
+		return ErrInvitationNotFound
+	}
+	return err
+}
+
+// TransferOwnership gives a form to another user, moving it to the given
+// workspace of theirs. They stop being a collaborator, since they own it now.
+// When previousOwner is given, they stay on the form as an editor.
+func (s *FormService) TransferOwnership(form *models.Form, newOwner *models.User, workspaceID primitive.ObjectID, previousOwner *models.User) (*models.Form, error) {
+	if form.UserID == newOwner.ID {
+		return nil, ErrAlreadyOwner
+	}
+
+	collaborators := make([]models.FormCollaborator, 0, len(form.Collaborators)+1)
+	for _, collaborator := range form.Collaborators {
+		if collaborator.UserID == newOwner.ID || collaborator.Email == normalizeEmail(newOwner.Email) {
+			continue
+		}
+		if previousOwner != nil && (collaborator.UserID == previousOwner.ID || collaborator.Email == normalizeEmail(previousOwner.Email)) {
+			continue
+		}
+		collaborators = append(collaborators, collaborator)
+	}
+	if previousOwner != nil {
+		now := time.Now()
+		collaborators = append(collaborators, models.FormCollaborator{
+			ID:         primitive.NewObjectID(),
+			Email:      normalizeEmail(previousOwner.Email),
+			UserID:     previousOwner.ID,
+			Role:       models.RoleEditor,
+			InvitedBy:  newOwner.ID,
+			InvitedAt:  now,
+			AcceptedAt: &now,
+		})
+	}
+
+	// Only applies when nobody changed the form's owner meanwhile
+	updated, err := s.updateSharing(
+		bson.M{"_id": form.ID, "user_id": form.UserID},
+		bson.M{"$set": bson.M{
+			"user_id":       newOwner.ID,
+			"workspace_id":  workspaceID,
+			"collaborators": collaborators,
+		}},
+	)
+	if err == nil && updated == nil {
+		return nil, ErrOwnerChanged
+	}
+	return updated, err
+}
+
+// updateSharing applies a change to who has access to a form. It does not
+// change the form's definition, so the revision stays as it is.
+func (s *FormService) updateSharing(filter, update bson.M, opts ...*options.FindOneAndUpdateOptions) (*models.Form, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts = append(opts, options.FindOneAndUpdate().SetReturnDocument(options.After))
+
+	var form models.Form
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&form)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &form, nil
+}
+
+// normalizeEmail is how emails are compared for invitations
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// realtimeRelay turns broker events into the messages dashboards receive, so
+// WebSocket rooms and event streams send the same events
+type realtimeRelay struct {
+	formService *FormService
+	userService *UserService
+}
+
+// relay builds the messages of an event and hands each to send. The time
+// series update needs the owner's timezone and is sent asynchronously.
+func (r *realtimeRelay) relay(event BrokerEvent, send func(message models.EventMessage)) {
+	form := event.Form
+	if form == nil {
+		var err error
+		form, err = r.formService.GetFormByID(event.FormID)
+		if err != nil || form == nil {
+			log.Printf("❌ Failed to load form %s for broadcast: %v", event.FormID.Hex(), err)
+			return
+		}
+	}
+
+	switch event.Type {
+	case EventResponseCreated:
+		send(analyticsDeltaMessage(form.ID, BuildAnalyticsDelta(form, event.Response)))
+		send(responseCreatedMessage(form, event.Response))
+		go func() {
+			timezone, err := r.userService.FormTimezone(form)
+			if err != nil {
+				log.Printf("❌ Failed to load form owner for time series broadcast: %v", err)
+				return
+			}
+			update, err := BuildTimeSeriesUpdate(form, event.Response, timezone)
+			if err != nil {
+				log.Printf("❌ Failed to build time series update: %v", err)
+				return
+			}
+			send(timeSeriesMessage(form.ID, update))
+		}()
+	case EventFormUpdated:
+		send(formUpdateMessage(form))
+	case EventFieldOperation:
+		send(fieldOperationMessage(form, event.Operation))
+	case EventResponsesImported:
+		send(responsesImportedMessage(form, event.Import))
+	}
+}
+
+// analyticsDeltaMessage carries the analytics delta of a newly submitted
+// response. Dashboards apply the delta to the analytics they already hold.
+func analyticsDeltaMessage(formID primitive.ObjectID, delta *models.AnalyticsDelta) models.EventMessage {
+	return models.EventMessage{
+		Version:   models.RealtimeProtocolVersion,
+		Type:      models.MessageAnalyticsDelta,
+		FormID:    formID.Hex(),
+		Delta:     delta,
+		Timestamp: &delta.SubmittedAt,
+	}
+}
+
+// timeSeriesMessage carries the time series buckets a new response falls into
+func timeSeriesMessage(formID primitive.ObjectID, update *models.TimeSeriesUpdate) models.EventMessage {
+	return models.EventMessage{
+		Version:   models.RealtimeProtocolVersion,
+		Type:      models.MessageTimeSeriesUpdate,
+		FormID:    formID.Hex(),
+		Update:    update,
+		Timestamp: &update.SubmittedAt,
+	}
+}
+
+// formUpdateMessage carries a form whose structure changed
+func formUpdateMessage(form *models.Form) models.EventMessage {
+	response := form.ToResponse()
+	return models.EventMessage{
+		Version: models.RealtimeProtocolVersion,
+		Type:    models.MessageFormUpdate,
+		FormID:  form.ID.Hex(),
+		Form:    &response,
+	}
+}
+
+// responsesImportedMessage tells dashboards an import finished, so they
+// refetch analytics and responses
+func responsesImportedMessage(form *models.Form, job *models.ResponseImportJob) models.EventMessage {
+	summary := *job
+	summary.Report.Rejected = nil
+	return models.EventMessage{
+		Version:   models.RealtimeProtocolVersion,
+		Type:      models.MessageResponsesImported,
+		FormID:    form.ID.Hex(),
+		Import:    &summary,
+		Timestamp: summary.FinishedAt,
+	}
+}
+
+// responseCreatedMessage carries a new response, redacted for the response feed
+func responseCreatedMessage(form *models.Form, response *models.FormUserResponse) models.EventMessage {
+	item := RedactResponse(form, response)
+	return models.EventMessage{
+		Version:   models.RealtimeProtocolVersion,
+		Type:      models.MessageResponseCreated,
+		FormID:    form.ID.Hex(),
+		Response:  &item,
+		Timestamp: &response.SubmittedAt,
+	}
+}
+
+// fieldOperationMessage carries an applied field operation, with the field as
+// it is now and its position so editors converge on the stored form
+func fieldOperationMessage(form *models.Form, op *models.FieldOperation) models.EventMessage {
+	applied := *op
+	applied.Field, applied.Index = nil, nil
+	if field, index := fieldPosition(form, op.FieldID); field != nil && op.Op != models.FieldOperationDelete {
+		applied.Field, applied.Index = field, &index
+	}
+	return models.EventMessage{
+		Version:   models.RealtimeProtocolVersion,
+		Type:      models.MessageFieldOperation,
+		FormID:    form.ID.Hex(),
+		Operation: &applied,
+		Timestamp: &applied.AppliedAt,
+	}
+}
+
+// eventTopics returns the topics an event message is published on
+func eventTopics(message models.EventMessage) []models.RealtimeTopicName {
+	switch message.Type {
+	case models.MessageFormUpdate:
+		return []models.RealtimeTopicName{models.TopicFormAnalytics, models.TopicFormEdits}
+	case models.MessageResponseCreated:
+		return []models.RealtimeTopicName{models.TopicFormResponses}
+	case models.MessageResponsesImported:
+		return []models.RealtimeTopicName{models.TopicFormAnalytics, models.TopicFormResponses}
+	case models.MessageFieldOperation, models.MessagePresence:
+		return []models.RealtimeTopicName{models.TopicFormEdits}
+	default:
+		return []models.RealtimeTopicName{models.TopicFormAnalytics}
+	}
+}
+
+// RealtimeProtocolSchema describes the WebSocket protocol as a JSON Schema,
+// generated from the message types so it cannot drift from the server. Every
+// message is either a ClientMessage or a ServerMessage.
+func RealtimeProtocolSchema() utils.JSONSchema {
+	g := utils.NewSchemaGenerator()
+	client := g.Ref(models.ClientMessage{})
+	server := []utils.JSONSchema{
+		g.Ref(models.ConnectedMessage{}),
+		g.Ref(models.AckMessage{}),
+		g.Ref(models.ErrorMessage{}),
+		g.Ref(models.EventMessage{}),
+	}
+
+	// Reflection only knows the Go types, so add the values they take
+	restrict := func(def, property string, values ...interface{}) {
+		properties := g.Defs[def]["properties"].(utils.JSONSchema)
+		properties[property] = utils.JSONSchema{"enum": values}
+	}
+	version := utils.JSONSchema{"const": models.RealtimeProtocolVersion}
+
+	requests := []interface{}{models.MessageAuth, models.MessageSubscribe, models.MessageUnsubscribe,
+		models.MessageJoinAnalytics, models.MessageLeaveAnalytics,
+		models.MessageSubscribeResponses, models.MessageUnsubscribeResponses,
+		models.MessageFieldOperation, models.MessagePresence}
+	restrict("ClientMessage", "type", requests...)
+	restrict("ConnectedMessage", "type", models.MessageConnected)
+	restrict("AckMessage", "type", models.MessageAck)
+	restrict("AckMessage", "request", requests...)
+	restrict("ErrorMessage", "type", models.MessageError)
+	restrict("ErrorMessage", "code", models.RealtimeErrorBadRequest, models.RealtimeErrorUnsupportedVersion,
+		models.RealtimeErrorUnknownTopic, models.RealtimeErrorUnauthorized, models.RealtimeErrorTokenExpired,
+		models.RealtimeErrorInvalidFormID, models.RealtimeErrorForbidden, models.RealtimeErrorConflict, models.RealtimeErrorInternal)
+	restrict("EventMessage", "type", models.MessageAnalyticsDelta, models.MessageTimeSeriesUpdate, models.MessageFormUpdate,
+		models.MessageResponseCreated, models.MessageResponsesReplay, models.MessageFieldOperation, models.MessagePresence)
+	restrict("FieldOperation", "op", models.FieldOperationAdd, models.FieldOperationUpdate,
+		models.FieldOperationMove, models.FieldOperationDelete)
+	restrict("RealtimeTopic", "name", models.TopicFormAnalytics, models.TopicFormResponses, models.TopicFormEdits)
+	for _, def := range []string{"ClientMessage", "ConnectedMessage", "AckMessage", "ErrorMessage", "EventMessage"} {
+		g.Defs[def]["properties"].(utils.JSONSchema)["v"] = version
+	}
+
+	g.Defs["ServerMessage"] = utils.JSONSchema{"oneOf": server}
+	return utils.JSONSchema{
+		"$schema":     utils.JSONSchemaDraft,
+		"title":       "RealtimeMessage",
+		"description": fmt.Sprintf("WebSocket message protocol, version %d", models.RealtimeProtocolVersion),
+		"version":     models.RealtimeProtocolVersion,
+		"oneOf":       []utils.JSONSchema{client, {"$ref": "#/$defs/ServerMessage"}},
+		"$defs":       g.Defs,
+	}
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// The client generates its message types from the checked-in schema, so it
+// must match the protocol the server speaks
+func TestRealtimeProtocolSchemaIsCurrent(t *testing.T) {
+	const path = "../../client/src/types/realtime-protocol.schema.json"
+
+	checkedIn, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	generated, err := json.MarshalIndent(RealtimeProtocolSchema(), "", "  ")
+	if err != nil {
+		t.Fatalf("encode schema: %v", err)
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(checkedIn), generated) {
+		t.Errorf("%s is out of date, run: go run ./cmd/realtime-schema -o %s", path, path[3:])
+	}
+}
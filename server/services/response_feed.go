@@ -0,0 +1,63 @@
+package services
+
+import (
+	"strings"
+
+	"dune-takehome-server/models"
+)
+
+// RedactedValue replaces the answers of sensitive fields in the response feed
+const RedactedValue = "[redacted]"
+
+// responseFeedPageSize is how many recent responses are replayed when a client
+// subscribes to the response feed
+const responseFeedPageSize = 20
+
+// RedactResponse prepares a response for the live feed. Answers to fields
+// marked sensitive are replaced, email addresses are masked, answers to fields
+// no longer on the form are left out, and the IP address and user agent are
+// dropped in favor of the parsed client.
+func RedactResponse(form *models.Form, response *models.FormUserResponse) models.ResponseFeedItem {
+	item := models.ResponseFeedItem{
+		ID:          response.ID,
+		FormID:      response.FormID,
+		Responses:   make(map[string]interface{}),
+		SubmittedAt: response.SubmittedAt,
+		StartedAt:   response.StartedAt,
+		Client:      response.Client,
+	}
+
+	for _, field := range form.Fields {
+		value, ok := response.Responses[field.ID]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case field.Sensitive:
+			item.Responses[field.ID] = RedactedValue
+			item.Redacted = append(item.Redacted, field.ID)
+		case field.Type == models.FieldTypeEmail:
+			if str, ok := value.(string); ok && str != "" {
+				item.Responses[field.ID] = maskEmail(str)
+				item.Redacted = append(item.Redacted, field.ID)
+			} else {
+				item.Responses[field.ID] = value
+			}
+		default:
+			item.Responses[field.ID] = value
+		}
+	}
+
+	return item
+}
+
+// maskEmail keeps the first character of the local part and the domain, so
+// owners can tell respondents apart without seeing their addresses
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return RedactedValue
+	}
+	return string([]rune(local)[0]) + "***@" + domain
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"dune-takehome-server/models"
+)
+
+func TestRedactResponse(t *testing.T) {
+	form := &models.Form{Fields: []models.FormField{
+		{ID: "name", Type: models.FieldTypeText},
+		{ID: "email", Type: models.FieldTypeEmail},
+		{ID: "ssn", Type: models.FieldTypeText, Sensitive: true},
+		{ID: "contact", Type: models.FieldTypeEmail, Sensitive: true},
+		{ID: "skipped", Type: models.FieldTypeEmail},
+	}}
+	response := &models.FormUserResponse{
+		Responses: map[string]interface{}{
+			"name":    "Ada",
+			"email":   "ada@example.com",
+			"ssn":     "123-45-6789",
+			"contact": "ada@example.com",
+			"removed": "answer to a field deleted from the form",
+		},
+		IPAddress: "203.0.113.7",
+		UserAgent: "Mozilla/5.0",
+		Client:    &models.ClientInfo{Browser: "Firefox", Device: "desktop"},
+	}
+
+	item := RedactResponse(form, response)
+
+	want := map[string]interface{}{
+		"name":    "Ada",
+		"email":   "a***@example.com",
+		"ssn":     RedactedValue,
+		"contact": RedactedValue,
+	}
+	if !reflect.DeepEqual(item.Responses, want) {
+		t.Errorf("got answers %v, want %v", item.Responses, want)
+	}
+	if !reflect.DeepEqual(item.Redacted, []string{"email", "ssn", "contact"}) {
+		t.Errorf("got redacted fields %v", item.Redacted)
+	}
+	if item.Client == nil || item.Client.Browser != "Firefox" {
+		t.Error("parsed client was not kept")
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	for email, want := range map[string]string{
+		"ada@example.com":  "a***@example.com",
+		"élise@example.fr": "é***@example.fr",
+		"not an email":     RedactedValue,
+		"@example.com":     RedactedValue,
+	} {
+		if got := maskEmail(email); got != want {
+			t.Errorf("maskEmail(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
@@ -0,0 +1,655 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"dune-takehome-server/database"
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxImportRows is the most rows a CSV file of responses can have
+	MaxImportRows = 100000
+	// BackgroundImportRows is the most rows stored while the request waits;
+	// larger imports run as a background job
+	BackgroundImportRows = 1000
+	// maxReportedRejections is the most rejected rows listed in a report
+	maxReportedRejections = 100
+	importBatchSize       = 500
+)
+
+// ErrInvalidImport is returned for CSV files and import options that cannot be read at all
+var ErrInvalidImport = errors.New("invalid import")
+
+// submittedAtHeaders are the column headers recognized as submission times,
+// as exported by this app and common survey tools
+var submittedAtHeaders = map[string]bool{
+	"submitted_at": true, "submitted at": true, "submittedat": true, "submitted": true,
+	"timestamp": true, "submission time": true, "date submitted": true, "created_at": true,
+}
+
+// importTimeLayouts are the layouts submission times are tried in, without a
+// layout given. Dates with the day first need a layout.
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"1/2/2006",
+}
+
+// ReadResponseCSV reads a CSV file of responses to a form, whose first row
+// names the columns. Each row becomes a response dated by its submission time
+// column, with answers coerced to the types of their fields and validated
+// like a submission. Rows that cannot be imported are rejected and listed in
+// the report; a file or options that cannot be read at all are an
+// ErrInvalidImport.
+func ReadResponseCSV(form *models.Form, data []byte, opts models.ResponseImportOptions) (*models.ResponseImportReport, []*models.FormUserResponse, error) {
+	var responses []*models.FormUserResponse
+	report, err := readResponseCSV(form, bytes.NewReader(data), opts, func(response *models.FormUserResponse) error {
+		responses = append(responses, response)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return report, responses, nil
+}
+
+// readResponseCSV reads a CSV file of responses like ReadResponseCSV, handing
+// each valid response to valid as it is read. An error from valid stops it.
+func readResponseCSV(form *models.Form, r io.Reader, opts models.ResponseImportOptions, valid func(*models.FormUserResponse) error) (*models.ResponseImportReport, error) {
+	buffered := bufio.NewReader(r)
+	if bom, _ := buffered.Peek(3); bytes.Equal(bom, []byte("\ufeff")) {
+		buffered.Discard(3) // Byte order mark of spreadsheet exports
+	}
+	reader := csv.NewReader(buffered)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	plan, err := planResponseImport(form, header, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ResponseImportReport{
+		DryRun:            true,
+		Columns:           map[string]string{},
+		IgnoredColumns:    plan.ignored,
+		MissingFields:     plan.missing,
+		SubmittedAtColumn: plan.submittedAtHeader(header),
+	}
+	for column, field := range plan.fields {
+		report.Columns[header[column]] = field.ID
+	}
+
+	schema := FormResponseSchema(form)
+	now := time.Now()
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+
+		report.TotalRows++
+		if report.TotalRows > MaxImportRows {
+			return nil, fmt.Errorf("%w: the file has more than %d rows", ErrInvalidImport, MaxImportRows)
+		}
+		line, _ := reader.FieldPos(0)
+
+		var problems []string
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("has %d columns, the header has %d", len(record), len(header)))
+		} else {
+			response, rowProblems := plan.readRow(record, header, schema, now)
+			if len(rowProblems) == 0 {
+				report.ValidRows++
+				if err := valid(response); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			problems = rowProblems
+		}
+
+		report.RejectedRows++
+		if len(report.Rejected) < maxReportedRejections {
+			report.Rejected = append(report.Rejected, models.RejectedRow{Line: line, Errors: problems})
+		}
+	}
+
+	return report, nil
+}
+
+// responseImportPlan is how the columns of a CSV file are read
+type responseImportPlan struct {
+	form        *models.Form
+	fields      map[int]models.FormField // By column
+	submittedAt int                      // Column of submission times, or -1
+	layout      string
+	location    *time.Location
+	separator   string
+	ignored     []string
+	missing     []string
+}
+
+func planResponseImport(form *models.Form, header []string, opts models.ResponseImportOptions) (*responseImportPlan, error) {
+	plan := &responseImportPlan{
+		form:        form,
+		fields:      map[int]models.FormField{},
+		submittedAt: -1,
+		layout:      opts.TimeLayout,
+		location:    time.UTC,
+		separator:   opts.ListSeparator,
+	}
+	if plan.separator == "" {
+		plan.separator = ","
+	}
+	if opts.Timezone != "" {
+		location, err := time.LoadLocation(opts.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidImport, opts.Timezone)
+		}
+		plan.location = location
+	}
+
+	fieldsByID := map[string]models.FormField{}
+	fieldsByLabel := map[string][]models.FormField{}
+	for _, field := range form.Fields {
+		fieldsByID[field.ID] = field
+		label := strings.ToLower(strings.TrimSpace(field.Label))
+		fieldsByLabel[label] = append(fieldsByLabel[label], field)
+	}
+
+	columns := map[string]int{}
+	for column, name := range header {
+		name = strings.TrimSpace(name)
+		header[column] = name
+		if name == "" {
+			continue // Left without a name, so there is nothing to import it into
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidImport, name)
+		}
+		columns[name] = column
+	}
+	for name := range opts.Mapping {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: the mapping names column %q, which the file does not have", ErrInvalidImport, name)
+		}
+	}
+
+	if opts.SubmittedAtColumn != "" {
+		column, ok := columns[opts.SubmittedAtColumn]
+		if !ok {
+			return nil, fmt.Errorf("%w: the file has no column %q", ErrInvalidImport, opts.SubmittedAtColumn)
+		}
+		plan.submittedAt = column
+	}
+
+	imported := map[string]string{} // Field ID to the column imported into it
+	for column, name := range header {
+		if column == plan.submittedAt || name == "" {
+			continue
+		}
+
+		fieldID, mapped := opts.Mapping[name]
+		var field models.FormField
+		var ok bool
+		switch {
+		case mapped && fieldID == "":
+			// Ignored on purpose
+		case mapped:
+			if field, ok = fieldsByID[fieldID]; !ok {
+				return nil, fmt.Errorf("%w: column %q is mapped to %q, which is not a field of the form", ErrInvalidImport, name, fieldID)
+			}
+		default:
+			field, ok = fieldsByID[name]
+			if matches := fieldsByLabel[strings.ToLower(name)]; !ok && len(matches) == 1 {
+				field, ok = matches[0], true
+			}
+		}
+
+		if !ok {
+			if plan.submittedAt < 0 && !mapped && opts.SubmittedAtColumn == "" && submittedAtHeaders[strings.ToLower(name)] {
+				plan.submittedAt = column
+				continue
+			}
+			plan.ignored = append(plan.ignored, name)
+			continue
+		}
+		if other, ok := imported[field.ID]; ok {
+			return nil, fmt.Errorf("%w: columns %q and %q are both imported into field %q", ErrInvalidImport, other, name, field.ID)
+		}
+		imported[field.ID] = name
+		plan.fields[column] = field
+	}
+
+	for _, field := range form.Fields {
+		if _, ok := imported[field.ID]; !ok {
+			plan.missing = append(plan.missing, field.ID)
+		}
+	}
+	return plan, nil
+}
+
+func (p *responseImportPlan) submittedAtHeader(header []string) string {
+	if p.submittedAt < 0 {
+		return ""
+	}
+	return header[p.submittedAt]
+}
+
+// readRow turns a row into a response, or lists why it cannot be imported
+func (p *responseImportPlan) readRow(record, header []string, schema utils.JSONSchema, now time.Time) (*models.FormUserResponse, []string) {
+	var problems []string
+	columnsByField := map[string]string{}
+	answers := map[string]interface{}{}
+	for column := range record {
+		field, ok := p.fields[column]
+		if !ok {
+			continue
+		}
+		columnsByField[field.ID] = header[column]
+		value := strings.TrimSpace(record[column])
+		if value == "" {
+			continue // Unanswered
+		}
+		answer, err := coerceAnswer(field, value, p.separator)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("column %q: %v", header[column], err))
+			continue
+		}
+		answers[field.ID] = answer
+	}
+
+	submittedAt := now
+	if p.submittedAt >= 0 {
+		value := strings.TrimSpace(record[p.submittedAt])
+		parsed, err := p.parseTime(value)
+		switch {
+		case value == "":
+			problems = append(problems, fmt.Sprintf("column %q: the submission time is missing", header[p.submittedAt]))
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("column %q: %q is not a known date and time format", header[p.submittedAt], value))
+		case parsed.After(now):
+			problems = append(problems, fmt.Sprintf("column %q: %s is in the future", header[p.submittedAt], value))
+		default:
+			submittedAt = parsed
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	if len(answers) == 0 {
+		return nil, []string{"has no answers"}
+	}
+
+	// Validated like a submission, with the problems named by column
+	for _, violation := range schema.Validate(map[string]interface{}{"responses": answers}) {
+		fieldID, _, _ := strings.Cut(strings.TrimPrefix(violation.Path, "/responses/"), "/")
+		if column, ok := columnsByField[fieldID]; ok {
+			problems = append(problems, fmt.Sprintf("column %q: %s", column, violation.Message))
+		} else {
+			problems = append(problems, fmt.Sprintf("field %q: %s", fieldID, violation.Message))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	return &models.FormUserResponse{
+		ID:           primitive.NewObjectID(),
+		FormID:       p.form.ID,
+		Responses:    answers,
+		SubmittedAt:  submittedAt.UTC(),
+		TextAnalysis: analyzeResponseText(p.form, answers),
+	}, nil
+}
+
+// parseTime reads a submission time in the given layout, or the first known
+// one it matches. Times without an offset are in the import's time zone.
+func (p *responseImportPlan) parseTime(value string) (time.Time, error) {
+	if p.layout != "" {
+		return time.ParseInLocation(p.layout, value, p.location)
+	}
+	var err error
+	for _, layout := range importTimeLayouts {
+		var parsed time.Time
+		if parsed, err = time.ParseInLocation(layout, value, p.location); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// coerceAnswer converts a cell to the answer to a field, as it would be
+// submitted: numbers for number and rating fields, the matching options for
+// choice fields and text otherwise. Whether the answer is valid is left to
+// the form's schema.
+func coerceAnswer(field models.FormField, value, separator string) (interface{}, error) {
+	switch field.Type {
+	case models.FieldTypeNumber, models.FieldTypeRating:
+		// ParseFloat accepts "Inf" and "NaN", which no number field can hold
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return n, nil
+	case models.FieldTypeSelect, models.FieldTypeRadio:
+		return matchOption(field.Options, value), nil
+	case models.FieldTypeCheckbox:
+		choices := []interface{}{}
+		for _, choice := range strings.Split(value, separator) {
+			if choice = strings.TrimSpace(choice); choice != "" {
+				choices = append(choices, matchOption(field.Options, choice))
+			}
+		}
+		return choices, nil
+	}
+	return value, nil
+}
+
+// matchOption finds the option a value names regardless of case, as exports
+// of other tools rarely keep it. Values naming no option are kept as they are.
+func matchOption(options []string, value string) string {
+	for _, option := range options {
+		if strings.EqualFold(option, value) {
+			return option
+		}
+	}
+	return value
+}
+
+const (
+	// importHeartbeat is how often a background import records that it is running
+	importHeartbeat = 10 * time.Second
+	// ImportStaleAfter is how long a background import goes without
+	// recording that it is running before it is taken to have died with its server
+	ImportStaleAfter = time.Minute
+)
+
+type ResponseImportService struct {
+	jobs      *mongo.Collection
+	responses *mongo.Collection
+	uploads   *gridfs.Bucket // CSV files of background imports, by job ID
+	analytics *AnalyticsService
+}
+
+func NewResponseImportService() *ResponseImportService {
+	// Only fails for invalid bucket options
+	uploads, _ := gridfs.NewBucket(database.Database, options.GridFSBucket().SetName("response_import_uploads"))
+	return &ResponseImportService{
+		jobs:      database.Database.Collection("response_imports"),
+		responses: database.Database.Collection("responses"),
+		uploads:   uploads,
+		analytics: NewAnalyticsService(),
+	}
+}
+
+// CreateImportJob records an import of responses about to be stored. The CSV
+// file of an import run in the background is kept until it finishes, so the
+// job reads it again rather than holding every response in memory.
+func (s *ResponseImportService) CreateImportJob(form *models.Form, userID primitive.ObjectID, report models.ResponseImportReport, upload []byte) (*models.ResponseImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report.DryRun = false
+	now := time.Now()
+	job := &models.ResponseImportJob{
+		ID:        primitive.NewObjectID(),
+		FormID:    form.ID,
+		UserID:    userID,
+		Status:    models.ImportJobRunning,
+		Report:    report,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if upload != nil {
+		if err := s.uploads.UploadFromStreamWithID(job.ID, job.ID.Hex()+".csv", bytes.NewReader(upload)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.jobs.InsertOne(ctx, job); err != nil {
+		s.deleteUpload(job)
+		return nil, err
+	}
+	return job, nil
+}
+
+// RunImportJob stores the responses of an import in batches, recording its
+// progress and counting each batch in the form's analytics. If storing fails,
+// the responses stored so far are kept and can be found by their import_id.
+func (s *ResponseImportService) RunImportJob(form *models.Form, job *models.ResponseImportJob, responses []*models.FormUserResponse) error {
+	var err error
+	for start := 0; start < len(responses) && err == nil; start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(responses) {
+			end = len(responses)
+		}
+		err = s.storeBatch(form, job, responses[start:end])
+	}
+	return s.finishImportJob(form, job, err)
+}
+
+// RunImportUpload runs an import in the background from the CSV file kept by
+// CreateImportJob, reading it again with the same options and storing the
+// valid rows a batch at a time. The file is deleted once the job finished.
+func (s *ResponseImportService) RunImportUpload(form *models.Form, job *models.ResponseImportJob, opts models.ResponseImportOptions) error {
+	defer s.deleteUpload(job)
+	stop := s.heartbeat(job)
+	defer stop()
+
+	err := func() error {
+		upload, err := s.uploads.OpenDownloadStream(job.ID)
+		if err != nil {
+			return err
+		}
+		defer upload.Close()
+
+		batch := make([]*models.FormUserResponse, 0, importBatchSize)
+		_, err = readResponseCSV(form, upload, opts, func(response *models.FormUserResponse) error {
+			batch = append(batch, response)
+			if len(batch) < importBatchSize {
+				return nil
+			}
+			err := s.storeBatch(form, job, batch)
+			batch = batch[:0]
+			return err
+		})
+		if err == nil && len(batch) > 0 {
+			err = s.storeBatch(form, job, batch)
+		}
+		return err
+	}()
+	return s.finishImportJob(form, job, err)
+}
+
+// FailStaleImportJobs marks the background imports whose server stopped
+// while they were running as failed, returning how many there were. Their
+// files are deleted and the responses they stored are kept.
+func (s *ResponseImportService) FailStaleImportJobs() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": models.ImportJobRunning, "updated_at": bson.M{"$lt": time.Now().Add(-ImportStaleAfter)}}
+	cursor, err := s.jobs.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var stale []*models.ResponseImportJob
+	if err := cursor.All(ctx, &stale); err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, job := range stale {
+		now := time.Now()
+		result, err := s.jobs.UpdateOne(ctx,
+			bson.M{"_id": job.ID, "status": models.ImportJobRunning},
+			bson.M{"$set": bson.M{
+				"status":      models.ImportJobFailed,
+				"error":       "the server stopped before the import finished",
+				"finished_at": now,
+				"updated_at":  now,
+			}},
+		)
+		if err != nil {
+			return failed, err
+		}
+		failed += int(result.ModifiedCount)
+		s.deleteUpload(job)
+	}
+	return failed, nil
+}
+
+// finishImportJob records how an import ended
+func (s *ResponseImportService) finishImportJob(form *models.Form, job *models.ResponseImportJob, err error) error {
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	job.UpdatedAt = finishedAt
+	job.Status = models.ImportJobCompleted
+	if err != nil {
+		job.Status = models.ImportJobFailed
+		job.Error = err.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, updateErr := s.jobs.ReplaceOne(ctx, bson.M{"_id": job.ID}, job); updateErr != nil {
+		log.Printf("❌ Failed to record the end of import %s for form %s: %v", job.ID.Hex(), form.ID.Hex(), updateErr)
+	}
+	return err
+}
+
+// storeBatch stores a batch of imported responses, counts them in the form's
+// analytics and records the progress of their job
+func (s *ResponseImportService) storeBatch(form *models.Form, job *models.ResponseImportJob, responses []*models.FormUserResponse) error {
+	docs := make([]interface{}, 0, len(responses))
+	for _, response := range responses {
+		response.ImportID = &job.ID
+		docs = append(docs, response)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := s.responses.InsertMany(ctx, docs); err != nil {
+		return err
+	}
+	if err := s.analytics.RecordResponses(form, responses); err != nil {
+		return err
+	}
+	job.Report.ImportedRows += len(responses)
+	_, err := s.jobs.UpdateOne(ctx, bson.M{"_id": job.ID}, bson.M{"$set": bson.M{
+		"report.imported_rows": job.Report.ImportedRows,
+		"updated_at":           time.Now(),
+	}})
+	return err
+}
+
+// heartbeat records that a background import is alive until stop is called,
+// so FailStaleImportJobs leaves it be
+func (s *ResponseImportService) heartbeat(job *models.ResponseImportJob) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(importHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				_, err := s.jobs.UpdateOne(ctx,
+					bson.M{"_id": job.ID, "status": models.ImportJobRunning},
+					bson.M{"$set": bson.M{"updated_at": time.Now()}},
+				)
+				cancel()
+				if err != nil {
+					log.Printf("⚠️ Failed to record that import %s is running: %v", job.ID.Hex(), err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// deleteUpload deletes the CSV file kept for a background import, if any
+func (s *ResponseImportService) deleteUpload(job *models.ResponseImportJob) {
+	err := s.uploads.Delete(job.ID)
+	if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		log.Printf("⚠️ Failed to delete the file of import %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// GetImportJob retrieves an import of responses to a form
+func (s *ResponseImportService) GetImportJob(formID, jobID primitive.ObjectID) (*models.ResponseImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var job models.ResponseImportJob
+	err := s.jobs.FindOne(ctx, bson.M{"_id": jobID, "form_id": formID}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Import not found
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// GetImportJobs lists the imports of responses to a form, latest first
+func (s *ResponseImportService) GetImportJobs(formID primitive.ObjectID) ([]*models.ResponseImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"report.rejected": 0})
+
+	cursor, err := s.jobs.Find(ctx, bson.M{"form_id": formID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []*models.ResponseImportJob{}
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
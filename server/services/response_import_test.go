@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+)
+
+func importForm() *models.Form {
+	return &models.Form{
+		Title: "Migrated survey",
+		Fields: []models.FormField{
+			{ID: "email", Type: models.FieldTypeEmail, Label: "Email", Required: true, Order: 0},
+			{ID: "age", Type: models.FieldTypeNumber, Label: "Age", Validation: map[string]string{"min": "0"}, Order: 1},
+			{ID: "plan", Type: models.FieldTypeSelect, Label: "Plan", Options: []string{"Free", "Pro"}, Order: 2},
+			{ID: "topics", Type: models.FieldTypeCheckbox, Label: "Topics", Options: []string{"Phishing", "Passwords"}, Order: 3},
+			{ID: "score", Type: models.FieldTypeRating, Label: "Score", Order: 4},
+		},
+	}
+}
+
+func TestReadResponseCSV(t *testing.T) {
+	data := "\ufeffTimestamp,Email,Age,plan,Topics,Score,Notes\n" +
+		"2024-03-01 09:30:00,ada@example.com,36,pro,\"phishing, Passwords\",5,first\n" +
+		"2024-03-02,bob@example.com,,,,,\n" +
+		"2024-03-03,not-an-email,-4,Enterprise,,6,\n" +
+		"yesterday,cy@example.com,,,,,\n" +
+		"2024-03-04,short@example.com\n"
+
+	report, responses, err := ReadResponseCSV(importForm(), []byte(data), models.ResponseImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantColumns := map[string]string{"Email": "email", "Age": "age", "plan": "plan", "Topics": "topics", "Score": "score"}
+	if !reflect.DeepEqual(report.Columns, wantColumns) {
+		t.Errorf("columns = %v, want %v", report.Columns, wantColumns)
+	}
+	if report.SubmittedAtColumn != "Timestamp" || !reflect.DeepEqual(report.IgnoredColumns, []string{"Notes"}) {
+		t.Errorf("submitted at column = %q, ignored = %v", report.SubmittedAtColumn, report.IgnoredColumns)
+	}
+	if !report.DryRun || report.TotalRows != 5 || report.ValidRows != 2 || report.RejectedRows != 3 {
+		t.Errorf("report = %+v", report)
+	}
+
+	if len(responses) != 2 {
+		t.Fatalf("got %d responses, want 2", len(responses))
+	}
+	wantAnswers := map[string]interface{}{
+		"email":  "ada@example.com",
+		"age":    36.0,
+		"plan":   "Pro",
+		"topics": []interface{}{"Phishing", "Passwords"},
+		"score":  5.0,
+	}
+	if !reflect.DeepEqual(responses[0].Responses, wantAnswers) {
+		t.Errorf("answers = %#v, want %#v", responses[0].Responses, wantAnswers)
+	}
+	if want := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC); !responses[0].SubmittedAt.Equal(want) {
+		t.Errorf("submitted at = %v, want %v", responses[0].SubmittedAt, want)
+	}
+	if len(responses[1].Responses) != 1 {
+		t.Errorf("empty cells answered: %v", responses[1].Responses)
+	}
+
+	if len(report.Rejected) != 3 {
+		t.Fatalf("rejected = %+v", report.Rejected)
+	}
+	invalid := report.Rejected[0]
+	if invalid.Line != 4 || len(invalid.Errors) != 4 {
+		t.Errorf("invalid row = %+v", invalid)
+	}
+	for _, column := range []string{`"Age"`, `"Email"`, `"plan"`, `"Score"`} {
+		if !strings.Contains(strings.Join(invalid.Errors, "\n"), column) {
+			t.Errorf("no error names column %s: %v", column, invalid.Errors)
+		}
+	}
+	if rejected := report.Rejected[1]; rejected.Line != 5 || !strings.Contains(rejected.Errors[0], "Timestamp") {
+		t.Errorf("row with an unknown time = %+v", rejected)
+	}
+	if rejected := report.Rejected[2]; rejected.Line != 6 || !strings.Contains(rejected.Errors[0], "columns") {
+		t.Errorf("short row = %+v", rejected)
+	}
+}
+
+func TestReadResponseCSVOptions(t *testing.T) {
+	data := "When,Contact,Age\n" +
+		"02/03/2024 10:00,ada@example.com,30\n"
+	opts := models.ResponseImportOptions{
+		Mapping:           map[string]string{"Contact": "email", "Age": ""},
+		SubmittedAtColumn: "When",
+		TimeLayout:        "02/01/2006 15:04",
+		Timezone:          "Europe/Paris",
+	}
+
+	report, responses, err := ReadResponseCSV(importForm(), []byte(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Columns, map[string]string{"Contact": "email"}) || !reflect.DeepEqual(report.IgnoredColumns, []string{"Age"}) {
+		t.Errorf("columns = %v, ignored = %v", report.Columns, report.IgnoredColumns)
+	}
+	if !reflect.DeepEqual(report.MissingFields, []string{"age", "plan", "topics", "score"}) {
+		t.Errorf("missing fields = %v", report.MissingFields)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if want := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC); !responses[0].SubmittedAt.Equal(want) {
+		t.Errorf("submitted at = %v, want %v", responses[0].SubmittedAt, want)
+	}
+}
+
+func TestReadResponseCSVInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		opts models.ResponseImportOptions
+	}{
+		{"empty", "", models.ResponseImportOptions{}},
+		{"duplicate column", "Email,Email\n", models.ResponseImportOptions{}},
+		{"unknown mapped column", "Email\n", models.ResponseImportOptions{Mapping: map[string]string{"Mail": "email"}}},
+		{"unknown field", "Mail\n", models.ResponseImportOptions{Mapping: map[string]string{"Mail": "phone"}}},
+		{"field imported twice", "Email,Mail\n", models.ResponseImportOptions{Mapping: map[string]string{"Mail": "email"}}},
+		{"unknown time zone", "Email\n", models.ResponseImportOptions{Timezone: "Mars/Olympus"}},
+		{"malformed", "Email\n\"ada@example.com\n", models.ResponseImportOptions{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := ReadResponseCSV(importForm(), []byte(test.data), test.opts)
+			if !errors.Is(err, ErrInvalidImport) {
+				t.Errorf("err = %v, want ErrInvalidImport", err)
+			}
+		})
+	}
+}
+
+func TestCoerceAnswer(t *testing.T) {
+	age := models.FormField{ID: "age", Type: models.FieldTypeNumber}
+	score := models.FormField{ID: "score", Type: models.FieldTypeRating}
+	plan := models.FormField{ID: "plan", Type: models.FieldTypeSelect, Options: []string{"Free", "Pro"}}
+	topics := models.FormField{ID: "topics", Type: models.FieldTypeCheckbox, Options: []string{"Phishing", "Passwords"}}
+	tests := []struct {
+		field models.FormField
+		value string
+		want  interface{}
+		ok    bool
+	}{
+		{age, "36", 36.0, true},
+		{age, "-4.5", -4.5, true},
+		{age, "1e3", 1000.0, true},
+		{age, "many", nil, false},
+		{age, "Inf", nil, false},
+		{age, "-infinity", nil, false},
+		{age, "NaN", nil, false},
+		{age, "1e400", nil, false},
+		{score, "+Inf", nil, false},
+		{plan, "pro", "Pro", true},
+		{plan, "Team", "Team", true},
+		{topics, "phishing; passwords", []interface{}{"Phishing", "Passwords"}, true},
+	}
+	for _, test := range tests {
+		got, err := coerceAnswer(test.field, test.value, ";")
+		if !reflect.DeepEqual(got, test.want) || (err == nil) != test.ok {
+			t.Errorf("coerceAnswer(%s, %q) = %#v, %v, want %#v", test.field.ID, test.value, got, err, test.want)
+		}
+	}
+}
+
+// Background imports read the file as a stream, a batch of responses at a time
+func TestReadResponseCSVStream(t *testing.T) {
+	data := "\ufeffEmail,Age\nada@example.com,36\nbob@example.com,NaN\ncy@example.com,\ndee@example.com,40\n"
+
+	var emails []string
+	report, err := readResponseCSV(importForm(), strings.NewReader(data), models.ResponseImportOptions{}, func(response *models.FormUserResponse) error {
+		emails = append(emails, response.Responses["email"].(string))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ada@example.com", "cy@example.com", "dee@example.com"}; !reflect.DeepEqual(emails, want) {
+		t.Errorf("responses = %v, want %v", emails, want)
+	}
+	if report.ValidRows != 3 || report.RejectedRows != 1 {
+		t.Errorf("report = %+v", report)
+	}
+
+	stop := errors.New("stop")
+	read := 0
+	_, err = readResponseCSV(importForm(), strings.NewReader(data), models.ResponseImportOptions{}, func(*models.FormUserResponse) error {
+		read++
+		return stop
+	})
+	if !errors.Is(err, stop) || read != 1 {
+		t.Errorf("err = %v after %d responses, want stop after 1", err, read)
+	}
+}
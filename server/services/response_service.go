@@ -3,8 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
-	"log" // Add this
-	"strconv"
+	"log"
 	"time"
 
 	"dune-takehome-server/database"
@@ -18,26 +17,30 @@ import (
 
 type ResponseService struct {
 	collection *mongo.Collection
+	analytics  *AnalyticsService
 }
 
 func NewResponseService() *ResponseService {
 	return &ResponseService{
 		collection: database.Database.Collection("responses"),
+		analytics:  NewAnalyticsService(),
 	}
 }
 
-// CreateResponse saves a new form response
-func (s *ResponseService) CreateResponse(formID primitive.ObjectID, req models.FormResponseRequest, ipAddress, userAgent string) (*models.FormUserResponse, error) {
+// CreateResponse saves a new form response and updates the form's analytics aggregates
+func (s *ResponseService) CreateResponse(form *models.Form, req models.FormResponseRequest, ipAddress, userAgent string) (*models.FormUserResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	response := &models.FormUserResponse{
-		ID:          primitive.NewObjectID(),
-		FormID:      formID,
-		Responses:   req.Responses,
-		IPAddress:   ipAddress,
-		UserAgent:   userAgent,
-		SubmittedAt: time.Now(),
+		ID:           primitive.NewObjectID(),
+		FormID:       form.ID,
+		Responses:    req.Responses,
+		IPAddress:    ipAddress,
+		UserAgent:    userAgent,
+		SubmittedAt:  time.Now(),
+		Client:       clientInfo(ipAddress, userAgent),
+		TextAnalysis: analyzeResponseText(form, req.Responses),
 	}
 
 	_, err := s.collection.InsertOne(ctx, response)
@@ -45,6 +48,27 @@ func (s *ResponseService) CreateResponse(formID primitive.ObjectID, req models.F
 		return nil, err
 	}
 
+	// The session is only completed once the response is stored, so a failed
+	// submission can be retried with it. A missing or reused session only loses
+	// funnel data, so the submission still goes through.
+	if req.SessionID != "" {
+		startedAt, err := s.analytics.CompleteSession(form, req.SessionID, response)
+		if err != nil {
+			log.Printf("⚠️ Failed to complete session %s for form %s: %v", req.SessionID, form.ID.Hex(), err)
+		} else if startedAt != nil {
+			response.StartedAt = startedAt
+			if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": response.ID}, bson.M{"$set": bson.M{"started_at": startedAt}}); err != nil {
+				log.Printf("⚠️ Failed to store the start time of response %s: %v", response.ID.Hex(), err)
+			}
+		}
+	}
+
+	// The response is already stored, so a failed aggregate update only leaves
+	// analytics stale until the form is rebuilt
+	if _, err := s.analytics.RecordResponse(form, response); err != nil {
+		log.Printf("❌ Failed to update analytics aggregates for form %s: %v", form.ID.Hex(), err)
+	}
+
 	return response, nil
 }
 
@@ -70,6 +94,29 @@ func (s *ResponseService) GetFormResponses(formID primitive.ObjectID) ([]*models
 	return responses, nil
 }
 
+// GetRecentResponses returns the latest responses of a form, most recent first
+func (s *ResponseService) GetRecentResponses(formID primitive.ObjectID, limit int64) ([]*models.FormUserResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "submitted_at", Value: -1}}).
+		SetLimit(limit)
+
+	cursor, err := s.collection.Find(ctx, bson.M{"form_id": formID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	responses := []*models.FormUserResponse{}
+	if err = cursor.All(ctx, &responses); err != nil {
+		return nil, err
+	}
+
+	return responses, nil
+}
+
 // GetResponseCount returns the total number of responses for a form
 func (s *ResponseService) GetResponseCount(formID primitive.ObjectID) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -79,8 +126,77 @@ func (s *ResponseService) GetResponseCount(formID primitive.ObjectID) (int64, er
 	return count, err
 }
 
-// GetFormAnalytics generates analytics data for a form
-func (s *ResponseService) GetFormAnalytics(form *models.Form) (*models.FormAnalytics, error) {
+// GetFormAnalytics returns analytics data for a form. Unsegmented analytics,
+// funnel included, are read from the materialized aggregates, segmented ones
+// run the aggregation pipelines.
+func (s *ResponseService) GetFormAnalytics(form *models.Form, query models.AnalyticsQuery) (*models.FormAnalytics, error) {
+	if query.IsEmpty() {
+		return s.analytics.GetFormAnalytics(form)
+	}
+
+	analytics, err := s.analytics.ComputeFormAnalytics(form, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(query.Filters) == 0 {
+		analytics.Funnel, err = s.analytics.GetFormFunnel(form, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return analytics, nil
+}
+
+// RecordView starts a funnel session for a visit of a shared form
+func (s *ResponseService) RecordView(form *models.Form) (*models.FormSession, error) {
+	return s.analytics.RecordView(form)
+}
+
+// RecordStart records that a respondent started filling a form, or their progress through it
+func (s *ResponseService) RecordStart(form *models.Form, req models.SessionEventRequest) error {
+	return s.analytics.RecordStart(form, req)
+}
+
+// GetCrossTab pivots the answers of two choice fields for the responses matching the query
+func (s *ResponseService) GetCrossTab(form *models.Form, rowFieldID, columnFieldID string, query models.AnalyticsQuery) (*models.CrossTab, error) {
+	return s.analytics.GetCrossTab(form, rowFieldID, columnFieldID, query)
+}
+
+// GetFormTimeSeries returns responses over time for a form
+func (s *ResponseService) GetFormTimeSeries(form *models.Form, query models.TimeSeriesQuery) (*models.FormTimeSeries, error) {
+	return s.analytics.GetFormTimeSeries(form, query)
+}
+
+// GetTextResponses lists a text field's answers ordered by sentiment for triage
+func (s *ResponseService) GetTextResponses(form *models.Form, fieldID, label string, limit int, query models.AnalyticsQuery) ([]models.TextResponseSentiment, error) {
+	return s.analytics.GetTextResponses(form, fieldID, label, limit, query)
+}
+
+// BackfillTextAnalysis re-analyzes the text answers of a form's stored responses
+func (s *ResponseService) BackfillTextAnalysis(form *models.Form) (int, error) {
+	return s.analytics.BackfillTextAnalysis(form)
+}
+
+// BackfillClientInfo parses the stored user agents and IP addresses of a form's responses
+func (s *ResponseService) BackfillClientInfo(form *models.Form) (int, error) {
+	return s.analytics.BackfillClientInfo(form)
+}
+
+// RebuildFormAnalytics recomputes a form's analytics aggregates from its responses
+func (s *ResponseService) RebuildFormAnalytics(form *models.Form) error {
+	return s.analytics.RebuildFormAnalytics(form)
+}
+
+// ComputeFormAnalytics generates analytics data for a form with an aggregation
+// pipeline over its responses, bypassing the materialized aggregates
+func (s *ResponseService) ComputeFormAnalytics(form *models.Form) (*models.FormAnalytics, error) {
+	return s.analytics.ComputeFormAnalytics(form, models.AnalyticsQuery{})
+}
+
+// computeFormAnalyticsInMemory generates analytics data for a form by decoding every
+// response and counting in Go. It is the baseline the pipeline is benchmarked against.
+func (s *ResponseService) computeFormAnalyticsInMemory(form *models.Form) (*models.FormAnalytics, error) {
 	responses, err := s.GetFormResponses(form.ID)
 	if err != nil {
 		return nil, err
@@ -164,52 +280,26 @@ func (s *ResponseService) analyzeTextField(fieldID string, responses []*models.F
 // analyzeNumberField analyzes numeric fields
 func (s *ResponseService) analyzeNumberField(fieldID string, responses []*models.FormUserResponse) map[string]interface{} {
 	data := make(map[string]interface{})
+	frequencies := make(map[float64]int64)
 	var total float64
 	var count int
 	var min, max float64
-	var hasValues bool
 
 	for _, response := range responses {
-		if value, exists := response.Responses[fieldID]; exists && value != nil {
-			var num float64
-			var validNumber bool
-			switch v := value.(type) {
-			case float64:
-				num = v
-				validNumber = true
-			case float32:
-				num = float64(v)
-				validNumber = true
-			case int:
-				num = float64(v)
-				validNumber = true
-			case int64:
-				num = float64(v)
-				validNumber = true
-			case string:
-				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
-					num = parsed
-					validNumber = true
-				}
-			}
+		num, ok := numericValue(response.Responses[fieldID], true)
+		if !ok {
+			continue
+		}
 
-			if validNumber {
-				if !hasValues {
-					min = num
-					max = num
-					hasValues = true
-				} else {
-					if num < min {
-						min = num
-					}
-					if num > max {
-						max = num
-					}
-				}
-				total += num
-				count++
-			}
+		if count == 0 || num < min {
+			min = num
+		}
+		if count == 0 || num > max {
+			max = num
 		}
+		frequencies[num]++
+		total += num
+		count++
 	}
 
 	if count > 0 {
@@ -223,15 +313,8 @@ func (s *ResponseService) analyzeNumberField(fieldID string, responses []*models
 	}
 	data["response_count"] = count
 
-	// Add debug logging after the loop
-	log.Printf("🔍 Debug number field %s: found %d valid numbers, total=%f, min=%f, max=%f",
-		fieldID, count, total, min, max)
-
-	// Also log the raw values
-	for _, response := range responses {
-		if value, exists := response.Responses[fieldID]; exists {
-			log.Printf("🔍 Raw value for field %s: %+v (type: %T)", fieldID, value, value)
-		}
+	for key, value := range numericStatistics(frequencies) {
+		data[key] = value
 	}
 
 	return data
@@ -266,9 +349,9 @@ func (s *ResponseService) analyzeCheckboxField(fieldID string, responses []*mode
 
 	for _, response := range responses {
 		if value, exists := response.Responses[fieldID]; exists {
-			if arr, ok := value.([]interface{}); ok {
+			if arr, ok := arrayValue(value); ok {
 				for _, item := range arr {
-					if str, ok := item.(string); ok {
+					if str, ok := item.(string); ok && str != "" {
 						distribution[str]++
 					}
 				}
@@ -289,24 +372,21 @@ func (s *ResponseService) analyzeCheckboxField(fieldID string, responses []*mode
 func (s *ResponseService) analyzeRatingField(fieldID string, responses []*models.FormUserResponse) map[string]interface{} {
 	data := make(map[string]interface{})
 	distribution := make(map[string]int)
+	frequencies := make(map[float64]int64)
 	var total float64
 	var count int
 
 	for _, response := range responses {
 		if value, exists := response.Responses[fieldID]; exists {
-			var rating float64
-			switch v := value.(type) {
-			case float64:
-				rating = v
-			case int:
-				rating = float64(v)
-			default:
+			rating, ok := numericValue(value, false)
+			if !ok {
 				continue
 			}
 
 			if rating >= 1 && rating <= 5 {
 				ratingStr := fmt.Sprintf("%.0f", rating)
 				distribution[ratingStr]++
+				frequencies[rating]++
 				total += rating
 				count++
 			}
@@ -321,5 +401,9 @@ func (s *ResponseService) analyzeRatingField(fieldID string, responses []*models
 	data["distribution"] = distribution
 	data["response_count"] = count
 
+	for key, value := range numericStatistics(frequencies) {
+		data[key] = value
+	}
+
 	return data
 }
@@ -0,0 +1,58 @@
+package services
+
+import "dune-takehome-server/models"
+
+// BuiltInTemplates returns the starter templates shipped with the server. They
+// are built on each call, so callers may change them.
+func BuiltInTemplates() []*models.FormTemplate {
+	return []*models.FormTemplate{
+		{
+			Key:         "nps",
+			Visibility:  models.TemplateVisibilityBuiltIn,
+			Title:       "Net Promoter Score survey",
+			Description: "Find out how likely your customers are to recommend you, and why.",
+			Tags:        []string{"feedback", "nps"},
+			Fields: []models.FormField{
+				{ID: "score", Type: models.FieldTypeNumber, Label: "How likely are you to recommend us to a friend or colleague?", Placeholder: "0 to 10", Required: true, Validation: map[string]string{"min": "0", "max": "10"}, Order: 0},
+				{ID: "reason", Type: models.FieldTypeTextarea, Label: "What is the main reason for your score?", Order: 1},
+				{ID: "improvement", Type: models.FieldTypeTextarea, Label: "What could we do better?", Order: 2},
+				{ID: "contact", Type: models.FieldTypeRadio, Label: "May we contact you about your feedback?", Options: []string{"Yes", "No"}, Order: 3},
+				{ID: "email", Type: models.FieldTypeEmail, Label: "Email", Placeholder: "you@example.com", Order: 4},
+			},
+		},
+		{
+			Key:         "event-registration",
+			Visibility:  models.TemplateVisibilityBuiltIn,
+			Title:       "Event registration",
+			Description: "Collect sign-ups for an event.",
+			Tags:        []string{"events"},
+			Fields: []models.FormField{
+				{ID: "name", Type: models.FieldTypeText, Label: "Full name", Required: true, Order: 0},
+				{ID: "email", Type: models.FieldTypeEmail, Label: "Email", Placeholder: "you@example.com", Required: true, Order: 1},
+				{ID: "company", Type: models.FieldTypeText, Label: "Company", Order: 2},
+				{ID: "ticket", Type: models.FieldTypeSelect, Label: "Ticket", Required: true, Options: []string{"General admission", "VIP", "Student"}, Order: 3},
+				{ID: "sessions", Type: models.FieldTypeCheckbox, Label: "Which sessions will you attend?", Options: []string{"Morning keynote", "Afternoon workshops", "Evening networking"}, Order: 4},
+				{ID: "dietary", Type: models.FieldTypeText, Label: "Dietary requirements", Order: 5},
+				{ID: "comments", Type: models.FieldTypeTextarea, Label: "Anything else we should know?", Order: 6},
+			},
+		},
+		{
+			Key:         "security-incident-report",
+			Visibility:  models.TemplateVisibilityBuiltIn,
+			Title:       "Security incident report",
+			Description: "Report a suspected security incident to the security team.",
+			Tags:        []string{"security"},
+			Fields: []models.FormField{
+				{ID: "reporter", Type: models.FieldTypeText, Label: "Your name", Required: true, Order: 0},
+				{ID: "reporter_email", Type: models.FieldTypeEmail, Label: "Your email", Required: true, Order: 1},
+				{ID: "incident_type", Type: models.FieldTypeSelect, Label: "Type of incident", Required: true, Options: []string{"Phishing", "Malware", "Lost or stolen device", "Unauthorized access", "Data leak", "Other"}, Order: 2},
+				{ID: "severity", Type: models.FieldTypeRadio, Label: "Severity", Required: true, Options: []string{"Low", "Medium", "High", "Critical"}, Order: 3},
+				{ID: "discovered_at", Type: models.FieldTypeText, Label: "When was it discovered?", Placeholder: "Date and time", Required: true, Order: 4},
+				{ID: "systems", Type: models.FieldTypeText, Label: "Affected systems", Order: 5},
+				{ID: "description", Type: models.FieldTypeTextarea, Label: "What happened?", Required: true, Order: 6},
+				{ID: "credentials", Type: models.FieldTypeTextarea, Label: "Details of any exposed credentials or personal data", Sensitive: true, Order: 7},
+				{ID: "actions", Type: models.FieldTypeTextarea, Label: "Actions taken so far", Order: 8},
+			},
+		},
+	}
+}
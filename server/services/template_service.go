@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"dune-takehome-server/database"
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TemplateService struct {
+	collection *mongo.Collection
+}
+
+func NewTemplateService() *TemplateService {
+	return &TemplateService{
+		collection: database.Database.Collection("templates"),
+	}
+}
+
+// GetTemplates retrieves the templates a user can use: the built-in ones,
+// their private ones and those of their workspaces
+func (s *TemplateService) GetTemplates(userID primitive.ObjectID, workspaceIDs []primitive.ObjectID) ([]*models.FormTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"visibility": models.TemplateVisibilityPrivate, "user_id": userID},
+		bson.M{"visibility": models.TemplateVisibilityWorkspace, "workspace_id": bson.M{"$in": workspaceIDs}},
+	}}
+	opts := options.Find().SetSort(bson.D{{Key: "title", Value: 1}})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var saved []*models.FormTemplate
+	if err = cursor.All(ctx, &saved); err != nil {
+		return nil, err
+	}
+
+	return append(BuiltInTemplates(), saved...), nil
+}
+
+// GetTemplateByID retrieves a template by its ID, or by its key for built-in ones
+func (s *TemplateService) GetTemplateByID(id string) (*models.FormTemplate, error) {
+	for _, template := range BuiltInTemplates() {
+		if template.Key == id {
+			return template, nil
+		}
+	}
+
+	templateID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil // Neither a key nor an ID, so no such template
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var template models.FormTemplate
+	err = s.collection.FindOne(ctx, bson.M{"_id": templateID}).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Template not found
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// CreateTemplate saves a form's definition as a template. Its fields keep
+// their IDs, and so do those of forms created from it.
+func (s *TemplateService) CreateTemplate(userID primitive.ObjectID, form *models.Form, req models.TemplateRequest) (*models.FormTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	template := &models.FormTemplate{
+		ID:          primitive.NewObjectID(),
+		Visibility:  req.Visibility,
+		UserID:      userID,
+		Title:       req.Title,
+		Description: req.Description,
+		Fields:      CopyFields(form.Fields, false),
+		Tags:        form.Tags,
+		CreatedAt:   time.Now(),
+	}
+	if template.Visibility == models.TemplateVisibilityWorkspace {
+		template.WorkspaceID = form.WorkspaceID
+	}
+
+	if _, err := s.collection.InsertOne(ctx, template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// DeleteTemplate deletes a saved template
+func (s *TemplateService) DeleteTemplate(templateID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": templateID})
+	return err
+}
+
+// CopyFields deep copies form fields, so a new form or template shares no
+// options or validation rules with the one it was copied from. With freshIDs,
+// the copies get new IDs, as fields added to a form do.
+func CopyFields(fields []models.FormField, freshIDs bool) []models.FormField {
+	copies := make([]models.FormField, len(fields))
+	for i, field := range fields {
+		if freshIDs {
+			field.ID = "field_" + primitive.NewObjectID().Hex()
+		}
+		if field.Options != nil {
+			field.Options = append([]string{}, field.Options...)
+		}
+		if field.Validation != nil {
+			validation := make(map[string]string, len(field.Validation))
+			for key, value := range field.Validation {
+				validation[key] = value
+			}
+			field.Validation = validation
+		}
+		copies[i] = field
+	}
+	return copies
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"dune-takehome-server/models"
+)
+
+func TestCopyFields(t *testing.T) {
+	fields := []models.FormField{
+		{ID: "plan", Type: models.FieldTypeSelect, Label: "Plan", Options: []string{"Free", "Pro"}, Validation: map[string]string{"pattern": ".+"}},
+		{ID: "name", Type: models.FieldTypeText, Label: "Name"},
+	}
+
+	copies := CopyFields(fields, true)
+	if len(copies) != len(fields) {
+		t.Fatalf("copied %d fields, want %d", len(copies), len(fields))
+	}
+	if copies[0].ID == "plan" || copies[0].ID == copies[1].ID {
+		t.Errorf("fresh IDs = %q, %q", copies[0].ID, copies[1].ID)
+	}
+	if copies[0].Label != "Plan" || copies[0].Options[1] != "Pro" || copies[0].Validation["pattern"] != ".+" {
+		t.Errorf("copy = %+v", copies[0])
+	}
+
+	copies[0].Options[0] = "Changed"
+	copies[0].Validation["pattern"] = "changed"
+	if fields[0].Options[0] != "Free" || fields[0].Validation["pattern"] != ".+" {
+		t.Error("copy shares options or validation with the original")
+	}
+
+	if kept := CopyFields(fields, false); kept[0].ID != "plan" || kept[1].ID != "name" {
+		t.Errorf("kept IDs = %q, %q", kept[0].ID, kept[1].ID)
+	}
+}
+
+func TestBuiltInTemplates(t *testing.T) {
+	keys := map[string]bool{}
+	for _, template := range BuiltInTemplates() {
+		if keys[template.Key] {
+			t.Errorf("duplicate template key %q", template.Key)
+		}
+		keys[template.Key] = true
+
+		ids := map[string]bool{}
+		for i, field := range template.Fields {
+			if ids[field.ID] {
+				t.Errorf("%s: duplicate field ID %q", template.Key, field.ID)
+			}
+			ids[field.ID] = true
+			if field.Order != i {
+				t.Errorf("%s: field %q has order %d, want %d", template.Key, field.ID, field.Order, i)
+			}
+			switch field.Type {
+			case models.FieldTypeSelect, models.FieldTypeRadio, models.FieldTypeCheckbox:
+				if len(field.Options) == 0 {
+					t.Errorf("%s: choice field %q has no options", template.Key, field.ID)
+				}
+			}
+		}
+	}
+	for _, key := range []string{"nps", "event-registration", "security-incident-report"} {
+		if !keys[key] {
+			t.Errorf("missing built-in template %q", key)
+		}
+	}
+}
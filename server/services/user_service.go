@@ -44,6 +44,7 @@ func (s *UserService) CreateUser(req models.UserRequest) (*models.User, error) {
 		Email:     req.Email,
 		Password:  string(hashedPassword),
 		Name:      req.Name,
+		Timezone:  req.Timezone,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -94,6 +95,44 @@ func (s *UserService) GetUserByID(id primitive.ObjectID) (*models.User, error) {
 	return &user, nil
 }
 
+// FormTimezone returns the timezone a form's time series is bucketed in: its
+// owner's, so that reads and live updates agree
+func (s *UserService) FormTimezone(form *models.Form) (string, error) {
+	owner, err := s.GetUserByID(form.UserID)
+	if err != nil {
+		return "", err
+	}
+	if owner == nil {
+		return "UTC", nil
+	}
+	return owner.TimezoneOrDefault(), nil
+}
+
+// UpdateProfile updates the editable profile fields of a user
+func (s *UserService) UpdateProfile(id primitive.ObjectID, req models.ProfileRequest) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.Name != "" {
+		set["name"] = req.Name
+	}
+	if req.Timezone != "" {
+		set["timezone"] = req.Timezone
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, nil // User not found
+	}
+
+	return s.GetUserByID(id)
+}
+
 // ValidatePassword compares provided password with stored hash
 func (s *UserService) ValidatePassword(user *models.User, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
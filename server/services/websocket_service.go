@@ -1,173 +1,817 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
 	"github.com/gofiber/websocket/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Connection defaults. Pings are sent often enough that a pong arrives before
+// the read deadline, which is pushed back by every pong.
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingInterval   = wsPongWait * 9 / 10
+	wsSendBufferSize = 64
+	wsMaxMessageSize = 64 * 1024
+)
+
+// wsConn is the part of *websocket.Conn the service uses, so tests can substitute it.
+// ReadJSON may run concurrently with the write methods, but writes must not overlap.
+type wsConn interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// wsClient is a connection and its outbound queue. Only its writer goroutine
+// writes to conn, and the queue is never closed; done signals the writer to stop.
+type wsClient struct {
+	id        string
+	conn      wsConn
+	send      chan interface{}
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	claims    *utils.Claims                     // Guarded by WebSocketService.mutex
+	expiry    *time.Timer                       // Closes the connection when the token expires, guarded by WebSocketService.mutex
+	editing   map[string]*models.EditorPresence // Form ID -> presence in its edits topic, guarded by WebSocketService.mutex
+}
+
+// close stops the client's writer, which sends a close frame with the code
+// given by the first caller and closes the connection
+func (c *wsClient) close(code int) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		close(c.done)
+	})
+}
+
 type WebSocketService struct {
-	clients map[string]*websocket.Conn
-	rooms   map[string]map[string]*websocket.Conn // roomID -> clientID -> connection
-	mutex   sync.RWMutex
+	clients     map[string]*wsClient
+	rooms       map[string]map[string]*wsClient // roomID -> clientID -> client
+	formService *FormService
+	authorizer  *AuthorizationService
+	responses   *ResponseService
+	broker      Broker
+	relay       *realtimeRelay
+	mutex       sync.RWMutex
+	closing     bool
+	connections sync.WaitGroup
+
+	writeWait      time.Duration
+	pongWait       time.Duration
+	pingInterval   time.Duration
+	sendBufferSize int
 }
 
-func NewWebSocketService() *WebSocketService {
+// NewWebSocketService creates the service and subscribes it to the broker's events
+func NewWebSocketService(broker Broker) *WebSocketService {
+	ws := newWebSocketService(NewFormService())
+	ws.relay.userService = NewUserService()
+	ws.authorizer = NewAuthorizationService()
+	ws.responses = NewResponseService()
+	ws.broker = broker
+	broker.Subscribe(ws.handleEvent)
+	return ws
+}
+
+func newWebSocketService(formService *FormService) *WebSocketService {
 	return &WebSocketService{
-		clients: make(map[string]*websocket.Conn),
-		rooms:   make(map[string]map[string]*websocket.Conn),
+		clients:        make(map[string]*wsClient),
+		rooms:          make(map[string]map[string]*wsClient),
+		formService:    formService,
+		relay:          &realtimeRelay{formService: formService},
+		writeWait:      wsWriteWait,
+		pongWait:       wsPongWait,
+		pingInterval:   wsPingInterval,
+		sendBufferSize: wsSendBufferSize,
 	}
 }
 
 // HandleConnection handles new WebSocket connections
 func (ws *WebSocketService) HandleConnection(c *websocket.Conn) {
-	clientID := generateClientID()
-	
+	ws.serve(c, c.Query("token"))
+}
+
+// serve runs a connection until it is closed by either side. The writer
+// goroutine has stopped by the time it returns, since the connection may be
+// reused afterwards.
+func (ws *WebSocketService) serve(conn wsConn, token string) {
+	client := &wsClient{
+		id:      generateClientID(),
+		conn:    conn,
+		send:    make(chan interface{}, ws.sendBufferSize),
+		done:    make(chan struct{}),
+		editing: make(map[string]*models.EditorPresence),
+	}
+
 	ws.mutex.Lock()
-	ws.clients[clientID] = c
+	if ws.closing {
+		ws.mutex.Unlock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "server shutting down"), time.Now().Add(ws.writeWait))
+		return
+	}
+	ws.clients[client.id] = client
+	ws.connections.Add(1)
 	ws.mutex.Unlock()
-	
-	log.Printf("🔌 Client connected: %s", clientID)
+	defer ws.connections.Done()
+
+	log.Printf("🔌 Client connected: %s", client.id)
+
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		ws.writePump(client)
+	}()
+
+	ws.sendMessage(client, models.ConnectedMessage{
+		Version:  models.RealtimeProtocolVersion,
+		Type:     models.MessageConnected,
+		ClientID: client.id,
+	})
+
+	// Browsers cannot set headers on WebSocket upgrades, so the token may come in the query.
+	// An invalid one closes the connection since the client cannot fix it without reconnecting.
+	if token == "" || ws.authenticate(client, models.ClientMessage{Type: models.MessageAuth, Token: token}) {
+		ws.readPump(client)
+	} else {
+		client.close(websocket.ClosePolicyViolation)
+	}
+
+	ws.removeClient(client)
+	client.close(websocket.CloseNormalClosure)
+	<-writerDone
 
-	ws.sendMessage(c, map[string]interface{}{
-		"type": "connected",
-		"client_id": clientID,
+	log.Printf("🔌❌ Client disconnected: %s", client.id)
+}
+
+// readPump handles incoming messages until the connection fails, the client
+// misses its heartbeat or the client is closed
+func (ws *WebSocketService) readPump(client *wsClient) {
+	client.conn.SetReadLimit(wsMaxMessageSize)
+	client.conn.SetReadDeadline(time.Now().Add(ws.pongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(ws.pongWait))
 	})
 
 	for {
-		var msg map[string]interface{}
-		err := c.ReadJSON(&msg)
+		var msg models.ClientMessage
+		err := client.conn.ReadJSON(&msg)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			// The frame was read in full, so the connection is still usable. A
+			// mistyped field leaves the rest decoded, including the request ID.
+			ws.sendError(client, msg.ID, models.RealtimeErrorBadRequest, "Malformed message: "+err.Error(), nil)
+			continue
+		}
 		if err != nil {
-			log.Printf("❌ WebSocket read error: %v", err)
-			break
+			select {
+			case <-client.done:
+				// Closed by the server, the read failed because the writer closed the connection
+			default:
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Printf("❌ WebSocket read error: %v", err)
+				}
+			}
+			return
 		}
 
-		ws.handleMessage(clientID, c, msg)
+		ws.handleMessage(client, msg)
 	}
+}
+
+// writePump is the only goroutine writing to a client's connection. It sends
+// queued messages and pings, and closes the connection once the client is closed.
+func (ws *WebSocketService) writePump(client *wsClient) {
+	ticker := time.NewTicker(ws.pingInterval)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-client.done:
+			// Flush what is already queued, such as a final error frame, within one write timeout
+			deadline := time.Now().Add(ws.writeWait)
+			client.conn.SetWriteDeadline(deadline)
+			ws.flushQueue(client)
+			client.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(client.closeCode, ""), deadline)
+			return
+		case message := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(ws.writeWait))
+			if err := client.conn.WriteJSON(message); err != nil {
+				log.Printf("❌ Failed to send message to client %s: %v", client.id, err)
+				ws.dropClient(client, websocket.CloseGoingAway)
+				return
+			}
+		case <-ticker.C:
+			if err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(ws.writeWait)); err != nil {
+				ws.dropClient(client, websocket.CloseGoingAway)
+				return
+			}
+		}
+	}
+}
+
+// flushQueue writes the messages queued for a closed client until the queue
+// is empty or a write fails
+func (ws *WebSocketService) flushQueue(client *wsClient) {
+	for {
+		select {
+		case message := <-client.send:
+			if err := client.conn.WriteJSON(message); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Shutdown closes every connection with a going-away frame and waits for them
+// to finish, or for the context to expire. New connections are refused.
+func (ws *WebSocketService) Shutdown(ctx context.Context) error {
+	ws.mutex.Lock()
+	ws.closing = true
+	clients := make([]*wsClient, 0, len(ws.clients))
+	for _, client := range ws.clients {
+		clients = append(clients, client)
+	}
+	ws.mutex.Unlock()
+
+	for _, client := range clients {
+		client.close(websocket.CloseGoingAway)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		ws.connections.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
+func (ws *WebSocketService) removeClient(client *wsClient) {
 	ws.mutex.Lock()
-	delete(ws.clients, clientID)
+	delete(ws.clients, client.id)
+	if client.expiry != nil {
+		client.expiry.Stop()
+	}
 	// Remove from all rooms
 	for roomID, room := range ws.rooms {
-		delete(room, clientID)
+		delete(room, client.id)
 		if len(room) == 0 {
 			delete(ws.rooms, roomID)
 		}
 	}
+	edited := make([]string, 0, len(client.editing))
+	for formID := range client.editing {
+		edited = append(edited, formID)
+		delete(client.editing, formID)
+	}
 	ws.mutex.Unlock()
-	
-	log.Printf("🔌❌ Client disconnected: %s", clientID)
+
+	// The remaining editors see the client leave
+	for _, formID := range edited {
+		ws.broadcastPresence(formID)
+	}
+}
+
+// dropClient disconnects a client that can no longer be written to
+func (ws *WebSocketService) dropClient(client *wsClient, code int) {
+	ws.removeClient(client)
+	client.close(code)
+}
+
+func (ws *WebSocketService) handleMessage(client *wsClient, msg models.ClientMessage) {
+	if msg.Version != 0 && msg.Version != models.RealtimeProtocolVersion {
+		ws.sendError(client, msg.ID, models.RealtimeErrorUnsupportedVersion,
+			fmt.Sprintf("Protocol version %d is not supported, use %d", msg.Version, models.RealtimeProtocolVersion), nil)
+		return
+	}
+
+	switch msg.Type {
+	case models.MessageAuth:
+		ws.authenticate(client, msg)
+	case models.MessageSubscribe, models.MessageJoinAnalytics, models.MessageSubscribeResponses:
+		ws.subscribe(client, msg)
+	case models.MessageUnsubscribe, models.MessageLeaveAnalytics, models.MessageUnsubscribeResponses:
+		ws.unsubscribe(client, msg)
+	case models.MessageFieldOperation:
+		ws.applyFieldOperation(client, msg)
+	case models.MessagePresence:
+		ws.updatePresence(client, msg)
+	default:
+		ws.sendError(client, msg.ID, models.RealtimeErrorBadRequest, fmt.Sprintf("Unknown message type %q", msg.Type), nil)
+	}
+}
+
+// requestTopics returns the topics of a subscribe or unsubscribe request. The
+// shorthands name a single form.
+func requestTopics(msg models.ClientMessage) []models.RealtimeTopic {
+	switch msg.Type {
+	case models.MessageJoinAnalytics, models.MessageLeaveAnalytics:
+		return []models.RealtimeTopic{{Name: models.TopicFormAnalytics, FormID: msg.FormID}}
+	case models.MessageSubscribeResponses, models.MessageUnsubscribeResponses:
+		return []models.RealtimeTopic{{Name: models.TopicFormResponses, FormID: msg.FormID}}
+	}
+	return msg.Topics
+}
+
+// subscribableTopics are the topics clients may subscribe to
+var subscribableTopics = map[models.RealtimeTopicName]bool{
+	models.TopicFormAnalytics: true,
+	models.TopicFormResponses: true,
+	models.TopicFormEdits:     true,
+}
+
+// subscribe joins every topic of a request, or none of them when any is refused
+func (ws *WebSocketService) subscribe(client *wsClient, msg models.ClientMessage) {
+	topics := requestTopics(msg)
+	if len(topics) == 0 {
+		ws.sendError(client, msg.ID, models.RealtimeErrorBadRequest, "No topics to subscribe to", nil)
+		return
+	}
+
+	for i := range topics {
+		if !subscribableTopics[topics[i].Name] {
+			ws.sendError(client, msg.ID, models.RealtimeErrorUnknownTopic, fmt.Sprintf("Unknown topic %q", topics[i].Name), &topics[i])
+			return
+		}
+		if !ws.authorizeTopic(client, msg.ID, topics[i]) {
+			return
+		}
+	}
+
+	for _, topic := range topics {
+		ws.joinRoom(client, topic)
+		log.Printf("📊 Client %s subscribed to %s", client.id, topic.Key())
+	}
+	ws.sendAck(client, msg, models.AckMessage{Topics: topics})
+
+	for _, topic := range topics {
+		switch topic.Name {
+		case models.TopicFormResponses:
+			ws.replayResponses(client, topic)
+		case models.TopicFormEdits:
+			ws.broadcastPresence(topic.FormID)
+		}
+	}
+}
+
+// replayResponses sends the first page of recent responses to a client that
+// subscribed to the response feed. The client joined the room first, so a
+// response arriving meanwhile is sent twice rather than missed.
+func (ws *WebSocketService) replayResponses(client *wsClient, topic models.RealtimeTopic) {
+	formID, _ := primitive.ObjectIDFromHex(topic.FormID) // Validated by authorizeTopic
+	form, err := ws.formService.GetFormByID(formID)
+	if err != nil || form == nil {
+		log.Printf("❌ Failed to load form %s for response replay: %v", topic.FormID, err)
+		return
+	}
+
+	responses, err := ws.responses.GetRecentResponses(formID, responseFeedPageSize)
+	if err != nil {
+		log.Printf("❌ Failed to load recent responses of form %s: %v", topic.FormID, err)
+		ws.sendError(client, "", models.RealtimeErrorInternal, "Failed to load recent responses", &topic)
+		return
+	}
+
+	items := make([]models.ResponseFeedItem, 0, len(responses))
+	for _, response := range responses {
+		items = append(items, RedactResponse(form, response))
+	}
+	ws.sendMessage(client, models.EventMessage{
+		Version:   models.RealtimeProtocolVersion,
+		Type:      models.MessageResponsesReplay,
+		Topic:     &topic,
+		FormID:    topic.FormID,
+		Responses: items,
+	})
+}
+
+func (ws *WebSocketService) unsubscribe(client *wsClient, msg models.ClientMessage) {
+	topics := requestTopics(msg)
+	for _, topic := range topics {
+		ws.leaveRoom(client.id, topic)
+		log.Printf("📤 Client %s unsubscribed from %s", client.id, topic.Key())
+	}
+	ws.sendAck(client, msg, models.AckMessage{Topics: topics})
+
+	for _, topic := range topics {
+		if topic.Name == models.TopicFormEdits {
+			ws.broadcastPresence(topic.FormID)
+		}
+	}
+}
+
+// applyFieldOperation applies a field operation sent by an editor of the form
+// and publishes it, so every editor receives it from the broker, including
+// the sender once its request is acknowledged
+func (ws *WebSocketService) applyFieldOperation(client *wsClient, msg models.ClientMessage) {
+	topic := models.RealtimeTopic{Name: models.TopicFormEdits, FormID: msg.FormID}
+	if msg.Operation == nil {
+		ws.sendError(client, msg.ID, models.RealtimeErrorBadRequest, "No operation to apply", &topic)
+		return
+	}
+	if !ws.isEditing(client, msg.FormID) {
+		ws.sendError(client, msg.ID, models.RealtimeErrorForbidden, "Subscribe to the form's edits before editing", &topic)
+		return
+	}
+	// Checked again on every operation, since the token may have expired since subscribing
+	if !ws.authorizeTopic(client, msg.ID, topic) {
+		return
+	}
+
+	ws.mutex.RLock()
+	userID := client.claims.UserID
+	ws.mutex.RUnlock()
+
+	op := *msg.Operation
+	op.UserID = userID.Hex()
+	op.ClientID = client.id
+	op.AppliedAt = time.Now()
+
+	formID, _ := primitive.ObjectIDFromHex(msg.FormID) // Validated by authorizeTopic
+	form, err := ws.formService.ApplyFieldOperation(formID, op)
+	var lintErr *PublishedLintError
+	switch {
+	case errors.Is(err, ErrInvalidFieldOperation), errors.As(err, &lintErr):
+		ws.sendError(client, msg.ID, models.RealtimeErrorBadRequest, err.Error(), &topic)
+		return
+	case errors.Is(err, ErrFieldNotFound), errors.Is(err, ErrFieldExists), errors.Is(err, ErrStaleRevision):
+		// Another editor changed the field first
+		ws.sendError(client, msg.ID, models.RealtimeErrorConflict, err.Error(), &topic)
+		return
+	case err != nil:
+		log.Printf("❌ Failed to apply field operation to form %s: %v", msg.FormID, err)
+		ws.sendError(client, msg.ID, models.RealtimeErrorInternal, "Failed to apply operation", &topic)
+		return
+	case form == nil:
+		ws.sendError(client, msg.ID, models.RealtimeErrorForbidden, "Form not found", &topic)
+		return
+	}
+	op.Revision = form.Revision
+	ws.sendAck(client, msg, models.AckMessage{})
+
+	if err := ws.broker.Publish(BrokerEvent{Type: EventFieldOperation, FormID: form.ID, Form: form, Operation: &op}); err != nil {
+		log.Printf("❌ Failed to publish field operation of form %s: %v", msg.FormID, err)
+	}
 }
 
-func (ws *WebSocketService) handleMessage(clientID string, c *websocket.Conn, msg map[string]interface{}) {
-	msgType, ok := msg["type"].(string)
-	if !ok {
+// updatePresence records the field an editor is working on and tells the other editors
+func (ws *WebSocketService) updatePresence(client *wsClient, msg models.ClientMessage) {
+	ws.mutex.Lock()
+	presence := client.editing[msg.FormID]
+	if presence != nil {
+		presence.FieldID = msg.FieldID
+	}
+	ws.mutex.Unlock()
+
+	if presence == nil {
+		topic := models.RealtimeTopic{Name: models.TopicFormEdits, FormID: msg.FormID}
+		ws.sendError(client, msg.ID, models.RealtimeErrorForbidden, "Subscribe to the form's edits before sharing presence", &topic)
 		return
 	}
+	ws.sendAck(client, msg, models.AckMessage{})
+	ws.broadcastPresence(msg.FormID)
+}
+
+// isEditing reports whether a client subscribed to a form's edits
+func (ws *WebSocketService) isEditing(client *wsClient, formID string) bool {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+	return client.editing[formID] != nil
+}
 
-	switch msgType {
-	case "join-analytics":
-		if formID, ok := msg["form_id"].(string); ok {
-			ws.joinRoom(clientID, c, formID)
-			log.Printf("📊 Client %s joined analytics room for form: %s", clientID, formID)
+// broadcastPresence sends everyone editing a form the list of its editors.
+// Presence is only known to the replica the editors are connected to.
+func (ws *WebSocketService) broadcastPresence(formID string) {
+	topic := models.RealtimeTopic{Name: models.TopicFormEdits, FormID: formID}
+
+	ws.mutex.RLock()
+	editors := make([]models.EditorPresence, 0, len(ws.rooms[topic.Key()]))
+	for _, client := range ws.rooms[topic.Key()] {
+		if presence := client.editing[formID]; presence != nil {
+			editors = append(editors, *presence)
 		}
-	case "leave-analytics":
-		if formID, ok := msg["form_id"].(string); ok {
-			ws.leaveRoom(clientID, formID)
-			log.Printf("📤 Client %s left analytics room for form: %s", clientID, formID)
+	}
+	ws.mutex.RUnlock()
+
+	sort.Slice(editors, func(i, j int) bool {
+		if !editors[i].Since.Equal(editors[j].Since) {
+			return editors[i].Since.Before(editors[j].Since)
 		}
+		return editors[i].ClientID < editors[j].ClientID
+	})
+	now := time.Now()
+	ws.broadcastToTopic(topic, models.EventMessage{
+		Version:   models.RealtimeProtocolVersion,
+		Type:      models.MessagePresence,
+		FormID:    formID,
+		Editors:   editors,
+		Timestamp: &now,
+	})
+}
+
+// authenticate validates a JWT and binds its user to the connection
+func (ws *WebSocketService) authenticate(client *wsClient, msg models.ClientMessage) bool {
+	claims, err := utils.ValidateJWT(msg.Token)
+	if err != nil {
+		log.Printf("🔒 Client %s failed to authenticate: %v", client.id, err)
+		ws.sendError(client, msg.ID, models.RealtimeErrorUnauthorized, "Invalid or expired token", nil)
+		return false
+	}
+
+	ws.setClaims(client, claims)
+	ws.sendAck(client, msg, models.AckMessage{UserID: claims.UserID.Hex()})
+	return true
+}
+
+// setClaims binds a user to the connection until their token expires. The
+// connection is then closed, so the client reconnects with a new token.
+func (ws *WebSocketService) setClaims(client *wsClient, claims *utils.Claims) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	client.claims = claims
+	if client.expiry != nil {
+		client.expiry.Stop()
+		client.expiry = nil
+	}
+	if claims.ExpiresAt != nil {
+		client.expiry = time.AfterFunc(time.Until(claims.ExpiresAt.Time), func() {
+			log.Printf("🔒 Token of client %s expired, disconnecting", client.id)
+			ws.sendError(client, "", models.RealtimeErrorTokenExpired, "Token has expired, reconnect with a new one", nil)
+			ws.dropClient(client, websocket.ClosePolicyViolation)
+		})
+	}
+}
+
+// authorizeTopic checks that the client is authenticated as a user whose role
+// on the topic's form grants the topic's permission, sending an error reply
+// when it is not
+func (ws *WebSocketService) authorizeTopic(client *wsClient, requestID string, topic models.RealtimeTopic) bool {
+	ws.mutex.RLock()
+	claims := client.claims
+	ws.mutex.RUnlock()
+
+	if claims == nil {
+		ws.sendError(client, requestID, models.RealtimeErrorUnauthorized, "Authenticate before subscribing", &topic)
+		return false
+	}
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
+		ws.sendError(client, requestID, models.RealtimeErrorTokenExpired, "Token has expired, authenticate again", &topic)
+		return false
+	}
+
+	formID, err := primitive.ObjectIDFromHex(topic.FormID)
+	if err != nil {
+		ws.sendError(client, requestID, models.RealtimeErrorInvalidFormID, "Invalid form ID", &topic)
+		return false
+	}
+
+	form, role, err := ws.authorizer.AuthorizeForm(claims.UserID, formID, topicPermission(topic.Name))
+	if errors.Is(err, ErrForbidden) {
+		log.Printf("🔒 Client %s (%s) denied access to %s", client.id, role, topic.Key())
+		ws.sendError(client, requestID, models.RealtimeErrorForbidden, "Your role on this form does not allow this topic", &topic)
+		return false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to check form access for client %s: %v", client.id, err)
+		ws.sendError(client, requestID, models.RealtimeErrorInternal, "Failed to retrieve form", &topic)
+		return false
 	}
+	if form == nil {
+		log.Printf("🔒 Client %s denied access to %s", client.id, topic.Key())
+		ws.sendError(client, requestID, models.RealtimeErrorForbidden, "Form not found", &topic)
+		return false
+	}
+
+	return true
 }
 
-func (ws *WebSocketService) joinRoom(clientID string, c *websocket.Conn, roomID string) {
+// topicPermission is the permission a topic needs: editing for the editing
+// session, reading responses for the others, which carry analytics or answers
+func topicPermission(name models.RealtimeTopicName) models.Permission {
+	if name == models.TopicFormEdits {
+		return models.PermissionEditForm
+	}
+	return models.PermissionViewResponses
+}
+
+// sendAck confirms a request, echoing its ID
+func (ws *WebSocketService) sendAck(client *wsClient, msg models.ClientMessage, ack models.AckMessage) {
+	ack.Version = models.RealtimeProtocolVersion
+	ack.Type = models.MessageAck
+	ack.ID = msg.ID
+	ack.Request = msg.Type
+	ws.sendMessage(client, ack)
+}
+
+// sendError replies with an error, echoing the request ID and the topic it concerns when there are some
+func (ws *WebSocketService) sendError(client *wsClient, requestID, code, message string, topic *models.RealtimeTopic) {
+	reply := models.ErrorMessage{
+		Version: models.RealtimeProtocolVersion,
+		Type:    models.MessageError,
+		ID:      requestID,
+		Code:    code,
+		Message: message,
+		Topic:   topic,
+	}
+	if topic != nil {
+		reply.FormID = topic.FormID
+	}
+	ws.sendMessage(client, reply)
+}
+
+func (ws *WebSocketService) joinRoom(client *wsClient, topic models.RealtimeTopic) {
 	ws.mutex.Lock()
 	defer ws.mutex.Unlock()
-	
+
+	// A client removed concurrently must not be added back to a room
+	if ws.clients[client.id] != client {
+		return
+	}
+	roomID := topic.Key()
 	if ws.rooms[roomID] == nil {
-		ws.rooms[roomID] = make(map[string]*websocket.Conn)
+		ws.rooms[roomID] = make(map[string]*wsClient)
+	}
+	ws.rooms[roomID][client.id] = client
+
+	if topic.Name == models.TopicFormEdits && client.editing[topic.FormID] == nil {
+		presence := &models.EditorPresence{ClientID: client.id, Since: time.Now()}
+		if client.claims != nil {
+			presence.UserID = client.claims.UserID.Hex()
+			presence.Email = client.claims.Email
+		}
+		client.editing[topic.FormID] = presence
 	}
-	ws.rooms[roomID][clientID] = c
 }
 
-func (ws *WebSocketService) leaveRoom(clientID, roomID string) {
+func (ws *WebSocketService) leaveRoom(clientID string, topic models.RealtimeTopic) {
 	ws.mutex.Lock()
 	defer ws.mutex.Unlock()
-	
+
+	roomID := topic.Key()
 	if room, exists := ws.rooms[roomID]; exists {
 		delete(room, clientID)
 		if len(room) == 0 {
 			delete(ws.rooms, roomID)
 		}
 	}
+	if client := ws.clients[clientID]; client != nil && topic.Name == models.TopicFormEdits {
+		delete(client.editing, topic.FormID)
+	}
 }
 
-func (ws *WebSocketService) sendMessage(c *websocket.Conn, message map[string]interface{}) {
-	if err := c.WriteJSON(message); err != nil {
-		log.Printf("❌ WebSocket write error: %v", err)
+// sendMessage queues a message for a client without blocking. A client whose
+// queue is full has fallen behind and is disconnected rather than slowing
+// down everyone else.
+func (ws *WebSocketService) sendMessage(client *wsClient, message interface{}) {
+	select {
+	case <-client.done:
+	case client.send <- message:
+	default:
+		log.Printf("🐢 Client %s fell behind, disconnecting", client.id)
+		ws.dropClient(client, websocket.ClosePolicyViolation)
 	}
 }
 
-// BroadcastNewResponse sends real-time analytics update when a new response is submitted
-func (ws *WebSocketService) BroadcastNewResponse(formID primitive.ObjectID, analytics *models.FormAnalytics) {
-	roomID := formID.Hex()
-	log.Printf("📡 Broadcasting analytics update to room: %s", roomID)
-	
-	message := map[string]interface{}{
-		"type":      "analytics-update",
-		"form_id":   formID.Hex(),
-		"analytics": analytics,
-		"timestamp": analytics.CreatedAt,
+// handleEvent broadcasts a broker event to the topics of its form. Events for
+// forms nobody is watching on this replica are skipped before any lookup.
+func (ws *WebSocketService) handleEvent(event BrokerEvent) {
+	if event.Type == EventAccessChanged {
+		ws.revalidateAccess(event)
+		return
 	}
 
-	ws.broadcastToRoom(roomID, message)
-}
-
-// BroadcastFormUpdate sends updates when form structure changes
-func (ws *WebSocketService) BroadcastFormUpdate(formID primitive.ObjectID, form *models.Form) {
-	roomID := formID.Hex()
-	log.Printf("📡 Broadcasting form update to room: %s", roomID)
-	
-	message := map[string]interface{}{
-		"type":    "form-update",
-		"form_id": formID.Hex(),
-		"form":    form.ToResponse(),
+	formID := event.FormID.Hex()
+	watched := false
+	for name := range subscribableTopics {
+		watched = watched || ws.hasRoom(models.RealtimeTopic{Name: name, FormID: formID})
+	}
+	if !watched {
+		return
 	}
 
-	ws.broadcastToRoom(roomID, message)
+	ws.relay.relay(event, func(message models.EventMessage) {
+		for _, name := range eventTopics(message) {
+			topic := models.RealtimeTopic{Name: name, FormID: formID}
+			if !ws.hasRoom(topic) {
+				continue
+			}
+			log.Printf("📡 Broadcasting %s to %s", message.Type, topic.Key())
+			ws.broadcastToTopic(topic, message)
+		}
+	})
 }
 
-func (ws *WebSocketService) broadcastToRoom(roomID string, message map[string]interface{}) {
-	ws.mutex.RLock()
-	room, exists := ws.rooms[roomID]
-	if !exists {
-		ws.mutex.RUnlock()
+// revalidateAccess checks the subscriptions an access change concerns again,
+// and drops those the client's user is no longer allowed
+func (ws *WebSocketService) revalidateAccess(event BrokerEvent) {
+	if ws.authorizer == nil {
 		return
 	}
-	
-	// Create a copy of connections to avoid holding the lock while sending
-	connections := make(map[string]*websocket.Conn)
-	for clientID, conn := range room {
-		connections[clientID] = conn
+
+	type subscription struct {
+		client *wsClient
+		userID primitive.ObjectID
+		formID primitive.ObjectID
+		topic  models.RealtimeTopic
+	}
+	var concerned []subscription
+	ws.mutex.RLock()
+	for roomID, room := range ws.rooms {
+		name, formIDHex, _ := strings.Cut(roomID, ":")
+		formID, _ := primitive.ObjectIDFromHex(formIDHex) // Validated by authorizeTopic
+		for _, client := range room {
+			if client.claims != nil && event.AccessChanged(client.claims.UserID, formID) {
+				topic := models.RealtimeTopic{Name: models.RealtimeTopicName(name), FormID: formIDHex}
+				concerned = append(concerned, subscription{client, client.claims.UserID, formID, topic})
+			}
+		}
 	}
 	ws.mutex.RUnlock()
 
-	// Send to all connections in the room
-	for clientID, conn := range connections {
-		if err := conn.WriteJSON(message); err != nil {
-			log.Printf("❌ Failed to send message to client %s: %v", clientID, err)
-			// Remove failed connection
-			ws.mutex.Lock()
-			delete(ws.rooms[roomID], clientID)
-			delete(ws.clients, clientID)
-			ws.mutex.Unlock()
+	allowed := make(map[string]bool)
+	for _, sub := range concerned {
+		permission := topicPermission(sub.topic.Name)
+		key := sub.userID.Hex() + ":" + sub.topic.FormID + ":" + string(permission)
+		ok, checked := allowed[key]
+		if !checked {
+			form, _, err := ws.authorizer.AuthorizeForm(sub.userID, sub.formID, permission)
+			if err != nil && !errors.Is(err, ErrForbidden) {
+				// Kept until the next change rather than dropped on a lookup failure
+				log.Printf("❌ Failed to check form access for client %s: %v", sub.client.id, err)
+				continue
+			}
+			ok = err == nil && form != nil
+			allowed[key] = ok
+		}
+		if ok {
+			continue
 		}
+
+		log.Printf("🔒 Client %s lost access to %s", sub.client.id, sub.topic.Key())
+		ws.leaveRoom(sub.client.id, sub.topic)
+		ws.sendError(sub.client, "", models.RealtimeErrorForbidden, "Your access to this form has changed", &sub.topic)
+		if sub.topic.Name == models.TopicFormEdits {
+			ws.broadcastPresence(sub.topic.FormID)
+		}
+	}
+}
+
+func (ws *WebSocketService) hasRoom(topic models.RealtimeTopic) bool {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+	return len(ws.rooms[topic.Key()]) > 0
+}
+
+// broadcastToTopic queues an event for every subscriber of a topic. It never
+// blocks on a connection, so it is safe to call from request handlers.
+func (ws *WebSocketService) broadcastToTopic(topic models.RealtimeTopic, message models.EventMessage) {
+	ws.mutex.RLock()
+	room := ws.rooms[topic.Key()]
+	clients := make([]*wsClient, 0, len(room))
+	for _, client := range room {
+		clients = append(clients, client)
+	}
+	ws.mutex.RUnlock()
+
+	message.Topic = &topic
+	// Queued outside the lock, since dropping a slow client takes it
+	for _, client := range clients {
+		ws.sendMessage(client, message)
 	}
 }
 
 func generateClientID() string {
 	// Simple client ID generation
 	return primitive.NewObjectID().Hex()
-}
\ No newline at end of file
+}
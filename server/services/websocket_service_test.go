@@ -0,0 +1,620 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dune-takehome-server/models"
+	"dune-takehome-server/utils"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	errFakeTimeout = errors.New("i/o timeout")
+	errFakeClosed  = errors.New("use of closed network connection")
+)
+
+// fakeConn is an in-memory wsConn. Writes that overlap are recorded so the
+// tests can assert that only one goroutine ever writes to a connection.
+type fakeConn struct {
+	incoming  chan map[string]interface{}
+	pongs     chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	autoPong    bool // Answer pings like a live browser
+	blockWrites bool // Never complete a data write, like a stalled client
+
+	writing    int32
+	overlapped int32
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	pongHandler   func(string) error
+	messages      []map[string]interface{}
+	pings         int
+	closeCodes    []int
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		incoming: make(chan map[string]interface{}, 16),
+		pongs:    make(chan struct{}, 16),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (f *fakeConn) ReadJSON(v interface{}) error {
+	for {
+		f.mu.Lock()
+		deadline := f.readDeadline
+		f.mu.Unlock()
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return errFakeTimeout
+		}
+
+		select {
+		case msg, ok := <-f.incoming:
+			if !ok {
+				return io.EOF
+			}
+			data, _ := json.Marshal(msg)
+			return json.Unmarshal(data, v)
+		case <-f.pongs:
+			// Control frames are handled inside reads, as in gorilla/websocket
+			f.mu.Lock()
+			handler := f.pongHandler
+			f.mu.Unlock()
+			if handler != nil {
+				handler("")
+			}
+		case <-f.closed:
+			return errFakeClosed
+		case <-time.After(2 * time.Millisecond):
+		}
+	}
+}
+
+func (f *fakeConn) beginWrite() func() {
+	if atomic.AddInt32(&f.writing, 1) > 1 {
+		atomic.StoreInt32(&f.overlapped, 1)
+	}
+	return func() { atomic.AddInt32(&f.writing, -1) }
+}
+
+func (f *fakeConn) WriteJSON(v interface{}) error {
+	defer f.beginWrite()()
+
+	select {
+	case <-f.closed:
+		return errFakeClosed
+	default:
+	}
+
+	if f.blockWrites {
+		f.mu.Lock()
+		deadline := f.writeDeadline
+		f.mu.Unlock()
+		select {
+		case <-f.closed:
+			return errFakeClosed
+		case <-time.After(time.Until(deadline)):
+			return errFakeTimeout
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var msg map[string]interface{}
+	json.Unmarshal(data, &msg)
+
+	f.mu.Lock()
+	f.messages = append(f.messages, msg)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	defer f.beginWrite()()
+
+	select {
+	case <-f.closed:
+		return errFakeClosed
+	default:
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch messageType {
+	case websocket.PingMessage:
+		f.pings++
+		if f.autoPong {
+			f.pongs <- struct{}{}
+		}
+	case websocket.CloseMessage:
+		f.closeCodes = append(f.closeCodes, int(binary.BigEndian.Uint16(data)))
+	}
+	return nil
+}
+
+func (f *fakeConn) SetReadDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readDeadline = t
+	return nil
+}
+
+func (f *fakeConn) SetWriteDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writeDeadline = t
+	return nil
+}
+
+func (f *fakeConn) SetReadLimit(int64) {}
+
+func (f *fakeConn) SetPongHandler(h func(string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pongHandler = h
+}
+
+func (f *fakeConn) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *fakeConn) messageCount(msgType string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, msg := range f.messages {
+		if msg["type"] == msgType {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *fakeConn) lastCloseCode() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.closeCodes) == 0 {
+		return 0
+	}
+	return f.closeCodes[len(f.closeCodes)-1]
+}
+
+func (f *fakeConn) pingCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pings
+}
+
+// connect serves a fake connection and returns once its client is registered.
+// The returned channel is closed when serve returns.
+func connect(t *testing.T, ws *WebSocketService, conn *fakeConn) (*wsClient, chan struct{}) {
+	t.Helper()
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		ws.serve(conn, "")
+	}()
+
+	var client *wsClient
+	waitFor(t, "client to register", func() bool {
+		ws.mutex.RLock()
+		defer ws.mutex.RUnlock()
+		for _, c := range ws.clients {
+			if c.conn == conn {
+				client = c
+				return true
+			}
+		}
+		return false
+	})
+	return client, served
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var testTopic = models.RealtimeTopic{Name: models.TopicFormAnalytics, FormID: "form"}
+
+func newTestWebSocketService() *WebSocketService {
+	ws := newWebSocketService(nil)
+	ws.writeWait = 200 * time.Millisecond
+	return ws
+}
+
+func TestWebSocketBroadcastsAreSerializedPerConnection(t *testing.T) {
+	ws := newTestWebSocketService()
+	ws.sendBufferSize = 1000
+
+	const clients = 5
+	const broadcasters = 8
+	const perBroadcaster = 50
+
+	var conns []*fakeConn
+	for i := 0; i < clients; i++ {
+		conn := newFakeConn()
+		client, _ := connect(t, ws, conn)
+		ws.joinRoom(client, testTopic)
+		conns = append(conns, conn)
+	}
+
+	var wg sync.WaitGroup
+	for b := 0; b < broadcasters; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			for i := 0; i < perBroadcaster; i++ {
+				ws.broadcastToTopic(testTopic, models.EventMessage{Type: "test", FormID: fmt.Sprint(b*perBroadcaster + i)})
+			}
+		}(b)
+	}
+	wg.Wait()
+
+	for i, conn := range conns {
+		waitFor(t, "every broadcast to be delivered", func() bool {
+			return conn.messageCount("test") == broadcasters*perBroadcaster
+		})
+		if atomic.LoadInt32(&conn.overlapped) != 0 {
+			t.Errorf("connection %d was written to by several goroutines at once", i)
+		}
+	}
+
+	if err := ws.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestWebSocketDropsSlowClient(t *testing.T) {
+	ws := newTestWebSocketService()
+	ws.sendBufferSize = 8
+
+	fast := newFakeConn()
+	fastClient, _ := connect(t, ws, fast)
+	ws.joinRoom(fastClient, testTopic)
+
+	slow := newFakeConn()
+	slow.blockWrites = true
+	slowClient, slowServed := connect(t, ws, slow)
+	ws.joinRoom(slowClient, testTopic)
+
+	const messages = 20
+	start := time.Now()
+	for i := 0; i < messages; i++ {
+		ws.broadcastToTopic(testTopic, models.EventMessage{Type: "test", FormID: fmt.Sprint(i)})
+		// Keep the fast client from falling behind the loop itself
+		waitFor(t, "the fast client to receive the broadcast", func() bool {
+			return fast.messageCount("test") == i+1
+		})
+	}
+	if elapsed := time.Since(start); elapsed > ws.writeWait {
+		t.Errorf("broadcasting took %v, a stalled client blocked the broadcaster", elapsed)
+	}
+
+	ws.mutex.RLock()
+	_, slowRegistered := ws.clients[slowClient.id]
+	_, slowInRoom := ws.rooms[testTopic.Key()][slowClient.id]
+	_, fastInRoom := ws.rooms[testTopic.Key()][fastClient.id]
+	ws.mutex.RUnlock()
+
+	if slowRegistered || slowInRoom {
+		t.Error("slow client was not dropped")
+	}
+	if !fastInRoom {
+		t.Error("fast client was dropped")
+	}
+
+	select {
+	case <-slowServed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow client connection was not closed")
+	}
+
+	if err := ws.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestWebSocketHeartbeat(t *testing.T) {
+	ws := newTestWebSocketService()
+	ws.pingInterval = 10 * time.Millisecond
+	ws.pongWait = 50 * time.Millisecond
+
+	alive := newFakeConn()
+	alive.autoPong = true
+	_, aliveServed := connect(t, ws, alive)
+
+	dead := newFakeConn()
+	deadClient, deadServed := connect(t, ws, dead)
+
+	select {
+	case <-deadServed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client that never answered pings was not disconnected")
+	}
+
+	ws.mutex.RLock()
+	_, deadRegistered := ws.clients[deadClient.id]
+	ws.mutex.RUnlock()
+	if deadRegistered {
+		t.Error("disconnected client is still registered")
+	}
+
+	// Outlive several pong timeouts
+	time.Sleep(5 * ws.pongWait)
+	select {
+	case <-aliveServed:
+		t.Fatal("client answering pings was disconnected")
+	default:
+	}
+	if pings := alive.pingCount(); pings < 5 {
+		t.Errorf("expected regular pings, got %d", pings)
+	}
+
+	if err := ws.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	ws := newTestWebSocketService()
+
+	var conns []*fakeConn
+	var served []chan struct{}
+	for i := 0; i < 3; i++ {
+		conn := newFakeConn()
+		conn.autoPong = true
+		_, done := connect(t, ws, conn)
+		conns = append(conns, conn)
+		served = append(served, done)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ws.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	for i := range conns {
+		select {
+		case <-served[i]:
+		default:
+			t.Errorf("connection %d was still being served after shutdown", i)
+		}
+		if code := conns[i].lastCloseCode(); code != websocket.CloseGoingAway {
+			t.Errorf("connection %d got close code %d, want %d", i, code, websocket.CloseGoingAway)
+		}
+	}
+
+	late := newFakeConn()
+	ws.serve(late, "")
+	if code := late.lastCloseCode(); code != websocket.CloseTryAgainLater {
+		t.Errorf("connection after shutdown got close code %d, want %d", code, websocket.CloseTryAgainLater)
+	}
+}
+
+func TestWebSocketRejectsInvalidToken(t *testing.T) {
+	ws := newTestWebSocketService()
+
+	conn := newFakeConn()
+	ws.serve(conn, "not-a-jwt")
+
+	if conn.messageCount("error") != 1 {
+		t.Error("expected an error frame before the connection was closed")
+	}
+	if code := conn.lastCloseCode(); code != websocket.ClosePolicyViolation {
+		t.Errorf("got close code %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+}
+
+func TestWebSocketClosesConnectionWhenTokenExpires(t *testing.T) {
+	ws := newTestWebSocketService()
+
+	conn := newFakeConn()
+	client, served := connect(t, ws, conn)
+	ws.joinRoom(client, testTopic)
+	ws.setClaims(client, &utils.Claims{
+		UserID:           primitive.NewObjectID(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(20 * time.Millisecond))},
+	})
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed when its token expired")
+	}
+	if msg := conn.lastMessage("error"); msg == nil || msg["code"] != models.RealtimeErrorTokenExpired {
+		t.Errorf("last error = %v, want %s", msg, models.RealtimeErrorTokenExpired)
+	}
+	if code := conn.lastCloseCode(); code != websocket.ClosePolicyViolation {
+		t.Errorf("got close code %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+	if ws.hasRoom(testTopic) {
+		t.Error("expired client is still subscribed")
+	}
+}
+
+func TestWebSocketBroadcastsBrokerEvents(t *testing.T) {
+	ws := newTestWebSocketService()
+	broker := NewInProcessBroker()
+	broker.Subscribe(ws.handleEvent)
+
+	form := &models.Form{ID: primitive.NewObjectID(), Title: "Survey"}
+	other := &models.Form{ID: primitive.NewObjectID(), Title: "Other"}
+
+	conn := newFakeConn()
+	client, _ := connect(t, ws, conn)
+	ws.joinRoom(client, models.RealtimeTopic{Name: models.TopicFormAnalytics, FormID: form.ID.Hex()})
+
+	for _, f := range []*models.Form{other, form} {
+		if err := broker.Publish(BrokerEvent{Type: EventFormUpdated, FormID: f.ID, Form: f}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	waitFor(t, "the form update to be delivered", func() bool {
+		return conn.messageCount("form-update") == 1
+	})
+	conn.mu.Lock()
+	for _, msg := range conn.messages {
+		if msg["type"] == "form-update" && msg["form_id"] != form.ID.Hex() {
+			t.Errorf("got an update for form %v, which the client did not join", msg["form_id"])
+		}
+	}
+	conn.mu.Unlock()
+
+	if err := ws.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+// lastMessage returns the last message of a type the connection received
+func (f *fakeConn) lastMessage(msgType string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.messages) - 1; i >= 0; i-- {
+		if f.messages[i]["type"] == msgType {
+			return f.messages[i]
+		}
+	}
+	return nil
+}
+
+func TestWebSocketProtocolReplies(t *testing.T) {
+	ws := newTestWebSocketService()
+	conn := newFakeConn()
+	conn.autoPong = true
+	connect(t, ws, conn)
+
+	token, err := utils.GenerateJWT(&models.User{ID: primitive.NewObjectID(), Email: "owner@example.com"})
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request map[string]interface{}
+		reply   string
+		code    string
+	}{
+		{"auth", map[string]interface{}{"v": 1, "id": "1", "type": "auth", "token": token}, "ack", ""},
+		{"unsupported version", map[string]interface{}{"v": 99, "id": "2", "type": "auth", "token": token}, "error", models.RealtimeErrorUnsupportedVersion},
+		{"unknown type", map[string]interface{}{"v": 1, "id": "3", "type": "dance"}, "error", models.RealtimeErrorBadRequest},
+		{"malformed", map[string]interface{}{"v": 1, "id": "4", "type": "subscribe", "topics": "all"}, "error", models.RealtimeErrorBadRequest},
+		{"no topics", map[string]interface{}{"v": 1, "id": "5", "type": "subscribe"}, "error", models.RealtimeErrorBadRequest},
+		{"unknown topic", map[string]interface{}{"v": 1, "id": "6", "type": "subscribe", "topics": []map[string]string{{"name": "gossip", "form_id": "x"}}}, "error", models.RealtimeErrorUnknownTopic},
+		{"invalid form", map[string]interface{}{"v": 1, "id": "7", "type": "subscribe", "topics": []map[string]string{{"name": "form-analytics", "form_id": "x"}}}, "error", models.RealtimeErrorInvalidFormID},
+		{"unsubscribe", map[string]interface{}{"v": 1, "id": "8", "type": "unsubscribe", "topics": []map[string]string{{"name": "form-analytics", "form_id": "x"}}}, "ack", ""},
+	}
+
+	for _, tt := range tests {
+		conn.incoming <- tt.request
+		waitFor(t, tt.name+" reply", func() bool {
+			reply := conn.lastMessage(tt.reply)
+			return reply != nil && reply["id"] == tt.request["id"]
+		})
+
+		reply := conn.lastMessage(tt.reply)
+		if reply["v"] != float64(models.RealtimeProtocolVersion) {
+			t.Errorf("%s: reply has version %v", tt.name, reply["v"])
+		}
+		if tt.code != "" && reply["code"] != tt.code {
+			t.Errorf("%s: got error code %v, want %s", tt.name, reply["code"], tt.code)
+		}
+		if tt.reply == "ack" && reply["request"] != tt.request["type"] {
+			t.Errorf("%s: ack names request %v", tt.name, reply["request"])
+		}
+	}
+
+	if err := ws.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestWebSocketEditorPresence(t *testing.T) {
+	ws := newTestWebSocketService()
+	edits := models.RealtimeTopic{Name: models.TopicFormEdits, FormID: primitive.NewObjectID().Hex()}
+
+	editor := func(email string) (*fakeConn, chan struct{}) {
+		conn := newFakeConn()
+		conn.autoPong = true
+		client, served := connect(t, ws, conn)
+		ws.mutex.Lock()
+		client.claims = &utils.Claims{UserID: primitive.NewObjectID(), Email: email}
+		ws.mutex.Unlock()
+		ws.joinRoom(client, edits)
+		return conn, served
+	}
+	alice, _ := editor("alice@example.com")
+	bob, bobServed := editor("bob@example.com")
+
+	editors := func(conn *fakeConn) []interface{} {
+		msg := conn.lastMessage("presence")
+		if msg == nil {
+			return nil
+		}
+		list, _ := msg["editors"].([]interface{})
+		return list
+	}
+
+	alice.incoming <- map[string]interface{}{"v": 1, "id": "1", "type": "presence", "form_id": edits.FormID, "field_id": "email"}
+	waitFor(t, "bob to see alice's field", func() bool {
+		for _, e := range editors(bob) {
+			if e := e.(map[string]interface{}); e["email"] == "alice@example.com" && e["field_id"] == "email" {
+				return len(editors(bob)) == 2
+			}
+		}
+		return false
+	})
+
+	// Operations and presence need a subscription to the form's edits
+	other := primitive.NewObjectID().Hex()
+	alice.incoming <- map[string]interface{}{"v": 1, "id": "2", "type": "presence", "form_id": other}
+	alice.incoming <- map[string]interface{}{"v": 1, "id": "3", "type": "field-op", "form_id": other,
+		"operation": map[string]interface{}{"op": "delete", "field_id": "email"}}
+	waitFor(t, "both requests to be refused", func() bool {
+		reply := alice.lastMessage("error")
+		return reply != nil && reply["id"] == "3"
+	})
+	if code := alice.lastMessage("error")["code"]; code != models.RealtimeErrorForbidden {
+		t.Errorf("got error code %v for an operation on a form not being edited", code)
+	}
+
+	close(bob.incoming)
+	<-bobServed
+	waitFor(t, "alice to see bob leave", func() bool {
+		list := editors(alice)
+		return len(list) == 1 && list[0].(map[string]interface{})["email"] == "alice@example.com"
+	})
+
+	if err := ws.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
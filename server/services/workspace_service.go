@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dune-takehome-server/database"
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned when managing workspace members
+var (
+	ErrMemberExists      = errors.New("user is already a member of the workspace")
+	ErrMemberNotFound    = errors.New("user is not a member of the workspace")
+	ErrLastOwner         = errors.New("a workspace needs at least one owner")
+	ErrPersonalWorkspace = errors.New("personal workspaces cannot be shared, create a workspace instead")
+)
+
+// personalWorkspaceName is the name given to every user's own workspace
+const personalWorkspaceName = "Personal"
+
+type WorkspaceService struct {
+	collection *mongo.Collection
+	forms      *mongo.Collection
+}
+
+func NewWorkspaceService() *WorkspaceService {
+	return &WorkspaceService{
+		collection: database.Database.Collection("workspaces"),
+		forms:      database.Database.Collection("forms"),
+	}
+}
+
+// EnsurePersonalWorkspace returns the user's personal workspace, creating it
+// the first time
+func (s *WorkspaceService) EnsurePersonalWorkspace(userID primitive.ObjectID) (*models.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var workspace models.Workspace
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"created_by": userID, "personal": true},
+		bson.M{"$setOnInsert": bson.M{
+			"name":       personalWorkspaceName,
+			"members":    []models.WorkspaceMember{{UserID: userID, Role: models.RoleOwner, AddedAt: now}},
+			"created_at": now,
+			"updated_at": now,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// MigrateLegacyForms moves the forms created before workspaces existed into
+// their owner's personal workspace, returning how many were moved. It runs at
+// startup, so requests never have to.
+func (s *WorkspaceService) MigrateLegacyForms() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	legacy := bson.M{"workspace_id": bson.M{"$exists": false}}
+	owners, err := s.forms.Distinct(ctx, "user_id", legacy)
+	if err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for _, owner := range owners {
+		userID, ok := owner.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		workspace, err := s.EnsurePersonalWorkspace(userID)
+		if err != nil {
+			return moved, err
+		}
+		result, err := s.forms.UpdateMany(ctx,
+			bson.M{"user_id": userID, "workspace_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"workspace_id": workspace.ID}},
+		)
+		if err != nil {
+			return moved, err
+		}
+		moved += result.ModifiedCount
+	}
+
+	return moved, nil
+}
+
+// GetUserWorkspaces retrieves the workspaces a user is a member of
+func (s *WorkspaceService) GetUserWorkspaces(userID primitive.ObjectID) ([]*models.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Personal workspace first, then by name
+	opts := options.Find().SetSort(bson.D{{Key: "personal", Value: -1}, {Key: "name", Value: 1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"members.user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var workspaces []*models.Workspace
+	if err = cursor.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// GetWorkspaceByID retrieves a workspace by ID
+func (s *WorkspaceService) GetWorkspaceByID(workspaceID primitive.ObjectID) (*models.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var workspace models.Workspace
+	err := s.collection.FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&workspace)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Workspace not found
+		}
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// CreateWorkspace creates a shared workspace owned by the user
+func (s *WorkspaceService) CreateWorkspace(userID primitive.ObjectID, req models.WorkspaceRequest) (*models.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	workspace := &models.Workspace{
+		ID:        primitive.NewObjectID(),
+		Name:      req.Name,
+		CreatedBy: userID,
+		Members:   []models.WorkspaceMember{{UserID: userID, Role: models.RoleOwner, AddedAt: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err := s.collection.InsertOne(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// RenameWorkspace changes a workspace's name
+func (s *WorkspaceService) RenameWorkspace(workspaceID primitive.ObjectID, req models.WorkspaceRequest) (*models.Workspace, error) {
+	return s.update(bson.M{"_id": workspaceID}, bson.M{"$set": bson.M{"name": req.Name}})
+}
+
+// AddMember adds a user to a workspace with a role
+func (s *WorkspaceService) AddMember(workspace *models.Workspace, userID primitive.ObjectID, role models.WorkspaceRole) (*models.Workspace, error) {
+	if workspace.Personal {
+		return nil, ErrPersonalWorkspace
+	}
+	if workspace.MemberRole(userID) != "" {
+		return nil, ErrMemberExists
+	}
+
+	member := models.WorkspaceMember{UserID: userID, Role: role, AddedAt: time.Now()}
+	updated, err := s.update(
+		bson.M{"_id": workspace.ID, "members.user_id": bson.M{"$ne": userID}},
+		bson.M{"$push": bson.M{"members": member}},
+	)
+	if err == nil && updated == nil {
+		return nil, ErrMemberExists // Added meanwhile
+	}
+	return updated, err
+}
+
+// UpdateMemberRole changes a member's role. The last owner cannot be demoted.
+func (s *WorkspaceService) UpdateMemberRole(workspace *models.Workspace, userID primitive.ObjectID, role models.WorkspaceRole) (*models.Workspace, error) {
+	current := workspace.MemberRole(userID)
+	if current == "" {
+		return nil, ErrMemberNotFound
+	}
+	if workspace.Personal && role != models.RoleOwner {
+		return nil, ErrLastOwner
+	}
+
+	filter := memberFilter(workspace.ID, userID, current == models.RoleOwner && role != models.RoleOwner)
+	updated, err := s.update(filter, bson.M{"$set": bson.M{"members.$[member].role": role}},
+		options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"member.user_id": userID}},
+		}))
+	if err == nil && updated == nil {
+		return nil, ErrLastOwner
+	}
+	return updated, err
+}
+
+// RemoveMember removes a user from a workspace. The last owner cannot be removed.
+func (s *WorkspaceService) RemoveMember(workspace *models.Workspace, userID primitive.ObjectID) (*models.Workspace, error) {
+	current := workspace.MemberRole(userID)
+	if current == "" {
+		return nil, ErrMemberNotFound
+	}
+	if workspace.Personal {
+		return nil, ErrLastOwner
+	}
+
+	filter := memberFilter(workspace.ID, userID, current == models.RoleOwner)
+	updated, err := s.update(filter, bson.M{"$pull": bson.M{"members": bson.M{"user_id": userID}}})
+	if err == nil && updated == nil {
+		return nil, ErrLastOwner
+	}
+	return updated, err
+}
+
+// memberFilter matches a workspace having the member. When the member is an
+// owner losing the role, another owner must remain, which the filter checks
+// so that two owners cannot leave at the same time.
+func memberFilter(workspaceID, userID primitive.ObjectID, keepOwner bool) bson.M {
+	filter := bson.M{"_id": workspaceID, "members.user_id": userID}
+	if keepOwner {
+		filter["members"] = bson.M{"$elemMatch": bson.M{
+			"user_id": bson.M{"$ne": userID},
+			"role":    models.RoleOwner,
+		}}
+	}
+	return filter
+}
+
+// update applies an update to the workspace matching the filter, returning
+// it as it is afterwards, or nil when none matched
+func (s *WorkspaceService) update(filter, update bson.M, opts ...*options.FindOneAndUpdateOptions) (*models.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update["$currentDate"] = bson.M{"updated_at": true}
+	opts = append(opts, options.FindOneAndUpdate().SetReturnDocument(options.After))
+
+	var workspace models.Workspace
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&workspace)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &workspace, nil
+}
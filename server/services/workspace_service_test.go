@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"dune-takehome-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemberFilter(t *testing.T) {
+	workspaceID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	want := bson.M{"_id": workspaceID, "members.user_id": userID}
+	if got := memberFilter(workspaceID, userID, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("memberFilter(keepOwner false) = %v, want %v", got, want)
+	}
+
+	want["members"] = bson.M{"$elemMatch": bson.M{
+		"user_id": bson.M{"$ne": userID},
+		"role":    models.RoleOwner,
+	}}
+	if got := memberFilter(workspaceID, userID, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("memberFilter(keepOwner true) = %v, want %v", got, want)
+	}
+}
+
+// The guards reject changes before the database is reached, so the service works without one
+func TestPersonalWorkspaceGuards(t *testing.T) {
+	owner, stranger := primitive.NewObjectID(), primitive.NewObjectID()
+	personal := &models.Workspace{
+		ID:       primitive.NewObjectID(),
+		Personal: true,
+		Members:  []models.WorkspaceMember{{UserID: owner, Role: models.RoleOwner}},
+	}
+
+	s := &WorkspaceService{}
+	tests := []struct {
+		name   string
+		change func() (*models.Workspace, error)
+		want   error
+	}{
+		{"add a member", func() (*models.Workspace, error) {
+			return s.AddMember(personal, stranger, models.RoleViewer)
+		}, ErrPersonalWorkspace},
+		{"demote the owner", func() (*models.Workspace, error) {
+			return s.UpdateMemberRole(personal, owner, models.RoleEditor)
+		}, ErrLastOwner},
+		{"remove the owner", func() (*models.Workspace, error) {
+			return s.RemoveMember(personal, owner)
+		}, ErrLastOwner},
+		{"change a non-member's role", func() (*models.Workspace, error) {
+			return s.UpdateMemberRole(personal, stranger, models.RoleOwner)
+		}, ErrMemberNotFound},
+		{"remove a non-member", func() (*models.Workspace, error) {
+			return s.RemoveMember(personal, stranger)
+		}, ErrMemberNotFound},
+	}
+	for _, tt := range tests {
+		workspace, err := tt.change()
+		if !errors.Is(err, tt.want) || workspace != nil {
+			t.Errorf("%s: %v, %v, want %v", tt.name, workspace, err, tt.want)
+		}
+	}
+}
+
+func TestSharedWorkspaceMemberGuards(t *testing.T) {
+	owner, stranger := primitive.NewObjectID(), primitive.NewObjectID()
+	shared := &models.Workspace{
+		ID:      primitive.NewObjectID(),
+		Members: []models.WorkspaceMember{{UserID: owner, Role: models.RoleOwner}},
+	}
+
+	s := &WorkspaceService{}
+	if _, err := s.AddMember(shared, owner, models.RoleEditor); !errors.Is(err, ErrMemberExists) {
+		t.Errorf("adding a member twice: %v, want %v", err, ErrMemberExists)
+	}
+	if _, err := s.RemoveMember(shared, stranger); !errors.Is(err, ErrMemberNotFound) {
+		t.Errorf("removing a non-member: %v, want %v", err, ErrMemberNotFound)
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	geoIPReader *maxminddb.Reader
+	geoIPOnce   sync.Once
+)
+
+// getGeoIPReader opens the MaxMind database named by GEOIP_DATABASE_PATH the
+// first time it is needed. Country lookups are disabled when it is not set.
+func getGeoIPReader() *maxminddb.Reader {
+	geoIPOnce.Do(func() {
+		path := os.Getenv("GEOIP_DATABASE_PATH")
+		if path == "" {
+			return
+		}
+
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			log.Printf("❌ Failed to open GeoIP database %s, country lookups are disabled: %v", path, err)
+			return
+		}
+
+		log.Printf("🌍 GeoIP database loaded: %s", reader.Metadata.DatabaseType)
+		geoIPReader = reader
+	})
+	return geoIPReader
+}
+
+// LookupCountry returns the ISO 3166-1 alpha-2 country code of an IP address
+// from the local GeoIP database, or an empty string when it is unknown. Works
+// with the GeoLite2/GeoIP2 Country and City databases.
+func LookupCountry(ipAddress string) string {
+	reader := getGeoIPReader()
+	if reader == nil {
+		return ""
+	}
+
+	ip := net.ParseIP(ipAddress)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+		return ""
+	}
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := reader.Lookup(ip, &record); err != nil {
+		return ""
+	}
+
+	return record.Country.ISOCode
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JSONSchemaDraft is the JSON Schema dialect of generated schemas
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is a JSON Schema document or subschema
+type JSONSchema map[string]interface{}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+// SchemaGenerator builds JSON Schemas describing how Go types encode to JSON,
+// following their json tags. Named struct types are added to Defs once and
+// referenced, so recursive and shared types stay small.
+type SchemaGenerator struct {
+	Defs map[string]JSONSchema
+}
+
+func NewSchemaGenerator() *SchemaGenerator {
+	return &SchemaGenerator{Defs: make(map[string]JSONSchema)}
+}
+
+// Ref returns a reference to the definition of a named struct type, generating it if needed
+func (g *SchemaGenerator) Ref(v interface{}) JSONSchema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *SchemaGenerator) schema(t reflect.Type) JSONSchema {
+	switch t {
+	case timeType:
+		return JSONSchema{"type": "string", "format": "date-time"}
+	case objectIDType:
+		return JSONSchema{"type": "string", "pattern": "^[0-9a-f]{24}$"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return JSONSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return JSONSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return JSONSchema{"type": "number"}
+	case reflect.String:
+		return JSONSchema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return JSONSchema{"type": "string", "contentEncoding": "base64"}
+		}
+		return JSONSchema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return JSONSchema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := t.Name()
+		if _, ok := g.Defs[name]; !ok {
+			g.Defs[name] = JSONSchema{} // Placeholder for recursive references
+			g.Defs[name] = g.structSchema(t)
+		}
+		return JSONSchema{"$ref": "#/$defs/" + name}
+	default:
+		// interface{} holds any JSON value
+		return JSONSchema{}
+	}
+}
+
+func (g *SchemaGenerator) structSchema(t reflect.Type) JSONSchema {
+	properties := JSONSchema{}
+	required := []string{}
+	g.addFields(t, properties, &required)
+
+	schema := JSONSchema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the JSON properties of a struct's fields, inlining embedded structs
+func (g *SchemaGenerator) addFields(t reflect.Type, properties JSONSchema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := g.schema(field.Type)
+		omitEmpty := strings.Contains(opts, "omitempty")
+		if !omitEmpty {
+			*required = append(*required, name)
+			// Nil pointers, slices and maps encode as null
+			switch field.Type.Kind() {
+			case reflect.Ptr, reflect.Slice, reflect.Map:
+				schema = JSONSchema{"anyOf": []JSONSchema{schema, {"type": "null"}}}
+			}
+		}
+		properties[name] = schema
+	}
+}
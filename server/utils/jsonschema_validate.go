@@ -0,0 +1,364 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SchemaViolation is a part of a value that does not match its JSON Schema,
+// at a JSON Pointer path such as "/responses/age"
+type SchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Validate checks a value decoded by encoding/json against the schema. It
+// supports the keywords of the schemas generated here: $ref to $defs, type,
+// enum, const, anyOf, oneOf, properties, required, additionalProperties,
+// items, minItems, maxItems, uniqueItems, minLength, maxLength, pattern,
+// format (email and date-time), minimum and maximum. Schemas may be built in
+// Go or decoded from JSON.
+func (s JSONSchema) Validate(value interface{}) []SchemaViolation {
+	v := &schemaValidator{root: s}
+	v.validate(s, value, "")
+	return v.violations
+}
+
+type schemaValidator struct {
+	root       JSONSchema
+	violations []SchemaViolation
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.violations = append(v.violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// matches reports whether a value matches a schema, without recording violations
+func (v *schemaValidator) matches(schema JSONSchema, value interface{}) bool {
+	sub := &schemaValidator{root: v.root}
+	sub.validate(schema, value, "")
+	return len(sub.violations) == 0
+}
+
+func (v *schemaValidator) validate(schema JSONSchema, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		defs, _ := asSchema(v.root["$defs"])
+		target, ok := asSchema(defs[name])
+		if !ok {
+			v.fail(path, "unresolvable reference %s", ref)
+			return
+		}
+		v.validate(target, value, path)
+		return
+	}
+
+	if types := asStrings(schema["type"]); types != nil {
+		actual := jsonType(value)
+		ok := false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				ok = true
+			}
+		}
+		if !ok {
+			v.fail(path, "must be %s, not %s", strings.Join(types, " or "), actual)
+			return // The other keywords would only repeat it
+		}
+	}
+
+	if constant, ok := schema["const"]; ok && !schemaValueEqual(constant, value) {
+		v.fail(path, "must be %s", describeJSON(constant))
+	}
+	if enum := asList(schema["enum"]); enum != nil {
+		found := false
+		for _, allowed := range enum {
+			if schemaValueEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			choices := make([]string, len(enum))
+			for i, allowed := range enum {
+				choices[i] = describeJSON(allowed)
+			}
+			v.fail(path, "must be one of %s", strings.Join(choices, ", "))
+		}
+	}
+	if anyOf := asSchemas(schema["anyOf"]); anyOf != nil {
+		matched := 0
+		for _, option := range anyOf {
+			if v.matches(option, value) {
+				matched++
+			}
+		}
+		if matched == 0 {
+			v.fail(path, "does not match any of the allowed schemas")
+		}
+	}
+	if oneOf := asSchemas(schema["oneOf"]); oneOf != nil {
+		matched := 0
+		for _, option := range oneOf {
+			if v.matches(option, value) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, "must match exactly one of the allowed schemas, matches %d", matched)
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, value, path)
+	case []interface{}:
+		v.validateArray(schema, value, path)
+	case string:
+		v.validateString(schema, value, path)
+	case float64:
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			v.fail(path, "must be a finite number")
+			return
+		}
+		if minimum, ok := asFloat(schema["minimum"]); ok && value < minimum {
+			v.fail(path, "must be at least %s", formatNumber(minimum))
+		}
+		if maximum, ok := asFloat(schema["maximum"]); ok && value > maximum {
+			v.fail(path, "must be at most %s", formatNumber(maximum))
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema JSONSchema, object map[string]interface{}, path string) {
+	for _, name := range asStrings(schema["required"]) {
+		if _, ok := object[name]; !ok {
+			v.fail(path+"/"+escapePointer(name), "is required")
+		}
+	}
+
+	properties, _ := asSchema(schema["properties"])
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Violations in a stable order
+
+	for _, name := range names {
+		propertyPath := path + "/" + escapePointer(name)
+		if property, ok := asSchema(properties[name]); ok {
+			v.validate(property, object[name], propertyPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(propertyPath, "is not allowed")
+			}
+		default:
+			if additional, ok := asSchema(additional); ok {
+				v.validate(additional, object[name], propertyPath)
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(schema JSONSchema, array []interface{}, path string) {
+	if minItems, ok := asFloat(schema["minItems"]); ok && float64(len(array)) < minItems {
+		v.fail(path, "must have at least %s items", formatNumber(minItems))
+	}
+	if maxItems, ok := asFloat(schema["maxItems"]); ok && float64(len(array)) > maxItems {
+		v.fail(path, "must have at most %s items", formatNumber(maxItems))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := 0; j < i; j++ {
+				if schemaValueEqual(array[i], array[j]) {
+					v.fail(path+"/"+strconv.Itoa(i), "repeats item %d", j)
+					break
+				}
+			}
+		}
+	}
+	if items, ok := asSchema(schema["items"]); ok {
+		for i, item := range array {
+			v.validate(items, item, path+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(schema JSONSchema, value, path string) {
+	length := float64(utf8.RuneCountInString(value))
+	if minLength, ok := asFloat(schema["minLength"]); ok && length < minLength {
+		if minLength == 1 {
+			v.fail(path, "must not be empty")
+		} else {
+			v.fail(path, "must be at least %s characters", formatNumber(minLength))
+		}
+	}
+	if maxLength, ok := asFloat(schema["maxLength"]); ok && length > maxLength {
+		v.fail(path, "must be at most %s characters", formatNumber(maxLength))
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			v.fail(path, "must match %s", pattern)
+		}
+	}
+	switch schema["format"] {
+	case "email":
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value {
+			v.fail(path, "must be an email address")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			v.fail(path, "must be an RFC 3339 date and time")
+		}
+	}
+}
+
+// jsonType names the JSON Schema type of a decoded value
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return "non-finite number" // Not a JSON value, so no type allows it
+		}
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaValueEqual compares values as JSON, so a schema's Go values equal the decoded ones
+func schemaValueEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+func normalizeJSON(value interface{}) interface{} {
+	switch value.(type) {
+	case nil, bool, float64, string:
+		return value
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func describeJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func asSchema(value interface{}) (JSONSchema, bool) {
+	switch value := value.(type) {
+	case JSONSchema:
+		return value, true
+	case map[string]interface{}:
+		return JSONSchema(value), true
+	}
+	return nil, false
+}
+
+func asSchemas(value interface{}) []JSONSchema {
+	switch value := value.(type) {
+	case []JSONSchema:
+		return value
+	case []interface{}:
+		schemas := make([]JSONSchema, 0, len(value))
+		for _, item := range value {
+			if schema, ok := asSchema(item); ok {
+				schemas = append(schemas, schema)
+			}
+		}
+		return schemas
+	}
+	return nil
+}
+
+// asStrings reads a string or list of strings
+func asStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		strs := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+func asList(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+	if list, ok := value.([]interface{}); ok {
+		return list
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list
+}
+
+func asFloat(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// escapePointer escapes a JSON Pointer reference token (RFC 6901)
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
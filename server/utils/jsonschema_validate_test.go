@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema := JSONSchema{
+		"type": "object",
+		"properties": JSONSchema{
+			"name":  JSONSchema{"type": "string", "minLength": 1, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"email": JSONSchema{"type": "string", "format": "email"},
+			"age":   JSONSchema{"type": "integer", "minimum": 18, "maximum": 130.5},
+			"plan":  JSONSchema{"type": "string", "enum": []string{"free", "pro"}},
+			"tags":  JSONSchema{"type": "array", "items": JSONSchema{"type": "string"}, "uniqueItems": true, "minItems": 1},
+			"note":  JSONSchema{"anyOf": []JSONSchema{{"type": "string"}, {"type": "null"}}},
+			"item":  JSONSchema{"$ref": "#/$defs/Item"},
+		},
+		"required":             []string{"name"},
+		"additionalProperties": false,
+		"$defs": JSONSchema{
+			"Item": JSONSchema{"type": "object", "properties": JSONSchema{"id": JSONSchema{"const": 1}}},
+		},
+	}
+
+	tests := []struct {
+		doc  string
+		want []string // path: message
+	}{
+		{`{"name": "ada", "email": "ada@example.com", "age": 36, "plan": "pro", "tags": ["a", "b"], "note": null, "item": {"id": 1}}`, nil},
+		{`{}`, []string{"/name: is required"}},
+		{`{"name": ""}`, []string{"/name: must not be empty", "/name: must match ^[a-z]+$"}},
+		{`{"name": "adalovelace"}`, []string{"/name: must be at most 5 characters"}},
+		{`{"name": "ada", "email": "ada"}`, []string{"/email: must be an email address"}},
+		{`{"name": "ada", "age": 17}`, []string{"/age: must be at least 18"}},
+		{`{"name": "ada", "age": 36.5}`, []string{"/age: must be integer, not number"}},
+		{`{"name": "ada", "age": "36"}`, []string{"/age: must be integer, not string"}},
+		{`{"name": "ada", "plan": "team"}`, []string{`/plan: must be one of "free", "pro"`}},
+		{`{"name": "ada", "tags": []}`, []string{"/tags: must have at least 1 items"}},
+		{`{"name": "ada", "tags": ["a", "a"]}`, []string{"/tags/1: repeats item 0"}},
+		{`{"name": "ada", "tags": [1]}`, []string{"/tags/0: must be string, not integer"}},
+		{`{"name": "ada", "note": 1}`, []string{"/note: does not match any of the allowed schemas"}},
+		{`{"name": "ada", "item": {"id": 2}}`, []string{"/item/id: must be 1"}},
+		{`{"name": "ada", "a/b": 1}`, []string{"/a~1b: is not allowed"}},
+		{`[]`, []string{": must be object, not array"}},
+	}
+
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.doc), &value); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, violation := range schema.Validate(value) {
+			got = append(got, violation.Path+": "+violation.Message)
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\n got %q\nwant %q", tt.doc, got, tt.want)
+		}
+	}
+}
+
+// Schemas read from JSON validate the same as those built in Go
+func TestJSONSchemaValidateDecodedSchema(t *testing.T) {
+	var schema JSONSchema
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {"n": {"type": "number", "maximum": 5, "enum": [1, 10]}}, "required": ["n"]}`), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value interface{}
+	json.Unmarshal([]byte(`{"n": 10}`), &value)
+	violations := schema.Validate(value)
+	if len(violations) != 1 || violations[0].Message != "must be at most 5" {
+		t.Errorf("violations = %+v", violations)
+	}
+}
+
+// JSON has no NaN or infinities, but values built in Go can hold them
+func TestJSONSchemaValidateNonFinite(t *testing.T) {
+	tests := []struct {
+		schema JSONSchema
+		value  float64
+		want   string
+	}{
+		{JSONSchema{"type": "integer"}, math.Inf(1), "must be integer, not non-finite number"},
+		{JSONSchema{"type": "number"}, math.Inf(-1), "must be number, not non-finite number"},
+		{JSONSchema{"type": "number", "minimum": 0, "maximum": 10}, math.NaN(), "must be number, not non-finite number"},
+		{JSONSchema{"minimum": 0, "maximum": 10}, math.NaN(), "must be a finite number"},
+		{JSONSchema{"maximum": 10}, math.Inf(1), "must be a finite number"},
+	}
+	for _, tt := range tests {
+		violations := tt.schema.Validate(tt.value)
+		if len(violations) != 1 || violations[0].Message != tt.want {
+			t.Errorf("%v against %v: violations = %+v, want %q", tt.value, tt.schema, violations, tt.want)
+		}
+	}
+}
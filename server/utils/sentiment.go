@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"math"
+	"strings"
+)
+
+// Sentiment labels
+const (
+	SentimentPositive = "positive"
+	SentimentNeutral  = "neutral"
+	SentimentNegative = "negative"
+)
+
+// sentimentThreshold is the absolute score below which text is neutral
+const sentimentThreshold = 0.05
+
+// sentimentNormalization tunes how quickly raw lexicon sums approach ±1
+const sentimentNormalization = 15
+
+// sentimentLexicon scores English words from -5 (very negative) to 5 (very
+// positive), in the style of the AFINN word list. It is intentionally small and
+// focused on the vocabulary of product, service and event feedback.
+var sentimentLexicon = lexicon(map[int]string{
+	5:  "amazing awesome excellent exceptional fantastic outstanding perfect superb wonderful brilliant",
+	4:  "love loved loving delighted impressive incredible",
+	3:  "great happy enjoy enjoyed enjoyable pleased beautiful best recommend recommended fun glad",
+	2:  "good nice helpful easy friendly fast quick clean smooth useful like liked satisfied comfortable reliable clear intuitive efficient thanks thank appreciate appreciated improved",
+	1:  "ok okay fine fair decent interesting",
+	-1: "slow confusing confused unclear long difficult hard expensive late boring meh missing lacking",
+	-2: "bad poor problem problems issue issues bug bugs broken frustrating frustrated annoying annoyed disappointed disappointing unhappy rude dirty crash crashed crashes error errors fail failed failure wrong",
+	-3: "hate hated terrible awful horrible worst useless angry unacceptable waste painful",
+	-4: "disgusting pathetic nightmare scam",
+	-5: "abysmal atrocious",
+})
+
+// negators flip the sign of the words that follow them
+var negators = wordSet("not no never dont doesnt didnt isnt wasnt werent cant cannot wont wouldnt shouldnt couldnt hardly barely nothing without")
+
+// intensifiers scale the next scored word
+var intensifiers = map[string]float64{
+	"very": 1.5, "really": 1.5, "extremely": 2, "super": 1.5, "so": 1.3, "totally": 1.5,
+	"incredibly": 2, "absolutely": 2, "quite": 1.2, "slightly": 0.5, "somewhat": 0.7, "bit": 0.7,
+}
+
+// negationWindow is how many tokens after a negator are flipped
+const negationWindow = 3
+
+func lexicon(groups map[int]string) map[string]float64 {
+	scores := make(map[string]float64)
+	for score, words := range groups {
+		for _, word := range strings.Fields(words) {
+			scores[word] = float64(score)
+		}
+	}
+	return scores
+}
+
+// SentimentSupported reports whether text in a language can be scored. The
+// lexicon is English, and undetermined text is scored too since short answers
+// such as "great app" have too few stop words to be recognized as English.
+func SentimentSupported(language string) bool {
+	return language == "en" || language == LanguageUndetermined
+}
+
+// SentimentScore scores tokenized English text between -1 and 1. Lexicon words
+// are summed after negation and intensifier handling, then normalized with
+// x / sqrt(x² + α) so long answers do not dominate.
+func SentimentScore(tokens []string) float64 {
+	var sum float64
+	negated := 0
+	multiplier := 1.0
+
+	for _, token := range tokens {
+		if negators[token] {
+			negated = negationWindow
+			continue
+		}
+		if scale, ok := intensifiers[token]; ok {
+			multiplier *= scale
+			continue
+		}
+
+		if score, ok := sentimentLexicon[token]; ok {
+			if negated > 0 {
+				// Negation dampens as well as flips: "not great" is milder than "terrible"
+				score = -score * 0.5
+			}
+			sum += score * multiplier
+		}
+
+		multiplier = 1
+		if negated > 0 {
+			negated--
+		}
+	}
+
+	if sum == 0 {
+		return 0
+	}
+	return sum / math.Sqrt(sum*sum+sentimentNormalization)
+}
+
+// SentimentLabel buckets a sentiment score into positive, neutral or negative
+func SentimentLabel(score float64) string {
+	switch {
+	case score >= sentimentThreshold:
+		return SentimentPositive
+	case score <= -sentimentThreshold:
+		return SentimentNegative
+	default:
+		return SentimentNeutral
+	}
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSentimentScore(t *testing.T) {
+	// Sums are normalized with x / sqrt(x² + 15)
+	normalized := func(sum float64) float64 { return sum / math.Sqrt(sum*sum+sentimentNormalization) }
+	tests := []struct {
+		text string
+		want float64
+	}{
+		{"great", normalized(3)},
+		{"not great", normalized(-1.5)},              // Negation flips and halves
+		{"very good", normalized(3)},                 // Intensifiers scale the next word
+		{"not very good", normalized(-1.5)},          // Both apply
+		{"not the app, fine great", normalized(2.5)}, // Negation lasts three tokens
+		{"the app", 0},
+		{"slow but helpful", normalized(1)},
+	}
+	for _, tt := range tests {
+		if got := SentimentScore(Tokenize(tt.text)); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("SentimentScore(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	long := Tokenize("amazing amazing amazing amazing amazing amazing amazing amazing")
+	if got := SentimentScore(long); got <= 0.99 || got >= 1 {
+		t.Errorf("SentimentScore of a long positive answer = %v, want just below 1", got)
+	}
+}
+
+func TestSentimentLabel(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{0.05, SentimentPositive},
+		{0.049, SentimentNeutral},
+		{0, SentimentNeutral},
+		{-0.049, SentimentNeutral},
+		{-0.05, SentimentNegative},
+	}
+	for _, tt := range tests {
+		if got := SentimentLabel(tt.score); got != tt.want {
+			t.Errorf("SentimentLabel(%v) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestSentimentSupported(t *testing.T) {
+	for language, want := range map[string]bool{"en": true, LanguageUndetermined: true, "fr": false, "es": false} {
+		if got := SentimentSupported(language); got != want {
+			t.Errorf("SentimentSupported(%s) = %v, want %v", language, got, want)
+		}
+	}
+}
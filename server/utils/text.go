@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// LanguageUndetermined is returned when no language scores high enough
+const LanguageUndetermined = "und"
+
+// stopWords holds common function words per ISO 639-1 language code. They are
+// dropped from term counts and double as the signal for language detection.
+var stopWords = map[string]map[string]bool{
+	"en": wordSet("a about above after again against all am an and any are as at be because been before being below between both but by can could did do does doing down during each few for from further had has have having he her here hers herself him himself his how i if in into is it its itself just me more most my myself no nor not now of off on once only or other our ours ourselves out over own same she should so some such than that the their theirs them themselves then there these they this those through to too under until up very was we were what when where which while who whom why will with would you your yours yourself yourselves im ive dont doesnt didnt isnt wasnt cant wont also get got really"),
+	"es": wordSet("a al algo ante antes como con contra cual cuando de del desde donde durante e el ella ellas ellos en entre era es esa ese eso esta estaba estan estar este esto estos fue ha hay la las le les lo los mas me mi mientras muy ni no nos o os otra otro para pero poco por porque que quien se sea ser si sin sobre son su sus tambien te tiene todo tu un una uno unos y ya yo"),
+	"fr": wordSet("a au aussi autre avec avoir bien c ce cela ces cet cette comme dans de des donc du elle elles en est et etait etre eu il ils je la le les leur lui ma mais me meme mes moi mon ne nos notre nous on ou par pas peu plus pour qu que qui sa sans se ses si son sont sur ta te tes toi ton tous tout tres tu un une vous y"),
+	"de": wordSet("aber alle als also am an auch auf aus bei bin bis da dann das dass dem den der des die doch du durch ein eine einem einen einer es fur hat hatte ich ihr im in ist ja kann kein mit mich mir nach nicht noch nur oder ohne sehr sein sich sie sind so uber um und uns unter vom von war wie wir wird zu zum zur"),
+	"pt": wordSet("a ao aos as com como da das de do dos e ela ele eles em entre era essa esse esta este eu foi ha isso ja mais mas me meu minha muito na nao nas nem no nos o os ou para pela pelo por quando que se sem ser seu sua tambem tem um uma voce"),
+	"it": wordSet("a ad al alla anche che chi ci come con da dal dei del della di e ed era gli ha ho i il in io la le lei lo loro lui ma mi mio molto ne nei nel non o per perche piu quando quello questo se si sono su sua suo ti tu un una uno"),
+}
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// Tokenize lowercases text and splits it into words. Apostrophes are removed so
+// contractions match the stop word lists ("don't" becomes "dont").
+func Tokenize(text string) []string {
+	var tokens []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			current.WriteRune(foldAccent(r))
+		case r == '\'' || r == '’':
+			// Keep the word going across apostrophes
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// foldAccent maps common Latin accented letters to their base letter so
+// stop words match regardless of accents
+func foldAccent(r rune) rune {
+	switch r {
+	case 'à', 'á', 'â', 'ã', 'ä', 'å':
+		return 'a'
+	case 'è', 'é', 'ê', 'ë':
+		return 'e'
+	case 'ì', 'í', 'î', 'ï':
+		return 'i'
+	case 'ò', 'ó', 'ô', 'õ', 'ö':
+		return 'o'
+	case 'ù', 'ú', 'û', 'ü':
+		return 'u'
+	case 'ç':
+		return 'c'
+	case 'ñ':
+		return 'n'
+	}
+	return r
+}
+
+// DetectLanguage guesses the language of tokenized text from the share of stop
+// words of each supported language. Short or unrecognized text is undetermined.
+func DetectLanguage(tokens []string) string {
+	best := LanguageUndetermined
+	bestHits := 0
+
+	for language, words := range stopWords {
+		hits := 0
+		for _, token := range tokens {
+			if words[token] {
+				hits++
+			}
+		}
+		if hits > bestHits || (hits == bestHits && hits > 0 && language < best) {
+			best = language
+			bestHits = hits
+		}
+	}
+
+	if bestHits < 2 {
+		return LanguageUndetermined
+	}
+	return best
+}
+
+// RemoveStopWords drops stop words of the given language, plus English ones
+// since mixed-language answers are common, and single-character tokens
+func RemoveStopWords(tokens []string, language string) []string {
+	var terms []string
+	for _, token := range tokens {
+		if len([]rune(token)) < 2 || stopWords["en"][token] || stopWords[language][token] {
+			continue
+		}
+		terms = append(terms, token)
+	}
+	return terms
+}
+
+// Bigrams joins consecutive terms with a space
+func Bigrams(terms []string) []string {
+	var bigrams []string
+	for i := 0; i+1 < len(terms); i++ {
+		bigrams = append(bigrams, terms[i]+" "+terms[i+1])
+	}
+	return bigrams
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Don't  stop—Believin’!", []string{"dont", "stop", "believin"}},
+		{"Café crème, naïve façade", []string{"cafe", "creme", "naive", "facade"}},
+		{"v2.0 rocks", []string{"v2", "0", "rocks"}},
+		{"...", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The app is great and I love it", "en"},
+		{"El servicio es muy bueno y la comida también", "es"},
+		{"Le service est très bien", "fr"},
+		{"Die App ist sehr gut und schnell", "de"},
+		{"great app", LanguageUndetermined},
+		{"the app", LanguageUndetermined}, // A single stop word is not enough
+		{"a e", "es"},                     // Ties go to the first language alphabetically
+	}
+	for _, tt := range tests {
+		if got := DetectLanguage(Tokenize(tt.text)); got != tt.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveStopWords(t *testing.T) {
+	tests := []struct {
+		tokens   []string
+		language string
+		want     []string
+	}{
+		{Tokenize("I really love the new dashboard, it's x fast"), "en", []string{"love", "new", "dashboard", "fast"}},
+		{[]string{"le", "service", "the", "bien", "ok"}, "fr", []string{"service", "ok"}}, // English ones too
+		{[]string{"le", "service"}, LanguageUndetermined, []string{"le", "service"}},
+	}
+	for _, tt := range tests {
+		if got := RemoveStopWords(tt.tokens, tt.language); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RemoveStopWords(%q, %s) = %q, want %q", tt.tokens, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestBigrams(t *testing.T) {
+	if got, want := Bigrams([]string{"fast", "checkout", "flow"}), []string{"fast checkout", "checkout flow"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Bigrams = %q, want %q", got, want)
+	}
+	if got := Bigrams([]string{"fast"}); got != nil {
+		t.Errorf("Bigrams of one term = %q", got)
+	}
+}
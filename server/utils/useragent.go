@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+
+	"dune-takehome-server/models"
+)
+
+// Device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UnknownClient labels a browser or operating system that was not recognized
+const UnknownClient = "Other"
+
+// botPattern identifies crawlers and scripted clients. Markers are word-bounded
+// so that device names such as "Cubot" do not make a phone a bot: a name ending
+// in bot must be followed by its version, and tools must start the user agent.
+var botPattern = regexp.MustCompile(`[a-z0-9]bot[/;-]|\bbot\b|(crawler|spider)\b|\bslurp\b|headlesschrome|\+https?://|^(curl|wget|python-requests|go-http-client|postmanruntime)/`)
+
+// uaRule maps a user agent substring to a name. Rules are checked in order,
+// since most browsers also claim to be the ones they are derived from.
+type uaRule struct {
+	marker string
+	name   string
+}
+
+var browserRules = []uaRule{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"chromium/", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"safari/", "Safari"},
+}
+
+var osRules = []uaRule{
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	{" cros ", "ChromeOS"}, // Spaced, since "microsoft" contains cros
+	{"windows", "Windows"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+// ParseUserAgent classifies a User-Agent header into browser, operating system
+// and device class. It recognizes the major browsers only; anything else is Other.
+func ParseUserAgent(userAgent string) models.ClientInfo {
+	ua := strings.ToLower(userAgent)
+	info := models.ClientInfo{
+		Browser: UnknownClient,
+		OS:      UnknownClient,
+		Device:  DeviceUnknown,
+	}
+	if ua == "" {
+		return info
+	}
+
+	if botPattern.MatchString(ua) {
+		info.Browser = "Bot"
+		info.Device = DeviceBot
+		return info
+	}
+
+	info.Browser = matchRule(ua, browserRules)
+	info.OS = matchRule(ua, osRules)
+
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		info.Device = DeviceTablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		info.Device = DeviceMobile
+	case info.OS != UnknownClient:
+		info.Device = DeviceDesktop
+	}
+
+	return info
+}
+
+func matchRule(ua string, rules []uaRule) string {
+	for _, rule := range rules {
+		if strings.Contains(ua, rule.marker) {
+			return rule.name
+		}
+	}
+	return UnknownClient
+}
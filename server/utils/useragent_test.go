@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+
+	"dune-takehome-server/models"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want models.ClientInfo
+	}{
+		{"empty", "", models.ClientInfo{Browser: UnknownClient, OS: UnknownClient, Device: DeviceUnknown}},
+		{"Chrome on Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			models.ClientInfo{Browser: "Chrome", OS: "Windows", Device: DeviceDesktop}},
+		{"Edge before Chrome", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			models.ClientInfo{Browser: "Edge", OS: "Windows", Device: DeviceDesktop}},
+		{"Opera before Chrome", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36 OPR/109.0.0.0",
+			models.ClientInfo{Browser: "Opera", OS: "Windows", Device: DeviceDesktop}},
+		{"Firefox on macOS", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:125.0) Gecko/20100101 Firefox/125.0",
+			models.ClientInfo{Browser: "Firefox", OS: "macOS", Device: DeviceDesktop}},
+		{"Firefox on Linux", "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			models.ClientInfo{Browser: "Firefox", OS: "Linux", Device: DeviceDesktop}},
+		{"ChromeOS", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			models.ClientInfo{Browser: "Chrome", OS: "ChromeOS", Device: DeviceDesktop}},
+		{"Microsoft is not ChromeOS", "Microsoft Office/16.0 (Windows NT 10.0; Microsoft Outlook 16.0.17328; Pro)",
+			models.ClientInfo{Browser: UnknownClient, OS: "Windows", Device: DeviceDesktop}},
+		{"Safari on iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			models.ClientInfo{Browser: "Safari", OS: "iOS", Device: DeviceMobile}},
+		{"Chrome on iPad", "Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			models.ClientInfo{Browser: "Chrome", OS: "iOS", Device: DeviceTablet}},
+		{"Android phone", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			models.ClientInfo{Browser: "Chrome", OS: "Android", Device: DeviceMobile}},
+		{"Android tablet", "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			models.ClientInfo{Browser: "Chrome", OS: "Android", Device: DeviceTablet}},
+		{"Samsung Internet", "Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			models.ClientInfo{Browser: "Samsung Internet", OS: "Android", Device: DeviceMobile}},
+		{"Cubot phone is not a bot", "Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			models.ClientInfo{Browser: "Chrome", OS: "Android", Device: DeviceMobile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseUserAgent(tt.ua); got != tt.want {
+				t.Errorf("ParseUserAgent(%q) = %+v, want %+v", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUserAgentBots(t *testing.T) {
+	bots := []string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; Googlebot/2.1) Chrome/124.0.6367.155 Safari/537.36",
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+		"Mozilla/5.0 (compatible; Baiduspider/2.0)",
+		"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/124.0.0.0 Safari/537.36",
+		"curl/8.4.0",
+		"Wget/1.21.4",
+		"python-requests/2.31.0",
+		"Go-http-client/1.1",
+		"PostmanRuntime/7.36.0",
+	}
+	for _, ua := range bots {
+		if got := ParseUserAgent(ua); got.Device != DeviceBot || got.Browser != "Bot" {
+			t.Errorf("ParseUserAgent(%q) = %+v, want a bot", ua, got)
+		}
+	}
+}